@@ -1,10 +1,12 @@
 package accessory
 
 import (
+	"github.com/brutella/hap/characteristic"
 	"github.com/brutella/hap/service"
 
 	"encoding/json"
 	"net/http"
+	"sync"
 )
 
 type A struct {
@@ -12,17 +14,33 @@ type A struct {
 	Type byte
 	Info *service.AccessoryInformation
 	Ss   []*service.S
-	// IdentifyFunc is called when a client
-	// makes a POST to the /identify endpoint.
+	// IdentifyFunc is called when a client makes a POST to the
+	// /identify endpoint or writes to the identify characteristic.
+	// See also hap.Server.OnIdentify.
 	IdentifyFunc func(*http.Request)
+
+	// MaintenanceStatus is the status code which is returned
+	// for every characteristic of the accessory while the
+	// accessory is in maintenance mode.
+	// If zero, the code -70402 (service communication failure) is used.
+	MaintenanceStatus int
+
+	maintenance       bool
+	maintenanceReason string
+	maintenanceFuncs  []MaintenanceFunc
+	m                 sync.Mutex
 }
 
+// MaintenanceFunc is called when an accessory enters or leaves maintenance mode.
+type MaintenanceFunc func(on bool, reason string)
+
 type Info struct {
 	Name         string
 	SerialNumber string
 	Manufacturer string
 	Model        string
 	Firmware     string
+	Hardware     string
 }
 
 func New(info Info, typ byte) *A {
@@ -53,6 +71,12 @@ func New(info Info, typ byte) *A {
 		s.FirmwareRevision.Val = info.Firmware
 	}
 
+	if info.Hardware != "" {
+		hw := characteristic.NewHardwareRevision()
+		hw.Val = info.Hardware
+		s.AddC(hw.C)
+	}
+
 	return &A{
 		Type: typ,
 		Info: s,
@@ -65,6 +89,57 @@ func (a *A) AddS(s *service.S) {
 	a.Ss = append(a.Ss, s)
 }
 
+// SetMaintenance enables or disables the maintenance mode of the accessory.
+// While in maintenance mode, reading and writing characteristic values
+// fails with MaintenanceStatus and no events are sent to controllers.
+// This is useful when the firmware of the backing device is being updated.
+func (a *A) SetMaintenance(on bool, reason string) {
+	a.m.Lock()
+	if a.maintenance == on && a.maintenanceReason == reason {
+		a.m.Unlock()
+		return
+	}
+	a.maintenance = on
+	a.maintenanceReason = reason
+	funcs := a.maintenanceFuncs
+	a.m.Unlock()
+
+	for _, fn := range funcs {
+		fn(on, reason)
+	}
+}
+
+// Maintenance returns true and the reason if the accessory is in maintenance mode.
+func (a *A) Maintenance() (bool, string) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.maintenance, a.maintenanceReason
+}
+
+// InMaintenance returns true if the accessory is in maintenance mode.
+func (a *A) InMaintenance() bool {
+	on, _ := a.Maintenance()
+	return on
+}
+
+// MaintenanceStatusCode returns the status code for characteristic
+// requests while the accessory is in maintenance mode.
+func (a *A) MaintenanceStatusCode() int {
+	if a.MaintenanceStatus != 0 {
+		return a.MaintenanceStatus
+	}
+
+	return -70402
+}
+
+// OnMaintenanceChange registers fn which is called when
+// the accessory enters or leaves maintenance mode.
+func (a *A) OnMaintenanceChange(fn MaintenanceFunc) {
+	a.m.Lock()
+	a.maintenanceFuncs = append(a.maintenanceFuncs, fn)
+	a.m.Unlock()
+}
+
 func (a *A) Name() string {
 	return a.Info.Name.Value()
 }
@@ -0,0 +1,147 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"net/http"
+	"sync"
+)
+
+// AirQualityThresholds are the upper bounds of the air quality levels
+// excellent, good, fair and inferior. Higher values are poor.
+type AirQualityThresholds [4]float64
+
+// level returns the air quality level of v.
+func (t AirQualityThresholds) level(v float64) int {
+	for i, max := range t {
+		if v <= max {
+			return characteristic.AirQualityExcellent + i
+		}
+	}
+
+	return characteristic.AirQualityPoor
+}
+
+// AirQualityMapping maps the readings of an air quality
+// monitor to air quality levels.
+type AirQualityMapping struct {
+	PM2_5 AirQualityThresholds // µg/m³
+	PM10  AirQualityThresholds // µg/m³
+	VOC   AirQualityThresholds // µg/m³
+	CO2   AirQualityThresholds // ppm
+}
+
+// DefaultAirQualityMapping is based on the breakpoints of the US air
+// quality index for particulate matter and common indoor guidelines
+// for VOC and CO2.
+var DefaultAirQualityMapping = AirQualityMapping{
+	PM2_5: AirQualityThresholds{12, 35.4, 55.4, 150.4},
+	PM10:  AirQualityThresholds{54, 154, 254, 354},
+	VOC:   AirQualityThresholds{65, 220, 660, 2200},
+	CO2:   AirQualityThresholds{600, 1000, 1500, 2000},
+}
+
+// AirQualityMonitor is an air quality sensor with particulate matter,
+// VOC, CO2, temperature and humidity readings. The air quality is the
+// worst level of the readings, which were set.
+type AirQualityMonitor struct {
+	*A
+	AirQualitySensor    *service.AirQualitySensor
+	CarbonDioxideSensor *service.CarbonDioxideSensor
+	TemperatureSensor   *service.TemperatureSensor
+	HumiditySensor      *service.HumiditySensor
+
+	PM2_5Density       *characteristic.PM2_5Density
+	PM10Density        *characteristic.PM10Density
+	VOCDensity         *characteristic.VOCDensity
+	CarbonDioxideLevel *characteristic.CarbonDioxideLevel
+
+	// Mapping maps the readings to air quality levels.
+	// The default is DefaultAirQualityMapping.
+	Mapping AirQualityMapping
+
+	mu  sync.Mutex
+	set map[*characteristic.C]bool // readings which were set
+}
+
+// NewAirQualityMonitor returns an air quality monitor accessory.
+func NewAirQualityMonitor(info Info) *AirQualityMonitor {
+	a := AirQualityMonitor{
+		Mapping: DefaultAirQualityMapping,
+		set:     map[*characteristic.C]bool{},
+	}
+	a.A = New(info, TypeSensor)
+
+	a.AirQualitySensor = service.NewAirQualitySensor()
+	a.AirQualitySensor.Primary = true
+	a.AddS(a.AirQualitySensor.S)
+
+	a.PM2_5Density = characteristic.NewPM2_5Density()
+	a.AirQualitySensor.AddC(a.PM2_5Density.C)
+
+	a.PM10Density = characteristic.NewPM10Density()
+	a.AirQualitySensor.AddC(a.PM10Density.C)
+
+	a.VOCDensity = characteristic.NewVOCDensity()
+	a.AirQualitySensor.AddC(a.VOCDensity.C)
+
+	a.CarbonDioxideSensor = service.NewCarbonDioxideSensor()
+	a.AddS(a.CarbonDioxideSensor.S)
+
+	a.CarbonDioxideLevel = characteristic.NewCarbonDioxideLevel()
+	a.CarbonDioxideSensor.AddC(a.CarbonDioxideLevel.C)
+
+	a.TemperatureSensor = service.NewTemperatureSensor()
+	a.AddS(a.TemperatureSensor.S)
+
+	a.HumiditySensor = service.NewHumiditySensor()
+	a.AddS(a.HumiditySensor.S)
+
+	for _, c := range []*characteristic.Float{a.PM2_5Density.Float, a.PM10Density.Float, a.VOCDensity.Float, a.CarbonDioxideLevel.Float} {
+		c.OnCValueUpdate(func(c *characteristic.C, new, old interface{}, r *http.Request) {
+			a.mu.Lock()
+			a.set[c] = true
+			a.mu.Unlock()
+
+			a.update()
+		})
+	}
+
+	return &a
+}
+
+// update sets the air quality to the worst level of the readings.
+func (a *AirQualityMonitor) update() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	readings := []struct {
+		c *characteristic.Float
+		t AirQualityThresholds
+	}{
+		{a.PM2_5Density.Float, a.Mapping.PM2_5},
+		{a.PM10Density.Float, a.Mapping.PM10},
+		{a.VOCDensity.Float, a.Mapping.VOC},
+		{a.CarbonDioxideLevel.Float, a.Mapping.CO2},
+	}
+
+	level := characteristic.AirQualityUnknown
+	for _, r := range readings {
+		if !a.set[r.c.C] {
+			continue
+		}
+
+		if l := r.t.level(r.c.Value()); l > level {
+			level = l
+		}
+	}
+
+	a.AirQualitySensor.AirQuality.SetValue(level)
+
+	co2 := characteristic.CarbonDioxideDetectedCO2LevelsNormal
+	if a.set[a.CarbonDioxideLevel.C] && a.CarbonDioxideLevel.Value() > a.Mapping.CO2[3] {
+		co2 = characteristic.CarbonDioxideDetectedCO2LevelsAbnormal
+	}
+	a.CarbonDioxideSensor.CarbonDioxideDetected.SetValue(co2)
+}
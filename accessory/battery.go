@@ -0,0 +1,75 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"context"
+	"net/http"
+)
+
+// Battery is a battery service, which sets the low battery
+// status whenever the battery level changes.
+type Battery struct {
+	*service.BatteryService
+
+	// LowThreshold is the battery level (in %) at or below which
+	// the battery is low. The default is 20. A new threshold is
+	// applied on the next update of the battery level.
+	LowThreshold int
+}
+
+// NewBattery returns a battery service.
+func NewBattery() *Battery {
+	b := Battery{LowThreshold: 20}
+	b.BatteryService = service.NewBatteryService()
+	b.BatteryLevel.OnValueUpdate(func(new, old int, r *http.Request) {
+		b.updateStatus()
+	})
+	b.updateStatus()
+
+	return &b
+}
+
+// AddBattery adds a battery service to the accessory.
+func (a *A) AddBattery() *Battery {
+	b := NewBattery()
+	a.AddS(b.S)
+
+	return b
+}
+
+// Update sets the battery level and the charging state.
+func (b *Battery) Update(level int, charging bool) {
+	if charging {
+		b.ChargingState.SetValue(characteristic.ChargingStateCharging)
+	} else if b.ChargingState.Value() != characteristic.ChargingStateNotChargeable {
+		b.ChargingState.SetValue(characteristic.ChargingStateNotCharging)
+	}
+
+	b.BatteryLevel.SetValue(level)
+}
+
+// OnValueRequest calls fn when a controller reads the battery level
+// or the charging state, and updates the battery service with the
+// returned values.
+func (b *Battery) OnValueRequest(fn func() (level int, charging bool)) {
+	b.BatteryLevel.OnValueRequestContext(func(ctx context.Context) (int, error) {
+		b.Update(fn())
+		return b.BatteryLevel.Value(), nil
+	})
+	b.ChargingState.OnValueRequestContext(func(ctx context.Context) (int, error) {
+		b.Update(fn())
+		return b.ChargingState.Value(), nil
+	})
+}
+
+// updateStatus sets the low battery status from the battery level.
+func (b *Battery) updateStatus() {
+	status := characteristic.StatusLowBatteryBatteryLevelNormal
+	if b.BatteryLevel.Value() <= b.LowThreshold {
+		status = characteristic.StatusLowBatteryBatteryLevelLow
+	}
+
+	b.StatusLowBattery.SetValue(status)
+}
@@ -10,6 +10,10 @@ type Camera struct {
 	Control           *service.CameraControl
 	StreamManagement1 *service.CameraRTPStreamManagement
 	StreamManagement2 *service.CameraRTPStreamManagement
+
+	// Microphone and Speaker are set by AddTwoWayAudio.
+	Microphone *service.Microphone
+	Speaker    *service.Speaker
 }
 
 // NewCamera returns an IP camera accessory.
@@ -28,3 +32,13 @@ func NewCamera(info Info) *Camera {
 
 	return &a
 }
+
+// AddTwoWayAudio adds a microphone and a speaker service to the camera.
+// Controllers then send audio to the camera while streaming.
+func (a *Camera) AddTwoWayAudio() {
+	a.Microphone = service.NewMicrophone()
+	a.AddS(a.Microphone.S)
+
+	a.Speaker = service.NewSpeaker()
+	a.AddS(a.Speaker.S)
+}
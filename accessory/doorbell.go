@@ -0,0 +1,36 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+// Doorbell is a doorbell. The programmable switch event of the
+// doorbell service is null when read; rings are only reported
+// to the controllers as notifications.
+type Doorbell struct {
+	*A
+	Doorbell *service.Doorbell
+}
+
+// NewDoorbell returns a doorbell accessory.
+func NewDoorbell(info Info) *Doorbell {
+	a := Doorbell{}
+	a.A = New(info, TypeVideoDoorbell)
+
+	a.Doorbell = service.NewDoorbell()
+	a.Doorbell.Primary = true
+	a.Doorbell.ProgrammableSwitchEvent.ValidVals = []int{
+		characteristic.ProgrammableSwitchEventSinglePress,
+	}
+	a.AddS(a.Doorbell.S)
+
+	return &a
+}
+
+// Ring notifies the controllers that the doorbell was pressed.
+// Every call results in a notification, even if the doorbell
+// was rung before.
+func (a *Doorbell) Ring() {
+	a.Doorbell.ProgrammableSwitchEvent.SetValue(characteristic.ProgrammableSwitchEventSinglePress)
+}
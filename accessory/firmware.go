@@ -0,0 +1,224 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"fmt"
+	"sync"
+)
+
+// SetFirmwareRevision sets the firmware revision of the accessory.
+// The server increments the configuration number (c#) when the
+// firmware revision changes.
+func (a *A) SetFirmwareRevision(rev string) {
+	a.Info.FirmwareRevision.SetValue(rev)
+}
+
+// SetHardwareRevision sets the hardware revision of the accessory.
+// Like SetFirmwareRevision, the configuration number is incremented.
+// If the accessory has no hardware revision characteristic (see
+// Info.Hardware), it is added and hap.Server.UpdateConfiguration
+// must be called afterwards.
+func (a *A) SetHardwareRevision(rev string) {
+	if c := a.Info.C(characteristic.TypeHardwareRevision); c != nil {
+		c.SetValueRequest(rev, nil)
+		return
+	}
+
+	hw := characteristic.NewHardwareRevision()
+	hw.SetValue(rev)
+	a.Info.AddC(hw.C)
+}
+
+const (
+	TypeFirmwareUpdate          = "236"
+	TypeFirmwareUpdateReadiness = "234"
+	TypeFirmwareUpdateStatus    = "235"
+	TypeStagedFirmwareVersion   = "249"
+)
+
+// Firmware update states
+const (
+	FirmwareUpdateStateIdle     byte = 0
+	FirmwareUpdateStateStaging  byte = 1
+	FirmwareUpdateStateStaged   byte = 2
+	FirmwareUpdateStateApplying byte = 3
+	FirmwareUpdateStateFailed   byte = 4
+)
+
+type firmwareUpdateReadiness struct {
+	StagingReady bool `tlv8:"1"`
+	UpdateReady  bool `tlv8:"2"`
+}
+
+type firmwareUpdateStatus struct {
+	State    byte   `tlv8:"1"`
+	Progress byte   `tlv8:"2"` // staging progress in %
+	Version  string `tlv8:"3"` // staged version
+}
+
+// FirmwareUpdate is a firmware update service, which reports the
+// progress of a firmware update to the controllers. The update is
+// driven by the application: Stage downloads and verifies a firmware
+// version with StageFunc, Apply installs it with ApplyFunc.
+type FirmwareUpdate struct {
+	*service.S
+	Readiness     *characteristic.Bytes
+	Status        *characteristic.Bytes
+	StagedVersion *characteristic.String
+
+	// StageFunc is called by Stage to download and verify the
+	// firmware version. It reports the progress (0–100) by
+	// calling progress.
+	StageFunc func(version string, progress func(percent int)) error
+
+	// ApplyFunc is called by Apply to install the staged firmware
+	// version. If it returns nil, the firmware revision of the
+	// accessory is set to the version.
+	ApplyFunc func(version string) error
+
+	a *A
+
+	mu     sync.Mutex
+	status firmwareUpdateStatus
+}
+
+// AddFirmwareUpdate adds a firmware update service to the accessory.
+func (a *A) AddFirmwareUpdate() *FirmwareUpdate {
+	u := FirmwareUpdate{a: a}
+	u.S = service.New(TypeFirmwareUpdate)
+
+	u.Readiness = characteristic.NewBytes(TypeFirmwareUpdateReadiness)
+	u.Readiness.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionEvents}
+	u.AddC(u.Readiness.C)
+
+	u.Status = characteristic.NewBytes(TypeFirmwareUpdateStatus)
+	u.Status.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionEvents}
+	u.AddC(u.Status.C)
+
+	u.StagedVersion = characteristic.NewString(TypeStagedFirmwareVersion)
+	u.StagedVersion.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionEvents}
+	u.StagedVersion.SetValue("")
+	u.AddC(u.StagedVersion.C)
+
+	u.update()
+	a.AddS(u.S)
+
+	return &u
+}
+
+// State returns the state of the update
+// (e.g. FirmwareUpdateStateStaged).
+func (u *FirmwareUpdate) State() byte {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.status.State
+}
+
+// Stage stages the firmware version by calling StageFunc.
+func (u *FirmwareUpdate) Stage(version string) error {
+	if u.StageFunc == nil {
+		return fmt.Errorf("firmware staging not supported")
+	}
+
+	u.mu.Lock()
+	if s := u.status.State; s == FirmwareUpdateStateStaging || s == FirmwareUpdateStateApplying {
+		u.mu.Unlock()
+		return fmt.Errorf("firmware update in progress")
+	}
+	u.status = firmwareUpdateStatus{State: FirmwareUpdateStateStaging, Version: version}
+	u.mu.Unlock()
+	u.update()
+
+	err := u.StageFunc(version, func(percent int) {
+		if percent < 0 || percent > 100 {
+			return
+		}
+
+		u.mu.Lock()
+		u.status.Progress = byte(percent)
+		u.mu.Unlock()
+		u.update()
+	})
+
+	u.mu.Lock()
+	if err != nil {
+		u.status.State = FirmwareUpdateStateFailed
+	} else {
+		u.status.State = FirmwareUpdateStateStaged
+		u.status.Progress = 100
+	}
+	u.mu.Unlock()
+	u.update()
+
+	return err
+}
+
+// Apply installs the staged firmware version by calling ApplyFunc
+// and updates the firmware revision of the accessory.
+func (u *FirmwareUpdate) Apply() error {
+	if u.ApplyFunc == nil {
+		return fmt.Errorf("firmware update not supported")
+	}
+
+	u.mu.Lock()
+	if u.status.State != FirmwareUpdateStateStaged {
+		u.mu.Unlock()
+		return fmt.Errorf("no staged firmware")
+	}
+	u.status.State = FirmwareUpdateStateApplying
+	version := u.status.Version
+	u.mu.Unlock()
+	u.update()
+
+	if err := u.ApplyFunc(version); err != nil {
+		u.mu.Lock()
+		u.status.State = FirmwareUpdateStateFailed
+		u.mu.Unlock()
+		u.update()
+		return err
+	}
+
+	u.mu.Lock()
+	u.status = firmwareUpdateStatus{State: FirmwareUpdateStateIdle}
+	u.mu.Unlock()
+	u.update()
+
+	u.a.SetFirmwareRevision(version)
+
+	return nil
+}
+
+// update sets the values of the characteristics to the current status.
+func (u *FirmwareUpdate) update() {
+	u.mu.Lock()
+	st := u.status
+	u.mu.Unlock()
+
+	r := firmwareUpdateReadiness{
+		StagingReady: st.State != FirmwareUpdateStateStaging && st.State != FirmwareUpdateStateApplying,
+		UpdateReady:  st.State == FirmwareUpdateStateStaged,
+	}
+
+	if b, err := tlv8.Marshal(r); err != nil {
+		log.Info.Println(err)
+	} else {
+		u.Readiness.SetValue(b)
+	}
+
+	if b, err := tlv8.Marshal(st); err != nil {
+		log.Info.Println(err)
+	} else {
+		u.Status.SetValue(b)
+	}
+
+	if st.State == FirmwareUpdateStateStaged {
+		u.StagedVersion.SetValue(st.Version)
+	} else {
+		u.StagedVersion.SetValue("")
+	}
+}
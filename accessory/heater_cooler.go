@@ -0,0 +1,142 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"net/http"
+)
+
+// HeaterCooler is a heater, cooler or both. The current state is
+// derived from the target state, the thresholds and the current
+// temperature whenever one of them changes.
+type HeaterCooler struct {
+	*A
+	HeaterCooler *service.HeaterCooler
+
+	// HeatingThreshold is nil if the heater cooler can't heat.
+	HeatingThreshold *characteristic.HeatingThresholdTemperature
+
+	// CoolingThreshold is nil if the heater cooler can't cool.
+	CoolingThreshold *characteristic.CoolingThresholdTemperature
+}
+
+// NewHeaterCooler returns a heater cooler accessory, which supports the
+// target states modes (e.g. characteristic.TargetHeaterCoolerStateHeat).
+// If no modes are specified, all target states are supported.
+func NewHeaterCooler(info Info, modes ...int) *HeaterCooler {
+	if len(modes) == 0 {
+		modes = []int{
+			characteristic.TargetHeaterCoolerStateAuto,
+			characteristic.TargetHeaterCoolerStateHeat,
+			characteristic.TargetHeaterCoolerStateCool,
+		}
+	}
+
+	a := HeaterCooler{}
+	a.A = New(info, TypeAirConditioner)
+
+	a.HeaterCooler = service.NewHeaterCooler()
+	a.HeaterCooler.Primary = true
+	a.AddS(a.HeaterCooler.S)
+
+	heat := contains(modes, characteristic.TargetHeaterCoolerStateAuto) || contains(modes, characteristic.TargetHeaterCoolerStateHeat)
+	cool := contains(modes, characteristic.TargetHeaterCoolerStateAuto) || contains(modes, characteristic.TargetHeaterCoolerStateCool)
+
+	current := []int{
+		characteristic.CurrentHeaterCoolerStateInactive,
+		characteristic.CurrentHeaterCoolerStateIdle,
+	}
+	if heat {
+		current = append(current, characteristic.CurrentHeaterCoolerStateHeating)
+		a.HeatingThreshold = characteristic.NewHeatingThresholdTemperature()
+		a.HeaterCooler.AddC(a.HeatingThreshold.C)
+		a.HeatingThreshold.OnValueUpdate(func(new, old float64, r *http.Request) {
+			a.update()
+		})
+	}
+	if cool {
+		current = append(current, characteristic.CurrentHeaterCoolerStateCooling)
+		a.CoolingThreshold = characteristic.NewCoolingThresholdTemperature()
+		a.HeaterCooler.AddC(a.CoolingThreshold.C)
+		a.CoolingThreshold.OnValueUpdate(func(new, old float64, r *http.Request) {
+			a.update()
+		})
+	}
+
+	a.HeaterCooler.CurrentHeaterCoolerState.ValidVals = current
+	a.HeaterCooler.TargetHeaterCoolerState.ValidVals = modes
+	a.HeaterCooler.TargetHeaterCoolerState.SetValue(modes[0])
+
+	a.HeaterCooler.Active.OnValueUpdate(func(new, old int, r *http.Request) {
+		a.update()
+	})
+	a.HeaterCooler.TargetHeaterCoolerState.OnValueUpdate(func(new, old int, r *http.Request) {
+		a.update()
+	})
+	a.HeaterCooler.CurrentTemperature.OnValueUpdate(func(new, old float64, r *http.Request) {
+		a.update()
+	})
+
+	return &a
+}
+
+// update sets the current state.
+func (a *HeaterCooler) update() {
+	var heating, cooling float64
+	if a.HeatingThreshold != nil {
+		heating = a.HeatingThreshold.Value()
+	}
+	if a.CoolingThreshold != nil {
+		cooling = a.CoolingThreshold.Value()
+	}
+
+	s := HeaterCoolerState(
+		a.HeaterCooler.Active.Value() == characteristic.ActiveActive,
+		a.HeaterCooler.TargetHeaterCoolerState.Value(),
+		a.HeaterCooler.CurrentTemperature.Value(),
+		heating,
+		cooling,
+	)
+	a.HeaterCooler.CurrentHeaterCoolerState.SetValue(s)
+}
+
+// HeaterCoolerState returns the current heater cooler state for the
+// target state, the current temperature and the heating and cooling
+// threshold temperatures. A heater heats below the heating threshold,
+// a cooler cools above the cooling threshold; in auto mode both apply.
+func HeaterCoolerState(active bool, target int, temp, heating, cooling float64) int {
+	if !active {
+		return characteristic.CurrentHeaterCoolerStateInactive
+	}
+
+	switch target {
+	case characteristic.TargetHeaterCoolerStateHeat:
+		if temp < heating {
+			return characteristic.CurrentHeaterCoolerStateHeating
+		}
+	case characteristic.TargetHeaterCoolerStateCool:
+		if temp > cooling {
+			return characteristic.CurrentHeaterCoolerStateCooling
+		}
+	case characteristic.TargetHeaterCoolerStateAuto:
+		if temp < heating {
+			return characteristic.CurrentHeaterCoolerStateHeating
+		}
+		if temp > cooling {
+			return characteristic.CurrentHeaterCoolerStateCooling
+		}
+	}
+
+	return characteristic.CurrentHeaterCoolerStateIdle
+}
+
+func contains(vs []int, v int) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
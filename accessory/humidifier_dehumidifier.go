@@ -0,0 +1,138 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"net/http"
+)
+
+// HumidifierDehumidifier is a humidifier, dehumidifier or both.
+// The current state is derived from the target state, the thresholds
+// and the current humidity whenever one of them changes.
+type HumidifierDehumidifier struct {
+	*A
+	HumidifierDehumidifier *service.HumidifierDehumidifier
+
+	// HumidifierThreshold is nil if the accessory can't humidify.
+	HumidifierThreshold *characteristic.RelativeHumidityHumidifierThreshold
+
+	// DehumidifierThreshold is nil if the accessory can't dehumidify.
+	DehumidifierThreshold *characteristic.RelativeHumidityDehumidifierThreshold
+}
+
+// NewHumidifierDehumidifier returns a humidifier dehumidifier accessory,
+// which supports the target states modes (e.g.
+// characteristic.TargetHumidifierDehumidifierStateHumidifier).
+// If no modes are specified, all target states are supported.
+func NewHumidifierDehumidifier(info Info, modes ...int) *HumidifierDehumidifier {
+	if len(modes) == 0 {
+		modes = []int{
+			characteristic.TargetHumidifierDehumidifierStateHumidifierOrDehumidifier,
+			characteristic.TargetHumidifierDehumidifierStateHumidifier,
+			characteristic.TargetHumidifierDehumidifierStateDehumidifier,
+		}
+	}
+
+	humidify := contains(modes, characteristic.TargetHumidifierDehumidifierStateHumidifierOrDehumidifier) || contains(modes, characteristic.TargetHumidifierDehumidifierStateHumidifier)
+	dehumidify := contains(modes, characteristic.TargetHumidifierDehumidifierStateHumidifierOrDehumidifier) || contains(modes, characteristic.TargetHumidifierDehumidifierStateDehumidifier)
+
+	a := HumidifierDehumidifier{}
+	if humidify {
+		a.A = New(info, TypeHumidifier)
+	} else {
+		a.A = New(info, TypeDehumidifier)
+	}
+
+	a.HumidifierDehumidifier = service.NewHumidifierDehumidifier()
+	a.HumidifierDehumidifier.Primary = true
+	a.AddS(a.HumidifierDehumidifier.S)
+
+	current := []int{
+		characteristic.CurrentHumidifierDehumidifierStateInactive,
+		characteristic.CurrentHumidifierDehumidifierStateIdle,
+	}
+	if humidify {
+		current = append(current, characteristic.CurrentHumidifierDehumidifierStateHumidifying)
+		a.HumidifierThreshold = characteristic.NewRelativeHumidityHumidifierThreshold()
+		a.HumidifierDehumidifier.AddC(a.HumidifierThreshold.C)
+		a.HumidifierThreshold.OnValueUpdate(func(new, old float64, r *http.Request) {
+			a.update()
+		})
+	}
+	if dehumidify {
+		current = append(current, characteristic.CurrentHumidifierDehumidifierStateDehumidifying)
+		a.DehumidifierThreshold = characteristic.NewRelativeHumidityDehumidifierThreshold()
+		a.DehumidifierThreshold.SetValue(100)
+		a.HumidifierDehumidifier.AddC(a.DehumidifierThreshold.C)
+		a.DehumidifierThreshold.OnValueUpdate(func(new, old float64, r *http.Request) {
+			a.update()
+		})
+	}
+
+	a.HumidifierDehumidifier.CurrentHumidifierDehumidifierState.ValidVals = current
+	a.HumidifierDehumidifier.TargetHumidifierDehumidifierState.ValidVals = modes
+	a.HumidifierDehumidifier.TargetHumidifierDehumidifierState.SetValue(modes[0])
+
+	a.HumidifierDehumidifier.Active.OnValueUpdate(func(new, old int, r *http.Request) {
+		a.update()
+	})
+	a.HumidifierDehumidifier.TargetHumidifierDehumidifierState.OnValueUpdate(func(new, old int, r *http.Request) {
+		a.update()
+	})
+	a.HumidifierDehumidifier.CurrentRelativeHumidity.OnValueUpdate(func(new, old float64, r *http.Request) {
+		a.update()
+	})
+
+	return &a
+}
+
+// update sets the current state.
+func (a *HumidifierDehumidifier) update() {
+	var humidifier, dehumidifier float64
+	if a.HumidifierThreshold != nil {
+		humidifier = a.HumidifierThreshold.Value()
+	}
+	if a.DehumidifierThreshold != nil {
+		dehumidifier = a.DehumidifierThreshold.Value()
+	}
+
+	s := HumidifierDehumidifierState(
+		a.HumidifierDehumidifier.Active.Value() == characteristic.ActiveActive,
+		a.HumidifierDehumidifier.TargetHumidifierDehumidifierState.Value(),
+		a.HumidifierDehumidifier.CurrentRelativeHumidity.Value(),
+		humidifier,
+		dehumidifier,
+	)
+	a.HumidifierDehumidifier.CurrentHumidifierDehumidifierState.SetValue(s)
+}
+
+// HumidifierDehumidifierState returns the current humidifier dehumidifier
+// state for the target state, the current relative humidity and the
+// humidifier and dehumidifier thresholds. A humidifier humidifies below
+// its threshold, a dehumidifier dehumidifies above its threshold.
+func HumidifierDehumidifierState(active bool, target int, humidity, humidifier, dehumidifier float64) int {
+	if !active {
+		return characteristic.CurrentHumidifierDehumidifierStateInactive
+	}
+
+	switch target {
+	case characteristic.TargetHumidifierDehumidifierStateHumidifier:
+		if humidity < humidifier {
+			return characteristic.CurrentHumidifierDehumidifierStateHumidifying
+		}
+	case characteristic.TargetHumidifierDehumidifierStateDehumidifier:
+		if humidity > dehumidifier {
+			return characteristic.CurrentHumidifierDehumidifierStateDehumidifying
+		}
+	case characteristic.TargetHumidifierDehumidifierStateHumidifierOrDehumidifier:
+		if humidity < humidifier {
+			return characteristic.CurrentHumidifierDehumidifierStateHumidifying
+		}
+		if humidity > dehumidifier {
+			return characteristic.CurrentHumidifierDehumidifierStateDehumidifying
+		}
+	}
+
+	return characteristic.CurrentHumidifierDehumidifierStateIdle
+}
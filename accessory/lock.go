@@ -0,0 +1,206 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Lock control point request types
+const (
+	lockControlReadLogsFromTime = 0x00
+	lockControlClearLogs        = 0x02
+	lockControlSetCurrentTime   = 0x03
+)
+
+// maxLockLogs is the maximum number of entries in the audit log.
+const maxLockLogs = 100
+
+// A LockLogEntry is an entry in the audit log of a lock.
+type LockLogEntry struct {
+	Time   uint32 `tlv8:"1"` // seconds since 1970
+	User   string `tlv8:"2"`
+	Action byte   `tlv8:"3"` // e.g. characteristic.LockLastKnownActionSecuredRemotely
+}
+
+type lockLogs struct {
+	Entries []LockLogEntry `tlv8:"-"`
+}
+
+// Lock is a smart lock with lock management.
+type Lock struct {
+	*A
+	LockMechanism  *service.LockMechanism
+	LockManagement *service.LockManagement
+
+	Logs                *characteristic.Logs
+	AutoSecurityTimeout *characteristic.LockManagementAutoSecurityTimeout
+	LastKnownAction     *characteristic.LockLastKnownAction
+
+	// AutoSecureFunc is called when the lock was unsecured longer
+	// than the auto security timeout. The target state is already
+	// set to secured when the function is called.
+	AutoSecureFunc func()
+
+	// SetCurrentTimeFunc is called when a controller sets
+	// the current time of the lock via the lock control point.
+	SetCurrentTimeFunc func(t time.Time)
+
+	mu    sync.Mutex
+	logs  []LockLogEntry
+	timer *time.Timer
+}
+
+// NewLock returns a lock accessory with lock management.
+func NewLock(info Info) *Lock {
+	a := Lock{}
+	a.A = New(info, TypeDoorLock)
+
+	a.LockMechanism = service.NewLockMechanism()
+	a.AddS(a.LockMechanism.S)
+
+	a.LockManagement = service.NewLockManagement()
+	a.AddS(a.LockManagement.S)
+
+	a.Logs = characteristic.NewLogs()
+	a.LockManagement.AddC(a.Logs.C)
+
+	a.AutoSecurityTimeout = characteristic.NewLockManagementAutoSecurityTimeout()
+	a.LockManagement.AddC(a.AutoSecurityTimeout.C)
+
+	a.LastKnownAction = characteristic.NewLockLastKnownAction()
+	a.LockManagement.AddC(a.LastKnownAction.C)
+
+	a.LockManagement.LockControlPoint.OnSetRemoteValue(a.control)
+	a.LockMechanism.LockCurrentState.OnValueUpdate(func(new, old int, r *http.Request) {
+		a.updateTimer(new)
+	})
+	a.AutoSecurityTimeout.OnValueUpdate(func(new, old int, r *http.Request) {
+		a.updateTimer(a.LockMechanism.LockCurrentState.Value())
+	})
+
+	return &a
+}
+
+// Log adds an entry to the audit log and
+// updates the last known action of the lock.
+func (a *Lock) Log(user string, action int) {
+	a.mu.Lock()
+	a.logs = append(a.logs, LockLogEntry{
+		Time:   uint32(time.Now().Unix()),
+		User:   user,
+		Action: byte(action),
+	})
+	if len(a.logs) > maxLockLogs {
+		a.logs = a.logs[len(a.logs)-maxLockLogs:]
+	}
+	a.mu.Unlock()
+
+	a.LastKnownAction.SetValue(action)
+}
+
+// LogEntries returns the entries of the audit log.
+func (a *Lock) LogEntries() []LockLogEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]LockLogEntry{}, a.logs...)
+}
+
+// control handles a write to the lock control point.
+func (a *Lock) control(b []byte) error {
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return fmt.Errorf("invalid lock control point request %x", b)
+		}
+
+		typ, v := b[0], b[2:2+int(b[1])]
+		b = b[2+int(b[1]):]
+
+		switch typ {
+		case lockControlReadLogsFromTime:
+			var from uint32
+			if len(v) >= 4 {
+				from = binary.LittleEndian.Uint32(v)
+			}
+			if err := a.readLogs(from); err != nil {
+				return err
+			}
+		case lockControlClearLogs:
+			a.mu.Lock()
+			a.logs = nil
+			a.mu.Unlock()
+			a.Logs.SetValue([]byte{})
+		case lockControlSetCurrentTime:
+			if len(v) < 4 {
+				return fmt.Errorf("invalid time %x", v)
+			}
+			if a.SetCurrentTimeFunc != nil {
+				a.SetCurrentTimeFunc(time.Unix(int64(binary.LittleEndian.Uint32(v)), 0))
+			}
+		default:
+			log.Debug.Printf("unsupported lock control point request %d\n", typ)
+		}
+	}
+
+	return nil
+}
+
+// readLogs sets the value of the logs characteristic
+// to the entries since the time from.
+func (a *Lock) readLogs(from uint32) error {
+	var l lockLogs
+	for _, e := range a.LogEntries() {
+		if e.Time >= from {
+			l.Entries = append(l.Entries, e)
+		}
+	}
+
+	if len(l.Entries) == 0 {
+		a.Logs.SetValue([]byte{})
+		return nil
+	}
+
+	b, err := tlv8.Marshal(l)
+	if err != nil {
+		return err
+	}
+	a.Logs.SetValue(b)
+
+	return nil
+}
+
+// updateTimer starts the auto security timer when the lock is
+// unsecured and stops it otherwise.
+func (a *Lock) updateTimer(state int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+
+	timeout := a.AutoSecurityTimeout.Value()
+	if state != characteristic.LockCurrentStateUnsecured || timeout == 0 {
+		return
+	}
+
+	a.timer = time.AfterFunc(time.Duration(timeout)*time.Second, a.autoSecure)
+}
+
+func (a *Lock) autoSecure() {
+	a.LockMechanism.LockTargetState.SetValue(characteristic.LockTargetStateSecured)
+	a.Log("", characteristic.LockLastKnownActionSecuredByAutoSecureTimeout)
+
+	if a.AutoSecureFunc != nil {
+		a.AutoSecureFunc()
+	}
+}
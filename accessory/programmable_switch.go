@@ -0,0 +1,60 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+// ProgrammableSwitch is a remote with multiple buttons.
+type ProgrammableSwitch struct {
+	*A
+	Buttons []*service.StatelessProgrammableSwitch
+	Label   *service.ServiceLabel
+}
+
+// NewProgrammableSwitch returns a programmable switch accessory
+// with n buttons, which are numbered 1, 2, … in the Home app.
+func NewProgrammableSwitch(info Info, n int) *ProgrammableSwitch {
+	a := ProgrammableSwitch{}
+	a.A = New(info, TypeProgrammableSwitch)
+
+	var ss []*service.S
+	for i := 0; i < n; i++ {
+		b := service.NewStatelessProgrammableSwitch()
+		a.Buttons = append(a.Buttons, b)
+		a.AddS(b.S)
+		ss = append(ss, b.S)
+	}
+
+	a.Label = service.Label(characteristic.ServiceLabelNamespaceArabicNumerals, ss...)
+	a.AddS(a.Label.S)
+
+	return &a
+}
+
+// PowerStrip is a power strip with multiple outlets.
+type PowerStrip struct {
+	*A
+	Outlets []*service.Outlet
+	Label   *service.ServiceLabel
+}
+
+// NewPowerStrip returns a power strip accessory with n outlets,
+// which are numbered 1, 2, … in the Home app.
+func NewPowerStrip(info Info, n int) *PowerStrip {
+	a := PowerStrip{}
+	a.A = New(info, TypeOutlet)
+
+	var ss []*service.S
+	for i := 0; i < n; i++ {
+		o := service.NewOutlet()
+		a.Outlets = append(a.Outlets, o)
+		a.AddS(o.S)
+		ss = append(ss, o.S)
+	}
+
+	a.Label = service.Label(characteristic.ServiceLabelNamespaceArabicNumerals, ss...)
+	a.AddS(a.Label.S)
+
+	return &a
+}
@@ -1,12 +1,42 @@
 package accessory
 
 import (
+	"github.com/brutella/hap/characteristic"
 	"github.com/brutella/hap/service"
+
+	"fmt"
+	"net/http"
+	"sync"
 )
 
 type SecuritySystem struct {
 	*A
 	SecuritySystem *service.SecuritySystem
+
+	// Zones are the zones added with AddContactZone and AddMotionZone.
+	Zones []*Zone
+
+	// TargetStateFunc is called when a controller changes the target
+	// state. If the function returns an error, the target state is
+	// not changed, e.g. when a window is open. If nil, the current
+	// state is changed to the target state immediately.
+	TargetStateFunc func(target int) error
+
+	// AlarmFunc is called when the alarm is triggered.
+	AlarmFunc func(z *Zone)
+
+	mu sync.Mutex
+}
+
+// A Zone triggers the alarm of a security system when
+// its sensor detects an intrusion.
+type Zone struct {
+	*service.S
+	Name *characteristic.Name
+
+	// Modes are the current states of the security system in which
+	// the zone triggers the alarm (e.g. SecuritySystemCurrentStateAwayArm).
+	Modes []int
 }
 
 // NewSecuritySystem returns a security system accessory.
@@ -15,7 +45,132 @@ func NewSecuritySystem(info Info) *SecuritySystem {
 	a.A = New(info, TypeSecuritySystem)
 
 	a.SecuritySystem = service.NewSecuritySystem()
+	a.SecuritySystem.Primary = true
+	a.SecuritySystem.SecuritySystemCurrentState.SetValue(characteristic.SecuritySystemCurrentStateDisarmed)
+	a.SecuritySystem.SecuritySystemTargetState.SetValue(characteristic.SecuritySystemTargetStateDisarm)
 	a.AddS(a.SecuritySystem.S)
 
+	a.SecuritySystem.SecuritySystemTargetState.OnSetRemoteValue(a.setTarget)
+
 	return &a
 }
+
+// AddContactZone adds a contact sensor zone, which triggers the alarm
+// when the contact is not detected in one of the modes.
+func (a *SecuritySystem) AddContactZone(name string, modes ...int) (*Zone, *service.ContactSensor) {
+	s := service.NewContactSensor()
+	z := a.addZone(s.S, name, modes)
+	s.ContactSensorState.OnValueUpdate(func(new, old int, r *http.Request) {
+		if new == characteristic.ContactSensorStateContactNotDetected {
+			a.detected(z)
+		}
+	})
+
+	return z, s
+}
+
+// AddMotionZone adds a motion sensor zone, which triggers the alarm
+// when motion is detected in one of the modes.
+func (a *SecuritySystem) AddMotionZone(name string, modes ...int) (*Zone, *service.MotionSensor) {
+	s := service.NewMotionSensor()
+	z := a.addZone(s.S, name, modes)
+	s.MotionDetected.OnValueUpdate(func(new, old bool, r *http.Request) {
+		if new {
+			a.detected(z)
+		}
+	})
+
+	return z, s
+}
+
+func (a *SecuritySystem) addZone(s *service.S, name string, modes []int) *Zone {
+	z := &Zone{S: s, Modes: modes}
+	z.Name = characteristic.NewName()
+	z.Name.SetValue(name)
+	s.AddC(z.Name.C)
+
+	a.AddS(s)
+	a.SecuritySystem.AddLinkedService(s)
+	a.Zones = append(a.Zones, z)
+
+	return z
+}
+
+// Trigger triggers the alarm.
+func (a *SecuritySystem) Trigger() {
+	a.trigger(nil)
+}
+
+// SetCurrentState sets the current state to
+// the state, which corresponds to the target state.
+func (a *SecuritySystem) SetCurrentState(target int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.SecuritySystem.SecuritySystemCurrentState.SetValue(currentStateForTarget(target))
+}
+
+// detected triggers the alarm if the zone is armed.
+func (a *SecuritySystem) detected(z *Zone) {
+	current := a.SecuritySystem.SecuritySystemCurrentState.Value()
+	for _, m := range z.Modes {
+		if m == current {
+			a.trigger(z)
+			return
+		}
+	}
+}
+
+func (a *SecuritySystem) trigger(z *Zone) {
+	a.mu.Lock()
+	cs := a.SecuritySystem.SecuritySystemCurrentState
+	triggered := cs.Value() == characteristic.SecuritySystemCurrentStateAlarmTriggered
+	cs.SetValue(characteristic.SecuritySystemCurrentStateAlarmTriggered)
+	a.mu.Unlock()
+
+	if !triggered && a.AlarmFunc != nil {
+		a.AlarmFunc(z)
+	}
+}
+
+// setTarget handles a change of the target state by a controller.
+func (a *SecuritySystem) setTarget(target int) error {
+	current := a.SecuritySystem.SecuritySystemCurrentState.Value()
+	if !validTransition(current, target) {
+		return characteristic.NewStatusError(-70410, fmt.Errorf("invalid transition from %d to %d", current, target))
+	}
+
+	if a.TargetStateFunc != nil {
+		if err := a.TargetStateFunc(target); err != nil {
+			return err
+		}
+	}
+
+	a.SetCurrentState(target)
+
+	return nil
+}
+
+// validTransition returns true if the target state can be set
+// when the security system is in the current state. A triggered
+// alarm can only be disarmed.
+func validTransition(current, target int) bool {
+	if current == characteristic.SecuritySystemCurrentStateAlarmTriggered {
+		return target == characteristic.SecuritySystemTargetStateDisarm
+	}
+
+	return true
+}
+
+func currentStateForTarget(target int) int {
+	switch target {
+	case characteristic.SecuritySystemTargetStateStayArm:
+		return characteristic.SecuritySystemCurrentStateStayArm
+	case characteristic.SecuritySystemTargetStateAwayArm:
+		return characteristic.SecuritySystemCurrentStateAwayArm
+	case characteristic.SecuritySystemTargetStateNightArm:
+		return characteristic.SecuritySystemCurrentStateNightArm
+	default:
+		return characteristic.SecuritySystemCurrentStateDisarmed
+	}
+}
@@ -1,6 +1,7 @@
 package accessory
 
 import (
+	"github.com/brutella/hap/characteristic"
 	"github.com/brutella/hap/service"
 )
 
@@ -8,6 +9,20 @@ type Television struct {
 	*A
 	Television *service.Television
 	Speaker    *service.Speaker
+
+	RemoteKey      *characteristic.RemoteKey
+	VolumeSelector *characteristic.VolumeSelector
+
+	// InputSources are the input sources added with AddInputSource.
+	InputSources []*service.InputSource
+
+	// RemoteKeyFunc is called when a key of the remote
+	// in the Control Center is pressed.
+	RemoteKeyFunc func(key int)
+
+	// VolumeSelectorFunc is called when the volume is increased
+	// or decreased with the remote in the Control Center.
+	VolumeSelectorFunc func(v int)
 }
 
 // NewTelevision returns a television accessory.
@@ -16,10 +31,65 @@ func NewTelevision(info Info) *Television {
 	a.A = New(info, TypeTelevision)
 
 	a.Television = service.NewTelevision()
+	a.Television.Primary = true
+	a.Television.ConfiguredName.SetValue(info.Name)
+	a.Television.SleepDiscoveryMode.SetValue(characteristic.SleepDiscoveryModeAlwaysDiscoverable)
 	a.AddS(a.Television.S)
 
+	a.RemoteKey = characteristic.NewRemoteKey()
+	a.RemoteKey.OnValueRemoteUpdate(func(v int) {
+		if a.RemoteKeyFunc != nil {
+			a.RemoteKeyFunc(v)
+		}
+	})
+	a.Television.AddC(a.RemoteKey.C)
+
 	a.Speaker = service.NewSpeaker()
 	a.AddS(a.Speaker.S)
+	a.Television.AddLinkedService(a.Speaker.S)
+
+	active := characteristic.NewActive()
+	active.SetValue(characteristic.ActiveActive)
+	a.Speaker.AddC(active.C)
+
+	volumeControlType := characteristic.NewVolumeControlType()
+	volumeControlType.SetValue(characteristic.VolumeControlTypeRelative)
+	a.Speaker.AddC(volumeControlType.C)
+
+	a.VolumeSelector = characteristic.NewVolumeSelector()
+	a.VolumeSelector.OnValueRemoteUpdate(func(v int) {
+		if a.VolumeSelectorFunc != nil {
+			a.VolumeSelectorFunc(v)
+		}
+	})
+	a.Speaker.AddC(a.VolumeSelector.C)
 
 	return &a
 }
+
+// AddInputSource adds an input source with the identifier id, which is
+// linked to the television service. The active identifier of the
+// television only accepts the identifiers of the added input sources.
+func (a *Television) AddInputSource(id int, name string, typ int) *service.InputSource {
+	is := service.NewInputSource()
+	is.ConfiguredName.SetValue(name)
+	is.InputSourceType.SetValue(typ)
+	is.IsConfigured.SetValue(characteristic.IsConfiguredConfigured)
+	is.CurrentVisibilityState.SetValue(characteristic.CurrentVisibilityStateShown)
+
+	identifier := characteristic.NewIdentifier()
+	identifier.SetValue(id)
+	is.AddC(identifier.C)
+
+	a.AddS(is.S)
+	a.Television.AddLinkedService(is.S)
+	a.InputSources = append(a.InputSources, is)
+
+	ai := a.Television.ActiveIdentifier
+	ai.ValidVals = append(ai.ValidVals, id)
+	if len(a.InputSources) == 1 {
+		ai.SetValue(id)
+	}
+
+	return is
+}
@@ -0,0 +1,200 @@
+package accessory
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TimedValve is a valve service, which closes after the set duration.
+// While the valve is open, the remaining duration counts down.
+type TimedValve struct {
+	*service.Valve
+	SetDuration       *characteristic.SetDuration
+	RemainingDuration *characteristic.RemainingDuration
+
+	// ActiveFunc is called when the valve is opened or closed
+	// by a controller or closed after the set duration.
+	ActiveFunc func(active bool)
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewTimedValve returns a valve of type typ
+// (e.g. characteristic.ValveTypeIrrigation).
+func NewTimedValve(typ int) *TimedValve {
+	v := TimedValve{}
+	v.Valve = service.NewValve()
+	v.ValveType.SetValue(typ)
+
+	v.SetDuration = characteristic.NewSetDuration()
+	v.AddC(v.SetDuration.C)
+
+	v.RemainingDuration = characteristic.NewRemainingDuration()
+	v.AddC(v.RemainingDuration.C)
+
+	v.Active.OnValueUpdate(func(new, old int, r *http.Request) {
+		if new == characteristic.ActiveActive {
+			v.start()
+		} else {
+			v.halt()
+		}
+
+		if r != nil && v.ActiveFunc != nil {
+			v.ActiveFunc(new == characteristic.ActiveActive)
+		}
+	})
+
+	return &v
+}
+
+// Close closes the valve and calls ActiveFunc.
+func (v *TimedValve) Close() {
+	if v.Active.Value() == characteristic.ActiveInactive {
+		return
+	}
+
+	v.Active.SetValue(characteristic.ActiveInactive)
+	if v.ActiveFunc != nil {
+		v.ActiveFunc(false)
+	}
+}
+
+// start marks the valve as in use and starts the countdown.
+func (v *TimedValve) start() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+
+	v.InUse.SetValue(characteristic.InUseInUse)
+
+	d := v.SetDuration.Value()
+	v.RemainingDuration.SetValue(d)
+	if d == 0 {
+		// no duration – the valve stays open
+		return
+	}
+
+	stop := make(chan struct{})
+	v.stop = stop
+	go v.countdown(d, stop)
+}
+
+// halt stops the countdown and marks the valve as not in use.
+func (v *TimedValve) halt() {
+	v.mu.Lock()
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+	v.mu.Unlock()
+
+	v.InUse.SetValue(characteristic.InUseNotInUse)
+	v.RemainingDuration.SetValue(0)
+}
+
+func (v *TimedValve) countdown(d int, stop chan struct{}) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for d > 0 {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			d--
+			v.RemainingDuration.SetValue(d)
+		}
+	}
+
+	v.Close()
+}
+
+// Valve is a valve with a countdown timer.
+type Valve struct {
+	*A
+	Valve *TimedValve
+}
+
+// NewValve returns a valve accessory.
+func NewValve(info Info, typ int) *Valve {
+	a := Valve{}
+	a.A = New(info, TypeFaucet)
+
+	a.Valve = NewTimedValve(typ)
+	a.AddS(a.Valve.S)
+
+	return &a
+}
+
+// IrrigationSystem is a sprinkler with multiple valves.
+type IrrigationSystem struct {
+	*A
+	IrrigationSystem *service.IrrigationSystem
+	Valves           []*TimedValve
+	Label            *service.ServiceLabel
+}
+
+// NewIrrigationSystem returns an irrigation system accessory with n
+// valves, which are numbered 1, 2, … in the Home app. The irrigation
+// system is in use while a valve is in use. If the irrigation system
+// is deactivated by a controller, all valves are closed.
+func NewIrrigationSystem(info Info, n int) *IrrigationSystem {
+	a := IrrigationSystem{}
+	a.A = New(info, TypeSprinkler)
+
+	a.IrrigationSystem = service.NewIrrigationSystem()
+	a.IrrigationSystem.Primary = true
+	a.IrrigationSystem.Active.SetValue(characteristic.ActiveActive)
+	a.AddS(a.IrrigationSystem.S)
+
+	var ss []*service.S
+	for i := 0; i < n; i++ {
+		v := NewTimedValve(characteristic.ValveTypeIrrigation)
+		isConfigured := characteristic.NewIsConfigured()
+		isConfigured.SetValue(characteristic.IsConfiguredConfigured)
+		v.AddC(isConfigured.C)
+
+		v.InUse.OnValueUpdate(func(new, old int, r *http.Request) {
+			a.updateInUse()
+		})
+
+		a.Valves = append(a.Valves, v)
+		a.AddS(v.S)
+		a.IrrigationSystem.AddLinkedService(v.S)
+		ss = append(ss, v.S)
+	}
+
+	a.Label = service.Label(characteristic.ServiceLabelNamespaceArabicNumerals, ss...)
+	a.AddS(a.Label.S)
+
+	a.IrrigationSystem.Active.OnValueRemoteUpdate(func(v int) {
+		if v == characteristic.ActiveInactive {
+			for _, valve := range a.Valves {
+				valve.Close()
+			}
+		}
+	})
+
+	return &a
+}
+
+// updateInUse sets the irrigation system in use, if a valve is in use.
+func (a *IrrigationSystem) updateInUse() {
+	inUse := characteristic.InUseNotInUse
+	for _, v := range a.Valves {
+		if v.InUse.Value() == characteristic.InUseInUse {
+			inUse = characteristic.InUseInUse
+		}
+	}
+
+	a.IrrigationSystem.InUse.SetValue(inUse)
+}
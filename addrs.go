@@ -0,0 +1,130 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"net"
+)
+
+// network returns the network the server listens on.
+func (s *Server) network() string {
+	switch s.Network {
+	case "tcp4", "tcp6":
+		return s.Network
+	default:
+		return "tcp"
+	}
+}
+
+// announcedAddrs returns the ip addresses and the interfaces at which
+// the service is announced, for a server listening at addr on network.
+// If the server listens on a specific ip address, only this address is
+// announced. If the server only listens on ipv4 or ipv6, only addresses
+// of this family are announced. Otherwise nil is returned and dnssd
+// announces the addresses of the interfaces ifaces.
+func announcedAddrs(addr net.Addr, network string, ifaces []string) ([]net.IP, []string) {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return nil, ifaces
+	}
+
+	if ip := tcpAddr.IP; ip != nil && !ip.IsUnspecified() {
+		if len(ifaces) > 0 {
+			return []net.IP{ip}, ifaces
+		}
+
+		if tcpAddr.Zone != "" {
+			return []net.IP{ip}, []string{tcpAddr.Zone}
+		}
+
+		if name := interfaceWithIP(ip); name != "" {
+			return []net.IP{ip}, []string{name}
+		}
+
+		return []net.IP{ip}, nil
+	}
+
+	if network == "tcp" {
+		return nil, ifaces
+	}
+
+	var ips []net.IP
+	var names []string
+	for _, iface := range interfaces(ifaces) {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Debug.Println(err)
+			continue
+		}
+
+		var found bool
+		for _, a := range addrs {
+			ip, _, err := net.ParseCIDR(a.String())
+			if err != nil {
+				continue
+			}
+
+			if (ip.To4() != nil) == (network == "tcp4") {
+				ips = append(ips, ip)
+				found = true
+			}
+		}
+
+		if found {
+			names = append(names, iface.Name)
+		}
+	}
+
+	return ips, names
+}
+
+// interfaces returns the interfaces with the names.
+// If names is empty, the multicast interfaces are returned.
+func interfaces(names []string) []net.Interface {
+	var ifis []net.Interface
+	if len(names) > 0 {
+		for _, name := range names {
+			if ifi, err := net.InterfaceByName(name); err == nil {
+				ifis = append(ifis, *ifi)
+			}
+		}
+		return ifis
+	}
+
+	all, err := net.Interfaces()
+	if err != nil {
+		log.Debug.Println(err)
+		return nil
+	}
+
+	for _, ifi := range all {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 && ifi.Flags&net.FlagLoopback == 0 {
+			ifis = append(ifis, ifi)
+		}
+	}
+
+	return ifis
+}
+
+// interfaceWithIP returns the name of the interface with the ip address.
+func interfaceWithIP(ip net.IP) string {
+	all, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	for _, ifi := range all {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addrs {
+			if x, _, err := net.ParseCIDR(a.String()); err == nil && x.Equal(ip) {
+				return ifi.Name
+			}
+		}
+	}
+
+	return ""
+}
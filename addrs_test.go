@@ -0,0 +1,53 @@
+package hap
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAnnouncedAddrs(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}
+	ips, ifaces := announcedAddrs(addr, "tcp", nil)
+	if is, want := len(ips), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := ips[0].String(), "127.0.0.1"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if lo := interfaceWithIP(net.ParseIP("127.0.0.1")); lo != "" {
+		if is, want := len(ifaces), 1; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+
+	// The addresses of an unspecified address are announced by dnssd.
+	addr = &net.TCPAddr{IP: net.IPv6unspecified, Port: 1234}
+	ips, ifaces = announcedAddrs(addr, "tcp", []string{"eth0"})
+	if ips != nil {
+		t.Fatal(ips)
+	}
+
+	if is, want := len(ifaces), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// Only ipv4 addresses are announced.
+	lo := interfaceWithIP(net.ParseIP("127.0.0.1"))
+	if lo == "" {
+		t.Skip("no loopback interface")
+	}
+
+	addr = &net.TCPAddr{IP: net.IPv4zero, Port: 1234}
+	ips, ifaces = announcedAddrs(addr, "tcp4", []string{lo})
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			t.Fatalf("unexpected ipv6 address %s", ip)
+		}
+	}
+
+	if is, want := len(ifaces), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,109 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+)
+
+// AdvertisementState is the state of the DNS-SD advertisement.
+type AdvertisementState int
+
+const (
+	// AdvertisementAnnounced means that the service was announced.
+	AdvertisementAnnounced AdvertisementState = iota
+
+	// AdvertisementRenamed means that the service is announced under a
+	// different name (e.g. "Outlet (2)") because of a name conflict.
+	AdvertisementRenamed
+
+	// AdvertisementInterfacesChanged means that the network interfaces
+	// changed and the service is announced again.
+	AdvertisementInterfacesChanged
+
+	// AdvertisementWithdrawn means that the service was removed.
+	AdvertisementWithdrawn
+
+	// AdvertisementFailed means that announcing, updating
+	// or withdrawing the service failed.
+	AdvertisementFailed
+)
+
+func (s AdvertisementState) String() string {
+	switch s {
+	case AdvertisementAnnounced:
+		return "announced"
+	case AdvertisementRenamed:
+		return "renamed"
+	case AdvertisementInterfacesChanged:
+		return "interfaces changed"
+	case AdvertisementWithdrawn:
+		return "withdrawn"
+	case AdvertisementFailed:
+		return "failed"
+	}
+
+	return "unknown"
+}
+
+// AdvertisementEvent describes a change of the DNS-SD advertisement.
+type AdvertisementEvent struct {
+	State AdvertisementState
+
+	// Name is the name under which the service is announced.
+	Name string
+
+	// Err is the error of AdvertisementFailed.
+	Err error
+}
+
+// An AdvertisementNotifier is a responder, which reports changes of
+// the advertisement after Announce returned, e.g. when the service
+// is renamed because of a name conflict. The server calls Notify
+// before announcing the service.
+type AdvertisementNotifier interface {
+	Notify(fn func(AdvertisementEvent))
+}
+
+// AdvertisedName returns the name under which the service is announced.
+// It differs from the accessory name after a name conflict.
+func (s *Server) AdvertisedName() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.advertisedName
+}
+
+// advertisementEvent records the event and calls AdvertisementFunc.
+func (s *Server) advertisementEvent(e AdvertisementEvent) {
+	switch e.State {
+	case AdvertisementAnnounced, AdvertisementRenamed:
+		s.mux.Lock()
+		s.advertisedName = e.Name
+		s.mux.Unlock()
+	case AdvertisementWithdrawn:
+		s.mux.Lock()
+		s.advertisedName = ""
+		s.mux.Unlock()
+	}
+
+	switch e.State {
+	case AdvertisementRenamed:
+		log.Info.Printf("dnssd: announced as \"%s\" because of a name conflict\n", e.Name)
+	case AdvertisementFailed:
+		log.Info.Println("dnssd:", e.Err)
+	default:
+		log.Debug.Println("dnssd:", e.State, e.Name)
+	}
+
+	if s.AdvertisementFunc != nil {
+		s.AdvertisementFunc(e)
+	}
+}
+
+// advertisementFailed reports the error as AdvertisementFailed.
+func (s *Server) advertisementFailed(err error) error {
+	if err != nil {
+		s.advertisementEvent(AdvertisementEvent{State: AdvertisementFailed, Err: err})
+	}
+
+	return err
+}
@@ -0,0 +1,94 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// conflictResponder reports name conflicts and fails to update txt records.
+type conflictResponder struct {
+	testResponder
+	fn  func(AdvertisementEvent)
+	err error
+}
+
+func (r *conflictResponder) Notify(fn func(AdvertisementEvent)) {
+	r.fn = fn
+}
+
+func (r *conflictResponder) UpdateText(txt map[string]string) error {
+	return r.err
+}
+
+func TestAdvertisementEvents(t *testing.T) {
+	r := &conflictResponder{err: errors.New("update failed")}
+	a := accessory.New(accessory.Info{Name: "Outlet"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), WithAddr("127.0.0.1:0"), WithResponder(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var events []AdvertisementEvent
+	s.AdvertisementFunc = func(e AdvertisementEvent) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.ListenAndServe(ctx)
+		close(stopped)
+	}()
+	waitRunning(t, s)
+
+	if is, want := s.AdvertisedName(), "Outlet"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	r.fn(AdvertisementEvent{State: AdvertisementRenamed, Name: "Outlet (2)"})
+	if is, want := s.AdvertisedName(), "Outlet (2)"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.SetupId = "ABCD"
+	if err := s.UpdateAdvertisement(); err != r.err {
+		t.Fatal(err)
+	}
+
+	cancel()
+	<-stopped
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	states := []AdvertisementState{
+		AdvertisementAnnounced,
+		AdvertisementRenamed,
+		AdvertisementFailed,
+		AdvertisementWithdrawn,
+	}
+	if is, want := len(events), len(states); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	for i, state := range states {
+		if is, want := events[i].State, state; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+
+	if is, want := events[1].Name, "Outlet (2)"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := s.AdvertisedName(), ""; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
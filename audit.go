@@ -0,0 +1,58 @@
+package hap
+
+import (
+	"github.com/brutella/hap/audit"
+	"github.com/brutella/hap/log"
+
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// record records the audit event e. The pairing and the address
+// of the controller are taken from the request context ctx.
+func (s *Server) record(ctx context.Context, e audit.Event) {
+	if s.Audit == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if e.Pairing == "" {
+		if p, ok := ContextPairing(ctx); ok {
+			e.Pairing = p.Name
+		}
+	}
+
+	if e.Addr == "" {
+		if c, ok := ctx.Value(connKey{}).(net.Conn); ok && c != nil {
+			e.Addr = c.RemoteAddr().String()
+		}
+	}
+
+	if err := s.Audit.Record(e); err != nil {
+		log.Info.Println("audit:", err)
+	}
+}
+
+// recordRequest records e for the request req.
+func (s *Server) recordRequest(req *http.Request, e audit.Event) {
+	if e.Addr == "" {
+		e.Addr = req.RemoteAddr
+	}
+
+	s.record(req.Context(), e)
+}
+
+// authFailed records a failed authentication of the
+// controller, which sent req, because of reason.
+func (s *Server) authFailed(req *http.Request, pairing, reason string) {
+	s.recordRequest(req, audit.Event{
+		Kind:    audit.AuthFailed,
+		Pairing: pairing,
+		Reason:  reason,
+	})
+}
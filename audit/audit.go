@@ -0,0 +1,160 @@
+// Package audit records security relevant events of an accessory,
+// e.g. for locks and alarm systems, which need an audit trail.
+//
+// The server records every characteristic write, pairing change
+// and failed authentication to the sink set with hap.WithAudit.
+//
+//	f, err := audit.OpenFile("audit.log")
+//	…
+//	s, err := hap.New(a.A, hap.WithAudit(f))
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is the kind of an audit event.
+type Kind string
+
+const (
+	// Write is a write of a characteristic value.
+	Write Kind = "write"
+
+	// PairingAdded is a new pairing or a changed permission of a pairing.
+	PairingAdded Kind = "pairing-added"
+
+	// PairingRemoved is a removed pairing.
+	PairingRemoved Kind = "pairing-removed"
+
+	// AuthFailed is a failed pair setup, pair verify or
+	// a request without the required permission.
+	AuthFailed Kind = "auth-failed"
+)
+
+// Event is an audit event.
+type Event struct {
+	Time time.Time `json:"time"`
+	Kind Kind      `json:"kind"`
+
+	// Pairing is the name of the controller's pairing,
+	// which caused the event. It is empty if the
+	// controller was not verified.
+	Pairing string `json:"pairing,omitempty"`
+
+	// Addr is the remote address of the controller.
+	Addr string `json:"addr,omitempty"`
+
+	// Aid, Iid and Type identify the written characteristic.
+	// Value is the written value and Status the
+	// HAP status code of the write.
+	Aid    uint64      `json:"aid,omitempty"`
+	Iid    uint64      `json:"iid,omitempty"`
+	Type   string      `json:"type,omitempty"`
+	Value  interface{} `json:"value,omitempty"`
+	Status int         `json:"status,omitempty"`
+
+	// Subject is the name of the added or removed pairing.
+	Subject string `json:"subject,omitempty"`
+	Admin   bool   `json:"admin,omitempty"`
+
+	// Reason describes a failed authentication.
+	Reason string `json:"reason,omitempty"`
+}
+
+// String returns the event as a line of key-value pairs.
+func (e Event) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "time=%s kind=%s", e.Time.Format(time.RFC3339Nano), e.Kind)
+
+	add := func(key string, value interface{}) {
+		fmt.Fprintf(&b, " %s=%v", key, value)
+	}
+
+	if e.Pairing != "" {
+		add("pairing", e.Pairing)
+	}
+	if e.Addr != "" {
+		add("addr", e.Addr)
+	}
+
+	switch e.Kind {
+	case Write:
+		add("aid", e.Aid)
+		add("iid", e.Iid)
+		if e.Type != "" {
+			add("type", e.Type)
+		}
+		add("value", e.Value)
+		add("status", e.Status)
+	case PairingAdded, PairingRemoved:
+		add("subject", e.Subject)
+		if e.Kind == PairingAdded {
+			add("admin", e.Admin)
+		}
+	}
+
+	if e.Reason != "" {
+		add("reason", fmt.Sprintf("%q", e.Reason))
+	}
+
+	return b.String()
+}
+
+// A Sink records audit events. A sink must be safe for concurrent use.
+type Sink interface {
+	Record(e Event) error
+}
+
+// Func is a sink, which calls the function with every event.
+type Func func(e Event)
+
+// Record calls fn with e.
+func (fn Func) Record(e Event) error {
+	fn(e)
+	return nil
+}
+
+type multi []Sink
+
+// Multi returns a sink, which records events to all sinks.
+// The first error of the sinks is returned.
+func Multi(sinks ...Sink) Sink {
+	return multi(sinks)
+}
+
+func (m multi) Record(e Event) error {
+	var err error
+	for _, s := range m {
+		if serr := s.Record(e); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	return err
+}
+
+// Memory is a sink, which keeps the events in memory.
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Record appends e to the events.
+func (m *Memory) Record(e Event) error {
+	m.mu.Lock()
+	m.events = append(m.events, e)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Events returns the recorded events.
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Event{}, m.events...)
+}
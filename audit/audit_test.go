@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestString(t *testing.T) {
+	tm := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := Event{Time: tm, Kind: Write, Pairing: "admin", Addr: "10.0.0.2:1234", Aid: 1, Iid: 10, Value: true}
+	if is, want := e.String(), "time=2022-01-02T03:04:05Z kind=write pairing=admin addr=10.0.0.2:1234 aid=1 iid=10 value=true status=0"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	e = Event{Time: tm, Kind: AuthFailed, Reason: "invalid setup code"}
+	if is, want := e.String(), `time=2022-01-02T03:04:05Z kind=auth-failed reason="invalid setup code"`; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Record(Event{Kind: PairingAdded, Pairing: "admin", Subject: "user"})
+	f.Record(Event{Kind: PairingRemoved, Pairing: "admin", Subject: "user"})
+	f.Close()
+
+	// Events are appended to existing files.
+	f, _ = OpenFile(path)
+	f.Record(Event{Kind: AuthFailed, Reason: "unknown controller"})
+	f.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if is, want := len(lines), 3; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	var e Event
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := e.Kind, PairingRemoved; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := e.Subject, "user"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+type errSink struct{}
+
+func (errSink) Record(Event) error { return errors.New("failed") }
+
+func TestMulti(t *testing.T) {
+	var m Memory
+	var n int
+	s := Multi(errSink{}, &m, Func(func(Event) { n++ }))
+
+	if err := s.Record(Event{Kind: Write}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if is, want := len(m.Events()), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := n, 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// File is a sink, which appends events as JSON lines to a file.
+type File struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// OpenFile opens the file at path for appending events.
+// The file is created if it doesn't exist.
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Record appends e to the file and syncs the file to disk,
+// so that recorded events survive a power loss.
+func (f *File) Record(e Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.enc.Encode(e); err != nil {
+		return err
+	}
+
+	return f.f.Sync()
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.f.Close()
+}
@@ -0,0 +1,39 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package audit
+
+import (
+	"log/syslog"
+)
+
+// Syslog is a sink, which sends events to the system log.
+type Syslog struct {
+	w *syslog.Writer
+}
+
+// NewSyslog returns a sink, which sends events with tag
+// to the local syslog daemon using the auth facility.
+func NewSyslog(tag string) (*Syslog, error) {
+	w, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Syslog{w}, nil
+}
+
+// Record sends e to the system log. Failed
+// authentications are logged as warnings.
+func (s *Syslog) Record(e Event) error {
+	if e.Kind == AuthFailed {
+		return s.w.Warning(e.String())
+	}
+
+	return s.w.Notice(e.String())
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *Syslog) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,158 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/audit"
+	"github.com/brutella/hap/tlv8"
+
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	var sink audit.Memory
+	s, err := New(a.A, WithStore(NewMemStore()), WithAudit(&sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Authorize = func(p Pairing, aid, iid uint64, op Op) bool {
+		return p.Permission == PermissionAdmin
+	}
+
+	write := func(p Pairing) {
+		body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true}]}", a.Id, a.Outlet.On.Id)
+		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+		s.setSession(reqConn(req), &session{Pairing: p})
+		s.ss.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	write(Pairing{Name: "admin", Permission: PermissionAdmin})
+	write(Pairing{Name: "user", Permission: PermissionUser})
+
+	// A non-admin controller adds a pairing.
+	b, _ := tlv8.Marshal(struct {
+		Method     byte   `tlv8:"0"`
+		Identifier string `tlv8:"1"`
+		PublicKey  []byte `tlv8:"3"`
+		Permission byte   `tlv8:"11"`
+		State      byte   `tlv8:"6"`
+	}{MethodAddPairing, "other", bytes.Repeat([]byte{0x01}, 32), PermissionAdmin, M1})
+	req := httptest.NewRequest(http.MethodPost, "/pairings", bytes.NewReader(b))
+	s.ss.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The admin controller adds the pairing.
+	req = httptest.NewRequest(http.MethodPost, "/pairings", bytes.NewReader(b))
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "admin", Permission: PermissionAdmin}})
+	s.ss.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	es := sink.Events()
+	if is, want := len(es), 4; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[0], (audit.Event{Time: es[0].Time, Kind: audit.Write, Pairing: "admin", Addr: req.RemoteAddr, Aid: a.Id, Iid: a.Outlet.On.Id, Type: a.Outlet.On.Type, Value: true}); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[1].Status, JsonStatusInsufficientPrivileges; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[2].Kind, audit.AuthFailed; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[2].Pairing, "user"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[3], (audit.Event{Time: es[3].Time, Kind: audit.PairingAdded, Pairing: "admin", Subject: "other", Admin: true}); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestAuditRejectedWrites(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	var sink audit.Memory
+	s, err := New(a.A, WithStore(NewMemStore()), WithAudit(&sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(iid uint64) {
+		body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true},{\"aid\":%[1]d,\"iid\":%[2]d,\"ev\":true}]}", a.Id, iid)
+		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+		s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "admin"}})
+		s.ss.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// unknown characteristic
+	write(1000)
+
+	// accessory in maintenance
+	a.SetMaintenance(true, "firmware update")
+	write(a.Outlet.On.Id)
+
+	es := sink.Events()
+	if is, want := len(es), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[0], (audit.Event{Time: es[0].Time, Kind: audit.Write, Pairing: "admin", Addr: es[0].Addr, Aid: a.Id, Iid: 1000, Value: true, Status: JsonStatusServiceCommunicationFailure}); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[1].Status, a.MaintenanceStatusCode(); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[1].Type, a.Outlet.On.Type; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestAuditRemovalReason(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	var sink audit.Memory
+	s, err := New(a.A, WithStore(NewMemStore()), WithAudit(&sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := func() []string {
+		var rs []string
+		for _, e := range sink.Events() {
+			if e.Kind == audit.PairingRemoved {
+				rs = append(rs, e.Subject+": "+e.Reason)
+			}
+		}
+		return rs
+	}
+
+	s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+	s.st.SavePairing(Pairing{Name: "user", Permission: PermissionUser})
+	if err := s.RemovePairing("admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := fmt.Sprint(reasons()), "[admin:  user: no admin pairing left]"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+	if err := s.Unpair(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := reasons()[2], "admin: unpaired"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
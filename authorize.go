@@ -0,0 +1,45 @@
+package hap
+
+import (
+	"net/http"
+)
+
+// An Op is an operation of a controller on a characteristic.
+type Op int
+
+const (
+	// OpRead reads the value of a characteristic.
+	OpRead Op = iota
+	// OpWrite writes the value of a characteristic.
+	OpWrite
+	// OpSubscribe enables or disables events of a characteristic.
+	OpSubscribe
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpSubscribe:
+		return "subscribe"
+	default:
+		return "unknown"
+	}
+}
+
+// authorized returns true if the controller of the request
+// is allowed to perform op on the characteristic aid.iid.
+func (srv *Server) authorized(req *http.Request, aid, iid uint64, op Op) bool {
+	ss, err := srv.getSession(reqConn(req))
+	if err != nil || ss.Pairing.Name == "" {
+		return false
+	}
+
+	if srv.Authorize == nil {
+		return true
+	}
+
+	return srv.Authorize(ss.Pairing, aid, iid, op)
+}
@@ -0,0 +1,484 @@
+package avahi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultBusAddress is the address of the system bus.
+const defaultBusAddress = "unix:path=/var/run/dbus/system_bus_socket"
+
+// D-Bus message types
+const (
+	msgMethodCall   byte = 1
+	msgMethodReturn byte = 2
+	msgError        byte = 3
+)
+
+// D-Bus header fields
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSignature   byte = 8
+)
+
+// maxMessageLen is the maximum length of a D-Bus message.
+const maxMessageLen = 1 << 27
+
+// message is a D-Bus message.
+type message struct {
+	Type        byte
+	Serial      uint32
+	Path        string
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Signature   string
+	Body        []byte
+
+	order binary.ByteOrder // byte order of the body
+}
+
+// decoder returns a decoder of the message body.
+func (m *message) decoder() *decoder {
+	order := m.order
+	if order == nil {
+		order = binary.LittleEndian
+	}
+
+	return &decoder{b: m.Body, order: order}
+}
+
+// conn is a minimal D-Bus connection, which
+// calls methods and waits for their replies.
+type conn struct {
+	mu     sync.Mutex
+	c      net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// dial connects to the bus at the address (e.g. "unix:path=/run/dbus/system_bus_socket").
+func dial(addr string) (*conn, error) {
+	path, err := socketPath(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	bc := &conn{c: c, r: bufio.NewReader(c)}
+	if err := bc.auth(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if _, err := bc.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "", nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+// systemBusAddress returns the address of the system bus.
+func systemBusAddress() string {
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+
+	return defaultBusAddress
+}
+
+func socketPath(addr string) (string, error) {
+	// only the first address is used
+	addr = strings.Split(addr, ";")[0]
+	if !strings.HasPrefix(addr, "unix:") {
+		return "", fmt.Errorf("dbus: unsupported address %s", addr)
+	}
+
+	for _, kv := range strings.Split(strings.TrimPrefix(addr, "unix:"), ",") {
+		switch {
+		case strings.HasPrefix(kv, "path="):
+			return strings.TrimPrefix(kv, "path="), nil
+		case strings.HasPrefix(kv, "abstract="):
+			return "@" + strings.TrimPrefix(kv, "abstract="), nil
+		}
+	}
+
+	return "", fmt.Errorf("dbus: unsupported address %s", addr)
+}
+
+// auth authenticates the connection with the EXTERNAL mechanism.
+func (c *conn) auth() error {
+	uid := strconv.Itoa(os.Getuid())
+	if _, err := c.c.Write([]byte("\x00AUTH EXTERNAL " + hex.EncodeToString([]byte(uid)) + "\r\n")); err != nil {
+		return err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus: authentication failed: %s", strings.TrimSpace(line))
+	}
+
+	_, err = c.c.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// call calls the method and returns the reply.
+func (c *conn) call(dest, path, iface, member, sig string, body []byte) (*message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.serial++
+	m := message{
+		Type:        msgMethodCall,
+		Serial:      c.serial,
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Destination: dest,
+		Signature:   sig,
+		Body:        body,
+	}
+
+	if _, err := c.c.Write(m.encode()); err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := readMessage(c.r)
+		if err != nil {
+			return nil, err
+		}
+
+		// signals and unrelated replies are ignored
+		if reply.ReplySerial != m.Serial {
+			continue
+		}
+
+		switch reply.Type {
+		case msgMethodReturn:
+			return reply, nil
+		case msgError:
+			d := reply.decoder()
+			if strings.HasPrefix(reply.Signature, "s") {
+				return nil, fmt.Errorf("%s: %s", reply.ErrorName, d.string())
+			}
+			return nil, errors.New(reply.ErrorName)
+		}
+	}
+}
+
+func (c *conn) Close() error {
+	return c.c.Close()
+}
+
+// encode returns the message in little-endian wire format.
+func (m message) encode() []byte {
+	e := &encoder{}
+	e.byte('l')
+	e.byte(m.Type)
+	e.byte(0) // flags
+	e.byte(1) // protocol version
+	e.uint32(uint32(len(m.Body)))
+	e.uint32(m.Serial)
+
+	fields := e.beginArray(8)
+	field := func(code byte, sig string, fn func()) {
+		e.align(8)
+		e.byte(code)
+		e.signature(sig)
+		fn()
+	}
+	if m.Path != "" {
+		field(fieldPath, "o", func() { e.string(m.Path) })
+	}
+	if m.Interface != "" {
+		field(fieldInterface, "s", func() { e.string(m.Interface) })
+	}
+	if m.Member != "" {
+		field(fieldMember, "s", func() { e.string(m.Member) })
+	}
+	if m.ErrorName != "" {
+		field(fieldErrorName, "s", func() { e.string(m.ErrorName) })
+	}
+	if m.ReplySerial != 0 {
+		field(fieldReplySerial, "u", func() { e.uint32(m.ReplySerial) })
+	}
+	if m.Destination != "" {
+		field(fieldDestination, "s", func() { e.string(m.Destination) })
+	}
+	if m.Signature != "" {
+		field(fieldSignature, "g", func() { e.signature(m.Signature) })
+	}
+	e.endArray(fields)
+	e.align(8)
+
+	return append(e.b, m.Body...)
+}
+
+// readMessage reads the next message.
+func readMessage(r io.Reader) (*message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	switch fixed[0] {
+	case 'l':
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("dbus: invalid endianness %x", fixed[0])
+	}
+
+	bodyLen := order.Uint32(fixed[4:8])
+	fieldsLen := order.Uint32(fixed[12:16])
+	if bodyLen > maxMessageLen || fieldsLen > maxMessageLen {
+		return nil, fmt.Errorf("dbus: message too large")
+	}
+
+	headerLen := 16 + int(fieldsLen)
+	pad := (8 - headerLen%8) % 8
+	rest := make([]byte, int(fieldsLen)+pad+int(bodyLen))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+
+	m := message{
+		Type:   fixed[1],
+		Serial: order.Uint32(fixed[8:12]),
+		Body:   append([]byte{}, rest[int(fieldsLen)+pad:]...),
+		order:  order,
+	}
+
+	// decode the fields with the offsets of the message
+	d := &decoder{b: append(fixed, rest[:fieldsLen]...), off: 16, order: order}
+	for d.off < len(d.b) && d.err == nil {
+		d.align(8)
+		code := d.byte()
+		sig := d.signature()
+		switch sig {
+		case "o", "s":
+			v := d.string()
+			switch code {
+			case fieldPath:
+				m.Path = v
+			case fieldInterface:
+				m.Interface = v
+			case fieldMember:
+				m.Member = v
+			case fieldErrorName:
+				m.ErrorName = v
+			case fieldDestination:
+				m.Destination = v
+			}
+		case "u":
+			v := d.uint32()
+			if code == fieldReplySerial {
+				m.ReplySerial = v
+			}
+		case "g":
+			v := d.signature()
+			if code == fieldSignature {
+				m.Signature = v
+			}
+		default:
+			return nil, fmt.Errorf("dbus: unsupported header field signature %s", sig)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &m, nil
+}
+
+// encoder encodes little-endian D-Bus values. The offsets of the
+// values are relative to the start of the message or the body.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) align(n int) {
+	for len(e.b)%n != 0 {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *encoder) byte(v byte) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.align(2)
+	e.b = append(e.b, byte(v), byte(v>>8))
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.b = append(e.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (e *encoder) int32(v int32) {
+	e.uint32(uint32(v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.b = append(e.b, s...)
+	e.b = append(e.b, 0)
+}
+
+func (e *encoder) signature(s string) {
+	e.byte(byte(len(s)))
+	e.b = append(e.b, s...)
+	e.b = append(e.b, 0)
+}
+
+// beginArray writes the length placeholder of an array,
+// whose elements are aligned to n bytes.
+func (e *encoder) beginArray(n int) [2]int {
+	e.uint32(0)
+	pos := len(e.b) - 4
+	e.align(n)
+	return [2]int{pos, len(e.b)}
+}
+
+func (e *encoder) endArray(a [2]int) {
+	binary.LittleEndian.PutUint32(e.b[a[0]:], uint32(len(e.b)-a[1]))
+}
+
+// byteArrays writes the array of byte arrays (aay).
+func (e *encoder) byteArrays(bs [][]byte) {
+	a := e.beginArray(4)
+	for _, b := range bs {
+		e.uint32(uint32(len(b)))
+		e.b = append(e.b, b...)
+	}
+	e.endArray(a)
+}
+
+type decoder struct {
+	b     []byte
+	off   int
+	order binary.ByteOrder
+	err   error
+}
+
+func (d *decoder) align(n int) {
+	for d.off%n != 0 {
+		d.off++
+	}
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if d.off+n > len(d.b) || n < 0 {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	b := d.b[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (d *decoder) uint32() uint32 {
+	d.align(4)
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+
+	return d.order.Uint32(b)
+}
+
+func (d *decoder) int32() int32 {
+	return int32(d.uint32())
+}
+
+func (d *decoder) uint16() uint16 {
+	d.align(2)
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+
+	return d.order.Uint16(b)
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	if n > maxMessageLen {
+		d.err = fmt.Errorf("dbus: invalid string length")
+		return ""
+	}
+
+	b := d.next(int(n) + 1)
+	if b == nil {
+		return ""
+	}
+
+	return string(b[:n])
+}
+
+func (d *decoder) signature() string {
+	n := d.byte()
+	b := d.next(int(n) + 1)
+	if b == nil {
+		return ""
+	}
+
+	return string(b[:n])
+}
+
+// byteArrays reads an array of byte arrays (aay).
+func (d *decoder) byteArrays() [][]byte {
+	n := int(d.uint32())
+	end := d.off + n
+	var bs [][]byte
+	for d.off < end && d.err == nil {
+		l := d.uint32()
+		bs = append(bs, append([]byte{}, d.next(int(l))...))
+	}
+
+	return bs
+}
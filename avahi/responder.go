@@ -0,0 +1,208 @@
+// Package avahi implements a responder, which announces accessories
+// via avahi-daemon over D-Bus. Use it on Linux systems running
+// avahi-daemon instead of the built-in mDNS responder, which would
+// conflict with avahi-daemon on port 5353.
+//
+//	s, _ := hap.NewServer(store, a)
+//	s.Responder = avahi.NewResponder()
+package avahi
+
+import (
+	"github.com/brutella/hap"
+
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+const (
+	avahiName       = "org.freedesktop.Avahi"
+	avahiServer     = "org.freedesktop.Avahi.Server"
+	avahiEntryGroup = "org.freedesktop.Avahi.EntryGroup"
+
+	ifaceUnspec int32 = -1
+	protoUnspec int32 = -1
+)
+
+// Responder announces services via avahi-daemon. The service is
+// announced with the host name and addresses of avahi-daemon;
+// the host and ip addresses of the service are ignored.
+type Responder struct {
+	// Addr is the address of the D-Bus system bus. If empty,
+	// DBUS_SYSTEM_BUS_ADDRESS or the default address is used.
+	Addr string
+
+	mu     sync.Mutex
+	conn   *conn
+	group  string // object path of the entry group
+	svc    hap.DNSSDService
+	ifaces []int32
+}
+
+// NewResponder returns a responder, which uses the system bus.
+func NewResponder() *Responder {
+	return &Responder{}
+}
+
+// Check connects to avahi-daemon without announcing a service.
+func (r *Responder) Check() error {
+	addr := r.Addr
+	if addr == "" {
+		addr = systemBusAddress()
+	}
+
+	c, err := dial(addr)
+	if err != nil {
+		return fmt.Errorf("avahi: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.call(avahiName, "/", avahiServer, "GetVersionString", "", nil); err != nil {
+		return fmt.Errorf("avahi: %v", err)
+	}
+
+	return nil
+}
+
+// Announce adds the service to a new entry group of avahi-daemon.
+func (r *Responder) Announce(s hap.DNSSDService) error {
+	ifaces, err := interfaceIndexes(s.Ifaces)
+	if err != nil {
+		return err
+	}
+
+	addr := r.Addr
+	if addr == "" {
+		addr = systemBusAddress()
+	}
+
+	c, err := dial(addr)
+	if err != nil {
+		return fmt.Errorf("avahi: %v", err)
+	}
+
+	reply, err := c.call(avahiName, "/", avahiServer, "EntryGroupNew", "", nil)
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("avahi: %v", err)
+	}
+
+	d := reply.decoder()
+	group := d.string()
+	if d.err != nil {
+		c.Close()
+		return fmt.Errorf("avahi: %v", d.err)
+	}
+
+	for _, iface := range ifaces {
+		e := &encoder{}
+		e.int32(iface)
+		e.int32(protoUnspec)
+		e.uint32(0) // flags
+		e.string(s.Name)
+		e.string(s.Type)
+		e.string(s.Domain)
+		e.string("") // host of avahi-daemon
+		e.uint16(uint16(s.Port))
+		e.byteArrays(txtRecords(s.Text))
+
+		if _, err := c.call(avahiName, group, avahiEntryGroup, "AddService", "iiussssqaay", e.b); err != nil {
+			c.Close()
+			return fmt.Errorf("avahi: %v", err)
+		}
+	}
+
+	if _, err := c.call(avahiName, group, avahiEntryGroup, "Commit", "", nil); err != nil {
+		c.Close()
+		return fmt.Errorf("avahi: %v", err)
+	}
+
+	r.mu.Lock()
+	r.conn, r.group, r.svc, r.ifaces = c, group, s, ifaces
+	r.mu.Unlock()
+
+	return nil
+}
+
+// UpdateText updates the txt records of the announced service.
+func (r *Responder) UpdateText(txt map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		return fmt.Errorf("avahi: service not announced")
+	}
+
+	r.svc.Text = txt
+	for _, iface := range r.ifaces {
+		e := &encoder{}
+		e.int32(iface)
+		e.int32(protoUnspec)
+		e.uint32(0) // flags
+		e.string(r.svc.Name)
+		e.string(r.svc.Type)
+		e.string(r.svc.Domain)
+		e.byteArrays(txtRecords(txt))
+
+		if _, err := r.conn.call(avahiName, r.group, avahiEntryGroup, "UpdateServiceTxt", "iiusssaay", e.b); err != nil {
+			return fmt.Errorf("avahi: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Withdraw frees the entry group, which removes the service.
+func (r *Responder) Withdraw() error {
+	r.mu.Lock()
+	c, group := r.conn, r.group
+	r.conn, r.group = nil, ""
+	r.mu.Unlock()
+
+	if c == nil {
+		return nil
+	}
+	defer c.Close()
+
+	if _, err := c.call(avahiName, group, avahiEntryGroup, "Free", "", nil); err != nil {
+		return fmt.Errorf("avahi: %v", err)
+	}
+
+	return nil
+}
+
+// interfaceIndexes returns the indexes of the network interfaces.
+// If names is empty, the service is announced on all interfaces.
+func interfaceIndexes(names []string) ([]int32, error) {
+	if len(names) == 0 {
+		return []int32{ifaceUnspec}, nil
+	}
+
+	var is []int32
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, err
+		}
+		is = append(is, int32(iface.Index))
+	}
+
+	return is, nil
+}
+
+// txtRecords returns the "key=value" strings of the txt records.
+func txtRecords(txt map[string]string) [][]byte {
+	var keys []string
+	for k := range txt {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var bs [][]byte
+	for _, k := range keys {
+		bs = append(bs, []byte(k+"="+txt[k]))
+	}
+
+	return bs
+}
@@ -0,0 +1,208 @@
+package avahi
+
+import (
+	"github.com/brutella/hap"
+
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bus is a fake D-Bus daemon, which records the method calls.
+type bus struct {
+	t     *testing.T
+	ln    net.Listener
+	calls chan *message
+}
+
+func newBus(t *testing.T) *bus {
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "bus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &bus{t, ln, make(chan *message, 10)}
+	go b.serve()
+
+	return b
+}
+
+func (b *bus) addr() string {
+	return "unix:path=" + b.ln.Addr().String()
+}
+
+func (b *bus) serve() {
+	c, err := b.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	line, _ := r.ReadString('\n')
+	if !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		return
+	}
+	c.Write([]byte("OK 0123456789abcdef\r\n"))
+	if line, _ := r.ReadString('\n'); line != "BEGIN\r\n" {
+		return
+	}
+
+	var serial uint32
+	for {
+		m, err := readMessage(r)
+		if err != nil {
+			return
+		}
+
+		serial++
+		reply := message{Type: msgMethodReturn, Serial: serial, ReplySerial: m.Serial}
+		switch m.Member {
+		case "Hello":
+			// a signal before the reply
+			c.Write(message{Type: 4, Serial: serial, Path: "/org/freedesktop/DBus", Interface: "org.freedesktop.DBus", Member: "NameAcquired"}.encode())
+			serial++
+			reply.Serial = serial
+		case "EntryGroupNew":
+			e := &encoder{}
+			e.string("/Client1/EntryGroup1")
+			reply.Signature = "o"
+			reply.Body = e.b
+		}
+
+		b.calls <- m
+		c.Write(reply.encode())
+	}
+}
+
+func (b *bus) call(member string) *message {
+	for m := range b.calls {
+		if m.Member == member {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func TestAnnounce(t *testing.T) {
+	b := newBus(t)
+	defer b.ln.Close()
+
+	r := NewResponder()
+	r.Addr = b.addr()
+
+	err := r.Announce(hap.DNSSDService{
+		Name:   "Outlet",
+		Type:   "_hap._tcp",
+		Domain: "local",
+		Port:   51826,
+		Text:   map[string]string{"c#": "1", "sf": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := b.call("AddService")
+	if is, want := m.Path, "/Client1/EntryGroup1"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := m.Signature, "iiussssqaay"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	d := m.decoder()
+	if is, want := d.int32(), ifaceUnspec; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	d.int32()
+	d.uint32()
+	if is, want := d.string(), "Outlet"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if is, want := d.string(), "_hap._tcp"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	d.string()
+	d.string()
+	if is, want := d.uint16(), uint16(51826); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	txt := d.byteArrays()
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+
+	if is, want := len(txt), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := string(txt[0]), "c#=1"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if b.call("Commit") == nil {
+		t.Fatal("entry group not committed")
+	}
+
+	if err := r.UpdateText(map[string]string{"c#": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if m := b.call("UpdateServiceTxt"); m == nil {
+		t.Fatal("txt records not updated")
+	}
+
+	if err := r.Withdraw(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.call("Free") == nil {
+		t.Fatal("entry group not freed")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	b := newBus(t)
+	defer b.ln.Close()
+
+	r := NewResponder()
+	r.Addr = b.addr()
+
+	if err := r.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.call("GetVersionString") == nil {
+		t.Fatal("avahi-daemon not called")
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	tests := []struct {
+		addr string
+		path string
+	}{
+		{"unix:path=/run/dbus/system_bus_socket", "/run/dbus/system_bus_socket"},
+		{"unix:abstract=/tmp/dbus-abc,guid=123", "@/tmp/dbus-abc"},
+	}
+
+	for _, test := range tests {
+		path, err := socketPath(test.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := path, test.path; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+
+	if _, err := socketPath("tcp:host=localhost,port=1234"); err == nil {
+		t.Fatal("expected error")
+	}
+}
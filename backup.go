@@ -0,0 +1,85 @@
+package hap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// archiveVersion is the version of the archive format.
+const archiveVersion = 1
+
+// archive is the format of a store backup.
+type archive struct {
+	Version int               `json:"version"`
+	Created time.Time         `json:"created"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+// isTransientKey returns true for keys which are not part of a backup.
+func isTransientKey(k string) bool {
+	return k == keyHealthCheck || k == keySelfTest || strings.HasSuffix(k, ".tmp")
+}
+
+// ExportStore writes all key-value pairs of st as a single versioned
+// archive to w. The archive contains the identity of the accessory
+// (uuid and keypair), the pairings, persisted characteristic values
+// and the schema version. It can be imported on another host with
+// ImportStore, which lets controllers connect without re-pairing.
+//
+// The archive contains the private key of the accessory and must be
+// kept secret.
+func ExportStore(st Store, w io.Writer) error {
+	ks, err := st.KeysWithSuffix("")
+	if err != nil {
+		return err
+	}
+
+	a := archive{
+		Version: archiveVersion,
+		Created: time.Now().UTC(),
+		Entries: map[string][]byte{},
+	}
+
+	for _, k := range ks {
+		if isTransientKey(k) {
+			continue
+		}
+
+		v, err := st.Get(k)
+		if err != nil {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+		a.Entries[k] = v
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&a)
+}
+
+// ImportStore reads an archive created by ExportStore from r
+// and writes all key-value pairs to st. Existing values for
+// the same keys are overwritten.
+func ImportStore(st Store, r io.Reader) error {
+	var a archive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return err
+	}
+
+	if a.Version < 1 || a.Version > archiveVersion {
+		return fmt.Errorf("unsupported archive version %d", a.Version)
+	}
+
+	for k, v := range a.Entries {
+		if err := st.Set(k, v); err != nil {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+	}
+
+	// Run the migrations in case the archive was
+	// created by a previous version.
+	return migrate(&storer{st})
+}
@@ -0,0 +1,35 @@
+package hap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestExportImportStore(t *testing.T) {
+	src := NewMemStore()
+	st := &storer{src}
+	st.SetString("schema", "1")
+	st.SaveKeyPair(KeyPair{Public: []byte{0x1}, Private: []byte{0x2}})
+	st.SavePairing(Pairing{Name: "ctrl", PublicKey: []byte{0x3}, Permission: PermissionAdmin})
+	src.Set(keyHealthCheck, []byte("ignored"))
+
+	var buf bytes.Buffer
+	if err := ExportStore(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewMemStore()
+	if err := ImportStore(dst, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dst.Get(keyHealthCheck); err == nil {
+		t.Fatal("transient key was exported")
+	}
+
+	delete(src.kv, keyHealthCheck)
+	if is, want := dst.Snapshot(), src.Snapshot(); !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,40 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+)
+
+// A CharacteristicWrite is the successful write of
+// a characteristic value by a controller.
+type CharacteristicWrite struct {
+	A     *accessory.A
+	C     *characteristic.C
+	Value interface{} // the written value
+}
+
+// OnWriteBatch sets fn, which is called with all characteristic writes
+// of a write request (e.g. hue, saturation and brightness of a scene)
+// after the callbacks of the characteristics were called.
+// Use it to apply the writes at once to a physical device.
+// fn is not called, if no write of the request succeeded.
+func (s *Server) OnWriteBatch(fn func(ws []CharacteristicWrite)) {
+	s.mux.Lock()
+	s.batchFunc = fn
+	s.mux.Unlock()
+}
+
+// writeBatch calls the function set with OnWriteBatch.
+func (s *Server) writeBatch(ws []CharacteristicWrite) {
+	if len(ws) == 0 {
+		return
+	}
+
+	s.mux.Lock()
+	fn := s.batchFunc
+	s.mux.Unlock()
+
+	if fn != nil {
+		fn(ws)
+	}
+}
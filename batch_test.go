@@ -0,0 +1,58 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteBatch(t *testing.T) {
+	a := accessory.NewColoredLightbulb(accessory.Info{Name: "ABC"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var batches [][]CharacteristicWrite
+	s.OnWriteBatch(func(ws []CharacteristicWrite) {
+		batches = append(batches, ws)
+	})
+
+	lb := a.Lightbulb
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":120},{\"aid\":%[1]d,\"iid\":%[3]d,\"value\":50},{\"aid\":%[1]d,\"iid\":%[4]d,\"value\":80}]}", a.Id, lb.Hue.Id, lb.Saturation.Id, lb.Brightness.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Code, http.StatusNoContent; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(batches), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	ws := batches[0]
+	if is, want := len(ws), 3; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := ws[0].C, lb.Hue.C; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := ws[0].A, a.A; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := ws[2].Value, 80; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
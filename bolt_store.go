@@ -0,0 +1,124 @@
+package hap
+
+import (
+	bolt "go.etcd.io/bbolt"
+
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// boltBucket is the name of the bucket in which all values are stored.
+var boltBucket = []byte("hap")
+
+// BoltStore is a Store which keeps all key-value pairs in a single
+// bbolt database file. Every operation is executed in a transaction,
+// which makes the store more robust than the filesystem store
+// on embedded flash storage.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the bbolt database at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db}, nil
+}
+
+// Set sets the value for the given key.
+func (bs *BoltStore) Set(key string, value []byte) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), value)
+	})
+}
+
+// Get returns the value for the given key.
+func (bs *BoltStore) Get(key string) ([]byte, error) {
+	var value []byte
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("no entry for key %s", key)
+		}
+
+		// The value is only valid during the transaction.
+		value = make([]byte, len(v))
+		copy(value, v)
+		return nil
+	})
+
+	return value, err
+}
+
+// Delete deletes the value for the given key.
+func (bs *BoltStore) Delete(key string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+// KeysWithSuffix returns a list keys with the give suffix.
+func (bs *BoltStore) KeysWithSuffix(suffix string) (keys []string, err error) {
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			if strings.HasSuffix(string(k), suffix) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+
+	return
+}
+
+// Close closes the database file.
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
+
+// MigrateFsStore copies all key-value pairs from the filesystem
+// store in dir to dst. The files in dir are not removed.
+func MigrateFsStore(dir string, dst Store) error {
+	src := newFsStore(dir)
+	ks, err := src.KeysWithSuffix("")
+	if err != nil {
+		return err
+	}
+
+	for _, k := range ks {
+		// Ignore temporary files of interrupted writes.
+		if strings.HasSuffix(k, ".tmp") {
+			continue
+		}
+
+		v, err := src.Get(k)
+		if err != nil {
+			return err
+		}
+
+		if err := dst.Set(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package hap
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFsStore(filepath.Join(dir, "fs"))
+	if err := fs.Set("uuid", []byte("ABC")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Set("a.pairing", []byte{0x0, 0x1}); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := NewBoltStore(filepath.Join(dir, "hap.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	if err := MigrateFsStore(filepath.Join(dir, "fs"), st); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := st.Get("a.pairing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := b, []byte{0x0, 0x1}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	ks, err := st.KeysWithSuffix(".pairing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := ks, []string{"a.pairing"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := st.Delete("a.pairing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Get("a.pairing"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,242 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MaxBridgedAccessories is the maximum number of accessories
+// a bridge can expose in addition to the bridge itself.
+const MaxBridgedAccessories = 149
+
+// keyBridgeGroup is the store key of the bridge assignments.
+const keyBridgeGroup = "bridgegroup"
+
+// A BridgeGroup distributes accessories across multiple bridges.
+// Every bridge is served by its own server with its own device id,
+// port and store namespace ("bridge1/", "bridge2/", …).
+//
+// The bridge of an accessory is persisted, which makes sure that an
+// accessory stays at the same bridge when other accessories are added
+// or removed. Controllers have to pair with every bridge separately.
+type BridgeGroup struct {
+	// Servers contains the server of every bridge.
+	Servers []*Server
+
+	st      *storer
+	info    accessory.Info
+	bridges map[string]int // bridge index by accessory key
+	mu      sync.Mutex
+}
+
+// NewBridgeGroup returns a bridge group which bridges the accessories as.
+// The bridges are named like info.Name, followed by their number ("Bridge 2").
+func NewBridgeGroup(st Store, info accessory.Info, as ...*accessory.A) (*BridgeGroup, error) {
+	g := &BridgeGroup{
+		st:      &storer{st},
+		info:    info,
+		bridges: map[string]int{},
+	}
+
+	if b, err := g.st.Get(keyBridgeGroup); err == nil && len(b) > 0 {
+		if err := json.Unmarshal(b, &g.bridges); err != nil {
+			return nil, fmt.Errorf("bridge group: %v", err)
+		}
+	}
+
+	// Accessories are added to the bridge they were assigned to before.
+	// New accessories are added to the first bridge with free space.
+	var bridged [][]*accessory.A
+	keys := map[string]int{}
+	var unassigned []*accessory.A
+	for _, a := range as {
+		i, ok := g.bridges[uniqueKey(keys, accessoryKey(a))]
+		if !ok {
+			unassigned = append(unassigned, a)
+			continue
+		}
+
+		for len(bridged) <= i {
+			bridged = append(bridged, nil)
+		}
+		bridged[i] = append(bridged[i], a)
+	}
+
+	keys = map[string]int{}
+	for _, a := range as {
+		key := uniqueKey(keys, accessoryKey(a))
+		if !contains(unassigned, a) {
+			continue
+		}
+
+		i := 0
+		for i < len(bridged) && len(bridged[i]) >= MaxBridgedAccessories {
+			i++
+		}
+
+		if i == len(bridged) {
+			bridged = append(bridged, nil)
+		}
+		bridged[i] = append(bridged[i], a)
+		g.bridges[key] = i
+	}
+
+	if len(bridged) == 0 {
+		bridged = append(bridged, nil)
+	}
+
+	for i, as := range bridged {
+		if len(as) > MaxBridgedAccessories {
+			return nil, fmt.Errorf("bridge %d has %d accessories", i+1, len(as))
+		}
+
+		s, err := NewServer(PrefixStore(st, fmt.Sprintf("bridge%d/", i+1)), g.newBridge(i).A, as...)
+		if err != nil {
+			return nil, err
+		}
+		g.Servers = append(g.Servers, s)
+	}
+
+	if err := g.save(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// AddAccessory adds the accessory a to the first bridge with free space.
+// An error is returned if every bridge is full.
+func (g *BridgeGroup) AddAccessory(a *accessory.A) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, s := range g.Servers {
+		s.amux.RLock()
+		n := len(s.as)
+		s.amux.RUnlock()
+
+		if n >= MaxBridgedAccessories {
+			continue
+		}
+
+		if err := s.AddAccessory(a); err != nil {
+			return err
+		}
+
+		g.bridges[g.key(a)] = i
+		return g.save()
+	}
+
+	return errors.New("bridge group: all bridges are full")
+}
+
+// RemoveAccessory removes the accessory a from its bridge.
+func (g *BridgeGroup) RemoveAccessory(a *accessory.A) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.Server(a)
+	if s == nil {
+		return fmt.Errorf("bridge group: accessory %s not found", a.Name())
+	}
+
+	key := g.key(a)
+	if err := s.RemoveAccessory(a.Id); err != nil {
+		return err
+	}
+
+	delete(g.bridges, key)
+	return g.save()
+}
+
+// Server returns the server which bridges the accessory a.
+func (g *BridgeGroup) Server(a *accessory.A) *Server {
+	for _, s := range g.Servers {
+		if s.findA(a.Id) == a {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// ListenAndServe starts the servers of all bridges.
+// If one server stops with an error, the other servers are stopped too.
+func (g *BridgeGroup) ListenAndServe(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(g.Servers))
+	for _, s := range g.Servers {
+		go func(s *Server) {
+			errs <- s.ListenAndServe(ctx)
+		}(s)
+	}
+
+	var err error
+	for range g.Servers {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			cancel()
+		}
+	}
+
+	return err
+}
+
+// key returns the key of the accessory a among all bridged accessories.
+func (g *BridgeGroup) key(a *accessory.A) string {
+	keys := map[string]int{}
+	for _, s := range g.Servers {
+		s.amux.RLock()
+		for _, x := range s.as {
+			if x != a {
+				uniqueKey(keys, accessoryKey(x))
+			}
+		}
+		s.amux.RUnlock()
+	}
+
+	return uniqueKey(keys, accessoryKey(a))
+}
+
+// newBridge returns the bridge accessory with index i.
+func (g *BridgeGroup) newBridge(i int) *accessory.Bridge {
+	info := g.info
+	if i > 0 {
+		info.Name = fmt.Sprintf("%s %d", info.Name, i+1)
+		if info.SerialNumber != "" {
+			info.SerialNumber = fmt.Sprintf("%s-%d", info.SerialNumber, i+1)
+		}
+	}
+
+	return accessory.NewBridge(info)
+}
+
+func (g *BridgeGroup) save() error {
+	if g.st.readOnly() {
+		return nil
+	}
+
+	b, err := json.Marshal(g.bridges)
+	if err != nil {
+		return err
+	}
+
+	return g.st.Set(keyBridgeGroup, b)
+}
+
+func contains(as []*accessory.A, a *accessory.A) bool {
+	for _, x := range as {
+		if x == a {
+			return true
+		}
+	}
+
+	return false
+}
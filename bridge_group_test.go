@@ -0,0 +1,72 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"fmt"
+	"testing"
+)
+
+func newSwitches(from, to int) []*accessory.A {
+	var as []*accessory.A
+	for i := from; i < to; i++ {
+		info := accessory.Info{Name: fmt.Sprintf("Switch %d", i), SerialNumber: fmt.Sprintf("SW%d", i)}
+		as = append(as, accessory.NewSwitch(info).A)
+	}
+
+	return as
+}
+
+func TestBridgeGroup(t *testing.T) {
+	st := NewMemStore()
+	as := newSwitches(0, 200)
+
+	g, err := NewBridgeGroup(st, accessory.Info{Name: "Bridge"}, as...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(g.Servers), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(g.Servers[0].as), MaxBridgedAccessories; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := g.Servers[1].a.Name(), "Bridge 2"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if g.Servers[0].uuid == g.Servers[1].uuid {
+		t.Fatal("bridges have the same device id")
+	}
+
+	// Accessories stay at their bridge when accessories are removed.
+	as = newSwitches(100, 200)
+	g, err = NewBridgeGroup(st, accessory.Info{Name: "Bridge"}, as...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := g.Server(as[len(as)-1]), g.Servers[1]; is != want {
+		t.Fatal("accessory moved to another bridge")
+	}
+
+	a := newSwitches(200, 201)[0]
+	if err := g.AddAccessory(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := g.Server(a), g.Servers[0]; is != want {
+		t.Fatal("accessory not added to the first bridge")
+	}
+
+	if err := g.RemoveAccessory(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Server(a) != nil {
+		t.Fatal("accessory not removed")
+	}
+}
@@ -0,0 +1,52 @@
+package chacha20poly1305
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	nonce := []byte("PS-Msg05")
+	add := []byte{0x02, 0x00}
+
+	enc, mac, err := EncryptAndSeal(key, nonce, []byte("hello"), add)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the encrypted message has spare capacity,
+	// which must not be overwritten by the mac
+	msg := append(make([]byte, 0, 64), enc...)
+	spare := msg[:cap(msg)]
+	copy(spare[len(msg):], bytes.Repeat([]byte{0xff}, cap(msg)-len(msg)))
+
+	dec, err := DecryptAndVerify(key, nonce, msg, mac, add)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(dec), "hello"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := spare[len(msg)], byte(0xff); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := string(msg), string(enc); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	mac[0] ^= 0xff
+	if _, err := DecryptAndVerify(key, nonce, enc, mac, add); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestInvalidNonce(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	if _, _, err := EncryptAndSeal(key, make([]byte, 12), nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -3,6 +3,7 @@ package characteristic
 import (
 	"github.com/brutella/hap/log"
 
+	"context"
 	"net/http"
 )
 
@@ -29,13 +30,13 @@ func (c *Bool) Value() bool {
 }
 
 // OnSetRemoteValue set c.SetValueRequestFunc and calls fn.
-// If the function returns an error, the code -70402 is
-// included in the HTTP response.
+// If the function returns an error, the code -70402 (or the code
+// of a StatusError) is included in the HTTP response.
 func (c *Bool) OnSetRemoteValue(fn func(v bool) error) {
 	c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
 		if err := fn(v.(bool)); err != nil {
 			log.Debug.Println(err)
-			return nil, -70402
+			return nil, codeForError(err)
 		}
 		return nil, 0
 	}
@@ -57,3 +58,42 @@ func (c *Bool) OnValueRemoteUpdate(fn func(v bool)) {
 		}
 	})
 }
+
+// OnSetRemoteValueContext is like OnSetRemoteValue but passes the context
+// of the HTTP request to fn. The context is canceled when the controller
+// disconnects. If the function returns context.DeadlineExceeded,
+// the code -70408 (operation timed out) is included in the HTTP response.
+func (c *Bool) OnSetRemoteValueContext(fn func(ctx context.Context, v bool) error) {
+	c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
+		if err := fn(requestContext(r), v.(bool)); err != nil {
+			log.Debug.Println(err)
+			return nil, codeForError(err)
+		}
+		return nil, 0
+	}
+}
+
+// OnValueRemoteUpdateContext is like OnValueRemoteUpdate but passes the
+// context of the HTTP request to fn.
+func (c *Bool) OnValueRemoteUpdateContext(fn func(ctx context.Context, v bool)) {
+	c.OnCValueUpdate(func(c *C, new, old interface{}, r *http.Request) {
+		if r != nil {
+			fn(r.Context(), new.(bool))
+		}
+	})
+}
+
+// OnValueRequestContext sets c.ValueRequestFunc and calls fn when a
+// controller reads the value of c. The context is canceled when the
+// read times out (see hap.Server.ReadTimeout). If fn returns an error,
+// the code -70402 (or -70408 on timeout) is included in the HTTP response.
+func (c *Bool) OnValueRequestContext(fn func(ctx context.Context) (bool, error)) {
+	c.ValueRequestFunc = func(r *http.Request) (interface{}, int) {
+		v, err := fn(requestContext(r))
+		if err != nil {
+			log.Debug.Println(err)
+			return nil, codeForError(err)
+		}
+		return v, 0
+	}
+}
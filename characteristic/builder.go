@@ -0,0 +1,157 @@
+package characteristic
+
+import (
+	"fmt"
+)
+
+// A Builder builds a custom characteristic, e.g. to expose
+// vendor-specific data.
+//
+//	c, err := characteristic.NewBuilder("E863F10D-079E-48FF-8F27-9C2605A29F52").
+//		Format(characteristic.FormatUInt16).
+//		Unit("watt").
+//		Range(0, 3000).
+//		Permissions(characteristic.PermissionRead, characteristic.PermissionEvents).
+//		Build()
+type Builder struct {
+	c   *C
+	val interface{}
+}
+
+// NewBuilder returns a builder for a characteristic of type typ.
+func NewBuilder(typ string) *Builder {
+	c := New()
+	c.Type = typ
+	c.Permissions = []string{PermissionRead}
+
+	return &Builder{c: c}
+}
+
+// Format sets the format (e.g. FormatFloat).
+func (b *Builder) Format(format string) *Builder {
+	b.c.Format = format
+	return b
+}
+
+// Unit sets the unit (e.g. UnitCelsius).
+func (b *Builder) Unit(unit string) *Builder {
+	b.c.Unit = unit
+	return b
+}
+
+// Description sets the manufacturer description.
+func (b *Builder) Description(d string) *Builder {
+	b.c.Description = d
+	return b
+}
+
+// Permissions sets the permissions. The default permission is PermissionRead.
+func (b *Builder) Permissions(perms ...string) *Builder {
+	b.c.Permissions = perms
+	return b
+}
+
+// Range sets the min and max value of a number.
+func (b *Builder) Range(min, max interface{}) *Builder {
+	b.c.MinVal = min
+	b.c.MaxVal = max
+	return b
+}
+
+// Step sets the step value of a number.
+func (b *Builder) Step(step interface{}) *Builder {
+	b.c.StepVal = step
+	return b
+}
+
+// MaxLen sets the maximum length of a string.
+func (b *Builder) MaxLen(n int) *Builder {
+	b.c.MaxLen = n
+	return b
+}
+
+// ValidValues sets the valid values of an integer.
+func (b *Builder) ValidValues(vs ...int) *Builder {
+	b.c.ValidVals = vs
+	return b
+}
+
+// Value sets the initial value. If no value is set,
+// the initial value is the zero value of the format.
+func (b *Builder) Value(v interface{}) *Builder {
+	b.val = v
+	return b
+}
+
+// Build returns the characteristic or an error,
+// if the type, format or initial value is invalid.
+func (b *Builder) Build() (*C, error) {
+	c := b.c
+	if !ValidType(c.Type) {
+		return nil, fmt.Errorf("invalid type %s", c.Type)
+	}
+
+	if err := c.normalizeRange(); err != nil {
+		return nil, err
+	}
+
+	// The zero value is clamped to the range.
+	v, clamp := b.val, false
+	if v == nil {
+		v, clamp = zeroValue(c.Format), true
+	}
+
+	if v == nil {
+		return nil, fmt.Errorf("invalid format %s", c.Format)
+	}
+
+	val, ok := c.validate(v, clamp, true)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %v", v)
+	}
+	c.Val = val
+
+	return c, nil
+}
+
+// normalizeRange converts the min, max and step value
+// to the type used for the format of c.
+func (c *C) normalizeRange() error {
+	vals := []*interface{}{&c.MinVal, &c.MaxVal, &c.StepVal}
+	for _, v := range vals {
+		if *v == nil {
+			continue
+		}
+
+		switch c.Format {
+		case FormatFloat, FormatUInt8, FormatUInt16, FormatUInt32, FormatUInt64, FormatInt32:
+			if !isNumber(*v) {
+				return fmt.Errorf("invalid range value %v", *v)
+			}
+			*v = c.convert(*v)
+		default:
+			return fmt.Errorf("range not supported for format %s", c.Format)
+		}
+	}
+
+	return nil
+}
+
+// zeroValue returns the zero value of the format
+// or nil, if the format is unknown.
+func zeroValue(format string) interface{} {
+	switch format {
+	case FormatBool:
+		return false
+	case FormatFloat:
+		return float64(0)
+	case FormatUInt8, FormatUInt16, FormatUInt32, FormatInt32:
+		return 0
+	case FormatUInt64:
+		return uint64(0)
+	case FormatString, FormatData, FormatTLV8:
+		return ""
+	default:
+		return nil
+	}
+}
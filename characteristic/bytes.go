@@ -3,6 +3,7 @@ package characteristic
 import (
 	"github.com/brutella/hap/log"
 
+	"context"
 	"encoding/base64"
 	"net/http"
 )
@@ -34,14 +35,14 @@ func (c *Bytes) Value() []byte {
 }
 
 // OnSetRemoteValue set c.SetValueRequestFunc and calls fn.
-// If the function returns an error, the code -70402 is
-// included in the HTTP response.
+// If the function returns an error, the code -70402 (or the code
+// of a StatusError) is included in the HTTP response.
 func (c *Bytes) OnSetRemoteValue(fn func(v []byte) error) {
 	c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
 		str, _ := base64.StdEncoding.DecodeString(v.(string))
 		if err := fn(str); err != nil {
 			log.Debug.Println(err)
-			return nil, -70402
+			return nil, codeForError(err)
 		}
 		return nil, 0
 	}
@@ -69,3 +70,58 @@ func (c *Bytes) OnValueUpdate(fn func(old, new []byte, r *http.Request)) {
 func base64FromBytes(v []byte) string {
 	return base64.StdEncoding.EncodeToString(v)
 }
+
+// OnWriteResponse sets c.SetValueRequestFunc and calls fn. The bytes returned
+// by fn are included in the HTTP response, if the controller requested a write
+// response. This requires the permission PermissionWriteResponse.
+func (c *Bytes) OnWriteResponse(fn func(ctx context.Context, v []byte) ([]byte, error)) {
+	c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
+		b, _ := base64.StdEncoding.DecodeString(v.(string))
+		resp, err := fn(requestContext(r), b)
+		if err != nil {
+			log.Debug.Println(err)
+			return nil, codeForError(err)
+		}
+		return base64FromBytes(resp), 0
+	}
+}
+
+// OnSetRemoteValueContext is like OnSetRemoteValue but passes the context
+// of the HTTP request to fn. The context is canceled when the controller
+// disconnects. If the function returns context.DeadlineExceeded,
+// the code -70408 (operation timed out) is included in the HTTP response.
+func (c *Bytes) OnSetRemoteValueContext(fn func(ctx context.Context, v []byte) error) {
+	c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
+		b, _ := base64.StdEncoding.DecodeString(v.(string))
+		if err := fn(requestContext(r), b); err != nil {
+			log.Debug.Println(err)
+			return nil, codeForError(err)
+		}
+		return nil, 0
+	}
+}
+
+// OnValueRemoteUpdateContext is like OnValueRemoteUpdate but passes the
+// context of the HTTP request to fn.
+func (c *Bytes) OnValueRemoteUpdateContext(fn func(ctx context.Context, v []byte)) {
+	c.OnValueUpdate(func(new, old []byte, r *http.Request) {
+		if r != nil {
+			fn(r.Context(), new)
+		}
+	})
+}
+
+// OnValueRequestContext sets c.ValueRequestFunc and calls fn when a
+// controller reads the value of c. The context is canceled when the
+// read times out (see hap.Server.ReadTimeout). If fn returns an error,
+// the code -70402 (or -70408 on timeout) is included in the HTTP response.
+func (c *Bytes) OnValueRequestContext(fn func(ctx context.Context) ([]byte, error)) {
+	c.ValueRequestFunc = func(r *http.Request) (interface{}, int) {
+		v, err := fn(requestContext(r))
+		if err != nil {
+			log.Debug.Println(err)
+			return nil, codeForError(err)
+		}
+		return base64FromBytes(v), 0
+	}
+}
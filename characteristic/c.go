@@ -113,6 +113,10 @@ type C struct {
 	// This flag is only used for programmable switch events.
 	updateOnSameValue bool
 
+	// Flag indicating if the characteristic only reports events
+	// and its value is null when read, e.g. programmable switch events.
+	eventOnly bool
+
 	// Stores which connected client has events enabled for this characteristic.
 	events map[string]bool
 
@@ -148,31 +152,26 @@ func (c *C) SetValueRequest(val interface{}, req *http.Request) (interface{}, in
 }
 
 func (c *C) setValue(v interface{}, req *http.Request) (interface{}, int) {
-	newVal := c.convert(v)
-	response := newVal
-	// Value must be within min and max
-	switch c.Format {
-	case FormatFloat:
-		newVal = c.clampFloat(newVal.(float64))
-	case FormatUInt8, FormatUInt16, FormatUInt32, FormatUInt64, FormatInt32:
-		newVal = c.clampInt(newVal.(int))
+	// Value must be valid and within min and max
+	newVal, ok := c.validate(v, true, req != nil)
+	if !ok {
+		return nil, -70410
 	}
+	response := newVal
 
 	c.m.Lock()
 	// reference old value
 	oldVal := c.Val
 	c.m.Unlock()
 
-	// ignore the same newVal
-	if oldVal == newVal && !c.updateOnSameValue {
+	// ignore the same newVal – except for write response and write-only
+	// characteristics, where every write request is handled (e.g. control
+	// points or remote keys)
+	if oldVal == newVal && !c.updateOnSameValue && !(req != nil && (c.IsWriteResponse() || c.IsWriteOnly())) {
 		// no error
 		return nil, 0
 	}
 
-	if !c.validVal(newVal) {
-		return nil, -70410
-	}
-
 	if c.SetValueRequestFunc != nil && req != nil {
 		v, c := c.SetValueRequestFunc(newVal, req)
 		if c != 0 {
@@ -222,10 +221,15 @@ func (c *C) Value() interface{} {
 	return c.Val
 }
 
+// SetEvent enables or disables events for the client at remoteAddr.
 func (c *C) SetEvent(remoteAddr string, enable bool) {
 	c.m.Lock()
 	defer c.m.Unlock()
-	c.events[remoteAddr] = enable
+	if enable {
+		c.events[remoteAddr] = true
+	} else {
+		delete(c.events, remoteAddr)
+	}
 }
 
 func (c *C) HasEventsEnabled(remoteAddr string) bool {
@@ -287,6 +291,12 @@ func (c *C) IsWriteResponse() bool {
 	return false
 }
 
+// IsEventOnly returns true if the value of the characteristic
+// is only meaningful in notifications and null when read.
+func (c *C) IsEventOnly() bool {
+	return c.eventOnly
+}
+
 // IsObservable returns true if clients are allowed
 // to observe the value of the characteristic.
 func (c *C) IsObservable() bool {
@@ -323,7 +333,7 @@ func (c *C) MarshalJSON() ([]byte, error) {
 		ValidRange  []int       `json:"valid-values-range,omitempty"`
 	}{
 		Id:          c.Id,
-		Type:        c.Type,
+		Type:        TypeString(c.Type),
 		Permissions: c.Permissions,
 		Description: c.Description,
 		Format:      c.Format,
@@ -386,8 +396,10 @@ func (c *C) convert(v interface{}) interface{} {
 	switch c.Format {
 	case FormatFloat:
 		return to.Float64(v)
-	case FormatUInt8, FormatUInt16, FormatUInt32, FormatInt32:
+	case FormatUInt8, FormatUInt16, FormatUInt32:
 		return int(to.Uint64(v))
+	case FormatInt32:
+		return int(to.Int64(v))
 	case FormatUInt64:
 		return to.Uint64(v)
 	case FormatBool:
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -100,6 +101,28 @@ func TestValueChange(t *testing.T) {
 	}
 }
 
+func TestEventOnly(t *testing.T) {
+	c := NewProgrammableSwitchEvent()
+	c.SetValue(ProgrammableSwitchEventDoublePress)
+
+	if is, want := c.IsEventOnly(), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := NewOn().IsEventOnly(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := strings.Contains(string(b), `"value":null`), true; is != want {
+		t.Fatalf("%v != %v: %s", is, want, b)
+	}
+}
+
 func TestValueIngoreValueUpdate(t *testing.T) {
 	c := NewBrightness()
 	c.Val = 5
@@ -255,3 +278,142 @@ func TestCharacteristicJson(t *testing.T) {
 		t.Fatalf("Identify characteristic cannot emit \"value\": %+v", jsonMap)
 	}
 }
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		c     *C
+		v     interface{}
+		clamp bool
+		want  interface{}
+		ok    bool
+	}{
+		{NewBrightness().C, float64(50), false, 50, true},
+		{NewBrightness().C, float64(120), true, 100, true},
+		{NewBrightness().C, float64(120), false, nil, false},
+		{NewBrightness().C, "50", true, nil, false},
+		{NewOn().C, float64(1), true, true, true},
+		{NewOn().C, float64(2), true, nil, false},
+		{NewHue().C, 120.4, true, float64(120), true},
+		{NewTargetTemperature().C, 21.26, true, 21.3, true},
+		{NewName().C, 5, true, nil, false},
+	}
+
+	for _, test := range tests {
+		v, ok := test.c.Validate(test.v, test.clamp)
+		if is, want := ok, test.ok; is != want {
+			t.Fatalf("%v: %v != %v", test.v, is, want)
+		}
+
+		if is, want := v, test.want; is != want {
+			t.Fatalf("%v: %v != %v", test.v, is, want)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	c, err := NewBuilder("e863f10d-079e-48ff-8f27-9c2605a29f52").
+		Format(FormatFloat).
+		Unit("watt").
+		Range(0, 3000).
+		Step(0.1).
+		Permissions(PermissionRead, PermissionEvents).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := c.MaxVal, float64(3000); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(b), `{"iid":0,"type":"E863F10D-079E-48FF-8F27-9C2605A29F52","perms":["pr","ev"],"format":"float","value":0,"unit":"watt","maxValue":3000,"minValue":0,"minStep":0.1}`; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := NewBuilder("invalid").Format(FormatBool).Build(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := NewBuilder("E863F10D-079E-48FF-8F27-9C2605A29F52").Format(FormatUInt8).Range(0, 10).Value(20).Build(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTypeString(t *testing.T) {
+	tests := []struct {
+		typ  string
+		want string
+	}{
+		{"25", "25"},
+		{"00000025-0000-1000-8000-0026BB765291", "25"},
+		{"0000003e-0000-1000-8000-0026bb765291", "3E"},
+		{"e863f10d-079e-48ff-8f27-9c2605a29f52", "E863F10D-079E-48FF-8F27-9C2605A29F52"},
+	}
+
+	for _, test := range tests {
+		if is, want := TypeString(test.typ), test.want; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+}
+
+func TestWriteOnlySameValue(t *testing.T) {
+	c := NewRemoteKey()
+
+	n := 0
+	c.OnValueRemoteUpdate(func(v int) {
+		n++
+	})
+
+	req := &http.Request{}
+	c.SetValueRequest(RemoteKeySelect, req)
+	c.SetValueRequest(RemoteKeySelect, req)
+
+	if is, want := n, 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	c := NewBrightness()
+
+	var es []ChangeEvent
+	c.OnChange(func(e ChangeEvent) {
+		es = append(es, e)
+	})
+
+	c.SetValue(10)
+
+	r := &http.Request{}
+	r = r.WithContext(WithPairingName(r.Context(), "Controller"))
+	c.SetValueRequest(20, r)
+
+	if is, want := len(es), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[0].Origin, OriginLocal; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[1].Origin, OriginRemote; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[1].Old, 10; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[1].New, 20; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := es[1].Pairing, "Controller"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
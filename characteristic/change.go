@@ -0,0 +1,66 @@
+package characteristic
+
+import (
+	"net/http"
+	"time"
+)
+
+// Origin is the origin of a value change.
+type Origin int
+
+const (
+	// OriginLocal is a change by the application, e.g. by calling SetValue.
+	OriginLocal Origin = iota
+	// OriginRemote is a change by a controller.
+	OriginRemote
+)
+
+func (o Origin) String() string {
+	switch o {
+	case OriginLocal:
+		return "local"
+	case OriginRemote:
+		return "remote"
+	default:
+		return "unknown"
+	}
+}
+
+// A ChangeEvent describes a change of the value of a characteristic.
+type ChangeEvent struct {
+	C      *C
+	Old    interface{}
+	New    interface{}
+	Time   time.Time // when the value changed
+	Origin Origin
+
+	// Pairing is the name of the controller, which changed
+	// the value. It is empty for local changes.
+	Pairing string
+
+	// Request is the request of the controller or nil.
+	Request *http.Request
+}
+
+// OnChange registers fn, which is called with a change event when the
+// value of c changes. The origin of the event can be used to prevent
+// loops, e.g. when a bridge mirrors the values of a physical device.
+func (c *C) OnChange(fn func(e ChangeEvent)) {
+	c.OnCValueUpdate(func(c *C, new, old interface{}, r *http.Request) {
+		e := ChangeEvent{
+			C:       c,
+			Old:     old,
+			New:     new,
+			Time:    time.Now(),
+			Origin:  OriginLocal,
+			Request: r,
+		}
+
+		if r != nil {
+			e.Origin = OriginRemote
+			e.Pairing = PairingName(r.Context())
+		}
+
+		fn(e)
+	})
+}
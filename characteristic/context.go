@@ -0,0 +1,77 @@
+package characteristic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	codeCommunicationFailure = -70402 // service communication failure
+	codeTimedOut             = -70408 // operation timed out
+)
+
+// requestContext returns the context of r.
+// If r is nil, the background context is returned.
+func requestContext(r *http.Request) context.Context {
+	if r == nil {
+		return context.Background()
+	}
+
+	return r.Context()
+}
+
+// StatusError is an error with a HAP status code.
+// If a callback returns a StatusError, its code is included
+// in the HTTP response, e.g. -70403 (resource busy).
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+// NewStatusError returns an error with the HAP status code.
+func NewStatusError(code int, err error) *StatusError {
+	return &StatusError{Code: code, Err: err}
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("hap status %d", e.Code)
+	}
+
+	return fmt.Sprintf("hap status %d: %v", e.Code, e.Err)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// codeForError returns the HAP status code for err.
+func codeForError(err error) int {
+	var serr *StatusError
+	if errors.As(err, &serr) && serr.Code != 0 {
+		return serr.Code
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codeTimedOut
+	}
+
+	return codeCommunicationFailure
+}
+
+type pairingNameKey struct{}
+
+// WithPairingName returns a copy of ctx, which contains the name of the
+// controller pairing. The server adds the name to the context of requests
+// from verified controllers, which is reported in change events.
+func WithPairingName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, pairingNameKey{}, name)
+}
+
+// PairingName returns the name of the controller pairing in ctx.
+func PairingName(ctx context.Context) string {
+	name, _ := ctx.Value(pairingNameKey{}).(string)
+	return name
+}
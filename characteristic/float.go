@@ -3,6 +3,7 @@ package characteristic
 import (
 	"github.com/brutella/hap/log"
 
+	"context"
 	"net/http"
 )
 
@@ -51,13 +52,13 @@ func (c *Float) StepValue() float64 {
 }
 
 // OnSetRemoteValue set c.SetValueRequestFunc and calls fn.
-// If the function returns an error, the code -70402 is
-// included in the HTTP response.
+// If the function returns an error, the code -70402 (or the code
+// of a StatusError) is included in the HTTP response.
 func (c *Float) OnSetRemoteValue(fn func(v float64) error) {
 	c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
 		if err := fn(v.(float64)); err != nil {
 			log.Debug.Println(err)
-			return nil, -70402
+			return nil, codeForError(err)
 		}
 		return nil, 0
 	}
@@ -79,3 +80,42 @@ func (c *Float) OnValueRemoteUpdate(fn func(v float64)) {
 		}
 	})
 }
+
+// OnSetRemoteValueContext is like OnSetRemoteValue but passes the context
+// of the HTTP request to fn. The context is canceled when the controller
+// disconnects. If the function returns context.DeadlineExceeded,
+// the code -70408 (operation timed out) is included in the HTTP response.
+func (c *Float) OnSetRemoteValueContext(fn func(ctx context.Context, v float64) error) {
+	c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
+		if err := fn(requestContext(r), v.(float64)); err != nil {
+			log.Debug.Println(err)
+			return nil, codeForError(err)
+		}
+		return nil, 0
+	}
+}
+
+// OnValueRemoteUpdateContext is like OnValueRemoteUpdate but passes the
+// context of the HTTP request to fn.
+func (c *Float) OnValueRemoteUpdateContext(fn func(ctx context.Context, v float64)) {
+	c.OnCValueUpdate(func(c *C, new, old interface{}, r *http.Request) {
+		if r != nil {
+			fn(r.Context(), new.(float64))
+		}
+	})
+}
+
+// OnValueRequestContext sets c.ValueRequestFunc and calls fn when a
+// controller reads the value of c. The context is canceled when the
+// read times out (see hap.Server.ReadTimeout). If fn returns an error,
+// the code -70402 (or -70408 on timeout) is included in the HTTP response.
+func (c *Float) OnValueRequestContext(fn func(ctx context.Context) (float64, error)) {
+	c.ValueRequestFunc = func(r *http.Request) (interface{}, int) {
+		v, err := fn(requestContext(r))
+		if err != nil {
+			log.Debug.Println(err)
+			return nil, codeForError(err)
+		}
+		return v, 0
+	}
+}
@@ -28,6 +28,7 @@ func NewProgrammableSwitchEvent() *ProgrammableSwitchEvent {
 	}
 
 	c.updateOnSameValue = true
+	c.eventOnly = true
 
 	return &ProgrammableSwitchEvent{c}
 }
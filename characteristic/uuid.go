@@ -0,0 +1,42 @@
+package characteristic
+
+import (
+	"regexp"
+	"strings"
+)
+
+// appleUUIDSuffix is the suffix of the UUIDs defined by Apple.
+const appleUUIDSuffix = "-0000-1000-8000-0026BB765291"
+
+var (
+	shortTypeRegexp = regexp.MustCompile(`^[0-9A-Fa-f]{1,8}$`)
+	uuidTypeRegexp  = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`)
+)
+
+// ValidType returns true if typ is a valid type of a characteristic
+// or service – either the short form of a type defined by Apple
+// (e.g. "25") or a full UUID (e.g. "E863F10A-079E-48FF-8F27-9C2605A29F52").
+func ValidType(typ string) bool {
+	return shortTypeRegexp.MatchString(typ) || uuidTypeRegexp.MatchString(typ)
+}
+
+// TypeString returns typ in the form used in the json representation
+// of accessories. Types defined by Apple are returned in the short
+// form without leading zeros, custom types as uppercase UUIDs.
+func TypeString(typ string) string {
+	if !uuidTypeRegexp.MatchString(typ) {
+		return typ
+	}
+
+	typ = strings.ToUpper(typ)
+	if !strings.HasSuffix(typ, appleUUIDSuffix) {
+		return typ
+	}
+
+	short := strings.TrimLeft(strings.TrimSuffix(typ, appleUUIDSuffix), "0")
+	if short == "" {
+		return "0"
+	}
+
+	return short
+}
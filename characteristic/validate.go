@@ -0,0 +1,122 @@
+package characteristic
+
+import (
+	"github.com/xiam/to"
+
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validate converts v to the format of c and checks it against the
+// min, max, step, maximum length and valid values of c.
+// Numbers are rounded to the step value. Numbers out of range are
+// clamped to the min and max value if clamp is true; otherwise
+// they are invalid. Validate returns false if v is invalid.
+func (c *C) Validate(v interface{}, clamp bool) (interface{}, bool) {
+	return c.validate(v, clamp, true)
+}
+
+// validate returns the value v in the format of c. If strict is true,
+// the type of v must match the format and numbers are rounded to the
+// step value. Values set by the application are not strictly validated.
+func (c *C) validate(v interface{}, clamp, strict bool) (interface{}, bool) {
+	if strict && !c.validType(v) {
+		return nil, false
+	}
+
+	val := c.convert(v)
+	switch c.Format {
+	case FormatFloat:
+		f := val.(float64)
+		if strict {
+			f = c.roundFloat(f)
+		}
+		if !clamp && c.clampFloat(f) != f {
+			return nil, false
+		}
+		val = c.clampFloat(f)
+	case FormatUInt8, FormatUInt16, FormatUInt32, FormatInt32:
+		i := val.(int)
+		if strict {
+			i = c.roundInt(i)
+		}
+		if !clamp && c.clampInt(i) != i {
+			return nil, false
+		}
+		val = c.clampInt(i)
+	case FormatString:
+		if s, ok := val.(string); ok && c.MaxLen > 0 && utf8.RuneCountInString(s) > c.MaxLen {
+			return nil, false
+		}
+	}
+
+	if !c.validVal(val) {
+		return nil, false
+	}
+
+	return val, true
+}
+
+// validType returns true if the type of v matches the format of c.
+func (c *C) validType(v interface{}) bool {
+	switch c.Format {
+	case FormatBool:
+		if _, ok := v.(bool); ok {
+			return true
+		}
+		// HAP accepts 0 and 1 as boolean values
+		if isNumber(v) {
+			f := to.Float64(v)
+			return f == 0 || f == 1
+		}
+		return false
+	case FormatFloat, FormatUInt8, FormatUInt16, FormatUInt32, FormatUInt64, FormatInt32:
+		return isNumber(v)
+	case FormatString, FormatData, FormatTLV8:
+		_, ok := v.(string)
+		return ok
+	default:
+		return true
+	}
+}
+
+// roundFloat rounds f to the step value of c.
+func (c *C) roundFloat(f float64) float64 {
+	step, ok := c.StepVal.(float64)
+	if !ok || step <= 0 {
+		return f
+	}
+
+	min, _ := c.MinVal.(float64)
+	f = min + math.Round((f-min)/step)*step
+
+	// remove rounding errors, e.g. 0.30000000000000004
+	str := strconv.FormatFloat(step, 'f', -1, 64)
+	if i := strings.Index(str, "."); i >= 0 {
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'f', len(str)-i-1, 64), 64)
+	}
+
+	return f
+}
+
+// roundInt rounds i to the step value of c.
+func (c *C) roundInt(i int) int {
+	step, ok := c.StepVal.(int)
+	if !ok || step <= 1 {
+		return i
+	}
+
+	min, _ := c.MinVal.(int)
+	return min + int(math.Round(float64(i-min)/float64(step)))*step
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	default:
+		return false
+	}
+}
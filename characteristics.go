@@ -1,16 +1,17 @@
 package hap
 
 import (
-	"time"
-
 	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/audit"
 	"github.com/brutella/hap/characteristic"
 	"github.com/brutella/hap/log"
 	"github.com/xiam/to"
 
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type characteristicData struct {
@@ -47,7 +48,7 @@ type putCharacteristicData struct {
 
 func (srv *Server) getCharacteristics(res http.ResponseWriter, req *http.Request) {
 	if !srv.IsAuthorized(req) {
-		log.Info.Printf("request from %s not authorized\n", req.RemoteAddr)
+		srv.logInfo(req).Printf("request from %s not authorized\n", req.RemoteAddr)
 		JsonError(res, JsonStatusInsufficientPrivileges)
 		return
 	}
@@ -85,7 +86,23 @@ func (srv *Server) getCharacteristics(res http.ResponseWriter, req *http.Request
 			continue
 		}
 
-		v, s := c.ValueRequest(req)
+		if a := srv.findA(cdata.Aid); a != nil && a.InMaintenance() {
+			err = true
+			status := a.MaintenanceStatusCode()
+			cdata.Status = &status
+			continue
+		}
+
+		if !srv.authorized(req, cdata.Aid, cdata.Iid, OpRead) {
+			err = true
+			status := JsonStatusInsufficientPrivileges
+			cdata.Status = &status
+			continue
+		}
+
+		start := time.Now()
+		v, s := srv.valueRequest(c, req)
+		srv.metrics.reads.observe(time.Since(start).Seconds())
 		if s != 0 {
 			err = true
 			cdata.Status = &s
@@ -138,7 +155,7 @@ func (srv *Server) getCharacteristics(res http.ResponseWriter, req *http.Request
 		Characteristics []*characteristicData `json:"characteristics"`
 	}{arr}
 
-	log.Debug.Println(toJSON(resp))
+	srv.logDebug(req).Println(toJSON(resp))
 
 	if err {
 		// when there's an error somewhere, "status: 0" must now be explicit
@@ -157,7 +174,8 @@ func (srv *Server) getCharacteristics(res http.ResponseWriter, req *http.Request
 
 func (srv *Server) putCharacteristics(res http.ResponseWriter, req *http.Request) {
 	if !srv.IsAuthorized(req) {
-		log.Info.Printf("request from %s not authorized\n", req.RemoteAddr)
+		srv.logInfo(req).Printf("request from %s not authorized\n", req.RemoteAddr)
+		srv.authFailed(req, "", "write: request not verified")
 		JsonError(res, JsonStatusInsufficientPrivileges)
 		return
 	}
@@ -173,10 +191,17 @@ func (srv *Server) putCharacteristics(res http.ResponseWriter, req *http.Request
 		return
 	}
 
-	timedWr := srv.TimedWrite(req)
-	log.Debug.Println(toJSON(data))
+	srv.logDebug(req).Println(toJSON(data))
+
+	// The timed write is checked once for all characteristics.
+	timedStatus := srv.timedWriteStatus(req, data.Pid)
+
+	subscribed := srv.hasSubscriptions(req.RemoteAddr)
+	subsChanged := false
 
 	arr := []*putCharacteristicData{}
+	all := []*putCharacteristicData{}
+	ws := []CharacteristicWrite{}
 	for _, d := range data.Cs {
 		c := srv.findC(d.Aid, d.Iid)
 
@@ -184,56 +209,71 @@ func (srv *Server) putCharacteristics(res http.ResponseWriter, req *http.Request
 			Aid: d.Aid,
 			Iid: d.Iid,
 		}
+		all = append(all, cdata)
 
-		if c == nil {
-			status := JsonStatusServiceCommunicationFailure
+		if status, ok := srv.available(d.Aid, c); !ok {
 			cdata.Status = &status
 			arr = append(arr, cdata)
+			srv.recordWrite(req, d, c, status)
 			continue
 		}
 
 		var value interface{}
-		var status int
-		if c.RequiresTimedWrite() {
-			if time.Now().After(timedWr.deadline) {
-				// HAP 6.7.2.4
-				// If the accessory receives an Execute Write Request after the TTL has expired it must ignore
-				// the request and respond with HAP status error code -70410 (HAPIPStatusErrorCodeInvalidWrite).
-				log.Info.Println("timed write wall time exceeded")
-				status = -70410
-			}
-			if data.Pid != timedWr.pid {
-				// HAP 6.7.2.4
-				// If the accessory receives a standard write request on a characteristic which requires timed write,
-				// the accessory must respond with HAP status error code -70410 (HAPIPStatusErrorCodeInvalidWrite).
-				log.Info.Println("timed write transaction id invalid")
-				status = -70410
+		status := timedStatus
+		if d.Value != nil && status == 0 && c.RequiresTimedWrite() && data.Pid == 0 {
+			// HAP 6.7.2.4
+			// If the accessory receives a standard write request on a characteristic which requires timed write,
+			// the accessory must respond with HAP status error code -70410 (HAPIPStatusErrorCodeInvalidWrite).
+			srv.logInfo(req).With(log.F("aid", d.Aid), log.F("iid", d.Iid)).Println("timed write required")
+			status = JsonStatusInvalidValueInRequest
+		}
+
+		if d.Value != nil && status == 0 && !srv.authorized(req, d.Aid, d.Iid, OpWrite) {
+			status = JsonStatusInsufficientPrivileges
+		}
+
+		if d.Value != nil && status == 0 && srv.RejectOutOfRange && c.IsWritable() {
+			if _, ok := c.Validate(d.Value, false); !ok {
+				status = JsonStatusInvalidValueInRequest
 			}
 		}
 
 		if d.Value != nil && status == 0 {
+			start := time.Now()
 			value, status = c.SetValueRequest(d.Value, req)
+			srv.metrics.writes.observe(time.Since(start).Seconds())
+
+			if status == 0 {
+				ws = append(ws, CharacteristicWrite{srv.findA(d.Aid), c, c.Value()})
+			}
 		}
 
 		if status != 0 {
 			cdata.Status = &status
 		}
 
-		if (d.Response != nil || c.IsWriteResponse()) && value != nil {
-			cdata.Value = value
+		srv.recordWrite(req, d, c, status)
 
-			if c.IsWriteResponse() {
-				cdata.Status = &status
-			}
+		// HAP 6.7.2.5
+		// The response value of a write response characteristic is
+		// only included if the controller requested it with "r".
+		if d.Response != nil && *d.Response && c.IsWriteResponse() && d.Value != nil && status == 0 {
+			cdata.Value = value
+			cdata.Status = &status
 		}
 
 		if d.Events != nil {
 			if !c.IsObservable() {
 				status := JsonStatusNotificationNotSupported
 				cdata.Status = &status
-				arr = append(arr, cdata)
+			} else if !srv.authorized(req, d.Aid, d.Iid, OpSubscribe) {
+				status := JsonStatusInsufficientPrivileges
+				cdata.Status = &status
 			} else {
 				c.SetEvent(req.RemoteAddr, *d.Events)
+				if srv.setSubscription(req, d.Aid, d.Iid, *d.Events) {
+					subsChanged = true
+				}
 			}
 		}
 
@@ -242,27 +282,145 @@ func (srv *Server) putCharacteristics(res http.ResponseWriter, req *http.Request
 		}
 	}
 
-	srv.DelTimedWrite(req)
+	srv.writeBatch(ws)
+
+	if subsChanged {
+		srv.saveSubscriptions()
+	}
+
+	if subscribed && !srv.hasSubscriptions(req.RemoteAddr) {
+		if ss, err := srv.getSession(reqConn(req)); err == nil {
+			srv.unsubscribed(req.RemoteAddr, ss.Pairing)
+		}
+	}
 
 	if len(arr) == 0 {
 		res.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	// HAP 6.7.2.2
+	// If a write fails, the response must contain the status
+	// of every characteristic, including "status: 0" on success.
+	if hasError(arr) {
+		noError := 0
+		for _, c := range all {
+			if c.Status == nil {
+				c.Status = &noError
+			}
+		}
+		arr = all
+	}
+
 	resp := struct {
 		Characteristics []*putCharacteristicData `json:"characteristics"`
 	}{arr}
 
-	log.Debug.Println(toJSON(resp))
+	srv.logDebug(req).Println(toJSON(resp))
 	JsonMultiStatus(res, resp)
 }
 
-func (srv *Server) findC(aid, iid uint64) *characteristic.C {
+// available returns false and the status of the response,
+// if c doesn't exist or its accessory is in maintenance.
+func (srv *Server) available(aid uint64, c *characteristic.C) (int, bool) {
+	if c == nil {
+		return JsonStatusServiceCommunicationFailure, false
+	}
+
+	if a := srv.findA(aid); a != nil && a.InMaintenance() {
+		return a.MaintenanceStatusCode(), false
+	}
+
+	return 0, true
+}
+
+// recordWrite records the write d with the final status, if d
+// contains a value. Rejected writes are recorded too.
+// c is nil if the characteristic doesn't exist.
+func (srv *Server) recordWrite(req *http.Request, d putCharacteristicData, c *characteristic.C, status int) {
+	if d.Value == nil {
+		return
+	}
+
+	e := audit.Event{
+		Kind:   audit.Write,
+		Aid:    d.Aid,
+		Iid:    d.Iid,
+		Value:  d.Value,
+		Status: status,
+	}
+	if c != nil {
+		e.Type = c.Type
+	}
+
+	srv.recordRequest(req, e)
+}
+
+// valueRequest returns the value of c. If the read takes
+// longer than srv.ReadTimeout, the status JsonStatusOperationTimedOut
+// is returned and the context of the request is canceled.
+func (srv *Server) valueRequest(c *characteristic.C, req *http.Request) (interface{}, int) {
+	if srv.ReadTimeout <= 0 || c.ValueRequestFunc == nil {
+		return c.ValueRequest(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), srv.ReadTimeout)
+	defer cancel()
+
+	type result struct {
+		v      interface{}
+		status int
+	}
+	ch := make(chan result, 1)
+	go func() {
+		v, status := c.ValueRequest(req.WithContext(ctx))
+		ch <- result{v, status}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.v, r.status
+	case <-ctx.Done():
+		srv.logInfo(req).With(log.F("iid", c.Id)).Println("read timed out")
+		return nil, JsonStatusOperationTimedOut
+	}
+}
+
+// hasError returns true if the status of a write is not 0.
+func hasError(arr []*putCharacteristicData) bool {
+	for _, c := range arr {
+		if c.Status != nil && *c.Status != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// accessories returns the main accessory and the bridged accessories.
+func (srv *Server) accessories() []*accessory.A {
+	srv.amux.RLock()
+	defer srv.amux.RUnlock()
+
 	var as []*accessory.A
 	as = append(as, srv.a)
 	as = append(as, srv.as[:]...)
 
-	for _, a := range as {
+	return as
+}
+
+func (srv *Server) findA(aid uint64) *accessory.A {
+	for _, a := range srv.accessories() {
+		if a.Id == aid {
+			return a
+		}
+	}
+
+	return nil
+}
+
+func (srv *Server) findC(aid, iid uint64) *characteristic.C {
+	for _, a := range srv.accessories() {
 		if a.Id == aid {
 			for _, s := range a.Ss {
 				for _, c := range s.Cs {
@@ -277,9 +435,39 @@ func (srv *Server) findC(aid, iid uint64) *characteristic.C {
 	return nil
 }
 
+// timedWriteStatus returns the status of a write request with the
+// transaction id pid. If pid is not 0, the request executes the timed
+// write, which must have been prepared with the same pid before its
+// ttl expired. The prepared timed write is consumed by the request.
+func (srv *Server) timedWriteStatus(req *http.Request, pid uint64) int {
+	if pid == 0 {
+		return 0
+	}
+
+	twr := srv.TimedWrite(req)
+	srv.DelTimedWrite(req)
+
+	switch {
+	case twr == nil || twr.pid != pid:
+		// HAP 6.7.2.4
+		// If the transaction id doesn't match the prepared timed write,
+		// the accessory must respond with HAP status error code -70410.
+		srv.logInfo(req).Println("timed write transaction id invalid")
+		return JsonStatusInvalidValueInRequest
+	case time.Now().After(twr.deadline):
+		// HAP 6.7.2.4
+		// If the accessory receives an Execute Write Request after the TTL has expired it must ignore
+		// the request and respond with HAP status error code -70410 (HAPIPStatusErrorCodeInvalidWrite).
+		srv.logInfo(req).Println("timed write wall time exceeded")
+		return JsonStatusInvalidValueInRequest
+	}
+
+	return 0
+}
+
 func (srv *Server) prepareCharacteristics(res http.ResponseWriter, req *http.Request) {
 	if !srv.IsAuthorized(req) {
-		log.Info.Printf("request from %s not authorized\n", req.RemoteAddr)
+		srv.logInfo(req).Printf("request from %s not authorized\n", req.RemoteAddr)
 		JsonError(res, JsonStatusInsufficientPrivileges)
 		return
 	}
@@ -300,6 +488,6 @@ func (srv *Server) prepareCharacteristics(res http.ResponseWriter, req *http.Req
 	resp := struct {
 		Status int `json:"status"`
 	}{0}
-	log.Debug.Println(toJSON(resp))
+	srv.logDebug(req).Println(toJSON(resp))
 	JsonOK(res, resp)
 }
@@ -0,0 +1,154 @@
+// hapgen generates the characteristic and service packages from HomeKit metadata.
+//
+// The metadata file is created by running the following command on macOS
+//
+//	plutil -convert json -r -o gen/metadata.json /Applications/HomeKit\ Accessory\ Simulator.app/Contents/Frameworks/HAPAccessoryKit.framework/Versions/A/Resources/default.metadata.plist
+//
+// Custom characteristics and services are defined in a separate file with
+// the same structure, which is merged into the metadata. Entries with the
+// same UUID replace the entries of the metadata.
+//
+//	go run ./cmd/hapgen -custom custom.json
+package main
+
+import (
+	"github.com/brutella/hap/gen"
+	"github.com/brutella/hap/gen/golang"
+
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var (
+		dir        = flag.String("dir", ".", "root directory of the hap module")
+		metadata   = flag.String("metadata", "", "metadata file (default <dir>/gen/metadata.json)")
+		custom     = flag.String("custom", "", "metadata file with custom characteristics and services")
+		categories = flag.Bool("categories", false, "generate the accessory categories")
+	)
+	flag.Parse()
+
+	if *metadata == "" {
+		*metadata = filepath.Join(*dir, "gen", "metadata.json")
+	}
+
+	m, err := readMetadata(*metadata)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *custom != "" {
+		c, err := readMetadata(*custom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		merge(m, c)
+	}
+
+	for _, char := range m.Characteristics {
+		b, err := golang.CharacteristicGoCode(char)
+		if err != nil {
+			log.Fatalf("characteristic %s: %v", char.Name, err)
+		}
+
+		if err := write(filepath.Join(*dir, "characteristic", golang.CharacteristicFileName(char)), b); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, svc := range m.Services {
+		b, err := golang.ServiceGoCode(svc, m.Characteristics)
+		if err != nil {
+			log.Fatalf("service %s: %v", svc.Name, err)
+		}
+
+		if err := write(filepath.Join(*dir, "service", golang.ServiceFileName(svc)), b); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *categories {
+		b, err := golang.CategoriesGoCode(m.Categories)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := write(filepath.Join(*dir, "accessory", "constant.go"), b); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func readMetadata(path string) (*gen.Metadata, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := gen.Metadata{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return &m, nil
+}
+
+// merge adds the characteristics and services of c to m.
+func merge(m, c *gen.Metadata) {
+	for _, char := range c.Characteristics {
+		i := indexOfChar(m.Characteristics, char.UUID)
+		if i < 0 {
+			m.Characteristics = append(m.Characteristics, char)
+		} else {
+			m.Characteristics[i] = char
+		}
+	}
+
+	for _, svc := range c.Services {
+		i := indexOfService(m.Services, svc.UUID)
+		if i < 0 {
+			m.Services = append(m.Services, svc)
+		} else {
+			m.Services[i] = svc
+		}
+	}
+
+	m.Categories = append(m.Categories, c.Categories...)
+}
+
+func indexOfChar(chars []*gen.CharacteristicMetadata, uuid string) int {
+	for i, c := range chars {
+		if strings.EqualFold(c.UUID, uuid) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func indexOfService(svcs []*gen.ServiceMetadata, uuid string) int {
+	for i, s := range svcs {
+		if strings.EqualFold(s.UUID, uuid) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// write formats the go code b and writes it to path.
+func write(path string, b []byte) error {
+	src, err := format.Source(b)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	log.Println("Creating file", path)
+	return ioutil.WriteFile(path, src, 0644)
+}
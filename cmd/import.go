@@ -2,6 +2,7 @@
 
 // Imports HomeKit metadata from a file and creates files for every characteristic and service.
 // It finishes by running `go fmt` in the characterist and service packages.
+// Deprecated: use `go run ./cmd/hapgen` instead.
 //
 // The metadata file is created by running the following command on OS X
 //
@@ -0,0 +1,263 @@
+// Package coap implements the message format of the
+// Constrained Application Protocol (RFC 7252).
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type is the type of a message.
+type Type uint8
+
+const (
+	Confirmable     Type = 0
+	NonConfirmable  Type = 1
+	Acknowledgement Type = 2
+	Reset           Type = 3
+)
+
+// Code is the method or response code of a message ("c.dd").
+type Code uint8
+
+// Method codes
+const (
+	GET    Code = 0x01
+	POST   Code = 0x02
+	PUT    Code = 0x03
+	DELETE Code = 0x04
+)
+
+// Response codes
+const (
+	Created                  Code = 0x41 // 2.01
+	Deleted                  Code = 0x42 // 2.02
+	Changed                  Code = 0x44 // 2.04
+	Content                  Code = 0x45 // 2.05
+	BadRequest               Code = 0x80 // 4.00
+	Unauthorized             Code = 0x81 // 4.01
+	Forbidden                Code = 0x83 // 4.03
+	NotFound                 Code = 0x84 // 4.04
+	MethodNotAllowed         Code = 0x85 // 4.05
+	RequestEntityTooLarge    Code = 0x8d // 4.13
+	UnsupportedContentFormat Code = 0x8f // 4.15
+	UnprocessableEntity      Code = 0x96 // 4.22
+	InternalServerError      Code = 0xa0 // 5.00
+	ServiceUnavailable       Code = 0xa3 // 5.03
+)
+
+// IsRequest returns true if c is a method code.
+func (c Code) IsRequest() bool {
+	return c > 0 && c < 0x20
+}
+
+func (c Code) String() string {
+	return fmt.Sprintf("%d.%02d", c>>5, c&0x1f)
+}
+
+// Option numbers
+const (
+	URIPath       uint16 = 11
+	ContentFormat uint16 = 12
+	URIQuery      uint16 = 15
+)
+
+// Option is an option of a message.
+type Option struct {
+	Number uint16
+	Value  []byte
+}
+
+// Message is a CoAP message.
+type Message struct {
+	Type      Type
+	Code      Code
+	MessageID uint16
+	Token     []byte
+	Options   []Option
+	Payload   []byte
+}
+
+var errInvalidMessage = errors.New("coap: invalid message")
+
+// Path returns the path of the Uri-Path options (e.g. "/characteristics").
+func (m *Message) Path() string {
+	return "/" + strings.Join(m.values(URIPath), "/")
+}
+
+// SetPath sets the Uri-Path options from the path.
+func (m *Message) SetPath(path string) {
+	m.remove(URIPath)
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if seg != "" {
+			m.Options = append(m.Options, Option{URIPath, []byte(seg)})
+		}
+	}
+}
+
+// Query returns the query of the Uri-Query options (e.g. "id=1.2&ev=1").
+func (m *Message) Query() string {
+	return strings.Join(m.values(URIQuery), "&")
+}
+
+// SetQuery sets the Uri-Query options from the query.
+func (m *Message) SetQuery(query string) {
+	m.remove(URIQuery)
+	for _, kv := range strings.Split(query, "&") {
+		if kv != "" {
+			m.Options = append(m.Options, Option{URIQuery, []byte(kv)})
+		}
+	}
+}
+
+func (m *Message) values(number uint16) []string {
+	var vs []string
+	for _, o := range m.Options {
+		if o.Number == number {
+			vs = append(vs, string(o.Value))
+		}
+	}
+
+	return vs
+}
+
+func (m *Message) remove(number uint16) {
+	var os []Option
+	for _, o := range m.Options {
+		if o.Number != number {
+			os = append(os, o)
+		}
+	}
+	m.Options = os
+}
+
+// MarshalBinary returns the message in wire format.
+func (m Message) MarshalBinary() ([]byte, error) {
+	if len(m.Token) > 8 {
+		return nil, fmt.Errorf("coap: invalid token length %d", len(m.Token))
+	}
+
+	b := make([]byte, 4, 4+len(m.Token)+len(m.Payload)+16)
+	b[0] = 1<<6 | byte(m.Type)<<4 | byte(len(m.Token))
+	b[1] = byte(m.Code)
+	binary.BigEndian.PutUint16(b[2:], m.MessageID)
+	b = append(b, m.Token...)
+
+	os := make([]Option, len(m.Options))
+	copy(os, m.Options)
+	sort.SliceStable(os, func(i, j int) bool {
+		return os[i].Number < os[j].Number
+	})
+
+	var prev uint16
+	for _, o := range os {
+		delta, dext := extend(int(o.Number - prev))
+		length, lext := extend(len(o.Value))
+		b = append(b, delta<<4|length)
+		b = append(b, dext...)
+		b = append(b, lext...)
+		b = append(b, o.Value...)
+		prev = o.Number
+	}
+
+	if len(m.Payload) > 0 {
+		b = append(b, 0xff)
+		b = append(b, m.Payload...)
+	}
+
+	return b, nil
+}
+
+// extend returns the 4-bit value and the extended bytes of an option delta or length.
+func extend(v int) (byte, []byte) {
+	switch {
+	case v < 13:
+		return byte(v), nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	default:
+		ext := make([]byte, 2)
+		binary.BigEndian.PutUint16(ext, uint16(v-269))
+		return 14, ext
+	}
+}
+
+// UnmarshalBinary parses the message in wire format.
+func (m *Message) UnmarshalBinary(b []byte) error {
+	if len(b) < 4 || b[0]>>6 != 1 {
+		return errInvalidMessage
+	}
+
+	tkl := int(b[0] & 0x0f)
+	if tkl > 8 || len(b) < 4+tkl {
+		return errInvalidMessage
+	}
+
+	*m = Message{
+		Type:      Type(b[0] >> 4 & 0x03),
+		Code:      Code(b[1]),
+		MessageID: binary.BigEndian.Uint16(b[2:]),
+		Token:     append([]byte{}, b[4:4+tkl]...),
+	}
+
+	b = b[4+tkl:]
+	var number int
+	for len(b) > 0 {
+		if b[0] == 0xff {
+			if len(b) == 1 {
+				// payload marker without payload
+				return errInvalidMessage
+			}
+			m.Payload = append([]byte{}, b[1:]...)
+			break
+		}
+
+		delta, length := int(b[0]>>4), int(b[0]&0x0f)
+		b = b[1:]
+
+		var err error
+		if delta, b, err = extended(delta, b); err != nil {
+			return err
+		}
+		if length, b, err = extended(length, b); err != nil {
+			return err
+		}
+
+		if len(b) < length {
+			return errInvalidMessage
+		}
+
+		number += delta
+		if number > 0xffff {
+			return errInvalidMessage
+		}
+		m.Options = append(m.Options, Option{uint16(number), append([]byte{}, b[:length]...)})
+		b = b[length:]
+	}
+
+	return nil
+}
+
+// extended returns the value of an option delta or length
+// with the extended bytes and the remaining bytes.
+func extended(v int, b []byte) (int, []byte, error) {
+	switch v {
+	case 13:
+		if len(b) < 1 {
+			return 0, nil, errInvalidMessage
+		}
+		return int(b[0]) + 13, b[1:], nil
+	case 14:
+		if len(b) < 2 {
+			return 0, nil, errInvalidMessage
+		}
+		return int(binary.BigEndian.Uint16(b)) + 269, b[2:], nil
+	case 15:
+		return 0, nil, errInvalidMessage
+	}
+
+	return v, b, nil
+}
@@ -0,0 +1,104 @@
+package coap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundtrip(t *testing.T) {
+	m := Message{
+		Type:      Confirmable,
+		Code:      GET,
+		MessageID: 0x1234,
+		Token:     []byte{0x01, 0x02},
+		Payload:   []byte("{}"),
+	}
+	m.SetPath("/characteristics")
+	m.SetQuery("id=1.10&ev=1")
+	// option with an extended length
+	m.Options = append(m.Options, Option{Number: 300, Value: bytes.Repeat([]byte{0xaa}, 20)})
+
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n Message
+	if err := n.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := n.Path(), "/characteristics"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := n.Query(), "id=1.10&ev=1"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := n.MessageID, m.MessageID; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := n.Token, m.Token; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := n.Payload, m.Payload; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(n.Options[len(n.Options)-1].Value), 20; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	// CON GET /a with token 0x7a and message id 1
+	b := []byte{0x41, 0x01, 0x00, 0x01, 0x7a, 0xb1, 'a'}
+
+	var m Message
+	if err := m.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := m.Type, Confirmable; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := m.Code, GET; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := m.Path(), "/a"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	tests := [][]byte{
+		{},
+		{0x81, 0x01, 0x00, 0x01},       // version 2
+		{0x49, 0x01, 0x00, 0x01},       // token length 9
+		{0x40, 0x01, 0x00, 0x01, 0xff}, // payload marker without payload
+		{0x40, 0x01, 0x00, 0x01, 0xb5}, // option too short
+		{0x40, 0x01, 0x00, 0x01, 0xf0}, // reserved option delta
+	}
+
+	for _, b := range tests {
+		var m Message
+		if err := m.UnmarshalBinary(b); err == nil {
+			t.Fatalf("expected error for %x", b)
+		}
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	if is, want := Content.String(), "2.05"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := UnprocessableEntity.String(), "4.22"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
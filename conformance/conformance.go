@@ -0,0 +1,618 @@
+// Package conformance provides an end-to-end test of the HomeKit Accessory
+// Protocol. It uses the controller of package hapctl to pair with an
+// accessory server and verifies pairing, error handling, timed writes,
+// event notifications and session setup.
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T) conformance.Target {
+//			addr := serve(t) // starts a new unpaired server
+//			return conformance.Target{Addr: addr, Pin: "00102003"}
+//		})
+//	}
+//
+// The accessory must have at least one characteristic with the permissions
+// "pr", "pw" and "ev" and a boolean or integer value, and one read-only
+// characteristic. The test of timed writes for characteristics with the
+// permission "tw" is skipped if the accessory has no such characteristic.
+package conformance
+
+import (
+	"github.com/brutella/hap/hapctl"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Target is an accessory server under test.
+type Target struct {
+	// Addr is the address ("host:port") of the server.
+	Addr string
+
+	// Pin is the setup code of the accessory.
+	Pin string
+}
+
+// timeout is the timeout of every subtest.
+const timeout = 10 * time.Second
+
+// backoff is the duration after which a failed
+// pairing attempt is retried.
+const backoff = 250 * time.Millisecond
+
+// quiet is the duration in which no event is expected.
+const quiet = 200 * time.Millisecond
+
+// HAP status codes
+const (
+	statusInsufficientPrivileges = -70401
+	statusReadOnly               = -70404
+	statusInvalidValue           = -70410
+)
+
+// TLV error codes
+const (
+	tlvErrorAuthentication = 0x02
+	tlvErrorBackoff        = 0x03
+	tlvErrorUnavailable    = 0x06
+	tlvErrorBusy           = 0x07
+)
+
+// Run runs the conformance test against the servers returned by
+// newTarget. Every subtest calls newTarget once and expects a new
+// unpaired server, which must be stopped by a cleanup function of t.
+func Run(t *testing.T, newTarget func(t *testing.T) Target) {
+	t.Run("pair setup", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		_, _, c := pair(ctx, t, newTarget(t))
+
+		as, err := c.Accessories(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(as) == 0 {
+			t.Fatal("no accessories")
+		}
+	})
+
+	t.Run("pair setup with invalid pin", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		tg := newTarget(t)
+		ctl := controller(t, "Controller")
+		_, err := ctl.PairSetup(ctx, tg.Addr, invalidPin(tg.Pin))
+		tlvError(t, err, tlvErrorAuthentication)
+
+		// pairing with the valid pin is still possible after the
+		// backoff or when the failed pairing attempt has ended
+		for {
+			_, err := ctl.PairSetup(ctx, tg.Addr, tg.Pin)
+			if err == nil {
+				break
+			}
+
+			var terr *hapctl.TLVError
+			if !errors.As(err, &terr) || (terr.Code != tlvErrorBackoff && terr.Code != tlvErrorBusy) {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		}
+	})
+
+	t.Run("pair setup when paired", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		tg := newTarget(t)
+		pair(ctx, t, tg)
+
+		_, err := controller(t, "Other").PairSetup(ctx, tg.Addr, tg.Pin)
+		tlvError(t, err, tlvErrorUnavailable)
+	})
+
+	t.Run("pair verify with unknown controller", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		tg := newTarget(t)
+		_, p, _ := pair(ctx, t, tg)
+
+		if _, err := controller(t, "Other").Dial(ctx, tg.Addr, p); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("unverified request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		tg := newTarget(t)
+		pair(ctx, t, tg)
+
+		for _, path := range []string{"/accessories", "/characteristics?id=1.1"} {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+tg.Addr+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var v struct {
+				Status int `json:"status"`
+			}
+			if err := json.Unmarshal(b, &v); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+
+			if is, want := v.Status, statusInsufficientPrivileges; is != want {
+				t.Fatalf("%s: %v != %v", path, is, want)
+			}
+		}
+	})
+
+	t.Run("write read-only characteristic", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		_, _, c := pair(ctx, t, newTarget(t))
+
+		ch := find(ctx, t, c, readOnly)
+		if ch == nil {
+			t.Fatal("no read-only characteristic")
+		}
+
+		err := c.Put(ctx, hapctl.Value{ID: ch.ID, Value: ch.Value})
+		statusError(t, err, statusReadOnly)
+	})
+
+	t.Run("unknown characteristic", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		_, _, c := pair(ctx, t, newTarget(t))
+
+		id := hapctl.ID{Aid: 1, Iid: 0xffff}
+		if err := c.Put(ctx, hapctl.Value{ID: id, Value: 1}); err == nil {
+			t.Fatal("expected error")
+		}
+
+		if _, err := c.Get(ctx, id); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("timed write", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		_, _, c := pair(ctx, t, newTarget(t))
+
+		ch := find(ctx, t, c, writable)
+		if ch == nil {
+			t.Fatal("no writable characteristic")
+		}
+
+		v := toggle(ch.Value)
+		if err := c.PutTimed(ctx, time.Second, hapctl.Value{ID: ch.ID, Value: v}); err != nil {
+			t.Fatal(err)
+		}
+
+		vs, err := c.Get(ctx, ch.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := fmt.Sprint(vs[0].Value), fmt.Sprint(v); is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		// the prepared write is consumed
+		pid, err := c.Prepare(ctx, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.PutPrepared(ctx, pid, hapctl.Value{ID: ch.ID, Value: ch.Value}); err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.PutPrepared(ctx, pid, hapctl.Value{ID: ch.ID, Value: v})
+		statusError(t, err, statusInvalidValue)
+	})
+
+	t.Run("expired timed write", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		_, _, c := pair(ctx, t, newTarget(t))
+
+		ch := find(ctx, t, c, writable)
+		if ch == nil {
+			t.Fatal("no writable characteristic")
+		}
+
+		pid, err := c.Prepare(ctx, time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		err = c.PutPrepared(ctx, pid, hapctl.Value{ID: ch.ID, Value: toggle(ch.Value)})
+		statusError(t, err, statusInvalidValue)
+	})
+
+	t.Run("timed write required", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		_, _, c := pair(ctx, t, newTarget(t))
+
+		ch := find(ctx, t, c, func(ch hapctl.Characteristic) bool {
+			return has(ch, "pw") && has(ch, "tw")
+		})
+		if ch == nil {
+			t.Skip("no characteristic with timed write permission")
+		}
+
+		err := c.Put(ctx, hapctl.Value{ID: ch.ID, Value: ch.Value})
+		statusError(t, err, statusInvalidValue)
+
+		if err := c.PutTimed(ctx, time.Second, hapctl.Value{ID: ch.ID, Value: ch.Value}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		tg := newTarget(t)
+		_, p, c1 := pair(ctx, t, tg)
+		_, c2 := addController(ctx, t, tg, p, c1, "Other", false)
+
+		events1, events2 := events(c1), events(c2)
+
+		ch := find(ctx, t, c1, writable)
+		if ch == nil {
+			t.Fatal("no writable characteristic")
+		}
+
+		if err := c1.Subscribe(ctx, ch.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c2.Subscribe(ctx, ch.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		v := toggle(ch.Value)
+		if err := c1.Put(ctx, hapctl.Value{ID: ch.ID, Value: v}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case e := <-events2:
+			if is, want := e.ID, ch.ID; is != want {
+				t.Fatalf("%v != %v", is, want)
+			}
+			if is, want := fmt.Sprint(e.Value), fmt.Sprint(v); is != want {
+				t.Fatalf("%v != %v", is, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+
+		// the controller, which changed the value, is not notified
+		select {
+		case e := <-events1:
+			t.Fatalf("unexpected event %v", e)
+		case <-time.After(quiet):
+		}
+
+		if err := c2.Unsubscribe(ctx, ch.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c1.Put(ctx, hapctl.Value{ID: ch.ID, Value: ch.Value}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case e := <-events2:
+			t.Fatalf("unexpected event %v", e)
+		case <-time.After(quiet):
+		}
+	})
+
+	t.Run("session renegotiation", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		tg := newTarget(t)
+		ctl, p, c := pair(ctx, t, tg)
+		c.Close()
+
+		// consecutive sessions
+		for i := 0; i < 3; i++ {
+			c, err := ctl.Dial(ctx, tg.Addr, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := c.Accessories(ctx); err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+		}
+
+		// concurrent sessions
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c, err := ctl.Dial(ctx, tg.Addr, p)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer c.Close()
+
+				for j := 0; j < 5; j++ {
+					if _, err := c.Accessories(ctx); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("pairings", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		tg := newTarget(t)
+		_, p, admin := pair(ctx, t, tg)
+		userCtl, user := addController(ctx, t, tg, p, admin, "User", false)
+
+		ps, err := admin.ListPairings(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		perms := map[string]bool{}
+		for _, p := range ps {
+			perms[p.ID] = p.Admin
+		}
+
+		if is, want := fmt.Sprint(perms), fmt.Sprint(map[string]bool{"Controller": true, "User": false}); is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		// non-admin controllers cannot change pairings
+		other := controller(t, "Other")
+		err = user.AddPairing(ctx, hapctl.ControllerPairing{ID: other.ID, PublicKey: other.PublicKey})
+		tlvError(t, err, tlvErrorAuthentication)
+
+		err = user.RemovePairing(ctx, "Controller")
+		tlvError(t, err, tlvErrorAuthentication)
+
+		// removing a pairing closes the connections of the controller
+		if err := admin.RemovePairing(ctx, "User"); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-user.Done():
+		case <-ctx.Done():
+			t.Fatal("connection not closed")
+		}
+
+		if _, err := userCtl.Dial(ctx, tg.Addr, p); err == nil {
+			t.Fatal("expected error")
+		}
+
+		// the admin connection is still usable
+		if _, err := admin.Accessories(ctx); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// controller returns a new controller with the identifier id.
+func controller(t *testing.T, id string) *hapctl.Controller {
+	ctl, err := hapctl.NewController(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ctl
+}
+
+// pair pairs the admin controller "Controller" with the target
+// and returns the controller, the pairing and the verified connection.
+func pair(ctx context.Context, t *testing.T, tg Target) (*hapctl.Controller, hapctl.Pairing, *hapctl.Conn) {
+	ctl := controller(t, "Controller")
+	p, err := ctl.PairSetup(ctx, tg.Addr, tg.Pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ctl, p, dial(ctx, t, ctl, tg, p)
+}
+
+// addController adds a controller with the identifier id via
+// admin and returns the controller and its verified connection.
+func addController(ctx context.Context, t *testing.T, tg Target, p hapctl.Pairing, admin *hapctl.Conn, id string, isAdmin bool) (*hapctl.Controller, *hapctl.Conn) {
+	ctl := controller(t, id)
+	err := admin.AddPairing(ctx, hapctl.ControllerPairing{
+		ID:        ctl.ID,
+		PublicKey: ctl.PublicKey,
+		Admin:     isAdmin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ctl, dial(ctx, t, ctl, tg, p)
+}
+
+func dial(ctx context.Context, t *testing.T, ctl *hapctl.Controller, tg Target, p hapctl.Pairing) *hapctl.Conn {
+	c, err := ctl.Dial(ctx, tg.Addr, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+// events returns the channel of the event notifications received by c.
+func events(c *hapctl.Conn) <-chan hapctl.Event {
+	ch := make(chan hapctl.Event, 16)
+	c.EventFunc = func(e hapctl.Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+
+	return ch
+}
+
+// char is a characteristic and its identifier.
+type char struct {
+	ID hapctl.ID
+	hapctl.Characteristic
+}
+
+// find returns the first characteristic of the accessories
+// of c for which fn returns true, or nil if none is found.
+func find(ctx context.Context, t *testing.T, c *hapctl.Conn, fn func(hapctl.Characteristic) bool) *char {
+	as, err := c.Accessories(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range as {
+		for _, s := range a.Services {
+			for _, ch := range s.Characteristics {
+				if fn(ch) {
+					return &char{hapctl.ID{Aid: a.Aid, Iid: ch.Iid}, ch}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func has(ch hapctl.Characteristic, perm string) bool {
+	for _, p := range ch.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readOnly(ch hapctl.Characteristic) bool {
+	return has(ch, "pr") && !has(ch, "pw")
+}
+
+// writable returns true for characteristics, whose
+// values can be written without a timed write.
+func writable(ch hapctl.Characteristic) bool {
+	if !has(ch, "pr") || !has(ch, "pw") || !has(ch, "ev") || has(ch, "tw") {
+		return false
+	}
+
+	switch ch.Format {
+	case "bool", "uint8":
+		return ch.Value != nil
+	}
+
+	return false
+}
+
+// toggle returns a valid value different from v.
+func toggle(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		return !v
+	case float64:
+		if v == 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// invalidPin returns a valid setup code different from pin.
+func invalidPin(pin string) string {
+	if pin == "111-22-333" || pin == "11122333" {
+		return "111-22-334"
+	}
+
+	return "111-22-333"
+}
+
+func tlvError(t *testing.T, err error, code byte) {
+	t.Helper()
+
+	var terr *hapctl.TLVError
+	if !errors.As(err, &terr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if is, want := terr.Code, code; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func statusError(t *testing.T, err error, status int) {
+	t.Helper()
+
+	var serr *hapctl.StatusError
+	if !errors.As(err, &serr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if is, want := serr.Status, status; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
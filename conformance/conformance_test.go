@@ -0,0 +1,51 @@
+package conformance
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+
+	"context"
+	"net"
+	"testing"
+)
+
+// nopResponder doesn't announce the accessory.
+type nopResponder struct{}
+
+func (nopResponder) Announce(hap.DNSSDService) error    { return nil }
+func (nopResponder) UpdateText(map[string]string) error { return nil }
+func (nopResponder) Withdraw() error                    { return nil }
+
+func TestServer(t *testing.T) {
+	Run(t, func(t *testing.T) Target {
+		a := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+
+		tw := characteristic.NewLockTargetState()
+		tw.Permissions = append(tw.Permissions, characteristic.PermissionTimedWrite)
+		a.Outlet.AddC(tw.C)
+
+		s, err := hap.New(a.A, hap.WithStore(hap.NewMemStore()), hap.WithPin("12344321"), hap.WithResponder(nopResponder{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			s.Serve(ctx, ln)
+			close(stopped)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-stopped
+		})
+
+		return Target{Addr: ln.Addr().String(), Pin: "123-44-321"}
+	})
+}
@@ -1,16 +1,32 @@
 package hap
 
 import (
-	"sync"
-
 	"github.com/brutella/hap/log"
 
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
-	"io"
 	"io/ioutil"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// eventQueueSize is the maximum number of queued
+	// event notifications of a connection.
+	eventQueueSize = 64
+
+	// eventWriteTimeout is the maximum duration of writing an event
+	// notification. If the controller doesn't read the notification
+	// in time, the connection is closed.
+	eventWriteTimeout = 10 * time.Second
+
+	// drainInterval is the interval of checking
+	// whether the queued events were written.
+	drainInterval = 10 * time.Millisecond
 )
 
 type conn struct {
@@ -26,16 +42,155 @@ type conn struct {
 	smu sync.Mutex
 	ss  *session
 
-	readBuf io.Reader
+	readBuf []byte        // unread decrypted data
+	readMsg []byte        // decrypted message, which is zeroed after reading
+	rbuf    *bufio.Reader // buffered reader of the encrypted data
+
+	// maxMessageSize is the maximum size of an encrypted message
+	// and receiveTimeout the maximum duration of receiving it.
+	maxMessageSize int
+	receiveTimeout time.Duration
+
+	// packetLimit is the number of packets after which
+	// the keys of the session are renegotiated.
+	packetLimit uint64
+
+	// dmu guards the read deadline of the connection.
+	// rdl is the read deadline set by the http server.
+	dmu sync.Mutex
+	rdl time.Time
+
+	// wmu serializes writes, which makes sure that encrypted
+	// messages are sent in the order of their nonces.
+	wmu sync.Mutex
+
+	// events are the queued event notifications,
+	// which are written by the writer goroutine.
+	events    chan []byte
+	pending   int32 // number of queued events, which are not written yet
+	startOnce sync.Once
+	closeOnce sync.Once
+	done      chan struct{} // closed when the connection is closed
+
+	metrics *metrics // counts decryption failures and events; may be nil
+
+	logHandler log.Handler // see Server.LogHandler
 }
 
 func newConn(c net.Conn) *conn {
 	return &conn{
-		Conn: c,
-		smu:  sync.Mutex{},
+		Conn:   c,
+		smu:    sync.Mutex{},
+		events: make(chan []byte, eventQueueSize),
+		done:   make(chan struct{}),
 	}
 }
 
+// Close closes the connection and stops the writer goroutine.
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
+	return c.Conn.Close()
+}
+
+// sendEvent queues the event notification b. If the queue is full,
+// because the controller doesn't read the notifications, the
+// notification is dropped and false is returned.
+func (c *conn) sendEvent(b []byte) bool {
+	c.startOnce.Do(func() {
+		go c.writeEvents()
+	})
+
+	atomic.AddInt32(&c.pending, 1)
+	select {
+	case c.events <- b:
+		return true
+	default:
+		atomic.AddInt32(&c.pending, -1)
+		if c.metrics != nil {
+			c.metrics.inc(&c.metrics.droppedEvents)
+		}
+		return false
+	}
+}
+
+// writeEvents writes the queued event notifications until
+// the connection is closed. A connection, on which an event
+// can't be written in time, is closed.
+func (c *conn) writeEvents() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case b := <-c.events:
+			err := c.writeEvent(b)
+			atomic.AddInt32(&c.pending, -1)
+			if err != nil {
+				c.logEntry(log.Debug).Println("writing event failed:", err)
+				c.Close()
+				return
+			}
+
+			if c.metrics != nil {
+				c.metrics.inc(&c.metrics.events)
+			}
+
+			// Connections, on which the controller only receives
+			// events, are closed too. Queued events are dropped.
+			if c.renegotiate() {
+				c.logEntry(log.Info).Println("closing connection to renegotiate session keys")
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// logEntry returns a log entry with the remote address.
+func (c *conn) logEntry(l *log.Logger) *log.Entry {
+	return l.With(log.F("addr", c.RemoteAddr().String())).WithHandler(c.logHandler)
+}
+
+// renegotiate returns true if the keys of the session were
+// used for the maximum number of packets.
+func (c *conn) renegotiate() bool {
+	c.smu.Lock()
+	ss := c.ss
+	c.smu.Unlock()
+
+	return ss != nil && ss.renegotiate(c.packetLimit)
+}
+
+// drain waits until the queued events are written,
+// the connection is closed or ctx is done.
+func (c *conn) drain(ctx context.Context) {
+	t := time.NewTicker(drainInterval)
+	defer t.Stop()
+
+	for atomic.LoadInt32(&c.pending) > 0 {
+		select {
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *conn) writeEvent(b []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.Conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	defer c.Conn.SetWriteDeadline(time.Time{})
+
+	_, err := c.write(b)
+	return err
+}
+
 func (c *conn) Upgrade(s *session) {
 	c.smu.Lock()
 	c.s = s
@@ -45,16 +200,28 @@ func (c *conn) Upgrade(s *session) {
 // Write writes bytes to the connection.
 // The written bytes are encrypted when possible.
 func (c *conn) Write(b []byte) (int, error) {
-	if c.ss == nil {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	return c.write(b)
+}
+
+func (c *conn) write(b []byte) (int, error) {
+	// ss is set by Read
+	c.smu.Lock()
+	ss := c.ss
+	c.smu.Unlock()
+
+	if ss == nil {
 		return c.Conn.Write(b)
 	}
 
 	var buf bytes.Buffer
 	buf.Write(b)
-	enc, err := c.ss.Encrypt(&buf)
+	enc, err := ss.Encrypt(&buf)
 
 	if err != nil {
-		log.Debug.Println("encryption failed:", err)
+		c.logEntry(log.Debug).Println("encryption failed:", err)
 		err = c.Conn.Close()
 		return 0, err
 	}
@@ -75,6 +242,60 @@ const (
 	packetSize = 0x400
 )
 
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *conn) SetDeadline(t time.Time) error {
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+
+	c.rdl = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection.
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+
+	c.rdl = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// startReceive limits the duration of receiving the
+// rest of a message to the receive timeout.
+func (c *conn) startReceive() {
+	if c.receiveTimeout <= 0 {
+		return
+	}
+
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+
+	t := time.Now().Add(c.receiveTimeout)
+	if c.rdl.IsZero() || t.Before(c.rdl) {
+		c.Conn.SetReadDeadline(t)
+	}
+}
+
+// endReceive restores the read deadline of the http server.
+func (c *conn) endReceive() {
+	if c.receiveTimeout <= 0 {
+		return
+	}
+
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+
+	c.Conn.SetReadDeadline(c.rdl)
+}
+
+func (c *conn) maxMessage() int {
+	if c.maxMessageSize > 0 {
+		return c.maxMessageSize
+	}
+
+	return defaultMaxRequestSize + maxHeaderBytes
+}
+
 // Read reads bytes from the connection.
 // The read bytes are decrypted when possible.
 func (c *conn) Read(b []byte) (int, error) {
@@ -90,28 +311,41 @@ func (c *conn) Read(b []byte) (int, error) {
 	}
 
 	if c.readBuf == nil {
-		r := bufio.NewReader(c.Conn)
-		buf, err := c.ss.Decrypt(r)
+		if c.rbuf == nil {
+			c.rbuf = bufio.NewReader(c.Conn)
+		}
+
+		// Wait for the next message. Timeouts while waiting
+		// are expected on idle connections (see #77).
+		if _, err := c.rbuf.Peek(1); err != nil {
+			return 0, err
+		}
+
+		c.startReceive()
+		buf, err := c.ss.Decrypt(c.rbuf, c.maxMessage())
+		c.endReceive()
 		if err != nil {
-			if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
-				// Ignore timeout error #77
-			} else if errors.Is(err, net.ErrClosed) {
-				// Ignore close errors
-			} else {
-				log.Debug.Println("decryption failed:", err)
-				c.Conn.Close()
+			// A partially read message can't be recovered.
+			if !errors.Is(err, net.ErrClosed) {
+				c.logEntry(log.Debug).Println("decryption failed:", err)
+				if c.metrics != nil {
+					c.metrics.inc(&c.metrics.decryptFailures)
+				}
 			}
+			c.Conn.Close()
 			return 0, err
 		}
 
-		c.readBuf = buf
+		c.readBuf, c.readMsg = buf, buf
 	}
 
-	n, err := c.readBuf.Read(b)
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
 
-	if n < len(b) || err == io.EOF {
-		c.readBuf = nil
+	if len(c.readBuf) == 0 {
+		zero(c.readMsg)
+		c.readBuf, c.readMsg = nil, nil
 	}
 
-	return n, err
+	return n, nil
 }
@@ -0,0 +1,94 @@
+package hap
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// keyConfigNumber is the store key of the configuration number (c#).
+	keyConfigNumber = "version"
+	// keyStateNumber is the store key of the state number (s#).
+	keyStateNumber = "statenumber"
+)
+
+// counter returns the value of the counter stored under key.
+// If no value is stored, 1 is returned.
+func (st *storer) counter(key string) (uint16, error) {
+	b, err := st.Get(key)
+	if err != nil || len(b) == 0 {
+		return 1, nil
+	}
+
+	v, err := strconv.ParseUint(string(b), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid counter %s: %v", key, err)
+	}
+
+	if v == 0 {
+		return 1, nil
+	}
+
+	return uint16(v), nil
+}
+
+// setCounter stores the value of the counter under key.
+func (st *storer) setCounter(key string, v uint16) error {
+	return st.SetString(key, strconv.FormatUint(uint64(v), 10))
+}
+
+// incrementCounter increments the counter stored under key
+// and returns the new value. The new value is persisted before
+// it is returned, which makes sure that a value is never handed
+// out twice – even if the process crashes afterwards.
+// Counters range from 1 to 65535 and wrap around to 1.
+func (st *storer) incrementCounter(key string) (uint16, error) {
+	v, err := st.counter(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if v == 65535 {
+		v = 1
+	} else {
+		v++
+	}
+
+	if err := st.setCounter(key, v); err != nil {
+		return 0, err
+	}
+
+	return v, nil
+}
+
+// ConfigurationNumber returns the current configuration number (c#).
+// The configuration number is incremented whenever the
+// accessory database changes.
+func (s *Server) ConfigurationNumber() uint16 {
+	return s.version
+}
+
+// StateNumber returns the current state number (s#).
+func (s *Server) StateNumber() uint16 {
+	v, err := s.st.counter(keyStateNumber)
+	if err != nil {
+		return 1
+	}
+
+	return v
+}
+
+// IncrementConfigurationNumber increments and persists the configuration
+// number (c#) and updates the dnssd txt records. This forces controllers
+// to reload the accessory database.
+func (s *Server) IncrementConfigurationNumber() (uint16, error) {
+	v, err := s.st.incrementCounter(keyConfigNumber)
+	if err != nil {
+		return s.version, err
+	}
+
+	s.version = v
+	s.updateTxtRecords()
+
+	return v, nil
+}
@@ -0,0 +1,28 @@
+package hap
+
+import (
+	"testing"
+)
+
+func TestCounterWrapsAround(t *testing.T) {
+	st := &storer{NewMemStore()}
+
+	if v, err := st.counter(keyConfigNumber); err != nil {
+		t.Fatal(err)
+	} else if is, want := v, uint16(1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := st.setCounter(keyConfigNumber, 65535); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := st.incrementCounter(keyConfigNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := v, uint16(1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -1,20 +1,33 @@
 package curve25519
 
 import (
-	"crypto/rand"
 	"golang.org/x/crypto/curve25519"
+
+	"crypto/rand"
 )
 
+// GenerateKeyPair returns a new random Curve25519 key pair.
 func GenerateKeyPair() (public, private [32]byte) {
-	rand.Read(private[:])
-	curve25519.ScalarBaseMult(&public, &private)
+	if _, err := rand.Read(private[:]); err != nil {
+		panic(err)
+	}
+
+	// X25519 only fails for low order points, which the base point is not.
+	pub, _ := curve25519.X25519(private[:], curve25519.Basepoint)
+	copy(public[:], pub)
+
 	return
 }
 
 // SharedSecret returns a Curve25519 shared secret derived from privateKey and otherPublicKey.
-func SharedSecret(privateKey, otherPublicKey [32]byte) [32]byte {
+// An error is returned if otherPublicKey is a low order point, which results in an all-zero secret.
+func SharedSecret(privateKey, otherPublicKey [32]byte) ([32]byte, error) {
 	var k [32]byte
-	curve25519.ScalarMult(&k, &privateKey, &otherPublicKey)
+	b, err := curve25519.X25519(privateKey[:], otherPublicKey[:])
+	if err != nil {
+		return k, err
+	}
+	copy(k[:], b)
 
-	return k
+	return k, nil
 }
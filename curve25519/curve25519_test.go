@@ -0,0 +1,33 @@
+package curve25519
+
+import (
+	"testing"
+)
+
+func TestSharedSecret(t *testing.T) {
+	pub1, priv1 := GenerateKeyPair()
+	pub2, priv2 := GenerateKeyPair()
+
+	k1, err := SharedSecret(priv1, pub2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k2, err := SharedSecret(priv2, pub1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := k1, k2; is != want {
+		t.Fatalf("%x != %x", is, want)
+	}
+}
+
+func TestSharedSecretLowOrder(t *testing.T) {
+	_, priv := GenerateKeyPair()
+
+	var zero [32]byte
+	if _, err := SharedSecret(priv, zero); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,187 @@
+// Package diagnostics implements the transfer of diagnostic logs
+// of an accessory to a controller.
+//
+// Users request a diagnostics snapshot in the Home app. The controller
+// then opens a dataSend stream over a HomeKit Data Stream (see package hds)
+// and the accessory sends a zip archive, which contents are supplied by
+// the application.
+package diagnostics
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/hds"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"archive/zip"
+	"bytes"
+	"fmt"
+)
+
+const (
+	TypeDiagnostics                  = "237"
+	TypeSupportedDiagnosticsSnapshot = "238"
+	TypeSupportedDiagnosticsModes    = "24B"
+	TypeSelectedDiagnosticsModes     = "24C"
+)
+
+// dataSendTypeSnapshot is the type of dataSend streams of diagnostics snapshots.
+const dataSendTypeSnapshot = "diagnostics.snapshot"
+
+const dataTypeSnapshot = "diagnostics"
+
+const FormatZip byte = 0
+
+// Types of diagnostics snapshots
+const (
+	SnapshotTypeADK       byte = 0x01
+	SnapshotTypeAccessory byte = 0x02
+)
+
+// Diagnostics modes
+const (
+	ModeNone           uint32 = 0x00
+	ModeVerboseLogging uint32 = 0x01
+)
+
+type supportedSnapshot struct {
+	Format byte `tlv8:"1"`
+	Type   byte `tlv8:"2"`
+}
+
+// Service is the diagnostics service.
+type Service struct {
+	*service.S
+
+	SupportedSnapshot *characteristic.Bytes
+	SupportedModes    *characteristic.Int
+	SelectedModes     *characteristic.Int
+}
+
+// NewService returns a diagnostics service,
+// which supports the diagnostics modes.
+func NewService(modes uint32) *Service {
+	s := Service{}
+	s.S = service.New(TypeDiagnostics)
+
+	s.SupportedSnapshot = characteristic.NewBytes(TypeSupportedDiagnosticsSnapshot)
+	s.SupportedSnapshot.Permissions = []string{characteristic.PermissionRead}
+	b, _ := tlv8.Marshal(supportedSnapshot{Format: FormatZip, Type: SnapshotTypeAccessory})
+	s.SupportedSnapshot.SetValue(b)
+	s.AddC(s.SupportedSnapshot.C)
+
+	s.SupportedModes = newUInt32(TypeSupportedDiagnosticsModes, characteristic.PermissionRead)
+	s.SupportedModes.SetValue(int(modes))
+	s.AddC(s.SupportedModes.C)
+
+	s.SelectedModes = newUInt32(TypeSelectedDiagnosticsModes, characteristic.PermissionRead, characteristic.PermissionWrite)
+	s.AddC(s.SelectedModes.C)
+
+	return &s
+}
+
+func newUInt32(t string, perms ...string) *characteristic.Int {
+	c := characteristic.NewInt(t)
+	c.Format = characteristic.FormatUInt32
+	c.Permissions = perms
+	c.SetValue(0)
+
+	return c
+}
+
+// Diagnostics provides diagnostic logs of an accessory to the controllers.
+type Diagnostics struct {
+	Service    *Service
+	DataStream *hds.TransportManagement
+
+	// SnapshotFunc is called when a controller requests a diagnostics
+	// snapshot. The function adds the logs to the zip archive w.
+	SnapshotFunc func(w *zip.Writer) error
+
+	// ModesFunc is called when a controller selects
+	// diagnostics modes (e.g. ModeVerboseLogging).
+	ModesFunc func(modes uint32)
+}
+
+// AddDiagnostics adds the diagnostics service to the accessory a,
+// which supports the diagnostics modes. The snapshots are sent over
+// the data streams of srv. If a has no data stream transport management
+// service yet, it is added.
+func AddDiagnostics(a *accessory.A, srv *hds.Server, modes uint32) *Diagnostics {
+	d := Diagnostics{
+		Service: NewService(modes),
+	}
+
+	d.Service.SelectedModes.OnValueRemoteUpdate(func(v int) {
+		if d.ModesFunc != nil {
+			d.ModesFunc(uint32(v) & modes)
+		}
+	})
+
+	srv.HandleDataSend(dataSendTypeSnapshot, d.send)
+
+	a.AddS(d.Service.S)
+	if !hasService(a, hds.TypeDataStreamTransportManagement) {
+		d.DataStream = hds.NewTransportManagement(srv)
+		a.AddS(d.DataStream.S)
+	}
+
+	return &d
+}
+
+// Modes returns the diagnostics modes selected by the controllers.
+func (d *Diagnostics) Modes() uint32 {
+	return uint32(d.Service.SelectedModes.Value())
+}
+
+// Snapshot returns the zip archive of a diagnostics snapshot.
+func (d *Diagnostics) Snapshot() ([]byte, error) {
+	if d.SnapshotFunc == nil {
+		return nil, fmt.Errorf("diagnostics: no snapshot function")
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if err := d.SnapshotFunc(w); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// send sends a diagnostics snapshot over the stream s.
+func (d *Diagnostics) send(s *hds.DataSendStream) error {
+	if d.SnapshotFunc == nil {
+		s.Close(hds.CloseReasonUnsupported)
+		return nil
+	}
+
+	b, err := d.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	log.Debug.Printf("diagnostics: sending %d bytes\n", len(b))
+	md := map[string]interface{}{
+		"dataType":           dataTypeSnapshot,
+		"dataSequenceNumber": 1,
+	}
+
+	return s.SendChunked(b, md, true)
+}
+
+func hasService(a *accessory.A, typ string) bool {
+	for _, s := range a.Ss {
+		if s.Type == typ {
+			return true
+		}
+	}
+
+	return false
+}
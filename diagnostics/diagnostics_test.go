@@ -0,0 +1,76 @@
+package diagnostics
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/hds"
+
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+	d := AddDiagnostics(a.A, hds.NewServer(), ModeVerboseLogging)
+
+	d.SnapshotFunc = func(w *zip.Writer) error {
+		f, err := w.Create("log.txt")
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte("hello"))
+		return err
+	}
+
+	b, err := d.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(r.File), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	f, err := r.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	content, _ := ioutil.ReadAll(f)
+	if is, want := string(content), "hello"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestSelectedModes(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+	srv := hds.NewServer()
+	tm := hds.NewTransportManagement(srv)
+	a.AddS(tm.S)
+
+	d := AddDiagnostics(a.A, srv, ModeVerboseLogging)
+	if d.DataStream != nil {
+		t.Fatal("data stream transport management added twice")
+	}
+
+	var modes uint32
+	d.ModesFunc = func(m uint32) {
+		modes = m
+	}
+
+	// written by a controller
+	req, _ := http.NewRequest(http.MethodPut, "/characteristics", nil)
+	d.Service.SelectedModes.SetValueRequest(0x03, req)
+
+	if is, want := modes, ModeVerboseLogging; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,314 @@
+// Package dnsupdate implements a responder, which registers accessories
+// with a unicast DNS server via dynamic updates (RFC 2136) as described
+// in RFC 6763 (wide-area DNS-SD). Use it where multicast doesn't reach
+// the controllers, e.g. when the accessory and the home hub are in
+// different VLANs.
+//
+//	r := dnsupdate.NewResponder("ns.example.com:53", "home.example.com")
+//	r.KeyName, r.Secret = "hap.", "c2VjcmV0"
+//	s.Responder = hap.Responders(hap.NewMulticastResponder(), r)
+//
+// The DNS server must allow updates of the zone with the TSIG key.
+// Controllers find the service when the zone is one of their browse
+// domains (e.g. via "b._dns-sd._udp" records of the search domain).
+package dnsupdate
+
+import (
+	"github.com/brutella/hap"
+	"github.com/miekg/dns"
+
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is the default ttl of the registered records.
+const DefaultTTL = 120
+
+// Responder registers services with a unicast DNS server.
+type Responder struct {
+	// Server is the address ("host:port") of the DNS server.
+	Server string
+
+	// Zone is the zone in which the service is registered.
+	Zone string
+
+	// TTL is the ttl of the records in seconds.
+	// If zero, DefaultTTL is used.
+	TTL uint32
+
+	// KeyName, Algorithm and Secret (base64) specify the TSIG key
+	// to sign the updates. If KeyName is empty, the updates are not
+	// signed. If Algorithm is empty, HMAC-SHA256 is used.
+	KeyName   string
+	Algorithm string
+	Secret    string
+
+	// Timeout is the timeout of an update. If zero, 5 seconds are used.
+	Timeout time.Duration
+
+	mu  sync.Mutex
+	svc *hap.DNSSDService
+}
+
+// NewResponder returns a responder, which
+// registers services in the zone at server.
+func NewResponder(server, zone string) *Responder {
+	return &Responder{
+		Server: server,
+		Zone:   zone,
+	}
+}
+
+// Announce adds the PTR, SRV and TXT records of the service
+// and the address records of its host to the zone.
+func (r *Responder) Announce(s hap.DNSSDService) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ips := s.IPs
+	if len(ips) == 0 {
+		var err error
+		if ips, err = addrs(s.Ifaces); err != nil {
+			return fmt.Errorf("dnsupdate: %v", err)
+		}
+	}
+
+	m := r.msg()
+	// replace stale records of a previous registration
+	m.RemoveName([]dns.RR{
+		&dns.ANY{Hdr: dns.RR_Header{Name: r.instance(s)}},
+		&dns.ANY{Hdr: dns.RR_Header{Name: r.host(s)}},
+	})
+	m.Insert(r.records(s, ips))
+
+	if err := r.exchange(m); err != nil {
+		return err
+	}
+
+	r.svc = &s
+	r.svc.IPs = ips
+
+	return nil
+}
+
+// UpdateText replaces the TXT record of the registered service.
+func (r *Responder) UpdateText(txt map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.svc == nil {
+		return fmt.Errorf("dnsupdate: service not announced")
+	}
+
+	s := *r.svc
+	s.Text = txt
+
+	m := r.msg()
+	m.RemoveRRset([]dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: r.instance(s), Rrtype: dns.TypeTXT}}})
+	m.Insert([]dns.RR{r.txt(s)})
+
+	if err := r.exchange(m); err != nil {
+		return err
+	}
+
+	r.svc.Text = txt
+
+	return nil
+}
+
+// Withdraw removes the records of the registered service from the zone.
+func (r *Responder) Withdraw() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.svc == nil {
+		return nil
+	}
+
+	s := *r.svc
+	m := r.msg()
+	m.Remove([]dns.RR{r.ptr(s)})
+	m.RemoveName([]dns.RR{
+		&dns.ANY{Hdr: dns.RR_Header{Name: r.instance(s)}},
+		&dns.ANY{Hdr: dns.RR_Header{Name: r.host(s)}},
+	})
+
+	if err := r.exchange(m); err != nil {
+		return err
+	}
+
+	r.svc = nil
+
+	return nil
+}
+
+func (r *Responder) msg() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(r.Zone))
+
+	return m
+}
+
+// exchange signs and sends the update to the server.
+func (r *Responder) exchange(m *dns.Msg) error {
+	c := &dns.Client{
+		Net:     "tcp",
+		Timeout: r.Timeout,
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+
+	if r.KeyName != "" {
+		key, algo := dns.CanonicalName(r.KeyName), r.Algorithm
+		if algo == "" {
+			algo = dns.HmacSHA256
+		}
+		c.TsigSecret = map[string]string{key: r.Secret}
+		m.SetTsig(key, dns.CanonicalName(algo), 300, time.Now().Unix())
+	}
+
+	resp, _, err := c.Exchange(m, r.Server)
+	if err != nil {
+		return fmt.Errorf("dnsupdate: %v", err)
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("dnsupdate: update failed: %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
+
+func (r *Responder) ttl() uint32 {
+	if r.TTL == 0 {
+		return DefaultTTL
+	}
+
+	return r.TTL
+}
+
+// serviceType returns the name of the service type (e.g. "_hap._tcp.home.example.com.").
+func (r *Responder) serviceType(s hap.DNSSDService) string {
+	return dns.Fqdn(s.Type + "." + r.Zone)
+}
+
+// instance returns the name of the service instance.
+func (r *Responder) instance(s hap.DNSSDService) string {
+	return escape(s.Name) + "." + r.serviceType(s)
+}
+
+func (r *Responder) host(s hap.DNSSDService) string {
+	return dns.Fqdn(s.Host + "." + r.Zone)
+}
+
+func (r *Responder) ptr(s hap.DNSSDService) dns.RR {
+	return &dns.PTR{
+		Hdr: dns.RR_Header{Name: r.serviceType(s), Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: r.ttl()},
+		Ptr: r.instance(s),
+	}
+}
+
+func (r *Responder) txt(s hap.DNSSDService) dns.RR {
+	var keys []string
+	for k := range s.Text {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var txt []string
+	for _, k := range keys {
+		txt = append(txt, k+"="+s.Text[k])
+	}
+
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: r.instance(s), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: r.ttl()},
+		Txt: txt,
+	}
+}
+
+// records returns the records of the service and its host.
+func (r *Responder) records(s hap.DNSSDService, ips []net.IP) []dns.RR {
+	rrs := []dns.RR{
+		r.ptr(s),
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: r.instance(s), Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: r.ttl()},
+			Port:   uint16(s.Port),
+			Target: r.host(s),
+		},
+		r.txt(s),
+	}
+
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			rrs = append(rrs, &dns.A{
+				Hdr: dns.RR_Header{Name: r.host(s), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: r.ttl()},
+				A:   ip4,
+			})
+		} else {
+			rrs = append(rrs, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: r.host(s), Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: r.ttl()},
+				AAAA: ip,
+			})
+		}
+	}
+
+	return rrs
+}
+
+// escape escapes the dots and backslashes of a service instance name.
+func escape(name string) string {
+	name = strings.Replace(name, `\`, `\\`, -1)
+	return strings.Replace(name, ".", `\.`, -1)
+}
+
+// addrs returns the global unicast addresses of the
+// interfaces with the names, or of all interfaces.
+func addrs(names []string) ([]net.IP, error) {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, ifi := range ifis {
+		if len(names) > 0 && !contains(names, ifi.Name) {
+			continue
+		}
+
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		as, err := ifi.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range as {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.IsGlobalUnicast() {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found")
+	}
+
+	return ips, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
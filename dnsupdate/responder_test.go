@@ -0,0 +1,154 @@
+package dnsupdate
+
+import (
+	"github.com/brutella/hap"
+	"github.com/miekg/dns"
+
+	"net"
+	"testing"
+)
+
+const secret = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+
+// server is a DNS server, which records the updates.
+type server struct {
+	addr    string
+	updates chan *dns.Msg
+}
+
+func newServer(t *testing.T) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{ln.Addr().String(), make(chan *dns.Msg, 10)}
+	srv := &dns.Server{
+		Listener:      ln,
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+		TsigSecret:    map[string]string{"hap.": secret},
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			if req.IsTsig() == nil || w.TsigStatus() != nil {
+				resp.Rcode = dns.RcodeRefused
+			} else {
+				s.updates <- req
+				resp.SetTsig("hap.", dns.HmacSHA256, 300, int64(req.IsTsig().TimeSigned))
+			}
+			w.WriteMsg(resp)
+		}),
+	}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+
+	return s
+}
+
+func TestAnnounce(t *testing.T) {
+	srv := newServer(t)
+
+	r := NewResponder(srv.addr, "home.example.com")
+	r.KeyName, r.Secret = "hap", secret
+
+	err := r.Announce(hap.DNSSDService{
+		Name: "Outlet",
+		Type: "_hap._tcp",
+		Host: "AABBCC",
+		Port: 51826,
+		Text: map[string]string{"c#": "1", "sf": "1"},
+		IPs:  []net.IP{net.ParseIP("192.168.0.2"), net.ParseIP("fd00::2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-srv.updates
+	if is, want := m.Question[0].Name, "home.example.com."; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	records := map[uint16]dns.RR{}
+	for _, rr := range m.Ns {
+		if rr.Header().Class == dns.ClassINET {
+			records[rr.Header().Rrtype] = rr
+		}
+	}
+
+	ptr, ok := records[dns.TypePTR].(*dns.PTR)
+	if !ok {
+		t.Fatal("missing PTR record")
+	}
+	if is, want := ptr.Ptr, "Outlet._hap._tcp.home.example.com."; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	srvRec, ok := records[dns.TypeSRV].(*dns.SRV)
+	if !ok {
+		t.Fatal("missing SRV record")
+	}
+	if is, want := srvRec.Target, "AABBCC.home.example.com."; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if is, want := srvRec.Port, uint16(51826); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	txt, ok := records[dns.TypeTXT].(*dns.TXT)
+	if !ok {
+		t.Fatal("missing TXT record")
+	}
+	if is, want := len(txt.Txt), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if is, want := txt.Txt[0], "c#=1"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, ok := records[dns.TypeA]; !ok {
+		t.Fatal("missing A record")
+	}
+	if _, ok := records[dns.TypeAAAA]; !ok {
+		t.Fatal("missing AAAA record")
+	}
+
+	if err := r.UpdateText(map[string]string{"c#": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m = <-srv.updates
+	if is, want := m.Ns[len(m.Ns)-1].(*dns.TXT).Txt[0], "c#=2"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := r.Withdraw(); err != nil {
+		t.Fatal(err)
+	}
+
+	m = <-srv.updates
+	if is, want := m.Ns[0].Header().Class, uint16(dns.ClassNONE); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestUnsignedUpdate(t *testing.T) {
+	srv := newServer(t)
+
+	r := NewResponder(srv.addr, "home.example.com")
+	err := r.Announce(hap.DNSSDService{
+		Name: "Outlet",
+		Type: "_hap._tcp",
+		Host: "AABBCC",
+		Port: 51826,
+		IPs:  []net.IP{net.ParseIP("192.168.0.2")},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if is, want := escape(`My.Outlet\`), `My\.Outlet\\`; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,154 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
+
+	"fmt"
+)
+
+// AddAccessory adds a bridged accessory to the server while it is running.
+// If the accessory has no id, an id is assigned by the IDAllocator.
+// The configuration number (c#) is incremented and re-announced via mDNS,
+// which makes the controllers reload the accessory database.
+func (s *Server) AddAccessory(a *accessory.A) error {
+	s.amux.Lock()
+	keys := map[string]int{}
+	for _, x := range s.allAccessories() {
+		if a == x {
+			s.amux.Unlock()
+			return fmt.Errorf("accessory %s already added", a.Name())
+		}
+		uniqueKey(keys, accessoryKey(x))
+	}
+
+	if a.Id == 0 {
+		aid, err := s.ids.Aid(uniqueKey(keys, accessoryKey(a)))
+		if err != nil {
+			s.amux.Unlock()
+			return err
+		}
+		a.Id = aid
+	}
+
+	for _, x := range s.allAccessories() {
+		if a.Id == x.Id {
+			s.amux.Unlock()
+			return fmt.Errorf("accessory id %d already exists", a.Id)
+		}
+	}
+
+	if err := s.setup(a); err != nil {
+		s.amux.Unlock()
+		return err
+	}
+
+	if err := s.saveIDs(); err != nil {
+		log.Info.Println(err)
+	}
+
+	s.as = append(s.as, a)
+	as := s.allAccessories()
+	s.amux.Unlock()
+
+	log.Debug.Printf("accessory %s added with id %d\n", a.Name(), a.Id)
+
+	return s.accessoriesChanged(as)
+}
+
+// RemoveAccessory removes the bridged accessory with the id aid.
+// The main accessory cannot be removed.
+// Like AddAccessory, the configuration number is incremented
+// and re-announced via mDNS.
+func (s *Server) RemoveAccessory(aid uint64) error {
+	if s.a.Id == aid {
+		return fmt.Errorf("main accessory %d cannot be removed", aid)
+	}
+
+	s.amux.Lock()
+	var removed *accessory.A
+	for i, a := range s.as {
+		if a.Id == aid {
+			removed = a
+			s.as = append(s.as[:i:i], s.as[i+1:]...)
+			break
+		}
+	}
+	as := s.allAccessories()
+	s.amux.Unlock()
+
+	if removed == nil {
+		return fmt.Errorf("accessory %d not found", aid)
+	}
+
+	// Events of the removed accessory are not sent anymore.
+	for _, cn := range s.conns() {
+		addr := cn.RemoteAddr().String()
+		for _, svc := range removed.Ss {
+			for _, c := range svc.Cs {
+				c.SetEvent(addr, false)
+			}
+		}
+	}
+
+	log.Debug.Printf("accessory %s with id %d removed\n", removed.Name(), aid)
+
+	return s.accessoriesChanged(as)
+}
+
+// UpdateConfiguration updates the configuration number (c#) after
+// services or characteristics were added to or removed from the accessories.
+// New services and characteristics get ids. If the attribute database changed,
+// the configuration number is incremented and re-announced via mDNS, which makes
+// the controllers reload the accessory database.
+func (s *Server) UpdateConfiguration() error {
+	s.amux.Lock()
+	as := s.allAccessories()
+	for _, a := range as {
+		if err := s.setup(a); err != nil {
+			s.amux.Unlock()
+			return err
+		}
+	}
+	s.amux.Unlock()
+
+	if err := s.saveIDs(); err != nil {
+		return err
+	}
+
+	return s.accessoriesChanged(as)
+}
+
+// accessoriesChanged updates the configuration number
+// and the mDNS announcement after accessories were added or removed.
+func (s *Server) accessoriesChanged(as []*accessory.A) error {
+	if err := s.updateConfigHash(as); err != nil {
+		return err
+	}
+
+	s.updateTxtRecords()
+
+	return nil
+}
+
+// isRevision returns true if c is the firmware
+// or hardware revision of an accessory.
+func isRevision(c *characteristic.C) bool {
+	return c.Type == characteristic.TypeFirmwareRevision || c.Type == characteristic.TypeHardwareRevision
+}
+
+// revisionChanged updates the configuration number after
+// the firmware or hardware revision of an accessory changed.
+func (s *Server) revisionChanged() {
+	if err := s.accessoriesChanged(s.accessories()); err != nil {
+		log.Info.Println(err)
+	}
+}
+
+// allAccessories returns the main and bridged accessories.
+// The caller must hold amux.
+func (s *Server) allAccessories() []*accessory.A {
+	as := []*accessory.A{s.a}
+	return append(as, s.as...)
+}
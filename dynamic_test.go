@@ -0,0 +1,138 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/service"
+
+	"testing"
+)
+
+func TestAddRemoveAccessory(t *testing.T) {
+	b := accessory.NewBridge(accessory.Info{Name: "Bridge"})
+	l := accessory.NewLightbulb(accessory.Info{Name: "Lightbulb"})
+
+	s, err := NewServer(NewMemStore(), b.A, l.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := s.version
+
+	o := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+	if err := s.AddAccessory(o.A); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := o.A.Id, uint64(3); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := s.version, v+1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if s.findA(3) != o.A {
+		t.Fatal("accessory not found")
+	}
+
+	if err := s.AddAccessory(o.A); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := s.RemoveAccessory(l.A.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.version, v+2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if s.findA(2) != nil {
+		t.Fatal("accessory not removed")
+	}
+
+	if err := s.RemoveAccessory(b.A.Id); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := s.RemoveAccessory(2); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestUpdateConfiguration(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := s.ConfigurationNumber()
+
+	// Unchanged accessories don't increment the configuration number.
+	if err := s.UpdateConfiguration(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.ConfigurationNumber(), v; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	sw := service.NewSwitch()
+	a.AddS(sw.S)
+	if err := s.UpdateConfiguration(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.ConfigurationNumber(), v+1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if sw.On.Id == 0 {
+		t.Fatal("no id assigned")
+	}
+
+	// Changing a value doesn't change the configuration.
+	a.Outlet.On.SetValue(true)
+	if err := s.UpdateConfiguration(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.ConfigurationNumber(), v+1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestFirmwareRevisionChange(t *testing.T) {
+	b := accessory.NewBridge(accessory.Info{Name: "Bridge", Firmware: "1.0"})
+	l := accessory.NewLightbulb(accessory.Info{Name: "Lightbulb", Firmware: "1.0"})
+
+	st := NewMemStore()
+	s, err := NewServer(st, b.A, l.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := s.version
+
+	l.SetFirmwareRevision("1.1")
+	if is, want := s.version, v+1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// same revision
+	l.SetFirmwareRevision("1.1")
+	if is, want := s.version, v+1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// a new firmware revision on the next start
+	b = accessory.NewBridge(accessory.Info{Name: "Bridge", Firmware: "2.0"})
+	l = accessory.NewLightbulb(accessory.Info{Name: "Lightbulb", Firmware: "1.1"})
+	s, err = NewServer(st, b.A, l.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.version, v+2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
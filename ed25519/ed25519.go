@@ -1,7 +1,6 @@
 package ed25519
 
 import (
-	"bytes"
 	"crypto/ed25519"
 	"fmt"
 )
@@ -23,23 +22,18 @@ func Signature(key, data []byte) ([]byte, error) {
 		return nil, fmt.Errorf("Invalid size of key (%v)", len(key))
 	}
 
-	signature := ed25519.Sign(ed25519.PrivateKey(key), data)
-
-	return signature[:], nil
+	return ed25519.Sign(ed25519.PrivateKey(key), data), nil
 }
 
 // GenerateKey return a public and private key pair from the provided str.
+// The first 32 bytes of str, padded with zeros, are used as seed.
 func GenerateKey(str string) (public [32]byte, private [64]byte, err error) {
-	b := bytes.NewBuffer([]byte(str))
-	if len(str) < 32 {
-		zeros := make([]byte, 32-len(str))
-		b.Write(zeros)
-	}
-
-	pub, priv, err := ed25519.GenerateKey(bytes.NewReader(b.Bytes()))
+	seed := make([]byte, ed25519.SeedSize)
+	copy(seed, str)
 
-	copy(public[:], pub)
+	priv := ed25519.NewKeyFromSeed(seed)
 	copy(private[:], priv)
+	copy(public[:], priv.Public().(ed25519.PublicKey))
 
-	return public, private, err
+	return public, private, nil
 }
@@ -0,0 +1,53 @@
+package ed25519
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestGenerateKey(t *testing.T) {
+	pub1, priv1, err := GenerateKey("12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub2, priv2, _ := GenerateKey("12345")
+	if is, want := pub1, pub2; is != want {
+		t.Fatalf("%x != %x", is, want)
+	}
+	if is, want := priv1, priv2; is != want {
+		t.Fatalf("%x != %x", is, want)
+	}
+
+	sig, err := Signature(priv1[:], []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ValidateSignature(pub1[:], []byte("data"), sig) {
+		t.Fatal("invalid signature")
+	}
+
+	if ValidateSignature(pub1[:], []byte("other"), sig) {
+		t.Fatal("expected invalid signature")
+	}
+}
+
+// TestGenerateKeyCompatibility makes sure that keys derived
+// from a string don't change.
+func TestGenerateKeyCompatibility(t *testing.T) {
+	for _, str := range []string{"", "12345", "0123456789abcdef0123456789abcdef0123"} {
+		seed := make([]byte, 64)
+		copy(seed, str)
+		pub, priv, _ := ed25519.GenerateKey(bytes.NewReader(seed))
+
+		public, private, _ := GenerateKey(str)
+		if is, want := public[:], []byte(pub); !bytes.Equal(is, want) {
+			t.Fatalf("%x != %x", is, want)
+		}
+		if is, want := private[:], []byte(priv); !bytes.Equal(is, want) {
+			t.Fatalf("%x != %x", is, want)
+		}
+	}
+}
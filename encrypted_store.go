@@ -0,0 +1,81 @@
+package hap
+
+import (
+	"github.com/brutella/hap/chacha20poly1305"
+
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// encryptedStoreVersion is the first byte of every encrypted value.
+const encryptedStoreVersion byte = 0x1
+
+type encryptedStore struct {
+	Store
+	key []byte
+}
+
+// NewEncryptedStore returns a store which encrypts values with
+// ChaCha20-Poly1305 before they are written to inner.
+// The key must be 32 bytes long. Keys are not encrypted.
+//
+// Values which were written to inner before (unencrypted)
+// cannot be read anymore.
+func NewEncryptedStore(inner Store, key []byte) (Store, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key length %d", len(key))
+	}
+
+	k := make([]byte, 32)
+	copy(k, key)
+
+	return &encryptedStore{inner, k}, nil
+}
+
+// Set encrypts the value and writes it to the wrapped store.
+// The key is used as additional authenticated data, which
+// prevents that encrypted values are swapped between keys.
+func (es *encryptedStore) Set(key string, value []byte) error {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+
+	enc, mac, err := chacha20poly1305.EncryptAndSeal(es.key, nonce[:], value, []byte(key))
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	b = append(b, encryptedStoreVersion)
+	b = append(b, nonce[:]...)
+	b = append(b, enc...)
+	b = append(b, mac[:]...)
+
+	return es.Store.Set(key, b)
+}
+
+// Get reads the value from the wrapped store and decrypts it.
+func (es *encryptedStore) Get(key string) ([]byte, error) {
+	b, err := es.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < 1+8+16 || b[0] != encryptedStoreVersion {
+		return nil, fmt.Errorf("value for key %s is not encrypted", key)
+	}
+
+	nonce := b[1:9]
+	msg := b[9 : len(b)-16]
+	var mac [16]byte
+	copy(mac[:], b[len(b)-16:])
+
+	dec, err := chacha20poly1305.DecryptAndVerify(es.key, nonce, msg, mac, []byte(key))
+	if err != nil {
+		return nil, errors.New("decrypting value failed")
+	}
+
+	return dec, nil
+}
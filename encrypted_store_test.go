@@ -0,0 +1,39 @@
+package hap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	inner := NewMemStore()
+	st, err := NewEncryptedStore(inner, bytes.Repeat([]byte{0x1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Set("keypair", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := inner.Get("keypair")
+	if bytes.Contains(raw, []byte("secret")) {
+		t.Fatal("value is not encrypted")
+	}
+
+	b, err := st.Get("keypair")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := b, []byte("secret"); !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// Values must not be valid under a different key.
+	inner.Set("other", raw)
+	if _, err := st.Get("other"); err == nil {
+		t.Fatal("expected error")
+	}
+}
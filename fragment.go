@@ -0,0 +1,162 @@
+package hap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+const (
+	tlvFragmentData byte = 0x0C
+	tlvFragmentLast byte = 0x0D
+
+	// fragmentSize is the max size of a fragment.
+	fragmentSize = 1024
+)
+
+// fragments are the fragments of a connection.
+type fragments struct {
+	in  bytes.Buffer // received fragments
+	out [][]byte     // fragments of a response which were not sent yet
+
+	// enabled is true if the controller supports fragments.
+	enabled bool
+}
+
+// parseFragment returns the tag and data of a fragment.
+// ok is false if b is not a fragment.
+func parseFragment(b []byte) (tag byte, data []byte, ok bool) {
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return 0, nil, false
+		}
+
+		if t := b[0]; t != tlvFragmentData && t != tlvFragmentLast {
+			return 0, nil, false
+		} else if tag != 0 && t != tag {
+			return 0, nil, false
+		} else {
+			tag = t
+		}
+
+		data = append(data, b[2:2+int(b[1])]...)
+		b = b[2+int(b[1]):]
+	}
+
+	return tag, data, tag != 0
+}
+
+// fragmentTLV returns data as tlv8 items with the given tag.
+// Data longer than 255 bytes is split into several items.
+func fragmentTLV(tag byte, data []byte) []byte {
+	var b []byte
+	for {
+		n := len(data)
+		if n > 255 {
+			n = 255
+		}
+
+		b = append(b, tag, byte(n))
+		b = append(b, data[:n]...)
+		data = data[n:]
+
+		if len(data) == 0 {
+			return b
+		}
+	}
+}
+
+// fragmentWriter buffers the response body.
+type fragmentWriter struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *fragmentWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// fragmented returns a handler which reassembles fragmented requests
+// before calling next. A response larger than the fragment size is
+// sent in fragments if the controller sent fragments before.
+//
+// Every fragment except the last is acknowledged by the receiver with
+// an empty fragment.
+func (s *Server) fragmented(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c := reqConn(req)
+		if tag, data, ok := parseFragment(b); ok {
+			f := s.fragments(c)
+			f.enabled = true
+
+			switch {
+			case tag == tlvFragmentData && len(data) == 0:
+				// The controller acknowledged a fragment of the response.
+				if len(f.out) == 0 {
+					s.logInfo(req).Println("no more fragments")
+					res.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				res.Write(f.out[0])
+				f.out = f.out[1:]
+				return
+			case f.in.Len()+len(data) > s.maxRequestSize():
+				s.logInfo(req).Println("fragmented request too large")
+				f.in.Reset()
+				res.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			case tag == tlvFragmentData:
+				f.in.Write(data)
+				res.Write(fragmentTLV(tlvFragmentData, nil))
+				return
+			default:
+				f.in.Write(data)
+				b = append([]byte{}, f.in.Bytes()...)
+				f.in.Reset()
+			}
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		w := &fragmentWriter{ResponseWriter: res}
+		next.ServeHTTP(w, req)
+
+		body := w.buf.Bytes()
+		f := s.fragments(c)
+		if !f.enabled || len(body) <= fragmentSize {
+			res.Write(body)
+			return
+		}
+
+		var out [][]byte
+		for len(body) > fragmentSize {
+			out = append(out, fragmentTLV(tlvFragmentData, body[:fragmentSize]))
+			body = body[fragmentSize:]
+		}
+		out = append(out, fragmentTLV(tlvFragmentLast, body))
+
+		res.Write(out[0])
+		f.out = out[1:]
+	})
+}
+
+// fragments returns the fragments of the connection c.
+func (s *Server) fragments(c net.Conn) *fragments {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	f, ok := s.frags[c]
+	if !ok {
+		f = &fragments{}
+		s.frags[c] = f
+	}
+
+	return f
+}
@@ -0,0 +1,61 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFragments(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := bytes.Repeat([]byte{0x1, 0x1, 0xA}, 1000)
+	h := s.fragmented(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		if !bytes.Equal(b, msg) {
+			t.Fatal("invalid message")
+		}
+		// respond with the same message
+		res.Write(b)
+	}))
+
+	send := func(b []byte) []byte {
+		req := httptest.NewRequest(http.MethodPost, "/pair-setup", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Body.Bytes()
+	}
+
+	ack := fragmentTLV(tlvFragmentData, nil)
+	if is, want := send(fragmentTLV(tlvFragmentData, msg[:2000])), ack; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	var resp []byte
+	b := send(fragmentTLV(tlvFragmentLast, msg[2000:]))
+	for {
+		tag, data, ok := parseFragment(b)
+		if !ok {
+			t.Fatalf("invalid fragment %v", b)
+		}
+
+		resp = append(resp, data...)
+		if tag == tlvFragmentLast {
+			break
+		}
+
+		b = send(ack)
+	}
+
+	if is, want := resp, msg; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", len(is), len(want))
+	}
+}
@@ -3,41 +3,307 @@ package hap
 import (
 	"github.com/brutella/hap/log"
 
+	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type fsStore struct {
 	Path string
+
+	dirMode  os.FileMode
+	fileMode os.FileMode
+	keyMode  os.FileMode
+	uid, gid int
+
+	dirModeSet bool // dirMode was set with FsDirMode
+}
+
+// An FsStoreOption configures a filesystem store.
+type FsStoreOption func(*fsStore)
+
+// FsDirMode sets the permissions of the store directory (default 0750).
+// Without this option, only the permissions of a new directory are set.
+func FsDirMode(mode os.FileMode) FsStoreOption {
+	return func(fs *fsStore) {
+		fs.dirMode = mode
+		fs.dirModeSet = true
+	}
+}
+
+// FsFileMode sets the permissions of the files in the store (default 0640).
+func FsFileMode(mode os.FileMode) FsStoreOption {
+	return func(fs *fsStore) {
+		fs.fileMode = mode
+	}
+}
+
+// FsKeyFileMode sets the permissions of the file, which contains
+// the private key of the accessory (default 0600).
+func FsKeyFileMode(mode os.FileMode) FsStoreOption {
+	return func(fs *fsStore) {
+		fs.keyMode = mode
+	}
+}
+
+// FsOwner sets the owner of the store directory and files.
+// A uid or gid of -1 leaves the value unchanged.
+func FsOwner(uid, gid int) FsStoreOption {
+	return func(fs *fsStore) {
+		fs.uid = uid
+		fs.gid = gid
+	}
+}
+
+func newFsStore(dir string, opts ...FsStoreOption) *fsStore {
+	fs := &fsStore{
+		Path:     dir,
+		dirMode:  0750,
+		fileMode: 0640,
+		keyMode:  0600,
+		uid:      -1,
+		gid:      -1,
+	}
+
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	return fs
 }
 
-func NewFsStore(dir string) Store {
+// NewFsStore returns a store which saves every key-value
+// pair in a separate file in dir. It panics if dir can't be
+// created. Failing to set the permissions or the owner of dir
+// is logged. Use OpenFsStore to handle these errors.
+func NewFsStore(dir string, opts ...FsStoreOption) Store {
+	fs := newFsStore(dir, opts...)
+
 	// Prepare filesystem directory
 	// Ensure that execute permission bit is set on all created dirs
 	// Read http://unix.stackexchange.com/questions/21251/why-do-directories-need-the-executable-x-permission-to-be-opened
-	err := os.MkdirAll(dir, 0750)
+	created, err := fs.mkdir()
 	if err != nil {
 		log.Info.Panic(err)
 	}
 
-	return &fsStore{dir}
+	if err := fs.prepareDir(created); err != nil {
+		log.Info.Println(err)
+	}
+
+	return fs
+}
+
+// OpenFsStore returns a store like NewFsStore, but returns an error
+// if dir can't be created or its permissions or owner can't be set.
+func OpenFsStore(dir string, opts ...FsStoreOption) (Store, error) {
+	fs := newFsStore(dir, opts...)
+
+	created, err := fs.mkdir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.prepareDir(created); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// mkdir creates the store directory and returns
+// true if it didn't exist before.
+func (fs *fsStore) mkdir() (bool, error) {
+	_, err := os.Stat(fs.Path)
+	created := os.IsNotExist(err)
+
+	return created, os.MkdirAll(fs.Path, fs.dirMode)
+}
+
+// prepareDir sets the permissions and the owner of the store
+// directory. The permissions and the owner of an existing directory
+// (e.g. a shared config directory) are only changed when they
+// were set explicitly with FsDirMode or FsOwner.
+func (fs *fsStore) prepareDir(created bool) error {
+	// The permissions of a new directory are limited by the umask.
+	if created || fs.dirModeSet {
+		if err := os.Chmod(fs.Path, fs.dirMode); err != nil {
+			return err
+		}
+	}
+
+	return fs.chown(fs.Path)
+}
+
+// ErrCorrupt is returned when reading a value whose checksum doesn't match.
+var ErrCorrupt = errors.New("value is corrupt")
+
+const (
+	// checksumDir contains a file for every value with the CRC-32
+	// checksums of the value. The values are stored unchanged, which
+	// keeps the files readable by older versions and other tools.
+	// Values without checksum file were written by older versions.
+	checksumDir   = "checksums"
+	quarantineDir = "quarantine"
+)
+
+func (fs *fsStore) checksumPath(key string) string {
+	return filepath.Join(fs.Path, checksumDir, sanitizeFilename(key))
+}
+
+// checksums returns the checksums of the value for key
+// or nil, if the value has no checksum file.
+func (fs *fsStore) checksums(key string) ([]uint32, error) {
+	b, err := os.ReadFile(fs.checksumPath(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 || len(b)%4 != 0 {
+		return nil, ErrCorrupt
+	}
+
+	var crcs []uint32
+	for ; len(b) > 0; b = b[4:] {
+		crcs = append(crcs, binary.BigEndian.Uint32(b))
+	}
+
+	return crcs, nil
+}
+
+// writeChecksums replaces the checksum file of key.
+func (fs *fsStore) writeChecksums(key string, crcs ...uint32) error {
+	if err := os.MkdirAll(filepath.Join(fs.Path, checksumDir), fs.dirMode); err != nil {
+		return err
+	}
+
+	b := make([]byte, 4*len(crcs))
+	for i, crc := range crcs {
+		binary.BigEndian.PutUint32(b[4*i:], crc)
+	}
+
+	return fs.writeFile(fs.checksumPath(key), b, fs.fileMode)
 }
 
+// Set writes the value to a temporary file and renames it afterwards.
+// This makes sure that the file for the corresponding key always
+// contains the old or the new value – even if the process crashes.
+//
+// The checksum of the value is written to a separate file. Until the
+// value is renamed, the checksum file contains the checksums of the
+// old and the new value, so that either value is valid after a crash.
 func (fs *fsStore) Set(key string, value []byte) error {
-	return os.WriteFile(fs.filePathToFile(key), value, 0640)
+	mode := fs.fileMode
+	if strings.HasSuffix(key, "keypair") {
+		mode = fs.keyMode
+	}
+
+	crc := crc32.ChecksumIEEE(value)
+	crcs, err := fs.checksums(key)
+	if err != nil && err != ErrCorrupt {
+		return err
+	}
+
+	// A value without checksum file is still valid after a crash.
+	if crcs == nil {
+		if b, err := os.ReadFile(fs.filePathToFile(key)); err == nil {
+			crcs = []uint32{crc32.ChecksumIEEE(b)}
+		}
+	}
+
+	if err := fs.writeChecksums(key, append(crcs, crc)...); err != nil {
+		return err
+	}
+
+	if err := fs.writeFile(fs.filePathToFile(key), value, mode); err != nil {
+		return err
+	}
+
+	return fs.writeChecksums(key, crc)
 }
 
+// writeFile writes b to a temporary file, which is renamed to path.
+func (fs *fsStore) writeFile(path string, b []byte, mode os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, mode); err != nil {
+		return err
+	}
+
+	// The permissions of an existing file are not changed by
+	// WriteFile and the umask applies to new files.
+	if err := os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+
+	if err := fs.chown(tmp); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (fs *fsStore) chown(path string) error {
+	if fs.uid == -1 && fs.gid == -1 {
+		return nil
+	}
+
+	return os.Chown(path, fs.uid, fs.gid)
+}
+
+// Get returns the value for key. ErrCorrupt is returned
+// if the value doesn't match its checksum.
 func (fs *fsStore) Get(key string) ([]byte, error) {
-	return os.ReadFile(fs.filePathToFile(key))
+	b, err := os.ReadFile(fs.filePathToFile(key))
+	if err != nil {
+		return nil, err
+	}
+
+	crcs, err := fs.checksums(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if crcs == nil {
+		// written by an older version
+		return b, nil
+	}
+
+	crc := crc32.ChecksumIEEE(b)
+	for _, c := range crcs {
+		if c == crc {
+			return b, nil
+		}
+	}
+
+	return nil, ErrCorrupt
 }
 
 // Delete removes the file for the corresponding key.
+// Deleting a key which doesn't exist is not an error.
 func (fs *fsStore) Delete(key string) error {
-	return os.Remove(fs.filePathToFile(key))
+	// A value without checksum file is still valid after a crash.
+	if err := os.Remove(fs.checksumPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err := os.Remove(fs.filePathToFile(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
 }
 
 func (fs *fsStore) KeysWithSuffix(suffix string) (keys []string, err error) {
@@ -45,8 +311,12 @@ func (fs *fsStore) KeysWithSuffix(suffix string) (keys []string, err error) {
 
 	if infos, err = ioutil.ReadDir(fs.Path); err == nil {
 		for _, info := range infos {
-			if info.IsDir() == false && strings.HasSuffix(info.Name(), suffix) == true {
-				keys = append(keys, info.Name())
+			if info.IsDir() {
+				continue
+			}
+
+			if key := unescapeFilename(info.Name()); strings.HasSuffix(key, suffix) {
+				keys = append(keys, key)
 			}
 		}
 	}
@@ -54,6 +324,75 @@ func (fs *fsStore) KeysWithSuffix(suffix string) (keys []string, err error) {
 	return
 }
 
+// Verify checks the checksum of every value and makes sure that
+// pairings and the keypair contain valid json. Corrupt files are moved
+// into the quarantine sub-directory, where they can be inspected.
+// The keys of the quarantined files are returned.
+func (fs *fsStore) Verify() ([]string, error) {
+	infos, err := ioutil.ReadDir(fs.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, info := range infos {
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			continue
+		}
+
+		key := unescapeFilename(info.Name())
+		err := fs.verify(key)
+		if err == nil || os.IsNotExist(err) {
+			continue
+		}
+
+		var js *json.SyntaxError
+		if err != ErrCorrupt && !errors.As(err, &js) {
+			return keys, err
+		}
+
+		if err := fs.quarantine(info.Name()); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (fs *fsStore) verify(key string) error {
+	b, err := fs.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(key, ".pairing") || key == "keypair" || key == keyJournal {
+		var v interface{}
+		return json.Unmarshal(b, &v)
+	}
+
+	return nil
+}
+
+func (fs *fsStore) quarantine(name string) error {
+	dir := filepath.Join(fs.Path, quarantineDir)
+	if err := os.MkdirAll(dir, fs.dirMode); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(dir, fmt.Sprintf("%s.%d", name, time.Now().Unix()))
+	if err := os.Rename(filepath.Join(fs.Path, name), dst); err != nil {
+		return err
+	}
+
+	err := os.Rename(filepath.Join(fs.Path, checksumDir, name), dst+".crc")
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
 func (fs *fsStore) filePathToFile(file string) string {
 	return filepath.Join(fs.Path, sanitizeFilename(file))
 }
@@ -62,8 +401,24 @@ type storer struct {
 	Store
 }
 
+// withContext returns a storer which uses the context-aware methods
+// of the underlying store, if the store implements StoreContext.
+// Every operation is canceled after timeout (if greater than 0).
+func (st *storer) withContext(ctx context.Context, timeout time.Duration) *storer {
+	sc, ok := st.Store.(StoreContext)
+	if !ok {
+		return st
+	}
+
+	return &storer{&ctxStore{sc, ctx, timeout}}
+}
+
 // migrate migrates data from previous versions.
 func migrate(st *storer) error {
+	if st.readOnly() {
+		return nil
+	}
+
 	s, _ := st.GetString("schema")
 	switch s {
 	case "": // schema is not set by previous hc version
@@ -159,18 +514,15 @@ func (st *storer) Pairing(name string) (Pairing, error) {
 }
 
 // SavePairing saves the given pairing.
+// The change is journaled to make it crash-consistent.
 func (st *storer) SavePairing(pairing Pairing) error {
-	b, err := json.Marshal(&pairing)
-	if err != nil {
-		return err
-	}
-
-	return st.Set(keyForPairingName(pairing.Name), b)
+	return st.journaled(journalEntry{journalOpSave, pairing})
 }
 
 // DeletePairing deletes the pairing with a given name.
+// The change is journaled to make it crash-consistent.
 func (st *storer) DeletePairing(name string) error {
-	return st.Delete(keyForPairingName(name))
+	return st.journaled(journalEntry{journalOpDelete, Pairing{Name: name}})
 }
 
 // Pairings returns all known pairings.
@@ -223,6 +575,17 @@ func keyForPairingName(s string) string {
 }
 
 // sanitizeFilename returns a valid file name by removing invalidcharacters (e.g. colon ":" which is not allowed in file names on Window)
+// Path separators are escaped, which lets keys contain slashes (e.g. "livingroom/keypair").
 func sanitizeFilename(filename string) string {
-	return strings.Replace(filename, ":", "", -1)
+	return filenameEscaper.Replace(strings.Replace(filename, ":", "", -1))
+}
+
+var (
+	filenameEscaper   = strings.NewReplacer("%", "%25", "/", "%2F", "\\", "%5C")
+	filenameUnescaper = strings.NewReplacer("%25", "%", "%2F", "/", "%5C", "\\")
+)
+
+// unescapeFilename returns the key for a file name.
+func unescapeFilename(filename string) string {
+	return filenameUnescaper.Replace(filename)
 }
@@ -0,0 +1,177 @@
+package hap
+
+import (
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFsStorePermissions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	st := NewFsStore(dir, FsDirMode(0700), FsFileMode(0644))
+
+	st.Set("uuid", []byte("ABC"))
+	st.Set("keypair", []byte("secret"))
+
+	tests := []struct {
+		path string
+		mode os.FileMode
+	}{
+		{dir, 0700},
+		{filepath.Join(dir, "uuid"), 0644},
+		{filepath.Join(dir, "keypair"), 0600},
+	}
+
+	for _, test := range tests {
+		fi, err := os.Stat(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := fi.Mode().Perm(), test.mode; is != want {
+			t.Fatalf("%s: %v != %v", test.path, is, want)
+		}
+	}
+}
+
+func TestFsStoreVerify(t *testing.T) {
+	dir := t.TempDir()
+	st := newFsStore(dir)
+
+	st.Set("uuid", []byte("ABC"))
+	st.Set("a.pairing", []byte(`{"Name":"a"}`))
+	st.Set("b.pairing", []byte(`{"Name":"b"}`))
+
+	// flip a bit of the pairing value
+	path := st.filePathToFile("a.pairing")
+	b, _ := os.ReadFile(path)
+	b[2] ^= 0x1
+	os.WriteFile(path, b, 0640)
+
+	// legacy files without checksum
+	os.WriteFile(st.filePathToFile("c.pairing"), []byte(`{"Name":"c"}`), 0640)
+	os.WriteFile(st.filePathToFile("d.pairing"), []byte(`{"Name":`), 0640)
+
+	if _, err := st.Get("a.pairing"); err != ErrCorrupt {
+		t.Fatal(err)
+	}
+
+	keys, err := st.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := strings.Join(keys, ","), "a.pairing,d.pairing"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	ks, _ := st.KeysWithSuffix(".pairing")
+	if is, want := strings.Join(ks, ","), "b.pairing,c.pairing"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// a.pairing is quarantined with its checksum file
+	fis, _ := os.ReadDir(filepath.Join(dir, quarantineDir))
+	if is, want := len(fis), 3; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestFsStoreLegacyValues(t *testing.T) {
+	st := newFsStore(t.TempDir())
+
+	// A value of an older version, which ends like
+	// the checksum trailer of a previous format.
+	want := []byte("value\x00crc\x01\x02\x03\x04")
+	os.WriteFile(st.filePathToFile("a"), want, 0640)
+
+	is, err := st.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(is, want) {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	// Values are stored unchanged.
+	if err := st.Set("b", want); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(st.filePathToFile("b"))
+	if !bytes.Equal(b, want) {
+		t.Fatalf("%q != %q", b, want)
+	}
+
+	if is, _ := st.Get("b"); !bytes.Equal(is, want) {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
+
+func TestFsStoreInterruptedSet(t *testing.T) {
+	st := newFsStore(t.TempDir())
+	st.Set("a", []byte("old"))
+
+	// The process crashed before the value was renamed.
+	crcs := []uint32{crc32.ChecksumIEEE([]byte("old")), crc32.ChecksumIEEE([]byte("new"))}
+	st.writeChecksums("a", crcs...)
+
+	if is, err := st.Get("a"); err != nil || string(is) != "old" {
+		t.Fatal(string(is), err)
+	}
+
+	// The process crashed after the value was renamed.
+	os.WriteFile(st.filePathToFile("a"), []byte("new"), 0640)
+	if is, err := st.Get("a"); err != nil || string(is) != "new" {
+		t.Fatal(string(is), err)
+	}
+
+	os.WriteFile(st.filePathToFile("a"), []byte("bad"), 0640)
+	if _, err := st.Get("a"); err != ErrCorrupt {
+		t.Fatal(err)
+	}
+
+	// The checksum file is removed with the value.
+	st.Delete("a")
+	if _, err := os.Stat(st.checksumPath("a")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestFsStoreExistingDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The permissions of an existing directory are kept.
+	NewFsStore(dir)
+	fi, _ := os.Stat(dir)
+	if is, want := fi.Mode().Perm(), os.FileMode(0755); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// unless they are set explicitly
+	NewFsStore(dir, FsDirMode(0700))
+	fi, _ = os.Stat(dir)
+	if is, want := fi.Mode().Perm(), os.FileMode(0700); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestOpenFsStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0640)
+
+	if _, err := OpenFsStore(file); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := OpenFsStore(filepath.Join(t.TempDir(), "db")); err != nil {
+		t.Fatal(err)
+	}
+}
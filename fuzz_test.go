@@ -0,0 +1,121 @@
+//go:build go1.18
+// +build go1.18
+
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/tlv8"
+
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func fuzzServer(t testing.TB) *Server {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pin = "00102003"
+
+	return s
+}
+
+func fuzzRequest(h http.HandlerFunc, path string, b []byte) {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	h(httptest.NewRecorder(), req)
+}
+
+func fuzzTLV8(f *testing.F, v interface{}) []byte {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	return b
+}
+
+// FuzzPairSetup sends the messages M1, M3 and M5 to /pair-setup.
+func FuzzPairSetup(f *testing.F) {
+	m1 := fuzzTLV8(f, struct {
+		Method byte `tlv8:"0"`
+		State  byte `tlv8:"6"`
+	}{MethodPair, M1})
+	m3 := fuzzTLV8(f, struct {
+		PublicKey []byte `tlv8:"3"`
+		Proof     []byte `tlv8:"4"`
+		State     byte   `tlv8:"6"`
+	}{bytes.Repeat([]byte{0x01}, 384), bytes.Repeat([]byte{0x02}, 64), M3})
+	m5 := fuzzTLV8(f, struct {
+		EncryptedData []byte `tlv8:"5"`
+		State         byte   `tlv8:"6"`
+	}{[]byte{0x01}, M5})
+	f.Add(m1, m3, m5)
+	f.Add(m1, m5, m5)
+	f.Add(m5, m3, m1)
+
+	f.Fuzz(func(t *testing.T, m1, m3, m5 []byte) {
+		s := fuzzServer(t)
+		for _, m := range [][]byte{m1, m3, m5} {
+			fuzzRequest(s.pairSetup, "/pair-setup", m)
+		}
+	})
+}
+
+// FuzzPairVerify sends the messages M1 and M3 to /pair-verify.
+func FuzzPairVerify(f *testing.F) {
+	m1 := fuzzTLV8(f, struct {
+		Method    byte   `tlv8:"0"`
+		PublicKey []byte `tlv8:"3"`
+		State     byte   `tlv8:"6"`
+	}{MethodPair, bytes.Repeat([]byte{0x01}, 32), M1})
+	m3 := fuzzTLV8(f, struct {
+		Method        byte   `tlv8:"0"`
+		EncryptedData []byte `tlv8:"5"`
+		State         byte   `tlv8:"6"`
+	}{MethodPair, []byte{0x01}, M3})
+	f.Add(m1, m3)
+	f.Add(m3, m3)
+
+	s := fuzzServer(f)
+	f.Fuzz(func(t *testing.T, m1, m3 []byte) {
+		fuzzRequest(s.pairVerify, "/pair-verify", m1)
+		fuzzRequest(s.pairVerify, "/pair-verify", m3)
+	})
+}
+
+// FuzzSessionDecrypt decrypts frames of an encrypted session.
+func FuzzSessionDecrypt(f *testing.F) {
+	shared := bytes.Repeat([]byte{0x01}, 32)
+
+	// The controller encrypts with the decryption key of the accessory.
+	ctl, err := newSession(shared, Pairing{})
+	if err != nil {
+		f.Fatal(err)
+	}
+	ctl.encryptKey = ctl.decryptKey
+
+	for _, n := range []int{0, 1, packetLengthMax, packetLengthMax + 1} {
+		ctl.encryptCount = 0
+		r, err := ctl.Encrypt(bytes.NewReader(bytes.Repeat([]byte{0xaa}, n)))
+		if err != nil {
+			f.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(r)
+		f.Add(b)
+	}
+	f.Add([]byte{0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		s, err := newSession(shared, Pairing{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s.Decrypt(bytes.NewReader(b), 4*packetLengthMax)
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"reflect"
-	"regexp"
 	"sort"
 	"strings"
 	"text/template"
@@ -160,7 +159,10 @@ func CharacteristicGoCode(char *gen.CharacteristicMetadata) ([]byte, error) {
 	t := template.New("Test Template")
 
 	t, err = t.Parse(CharStructTemplate)
-	t.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	err = t.Execute(&buf, data)
 
 	return buf.Bytes(), err
 }
@@ -240,13 +242,9 @@ func defaultValue(char *gen.CharacteristicMetadata) interface{} {
 // minifyUUID returns a minified version of s by removing unneeded characters.
 // For example the UUID "0000008C-0000-1000-8000-0026BB765291" the Window Covering
 // service will be minified to "8C".
+// Custom UUIDs are not minified.
 func minifyUUID(s string) string {
-	authRegexp := regexp.MustCompile(`^([0-9a-fA-F]*)`)
-	if str := authRegexp.FindString(s); len(str) > 0 {
-		return strings.TrimLeft(str, "0")
-	}
-
-	return s
+	return characteristic.TypeString(s)
 }
 
 // Return the name of the characteristic type name
@@ -79,7 +79,10 @@ func ServiceGoCode(svc *gen.ServiceMetadata, chars []*gen.CharacteristicMetadata
 	t := template.New("Test Template")
 
 	t, err = t.Parse(ServiceStructTemplate)
-	t.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	err = t.Execute(&buf, data)
 
 	return buf.Bytes(), err
 }
@@ -13,6 +13,7 @@ const (
 	JsonStatusOperationTimedOut           = -70408
 	JsonStatusResourceDoesNotExist        = -70409
 	JsonStatusInvalidValueInRequest       = -70410
+	JsonStatusNotAllowedInCurrentState    = -70412
 )
 
 // Error codes for TLV8 communication.
@@ -34,6 +35,9 @@ const (
 
 	// HTTPContentTypeHAPJson is the HTTP content type for json data
 	HTTPContentTypeHAPJson = "application/hap+json"
+
+	// HTTPContentTypeImageJPEG is the HTTP content type for snapshots
+	HTTPContentTypeImageJPEG = "image/jpeg"
 )
 
 const (
@@ -45,6 +49,17 @@ const (
 	MethodListPairings  byte = 0x5
 )
 
+const (
+	// PairingFlagTransient requests a transient pair-setup, which
+	// establishes a session without saving a pairing. It is only
+	// allowed while unpaired, and the session has no access to
+	// accessory data.
+	PairingFlagTransient uint32 = 0x00000010
+	// PairingFlagSplit requests a split pair-setup, which reuses the
+	// setup code of a previous pair-setup.
+	PairingFlagSplit uint32 = 0x01000000
+)
+
 const (
 	// PermissionUser is the user permission for a paired controller.
 	PermissionUser byte = 0x0
@@ -0,0 +1,538 @@
+package hapctl
+
+import (
+	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/hkdf"
+
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// frameLengthMax is the maximum length of an encrypted frame.
+const frameLengthMax = 0x400
+
+var noDeadline time.Time
+
+// ErrClosed is returned when the connection is closed.
+var ErrClosed = errors.New("hapctl: connection closed")
+
+// ID identifies a characteristic.
+type ID struct {
+	Aid uint64 `json:"aid"`
+	Iid uint64 `json:"iid"`
+}
+
+func (id ID) String() string {
+	return fmt.Sprintf("%d.%d", id.Aid, id.Iid)
+}
+
+// Value is the value of a characteristic.
+type Value struct {
+	ID
+	Value interface{} `json:"value"`
+}
+
+// Event is an event notification of a characteristic.
+type Event Value
+
+// Accessory is an accessory of the accessory database (GET /accessories).
+type Accessory struct {
+	Aid      uint64    `json:"aid"`
+	Services []Service `json:"services"`
+}
+
+// Service is a service of an accessory.
+type Service struct {
+	Iid             uint64           `json:"iid"`
+	Type            string           `json:"type"`
+	Primary         bool             `json:"primary,omitempty"`
+	Hidden          bool             `json:"hidden,omitempty"`
+	Linked          []uint64         `json:"linked,omitempty"`
+	Characteristics []Characteristic `json:"characteristics"`
+}
+
+// Characteristic is a characteristic of a service.
+type Characteristic struct {
+	Iid         uint64      `json:"iid"`
+	Type        string      `json:"type"`
+	Permissions []string    `json:"perms"`
+	Format      string      `json:"format"`
+	Value       interface{} `json:"value,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Unit        string      `json:"unit,omitempty"`
+	MinValue    interface{} `json:"minValue,omitempty"`
+	MaxValue    interface{} `json:"maxValue,omitempty"`
+	StepValue   interface{} `json:"minStep,omitempty"`
+}
+
+// A StatusError is the HAP status code of a failed request
+// (e.g. -70402 if the accessory is not reachable).
+type StatusError struct {
+	ID
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: status %d", e.ID, e.Status)
+}
+
+// Conn is a verified and encrypted connection to an accessory.
+type Conn struct {
+	// EventFunc is called with the event notifications of the
+	// subscribed characteristics. It is called from the goroutine,
+	// which reads the connection, and must not block.
+	EventFunc func(e Event)
+
+	sc   *secureConn
+	addr string
+
+	mu        sync.Mutex // serializes requests
+	responses chan *response
+	done      chan struct{}
+	err       error // read error, valid after done is closed
+}
+
+type response struct {
+	status int
+	body   []byte
+}
+
+// Dial connects to the paired accessory at addr ("host:port"),
+// verifies the pairing and returns the encrypted connection.
+func (ctl *Controller) Dial(ctx context.Context, addr string, p Pairing) (*Conn, error) {
+	nc, err := dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &plainConn{nc, bufio.NewReader(nc), addr}
+	shared, err := ctl.pairVerify(ctx, pc, p)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	sc, err := newSecureConn(nc, shared)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	c := &Conn{
+		sc:        sc,
+		addr:      addr,
+		responses: make(chan *response, 1),
+		done:      make(chan struct{}),
+	}
+	go c.read()
+
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.sc.Close()
+}
+
+// Done returns a channel, which is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Accessories returns the accessory database.
+func (c *Conn) Accessories(ctx context.Context) ([]Accessory, error) {
+	res, err := c.request(ctx, http.MethodGet, "/accessories", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.status != http.StatusOK {
+		return nil, statusError(res)
+	}
+
+	var v struct {
+		Accessories []Accessory `json:"accessories"`
+	}
+	if err := json.Unmarshal(res.body, &v); err != nil {
+		return nil, err
+	}
+
+	return v.Accessories, nil
+}
+
+// Get returns the values of the characteristics.
+func (c *Conn) Get(ctx context.Context, ids ...ID) ([]Value, error) {
+	var strs []string
+	for _, id := range ids {
+		strs = append(strs, id.String())
+	}
+
+	res, err := c.request(ctx, http.MethodGet, "/characteristics?id="+strings.Join(strs, ","), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.status != http.StatusOK && res.status != http.StatusMultiStatus {
+		return nil, statusError(res)
+	}
+
+	var v struct {
+		Characteristics []struct {
+			Value
+			Status int `json:"status"`
+		} `json:"characteristics"`
+	}
+	if err := json.Unmarshal(res.body, &v); err != nil {
+		return nil, err
+	}
+
+	var vs []Value
+	for _, ch := range v.Characteristics {
+		if ch.Status != 0 {
+			return nil, &StatusError{ch.ID, ch.Status}
+		}
+		vs = append(vs, ch.Value)
+	}
+
+	return vs, nil
+}
+
+// Put writes the values of the characteristics.
+func (c *Conn) Put(ctx context.Context, vs ...Value) error {
+	return c.put(ctx, vs, 0)
+}
+
+// PutTimed writes the values of the characteristics with a timed
+// write, which the accessory executes if the values are written
+// within ttl after the write was prepared. Characteristics with
+// the permission "tw" must be written with a timed write.
+func (c *Conn) PutTimed(ctx context.Context, ttl time.Duration, vs ...Value) error {
+	pid, err := c.Prepare(ctx, ttl)
+	if err != nil {
+		return err
+	}
+
+	return c.PutPrepared(ctx, pid, vs...)
+}
+
+// Prepare prepares a timed write, which must be executed
+// with PutPrepared within ttl, and returns its transaction id.
+func (c *Conn) Prepare(ctx context.Context, ttl time.Duration) (uint64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	pid := binary.LittleEndian.Uint64(b[:])>>1 | 1 // non-zero
+
+	body, err := json.Marshal(struct {
+		Ttl uint64 `json:"ttl"`
+		Pid uint64 `json:"pid"`
+	}{uint64(ttl / time.Millisecond), pid})
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.request(ctx, http.MethodPut, "/prepare", body)
+	if err != nil {
+		return 0, err
+	}
+
+	if res.status != http.StatusOK {
+		return 0, statusError(res)
+	}
+
+	return pid, nil
+}
+
+// PutPrepared executes the timed write with the transaction id pid.
+func (c *Conn) PutPrepared(ctx context.Context, pid uint64, vs ...Value) error {
+	return c.put(ctx, vs, pid)
+}
+
+// Subscribe enables event notifications of the characteristics,
+// which are delivered to EventFunc.
+func (c *Conn) Subscribe(ctx context.Context, ids ...ID) error {
+	return c.subscribe(ctx, ids, true)
+}
+
+// Unsubscribe disables event notifications of the characteristics.
+func (c *Conn) Unsubscribe(ctx context.Context, ids ...ID) error {
+	return c.subscribe(ctx, ids, false)
+}
+
+func (c *Conn) subscribe(ctx context.Context, ids []ID, ev bool) error {
+	type subscription struct {
+		ID
+		Events bool `json:"ev"`
+	}
+
+	var subs []subscription
+	for _, id := range ids {
+		subs = append(subs, subscription{id, ev})
+	}
+
+	return c.put(ctx, subs, 0)
+}
+
+func (c *Conn) put(ctx context.Context, v interface{}, pid uint64) error {
+	b, err := json.Marshal(struct {
+		Characteristics interface{} `json:"characteristics"`
+		Pid             uint64      `json:"pid,omitempty"`
+	}{v, pid})
+	if err != nil {
+		return err
+	}
+
+	res, err := c.request(ctx, http.MethodPut, "/characteristics", b)
+	if err != nil {
+		return err
+	}
+
+	switch res.status {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusMultiStatus:
+		var v struct {
+			Characteristics []struct {
+				ID
+				Status int `json:"status"`
+			} `json:"characteristics"`
+		}
+		if err := json.Unmarshal(res.body, &v); err != nil {
+			return err
+		}
+
+		for _, ch := range v.Characteristics {
+			if ch.Status != 0 {
+				return &StatusError{ch.ID, ch.Status}
+			}
+		}
+
+		return nil
+	}
+
+	return statusError(res)
+}
+
+// statusError returns the error of an unexpected response.
+func statusError(res *response) error {
+	var v struct {
+		Status int `json:"status"`
+	}
+	if err := json.Unmarshal(res.body, &v); err == nil && v.Status != 0 {
+		return &StatusError{Status: v.Status}
+	}
+
+	return fmt.Errorf("hapctl: unexpected response %d", res.status)
+}
+
+// request sends the request and waits for the response.
+func (c *Conn) request(ctx context.Context, method, path string, body []byte) (*response, error) {
+	return c.requestType(ctx, method, path, contentTypeJSON, body)
+}
+
+func (c *Conn) requestType(ctx context.Context, method, path, contentType string, body []byte) (*response, error) {
+	req, err := http.NewRequest(method, "http://"+c.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.sc.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-c.responses:
+		return res, nil
+	case <-c.done:
+		return nil, c.err
+	case <-ctx.Done():
+		// The response can't be assigned to
+		// the next request anymore.
+		c.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// read reads responses and event notifications until the connection is closed.
+func (c *Conn) read() {
+	defer close(c.done)
+
+	r := bufio.NewReader(c.sc)
+	for {
+		res, err := http.ReadResponse(r, nil)
+		if err != nil {
+			c.err = ErrClosed
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				c.err = err
+			}
+			return
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		// Events are sent as "EVENT/1.0", which is replaced by
+		// "HTTP/1.0" in secureConn. Responses are "HTTP/1.1".
+		if res.ProtoMinor == 0 {
+			c.event(body)
+			continue
+		}
+
+		c.responses <- &response{res.StatusCode, body}
+	}
+}
+
+func (c *Conn) event(body []byte) {
+	var v struct {
+		Characteristics []Value `json:"characteristics"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return
+	}
+
+	if c.EventFunc == nil {
+		return
+	}
+
+	for _, ch := range v.Characteristics {
+		c.EventFunc(Event(ch))
+	}
+}
+
+// secureConn encrypts and decrypts the data of a connection
+// with the session keys of pair-verify.
+type secureConn struct {
+	net.Conn
+
+	encKey   [32]byte
+	decKey   [32]byte
+	encCount uint64
+	decCount uint64
+	wmu      sync.Mutex
+
+	r   *bufio.Reader
+	buf []byte // decrypted, unread data
+}
+
+func newSecureConn(c net.Conn, shared []byte) (*secureConn, error) {
+	salt := []byte("Control-Salt")
+	enc, err := hkdf.Sha512(shared, salt, []byte("Control-Write-Encryption-Key"))
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := hkdf.Sha512(shared, salt, []byte("Control-Read-Encryption-Key"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &secureConn{Conn: c, encKey: enc, decKey: dec, r: bufio.NewReader(c)}, nil
+}
+
+func (c *secureConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	var buf bytes.Buffer
+	for rest := b; len(rest) > 0; {
+		n := len(rest)
+		if n > frameLengthMax {
+			n = frameLengthMax
+		}
+
+		var nonce [8]byte
+		binary.LittleEndian.PutUint64(nonce[:], c.encCount)
+		c.encCount++
+
+		length := make([]byte, 2)
+		binary.LittleEndian.PutUint16(length, uint16(n))
+
+		encrypted, mac, err := chacha20poly1305.EncryptAndSeal(c.encKey[:], nonce[:], rest[:n], length)
+		if err != nil {
+			return 0, err
+		}
+
+		buf.Write(length)
+		buf.Write(encrypted)
+		buf.Write(mac[:])
+		rest = rest[n:]
+	}
+
+	if _, err := c.Conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *secureConn) Read(b []byte) (int, error) {
+	if len(c.buf) == 0 {
+		frame, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		if bytes.HasPrefix(frame, []byte("EVENT/1.0")) {
+			frame = append([]byte("HTTP/1.0"), frame[len("EVENT/1.0"):]...)
+		}
+		c.buf = frame
+	}
+
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+
+	return n, nil
+}
+
+func (c *secureConn) readFrame() ([]byte, error) {
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, length); err != nil {
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint16(length)
+	if n > frameLengthMax {
+		return nil, fmt.Errorf("hapctl: invalid frame length %d", n)
+	}
+
+	b := make([]byte, int(n)+16)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, err
+	}
+
+	var mac [16]byte
+	copy(mac[:], b[n:])
+
+	var nonce [8]byte
+	binary.LittleEndian.PutUint64(nonce[:], c.decCount)
+	c.decCount++
+
+	return chacha20poly1305.DecryptAndVerify(c.decKey[:], nonce[:], b[:n], mac, length)
+}
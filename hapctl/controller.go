@@ -0,0 +1,80 @@
+// Package hapctl implements a HomeKit controller, which discovers
+// accessories, pairs with them and reads and writes characteristics.
+//
+//	ctl, _ := hapctl.NewController("My Controller")
+//	p, _ := ctl.PairSetup(ctx, "192.168.0.10:51826", "00102003")
+//	c, _ := ctl.Dial(ctx, "192.168.0.10:51826", p)
+//	defer c.Close()
+//	vs, _ := c.Get(ctx, hapctl.ID{Aid: 1, Iid: 10})
+//
+// The pairings of the controller and its keys must be stored by the
+// application to connect to an accessory again after a restart.
+package hapctl
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+)
+
+// Controller is the identity of a controller.
+type Controller struct {
+	// ID is the pairing identifier of the controller.
+	ID string
+
+	// PublicKey and PrivateKey are the ed25519
+	// long-term keys of the controller.
+	PublicKey  []byte
+	PrivateKey []byte
+}
+
+// NewController returns a controller with the
+// identifier id and new long-term keys.
+func NewController(id string) (*Controller, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Controller{
+		ID:         id,
+		PublicKey:  pub,
+		PrivateKey: priv,
+	}, nil
+}
+
+// Pairing is the pairing of a controller with an accessory.
+type Pairing struct {
+	// ID is the pairing identifier of the accessory (e.g. "AA:BB:CC:DD:EE:FF").
+	ID string
+
+	// PublicKey is the ed25519 long-term public key of the accessory.
+	PublicKey []byte
+}
+
+// A TLVError is the error of a pairing step returned by the accessory.
+type TLVError struct {
+	State byte
+	Code  byte
+}
+
+func (e *TLVError) Error() string {
+	switch e.Code {
+	case 0x01:
+		return fmt.Sprintf("M%d: unknown error", e.State)
+	case 0x02:
+		return fmt.Sprintf("M%d: authentication failed", e.State)
+	case 0x03:
+		return fmt.Sprintf("M%d: too many attempts, try again later", e.State)
+	case 0x04:
+		return fmt.Sprintf("M%d: max peers or unknown peer", e.State)
+	case 0x05:
+		return fmt.Sprintf("M%d: max authentication attempts", e.State)
+	case 0x06:
+		return fmt.Sprintf("M%d: accessory is paired already", e.State)
+	case 0x07:
+		return fmt.Sprintf("M%d: accessory is busy", e.State)
+	}
+
+	return fmt.Sprintf("M%d: error %d", e.State, e.Code)
+}
@@ -0,0 +1,56 @@
+package hapctl
+
+import (
+	"github.com/brutella/dnssd"
+
+	"context"
+	"net"
+	"strconv"
+)
+
+// ServiceType is the DNS-SD service type of accessories.
+const ServiceType = "_hap._tcp.local."
+
+// Advertisement is an accessory found via DNS-SD.
+type Advertisement struct {
+	Name     string
+	ID       string // pairing identifier ("id")
+	Model    string // "md"
+	Category int    // "ci"
+	Config   int    // configuration number ("c#")
+	Paired   bool   // false if the accessory can be paired ("sf=1")
+
+	// Addrs are the addresses ("host:port") of the accessory.
+	Addrs []string
+}
+
+// Discover browses for accessories on the local network and calls fn
+// for every accessory found or updated, until ctx is done.
+func Discover(ctx context.Context, fn func(Advertisement)) error {
+	add := func(e dnssd.BrowseEntry) {
+		fn(advertisement(e))
+	}
+
+	return dnssd.LookupType(ctx, ServiceType, add, func(dnssd.BrowseEntry) {})
+}
+
+func advertisement(e dnssd.BrowseEntry) Advertisement {
+	a := Advertisement{
+		Name:   e.Name,
+		ID:     e.Text["id"],
+		Model:  e.Text["md"],
+		Paired: e.Text["sf"] == "0",
+	}
+	a.Category, _ = strconv.Atoi(e.Text["ci"])
+	a.Config, _ = strconv.Atoi(e.Text["c#"])
+
+	for _, ip := range e.IPs {
+		host := ip.String()
+		if ip.To4() == nil && ip.IsLinkLocalUnicast() && e.IfaceName != "" {
+			host += "%" + e.IfaceName
+		}
+		a.Addrs = append(a.Addrs, net.JoinHostPort(host, strconv.Itoa(e.Port)))
+	}
+
+	return a
+}
@@ -0,0 +1,183 @@
+package hapctl
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nopResponder doesn't announce the accessory.
+type nopResponder struct{}
+
+func (nopResponder) Announce(hap.DNSSDService) error    { return nil }
+func (nopResponder) UpdateText(map[string]string) error { return nil }
+func (nopResponder) Withdraw() error                    { return nil }
+
+func serve(t *testing.T, a *accessory.A) string {
+	s, err := hap.New(a, hap.WithStore(hap.NewMemStore()), hap.WithPin("12344321"), hap.WithResponder(nopResponder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Serve(ctx, ln)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+
+	return ln.Addr().String()
+}
+
+func TestController(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+	addr := serve(t, a.A)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ctl, err := NewController("Controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ctl.PairSetup(ctx, addr, "123-44-321")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ctl.Dial(ctx, addr, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	as, err := c.Accessories(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(as), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	on := ID{a.Id, a.Outlet.On.Id}
+	if err := c.Put(ctx, Value{on, true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := a.Outlet.On.Value(), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	vs, err := c.Get(ctx, on)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := vs[0].Value, true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	events := make(chan Event, 1)
+	c.EventFunc = func(e Event) {
+		events <- e
+	}
+
+	if err := c.Subscribe(ctx, on); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Outlet.On.SetValue(false)
+
+	select {
+	case e := <-events:
+		if is, want := e.ID, on; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+		if is, want := e.Value, false; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event received")
+	}
+
+	// requests still work after an event
+	if _, err := c.Get(ctx, on); err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown controller
+	other, _ := NewController("Other")
+	if _, err := other.Dial(ctx, addr, p); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPairSetupInvalidPin(t *testing.T) {
+	addr := serve(t, accessory.New(accessory.Info{Name: "Outlet"}, accessory.TypeOutlet))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ctl, _ := NewController("Controller")
+	_, err := ctl.PairSetup(ctx, addr, "111-22-333")
+
+	var terr *TLVError
+	if !errors.As(err, &terr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if is, want := terr.Code, byte(0x02); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestFmtPin(t *testing.T) {
+	if is, want := fmtPin("12344321"), "123-44-321"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestPairingsList(t *testing.T) {
+	tests := [][]byte{
+		// items without separator
+		{0x01, 0x01, 'A', 0x03, 0x01, 0xaa, 0x0b, 0x01, 0x01, 0x01, 0x01, 'B', 0x03, 0x01, 0xbb, 0x0b, 0x01, 0x00},
+		// state and items with separator
+		{0x06, 0x01, 0x02, 0x01, 0x01, 'A', 0x03, 0x01, 0xaa, 0x0b, 0x01, 0x01, 0xff, 0x00, 0x01, 0x01, 'B', 0x03, 0x01, 0xbb, 0x0b, 0x01, 0x00},
+	}
+
+	for _, b := range tests {
+		ps, err := pairingsList(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, p := range ps {
+			if p.Identifier != "" {
+				ids = append(ids, fmt.Sprintf("%s:%x:%d", p.Identifier, p.PublicKey, p.Permission))
+			}
+		}
+
+		if is, want := strings.Join(ids, ","), "A:aa:1,B:bb:0"; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package hapctl
+
+import (
+	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/curve25519"
+	"github.com/brutella/hap/ed25519"
+	"github.com/brutella/hap/hkdf"
+	"github.com/brutella/hap/tlv8"
+	"github.com/tadglines/go-pkgs/crypto/srp"
+
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	contentTypeTLV8 = "application/pairing+tlv8"
+	contentTypeJSON = "application/hap+json"
+
+	methodPair byte = 0
+
+	srpGroup = "rfc5054.3072"
+)
+
+type pairPayload struct {
+	Method        byte   `tlv8:"0,optional"`
+	Identifier    string `tlv8:"1,optional"`
+	Salt          []byte `tlv8:"2,optional"`
+	PublicKey     []byte `tlv8:"3,optional"`
+	Proof         []byte `tlv8:"4,optional"`
+	EncryptedData []byte `tlv8:"5,optional"`
+	State         byte   `tlv8:"6,optional"`
+	Error         byte   `tlv8:"7,optional"`
+	Signature     []byte `tlv8:"10,optional"`
+	Permissions   byte   `tlv8:"11,optional"`
+}
+
+// PairSetup pairs the controller with the unpaired accessory at
+// addr ("host:port") using the setup code pin (e.g. "001-02-003").
+// The controller becomes an admin of the accessory.
+func (ctl *Controller) PairSetup(ctx context.Context, addr, pin string) (Pairing, error) {
+	nc, err := dial(ctx, addr)
+	if err != nil {
+		return Pairing{}, err
+	}
+	defer nc.Close()
+
+	c := &plainConn{nc, bufio.NewReader(nc), addr}
+
+	// M1 – M2
+	var m2 pairPayload
+	if err := c.tlv8(ctx, "/pair-setup", pairPayload{Method: methodPair, State: 1}, 2, &m2); err != nil {
+		return Pairing{}, err
+	}
+
+	// M3 – M4
+	id := []byte("Pair-Setup")
+	s, err := srp.NewSRP(srpGroup, sha512.New, keyDerivativeFunc(sha512.New, id))
+	if err != nil {
+		return Pairing{}, err
+	}
+	cs := s.NewClientSession(id, []byte(fmtPin(pin)))
+
+	key, err := cs.ComputeKey(m2.Salt, m2.PublicKey)
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	var m4 pairPayload
+	m3 := pairPayload{PublicKey: cs.GetA(), Proof: cs.ComputeAuthenticator(), State: 3}
+	if err := c.tlv8(ctx, "/pair-setup", m3, 4, &m4); err != nil {
+		return Pairing{}, err
+	}
+
+	if !cs.VerifyServerAuthenticator(m4.Proof) {
+		return Pairing{}, fmt.Errorf("pair-setup: invalid accessory proof")
+	}
+
+	// M5 – M6
+	encKey, err := hkdf.Sha512(key, []byte("Pair-Setup-Encrypt-Salt"), []byte("Pair-Setup-Encrypt-Info"))
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	hash, err := hkdf.Sha512(key, []byte("Pair-Setup-Controller-Sign-Salt"), []byte("Pair-Setup-Controller-Sign-Info"))
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	var buf []byte
+	buf = append(buf, hash[:]...)
+	buf = append(buf, ctl.ID...)
+	buf = append(buf, ctl.PublicKey...)
+	signature, err := ed25519.Signature(ctl.PrivateKey, buf)
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	b, err := tlv8.Marshal(pairPayload{Identifier: ctl.ID, PublicKey: ctl.PublicKey, Signature: signature})
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	encrypted, mac, err := chacha20poly1305.EncryptAndSeal(encKey[:], []byte("PS-Msg05"), b, nil)
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	var m6 pairPayload
+	m5 := pairPayload{EncryptedData: append(encrypted, mac[:]...), State: 5}
+	if err := c.tlv8(ctx, "/pair-setup", m5, 6, &m6); err != nil {
+		return Pairing{}, err
+	}
+
+	decrypted, err := open(encKey, "PS-Msg06", m6.EncryptedData)
+	if err != nil {
+		return Pairing{}, fmt.Errorf("pair-setup: %v", err)
+	}
+
+	var acc pairPayload
+	if err := tlv8.Unmarshal(decrypted, &acc); err != nil {
+		return Pairing{}, err
+	}
+
+	hash, err = hkdf.Sha512(key, []byte("Pair-Setup-Accessory-Sign-Salt"), []byte("Pair-Setup-Accessory-Sign-Info"))
+	if err != nil {
+		return Pairing{}, err
+	}
+
+	buf = nil
+	buf = append(buf, hash[:]...)
+	buf = append(buf, acc.Identifier...)
+	buf = append(buf, acc.PublicKey...)
+	if !ed25519.ValidateSignature(acc.PublicKey, buf, acc.Signature) {
+		return Pairing{}, fmt.Errorf("pair-setup: invalid accessory signature")
+	}
+
+	return Pairing{ID: acc.Identifier, PublicKey: acc.PublicKey}, nil
+}
+
+// pairVerify verifies the pairing with the accessory on c and
+// returns the shared secret, from which the session keys are derived.
+func (ctl *Controller) pairVerify(ctx context.Context, c *plainConn, p Pairing) ([]byte, error) {
+	public, private := curve25519.GenerateKeyPair()
+
+	// M1 – M2
+	var m2 pairPayload
+	if err := c.tlv8(ctx, "/pair-verify", pairPayload{PublicKey: public[:], State: 1}, 2, &m2); err != nil {
+		return nil, err
+	}
+
+	var other [32]byte
+	copy(other[:], m2.PublicKey)
+	shared, err := curve25519.SharedSecret(private, other)
+	if err != nil {
+		return nil, fmt.Errorf("pair-verify: %v", err)
+	}
+
+	encKey, err := hkdf.Sha512(shared[:], []byte("Pair-Verify-Encrypt-Salt"), []byte("Pair-Verify-Encrypt-Info"))
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := open(encKey, "PV-Msg02", m2.EncryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("pair-verify: %v", err)
+	}
+
+	var acc pairPayload
+	if err := tlv8.Unmarshal(decrypted, &acc); err != nil {
+		return nil, err
+	}
+
+	if acc.Identifier != p.ID {
+		return nil, fmt.Errorf("pair-verify: unexpected accessory %s", acc.Identifier)
+	}
+
+	var buf []byte
+	buf = append(buf, m2.PublicKey...)
+	buf = append(buf, acc.Identifier...)
+	buf = append(buf, public[:]...)
+	if !ed25519.ValidateSignature(p.PublicKey, buf, acc.Signature) {
+		return nil, fmt.Errorf("pair-verify: invalid accessory signature")
+	}
+
+	// M3 – M4
+	buf = nil
+	buf = append(buf, public[:]...)
+	buf = append(buf, ctl.ID...)
+	buf = append(buf, m2.PublicKey...)
+	signature, err := ed25519.Signature(ctl.PrivateKey, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := tlv8.Marshal(pairPayload{Identifier: ctl.ID, Signature: signature})
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, mac, err := chacha20poly1305.EncryptAndSeal(encKey[:], []byte("PV-Msg03"), b, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var m4 pairPayload
+	m3 := pairPayload{EncryptedData: append(encrypted, mac[:]...), State: 3}
+	if err := c.tlv8(ctx, "/pair-verify", m3, 4, &m4); err != nil {
+		return nil, err
+	}
+
+	return shared[:], nil
+}
+
+// fmtPin returns the pin in the format "XXX-XX-XXX".
+func fmtPin(pin string) string {
+	pin = strings.Replace(pin, "-", "", -1)
+	if len(pin) != 8 {
+		return pin
+	}
+
+	return pin[:3] + "-" + pin[3:5] + "-" + pin[5:]
+}
+
+// open decrypts and verifies the encrypted data with the mac appended.
+func open(key [32]byte, nonce string, data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("invalid encrypted data")
+	}
+
+	var mac [16]byte
+	msg := data[:len(data)-16]
+	copy(mac[:], data[len(msg):])
+
+	return chacha20poly1305.DecryptAndVerify(key[:], []byte(nonce), msg, mac, nil)
+}
+
+// keyDerivativeFunc returns the SRP-6a key derivative
+// function x = H(s | H(I | ":" | P)) used by HAP.
+func keyDerivativeFunc(h srp.HashFunc, id []byte) srp.KeyDerivationFunc {
+	return func(salt, pin []byte) []byte {
+		h := h()
+		h.Write(id)
+		h.Write([]byte(":"))
+		h.Write(pin)
+		t2 := h.Sum(nil)
+		h.Reset()
+		h.Write(salt)
+		h.Write(t2)
+		return h.Sum(nil)
+	}
+}
+
+func dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// plainConn sends unencrypted http requests.
+type plainConn struct {
+	net.Conn
+	r    *bufio.Reader
+	addr string
+}
+
+// tlv8 posts the tlv8 encoded request to path and decodes the
+// response of the state into resp. The error of the response
+// is returned as *TLVError.
+func (c *plainConn) tlv8(ctx context.Context, path string, v interface{}, state byte, resp *pairPayload) error {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+c.addr+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeTLV8)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+		defer c.SetDeadline(noDeadline)
+	}
+
+	if err := req.Write(c.Conn); err != nil {
+		return err
+	}
+
+	res, err := http.ReadResponse(c.r, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := tlv8.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if resp.Error != 0 {
+		return &TLVError{State: state, Code: resp.Error}
+	}
+
+	if resp.State != state {
+		return fmt.Errorf("%s: unexpected state %d", path, resp.State)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package hapctl
+
+import (
+	"github.com/brutella/hap/tlv8"
+
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const (
+	methodAddPairing    byte = 3
+	methodDeletePairing byte = 4
+	methodListPairings  byte = 5
+
+	permissionUser  byte = 0
+	permissionAdmin byte = 1
+)
+
+// ControllerPairing is a pairing of a controller with the accessory.
+type ControllerPairing struct {
+	ID        string
+	PublicKey []byte
+	Admin     bool
+}
+
+type pairingsPayload struct {
+	Method     byte   `tlv8:"0,optional"`
+	Identifier string `tlv8:"1,optional"`
+	PublicKey  []byte `tlv8:"3,optional"`
+	State      byte   `tlv8:"6,optional"`
+	Error      byte   `tlv8:"7,optional"`
+	Permission byte   `tlv8:"11,optional"`
+}
+
+// AddPairing pairs the controller with the accessory. Only admin
+// controllers can add pairings. If the controller is paired already,
+// its permission is updated.
+func (c *Conn) AddPairing(ctx context.Context, p ControllerPairing) error {
+	perm := permissionUser
+	if p.Admin {
+		perm = permissionAdmin
+	}
+
+	_, err := c.pairings(ctx, pairingsPayload{
+		Method:     methodAddPairing,
+		Identifier: p.ID,
+		PublicKey:  p.PublicKey,
+		Permission: perm,
+		State:      1,
+	})
+
+	return err
+}
+
+// RemovePairing removes the pairing of the controller with the
+// identifier id. The accessory closes the connections of the controller.
+func (c *Conn) RemovePairing(ctx context.Context, id string) error {
+	_, err := c.pairings(ctx, pairingsPayload{
+		Method:     methodDeletePairing,
+		Identifier: id,
+		State:      1,
+	})
+
+	return err
+}
+
+// ListPairings returns the pairings of the accessory.
+func (c *Conn) ListPairings(ctx context.Context) ([]ControllerPairing, error) {
+	ps, err := c.pairings(ctx, pairingsPayload{Method: methodListPairings, State: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var cps []ControllerPairing
+	for _, p := range ps {
+		if p.Identifier == "" {
+			continue // state of the response
+		}
+		cps = append(cps, ControllerPairing{
+			ID:        p.Identifier,
+			PublicKey: p.PublicKey,
+			Admin:     p.Permission == permissionAdmin,
+		})
+	}
+
+	return cps, nil
+}
+
+// pairings sends the request to /pairings and returns the response items.
+func (c *Conn) pairings(ctx context.Context, v pairingsPayload) ([]pairingsPayload, error) {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.requestType(ctx, http.MethodPost, "/pairings", contentTypeTLV8, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.status != http.StatusOK {
+		var p pairingsPayload
+		if err := tlv8.Unmarshal(res.body, &p); err == nil && p.Error != 0 {
+			return nil, &TLVError{State: 2, Code: p.Error}
+		}
+		return nil, statusError(res)
+	}
+
+	var ps []pairingsPayload
+	if v.Method == methodListPairings {
+		if ps, err = pairingsList(res.body); err != nil {
+			return nil, err
+		}
+	} else {
+		var p pairingsPayload
+		if err := tlv8.Unmarshal(res.body, &p); err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+
+	for _, p := range ps {
+		if p.Error != 0 {
+			return nil, &TLVError{State: 2, Code: p.Error}
+		}
+	}
+
+	return ps, nil
+}
+
+// pairingsList decodes the items of a list pairings response.
+// Items are delimited by a separator (0xff) or start with
+// the identifier of the next pairing.
+func pairingsList(b []byte) ([]pairingsPayload, error) {
+	var ps []pairingsPayload
+	var p *pairingsPayload
+	var last byte
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, fmt.Errorf("pairings: invalid tlv8 data")
+		}
+		tag, v := b[0], b[2:2+int(b[1])]
+		b = b[2+len(v):]
+
+		if tag == 0xff {
+			p = nil
+			continue
+		}
+
+		if p == nil || (tag == 1 && p.Identifier != "" && last != 1) {
+			ps = append(ps, pairingsPayload{})
+			p = &ps[len(ps)-1]
+		}
+
+		switch tag {
+		case 1:
+			p.Identifier += string(v)
+		case 3:
+			p.PublicKey = append(p.PublicKey, v...)
+		case 6:
+			p.State = byte1(v)
+		case 7:
+			p.Error = byte1(v)
+		case 11:
+			p.Permission = byte1(v)
+		}
+		last = tag
+	}
+
+	return ps, nil
+}
+
+func byte1(v []byte) byte {
+	if len(v) == 0 {
+		return 0
+	}
+
+	return v[0]
+}
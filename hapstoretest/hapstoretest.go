@@ -0,0 +1,101 @@
+// Package hapstoretest provides a conformance test for hap.Store implementations.
+//
+//	func TestRedisStore(t *testing.T) {
+//		hapstoretest.Run(t, func() hap.Store {
+//			return newRedisStore(t)
+//		})
+//	}
+package hapstoretest
+
+import (
+	"github.com/brutella/hap"
+
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Run verifies that the stores returned by newStore satisfy the
+// semantics which the hap server relies on. Every subtest calls
+// newStore once and expects an empty store.
+func Run(t *testing.T, newStore func() hap.Store) {
+	t.Run("get missing", func(t *testing.T) {
+		st := newStore()
+		if _, err := st.Get("missing"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("set get", func(t *testing.T) {
+		st := newStore()
+		values := [][]byte{
+			[]byte("value"),
+			{0x0, 0xFF, 0x0, 0xA, 0xD}, // binary
+			bytes.Repeat([]byte{0xAB}, 64*1024),
+		}
+
+		for _, v := range values {
+			if err := st.Set("key", v); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := st.Get("key")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, v) {
+				t.Fatalf("%v != %v", b, v)
+			}
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		st := newStore()
+		if err := st.Set("key", []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := st.Delete("key"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := st.Get("key"); err == nil {
+			t.Fatal("expected error")
+		}
+
+		// Deleting a missing key is not an error.
+		if err := st.Delete("key"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("keys with suffix", func(t *testing.T) {
+		st := newStore()
+		for _, k := range []string{"a.pairing", "b.pairing", "keypair", "pairing.c"} {
+			if err := st.Set(k, []byte(k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ks, err := st.KeysWithSuffix(".pairing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(ks)
+
+		if is, want := ks, []string{"a.pairing", "b.pairing"}; !reflect.DeepEqual(is, want) {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		ks, err = st.KeysWithSuffix(".entity")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := len(ks), 0; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	})
+}
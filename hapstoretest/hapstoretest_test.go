@@ -0,0 +1,51 @@
+package hapstoretest_test
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/hapstoretest"
+
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	t.Run("mem", func(t *testing.T) {
+		hapstoretest.Run(t, func() hap.Store { return hap.NewMemStore() })
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		hapstoretest.Run(t, func() hap.Store { return hap.NewFsStore(t.TempDir()) })
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		hapstoretest.Run(t, func() hap.Store {
+			st := hap.NewFsStore(t.TempDir())
+			// Keys of other namespaces must not be visible.
+			st.Set("other.pairing", []byte{})
+			st.Set("kitchen/a.pairing", []byte{})
+			return hap.PrefixStore(st, "livingroom/")
+		})
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		hapstoretest.Run(t, func() hap.Store {
+			st, err := hap.NewBoltStore(filepath.Join(t.TempDir(), "hap.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { st.Close() })
+			return st
+		})
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		hapstoretest.Run(t, func() hap.Store {
+			st, err := hap.NewEncryptedStore(hap.NewMemStore(), bytes.Repeat([]byte{0x1}, 32))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return st
+		})
+	})
+}
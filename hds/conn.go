@@ -0,0 +1,220 @@
+package hds
+
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Protocol and topics of the control messages
+const (
+	ProtocolControl = "control"
+	TopicHello      = "hello"
+)
+
+// Conn is a data stream connection to a controller.
+type Conn struct {
+	conn net.Conn
+	srv  *Server
+	name string // pairing name of the controller
+
+	wmu sync.Mutex // guards enc and writes
+	enc cipherState
+	dec cipherState
+
+	mu      sync.Mutex
+	id      int64
+	pending map[int64]chan *Message // requests waiting for a response
+	streams map[int64]*DataSendStream
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newConn(c net.Conn, srv *Server, p *prepared) *Conn {
+	return &Conn{
+		conn:    c,
+		srv:     srv,
+		name:    p.name,
+		enc:     cipherState{key: p.enc},
+		dec:     cipherState{key: p.dec},
+		pending: map[int64]chan *Message{},
+		streams: map[int64]*DataSendStream{},
+		done:    make(chan struct{}),
+	}
+}
+
+// PairingName returns the pairing name of the controller.
+func (c *Conn) PairingName() string {
+	return c.name
+}
+
+// RemoteAddr returns the network address of the controller.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Done returns a channel, which is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.conn.Close()
+		close(c.done)
+	})
+
+	return err
+}
+
+// SendEvent sends an event to the controller.
+func (c *Conn) SendEvent(protocol, topic string, body map[string]interface{}) error {
+	return c.send(&Message{
+		Type:     MessageTypeEvent,
+		Protocol: protocol,
+		Topic:    topic,
+		Body:     body,
+	})
+}
+
+// SendRequest sends a request to the controller and
+// waits for the response until ctx is done.
+func (c *Conn) SendRequest(ctx context.Context, protocol, topic string, body map[string]interface{}) (*Message, error) {
+	ch := make(chan *Message, 1)
+
+	c.mu.Lock()
+	c.id++
+	id := c.id
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	err := c.send(&Message{
+		Type:     MessageTypeRequest,
+		Protocol: protocol,
+		Topic:    topic,
+		Id:       id,
+		Body:     body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-c.done:
+		return nil, fmt.Errorf("hds: connection closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// respond sends the response to the request req.
+func (c *Conn) respond(req *Message, status int, body map[string]interface{}) error {
+	return c.send(&Message{
+		Type:     MessageTypeResponse,
+		Protocol: req.Protocol,
+		Topic:    req.Topic,
+		Id:       req.Id,
+		Status:   int64(status),
+		Body:     body,
+	})
+}
+
+func (c *Conn) send(m *Message) error {
+	p, err := encodeMessage(m)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	b, err := c.enc.seal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.Write(b)
+	return err
+}
+
+// serve reads messages until the connection is closed.
+func (c *Conn) serve() {
+	defer c.Close()
+
+	for {
+		f, err := readFrame(c.conn)
+		if err != nil {
+			log.Debug.Println("hds:", err)
+			return
+		}
+
+		p, err := c.dec.open(f)
+		if err != nil {
+			log.Info.Println("hds:", err)
+			return
+		}
+
+		if err := c.handlePayload(p); err != nil {
+			log.Info.Println("hds:", err)
+			return
+		}
+	}
+}
+
+func (c *Conn) handlePayload(p []byte) error {
+	m, err := decodeMessage(p)
+	if err != nil {
+		return err
+	}
+
+	log.Debug.Printf("hds: %s %s/%s %v\n", c.conn.RemoteAddr(), m.Protocol, m.Topic, m.Body)
+
+	switch m.Type {
+	case MessageTypeEvent:
+		if fn := c.srv.eventFunc(m.Protocol, m.Topic); fn != nil {
+			fn(c, m)
+		}
+	case MessageTypeRequest:
+		if m.Protocol == ProtocolControl && m.Topic == TopicHello {
+			return c.respond(m, StatusSuccess, nil)
+		}
+
+		fn := c.srv.requestFunc(m.Protocol, m.Topic)
+		if fn == nil {
+			return c.respond(m, StatusMissingProtocol, nil)
+		}
+
+		status, body := fn(c, m)
+		if err := c.respond(m, status, body); err != nil {
+			return err
+		}
+
+		if m.after != nil {
+			m.after()
+		}
+	case MessageTypeResponse:
+		c.mu.Lock()
+		ch, ok := c.pending[m.Id]
+		c.mu.Unlock()
+
+		if ok {
+			ch <- m
+		}
+	}
+
+	return nil
+}
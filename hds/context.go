@@ -0,0 +1,21 @@
+package hds
+
+import (
+	"context"
+)
+
+type sharedSecretKey struct{}
+
+// WithSharedSecret returns a copy of ctx, which contains the shared
+// secret of the HAP session. The keys of a data stream are derived
+// from the shared secret.
+func WithSharedSecret(ctx context.Context, secret []byte) context.Context {
+	return context.WithValue(ctx, sharedSecretKey{}, secret)
+}
+
+// SharedSecret returns the shared secret of the HAP session,
+// which is contained in ctx.
+func SharedSecret(ctx context.Context) ([]byte, bool) {
+	b, ok := ctx.Value(sharedSecretKey{}).([]byte)
+	return b, ok && len(b) > 0
+}
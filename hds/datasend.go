@@ -0,0 +1,286 @@
+package hds
+
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Protocol and topics of the dataSend messages
+const (
+	ProtocolDataSend = "dataSend"
+	TopicOpen        = "open"
+	TopicData        = "data"
+	TopicClose       = "close"
+	TopicAck         = "ack"
+)
+
+// Reasons to close a dataSend stream
+const (
+	CloseReasonNormal               = 0
+	CloseReasonNotAllowed           = 1
+	CloseReasonBusy                 = 2
+	CloseReasonCancelled            = 3
+	CloseReasonUnsupported          = 4
+	CloseReasonUnexpectedFailure    = 5
+	CloseReasonTimeout              = 6
+	CloseReasonBadData              = 7
+	CloseReasonProtocolError        = 8
+	CloseReasonInvalidConfiguration = 9
+)
+
+// maxChunkSize is the maximum size of the data of a packet.
+const maxChunkSize = 0x40000
+
+// A DataSendFunc sends data over the stream s. The stream is closed
+// when the function returns; with CloseReasonNormal if the returned
+// error is nil, otherwise with CloseReasonUnexpectedFailure.
+type DataSendFunc func(s *DataSendStream) error
+
+// DataSendStream is a stream over which the accessory sends data
+// (e.g. recordings) to the controller.
+type DataSendStream struct {
+	Conn *Conn
+	Id   int64
+	Type string // e.g. "ipcamera.recording"
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// A Packet is the data of a dataSend message.
+type Packet struct {
+	Data     []byte
+	Metadata map[string]interface{}
+}
+
+// Context returns the context of the stream, which is canceled when
+// the controller closes the stream or the connection is closed.
+func (s *DataSendStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send sends the packets. If endOfStream is true,
+// the packets are the last of the stream.
+func (s *DataSendStream) Send(packets []Packet, endOfStream bool) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	arr := []interface{}{}
+	for _, p := range packets {
+		arr = append(arr, map[string]interface{}{
+			"data":     p.Data,
+			"metadata": p.Metadata,
+		})
+	}
+
+	body := map[string]interface{}{
+		"streamId": s.Id,
+		"packets":  arr,
+	}
+	if endOfStream {
+		body["endOfStream"] = true
+	}
+
+	return s.Conn.SendEvent(ProtocolDataSend, TopicData, body)
+}
+
+// SendChunked sends data in chunks. The metadata of every chunk contains
+// the chunk sequence number and whether it is the last chunk; the first
+// chunk contains the total size of the data.
+func (s *DataSendStream) SendChunked(data []byte, metadata map[string]interface{}, endOfStream bool) error {
+	for i := 0; i == 0 || len(data) > 0; i++ {
+		n := len(data)
+		if n > maxChunkSize {
+			n = maxChunkSize
+		}
+
+		md := map[string]interface{}{}
+		for k, v := range metadata {
+			md[k] = v
+		}
+		md["dataChunkSequenceNumber"] = i + 1
+		md["isLastDataChunk"] = n == len(data)
+		if i == 0 {
+			md["dataTotalSize"] = len(data)
+		}
+
+		last := n == len(data)
+		if err := s.Send([]Packet{{Data: data[:n], Metadata: md}}, endOfStream && last); err != nil {
+			return err
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
+
+// Close closes the stream with the reason (e.g. CloseReasonNormal).
+func (s *DataSendStream) Close(reason int) error {
+	s.mu.Lock()
+	closed := s.closed
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.Conn.removeStream(s.Id)
+
+	if closed {
+		return nil
+	}
+
+	return s.Conn.SendEvent(ProtocolDataSend, TopicClose, map[string]interface{}{
+		"streamId": s.Id,
+		"reason":   reason,
+	})
+}
+
+// closedByController cancels the stream, which
+// was closed or acknowledged by the controller.
+func (s *DataSendStream) closedByController() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+}
+
+// HandleDataSend sets the function, which is called when a
+// controller opens a dataSend stream of the type typ.
+func (s *Server) HandleDataSend(typ string, fn DataSendFunc) {
+	s.mu.Lock()
+	s.dataSend[typ] = fn
+	s.mu.Unlock()
+
+	s.HandleRequest(ProtocolDataSend, TopicOpen, s.openDataSend)
+	s.handleDataSendEvents()
+}
+
+func (s *Server) handleDataSendEvents() {
+	s.HandleEvent(ProtocolDataSend, TopicClose, s.closeDataSend)
+	s.HandleEvent(ProtocolDataSend, TopicAck, s.closeDataSend)
+}
+
+// OpenDataSend opens a dataSend stream of the type typ
+// (e.g. "audio.siri") to the controller. The stream
+// must be closed when all data was sent.
+func (c *Conn) OpenDataSend(ctx context.Context, typ string) (*DataSendStream, error) {
+	c.srv.handleDataSendEvents()
+
+	resp, err := c.SendRequest(ctx, ProtocolDataSend, TopicOpen, map[string]interface{}{
+		"target": "controller",
+		"type":   typ,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Status != StatusSuccess {
+		return nil, fmt.Errorf("hds: opening %s stream failed with status %d", typ, resp.Status)
+	}
+
+	id, ok := resp.Body["streamId"].(int64)
+	if !ok {
+		return nil, fmt.Errorf("hds: missing stream id")
+	}
+
+	stream := c.newStream(id, typ)
+	if stream == nil {
+		return nil, fmt.Errorf("hds: stream %d already open", id)
+	}
+
+	return stream, nil
+}
+
+func (s *Server) openDataSend(c *Conn, req *Message) (int, map[string]interface{}) {
+	typ, _ := req.Body["type"].(string)
+	id, ok := req.Body["streamId"].(int64)
+	if !ok {
+		return StatusPayloadError, nil
+	}
+
+	s.mu.Lock()
+	fn, ok := s.dataSend[typ]
+	s.mu.Unlock()
+
+	if !ok {
+		log.Info.Printf("hds: unsupported dataSend type %s\n", typ)
+		return StatusProtocolSpecific, map[string]interface{}{"status": CloseReasonUnsupported}
+	}
+
+	stream := c.newStream(id, typ)
+	if stream == nil {
+		return StatusProtocolSpecific, map[string]interface{}{"status": CloseReasonBusy}
+	}
+
+	// start sending after the stream is open
+	req.after = func() {
+		go func() {
+			reason := CloseReasonNormal
+			if err := fn(stream); err != nil {
+				log.Info.Printf("hds: dataSend %s: %v\n", typ, err)
+				reason = CloseReasonUnexpectedFailure
+			}
+			stream.Close(reason)
+		}()
+	}
+
+	return StatusSuccess, map[string]interface{}{"status": StatusSuccess}
+}
+
+func (s *Server) closeDataSend(c *Conn, ev *Message) {
+	id, _ := ev.Body["streamId"].(int64)
+	if stream := c.stream(id); stream != nil {
+		stream.closedByController()
+	}
+}
+
+// newStream returns a new stream with the id,
+// or nil if a stream with the id is already open.
+func (c *Conn) newStream(id int64, typ string) *DataSendStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.streams[id]; ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	s := &DataSendStream{Conn: c, Id: id, Type: typ, ctx: ctx, cancel: cancel}
+	c.streams[id] = s
+
+	return s
+}
+
+func (c *Conn) stream(id int64) *DataSendStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.streams[id]
+}
+
+func (c *Conn) removeStream(id int64) {
+	c.mu.Lock()
+	delete(c.streams, id)
+	c.mu.Unlock()
+}
+
+// String returns a description of the stream.
+func (s *DataSendStream) String() string {
+	return fmt.Sprintf("%s stream %d", s.Type, s.Id)
+}
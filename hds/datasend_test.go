@@ -0,0 +1,149 @@
+package hds
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestDataSend(t *testing.T) {
+	srv := NewServer()
+	srv.Addr = "127.0.0.1:0"
+	defer srv.Close()
+
+	data := bytes.Repeat([]byte{0xAB}, maxChunkSize+10)
+	srv.HandleDataSend("test.data", func(s *DataSendStream) error {
+		return s.SendChunked(data, map[string]interface{}{"dataType": "test"}, true)
+	})
+
+	c := connect(t, srv)
+	defer c.conn.Close()
+
+	resp := c.request(&Message{
+		Type:     MessageTypeRequest,
+		Protocol: ProtocolDataSend,
+		Topic:    TopicOpen,
+		Id:       1,
+		Body:     map[string]interface{}{"target": "controller", "type": "test.data", "streamId": 7},
+	})
+
+	if is, want := resp.Status, int64(StatusSuccess); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	var received []byte
+	for i := 1; i <= 2; i++ {
+		ev := c.receive()
+		if is, want := ev.Topic, TopicData; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		if is, want := ev.Body["streamId"], int64(7); is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		p := ev.Body["packets"].([]interface{})[0].(map[string]interface{})
+		md := p["metadata"].(map[string]interface{})
+		if is, want := md["dataChunkSequenceNumber"], int64(i); is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		if is, want := md["isLastDataChunk"], i == 2; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		if is, want := ev.Body["endOfStream"] == true, i == 2; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		received = append(received, p["data"].([]byte)...)
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Fatal("received data differs")
+	}
+
+	ev := c.receive()
+	if is, want := ev.Topic, TopicClose; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := ev.Body["reason"], int64(CloseReasonNormal); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestDataSendUnsupported(t *testing.T) {
+	srv := NewServer()
+	srv.Addr = "127.0.0.1:0"
+	defer srv.Close()
+
+	srv.HandleDataSend("test.data", func(s *DataSendStream) error {
+		return nil
+	})
+
+	c := connect(t, srv)
+	defer c.conn.Close()
+
+	resp := c.request(&Message{
+		Type:     MessageTypeRequest,
+		Protocol: ProtocolDataSend,
+		Topic:    TopicOpen,
+		Id:       1,
+		Body:     map[string]interface{}{"target": "controller", "type": "unknown", "streamId": 1},
+	})
+
+	if is, want := resp.Status, int64(StatusProtocolSpecific); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestOpenDataSend(t *testing.T) {
+	srv := NewServer()
+	srv.Addr = "127.0.0.1:0"
+	defer srv.Close()
+
+	c := connect(t, srv)
+	defer c.conn.Close()
+
+	c.request(&Message{Type: MessageTypeRequest, Protocol: ProtocolControl, Topic: TopicHello, Id: 1})
+
+	type result struct {
+		s   *DataSendStream
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		s, err := srv.Conns()[0].OpenDataSend(context.Background(), "audio.siri")
+		ch <- result{s, err}
+	}()
+
+	req := c.receive()
+	if is, want := req.Topic, TopicOpen; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := req.Body["type"], "audio.siri"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	c.send(&Message{Type: MessageTypeResponse, Protocol: ProtocolDataSend, Topic: TopicOpen, Id: req.Id, Body: map[string]interface{}{"streamId": 3}})
+
+	r := <-ch
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	if err := r.s.Send([]Packet{{Data: []byte{0x01}}}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := c.receive()
+	if is, want := ev.Body["streamId"], int64(3); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	c.send(&Message{Type: MessageTypeEvent, Protocol: ProtocolDataSend, Topic: TopicAck, Body: map[string]interface{}{"streamId": 3, "endOfStream": true}})
+
+	<-r.s.Context().Done()
+}
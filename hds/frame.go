@@ -0,0 +1,109 @@
+package hds
+
+import (
+	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/hkdf"
+
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	frameTypeEncrypted = 0x01
+	frameHeaderLen     = 4
+	frameTagLen        = 16
+
+	// maxFramePayload is the maximum length of a frame payload.
+	maxFramePayload = 1 << 20
+)
+
+// deriveKeys returns the keys to encrypt and decrypt the frames
+// of a data stream, which are derived from the shared secret
+// of the HAP session and the salts of both sides.
+func deriveKeys(shared, controllerSalt, accessorySalt []byte) (enc, dec [32]byte, err error) {
+	salt := append(append([]byte{}, controllerSalt...), accessorySalt...)
+	enc, err = hkdf.Sha512(shared, salt, []byte("HDS-Read-Encryption-Key"))
+	if err != nil {
+		return
+	}
+
+	dec, err = hkdf.Sha512(shared, salt, []byte("HDS-Write-Encryption-Key"))
+	return
+}
+
+// cipherState encrypts or decrypts the frames of one direction.
+type cipherState struct {
+	key   [32]byte
+	count uint64
+}
+
+func (c *cipherState) nonce() []byte {
+	nonce := make([]byte, 8)
+	binary.LittleEndian.PutUint64(nonce, c.count)
+	return nonce
+}
+
+// seal returns the encrypted frame of the payload.
+func (c *cipherState) seal(payload []byte) ([]byte, error) {
+	if len(payload) > maxFramePayload {
+		return nil, fmt.Errorf("hds: payload too large (%d bytes)", len(payload))
+	}
+
+	header := []byte{frameTypeEncrypted, byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload))}
+	b, mac, err := chacha20poly1305.EncryptAndSeal(c.key[:], c.nonce(), payload, header)
+	if err != nil {
+		return nil, err
+	}
+	c.count++
+
+	frame := make([]byte, 0, frameHeaderLen+len(b)+frameTagLen)
+	frame = append(frame, header...)
+	frame = append(frame, b...)
+	return append(frame, mac[:]...), nil
+}
+
+// open returns the decrypted payload of the frame f.
+func (c *cipherState) open(f *frame) ([]byte, error) {
+	b, err := chacha20poly1305.DecryptAndVerify(c.key[:], c.nonce(), f.body, f.tag, f.header[:])
+	if err != nil {
+		return nil, err
+	}
+	c.count++
+
+	return b, nil
+}
+
+type frame struct {
+	header [frameHeaderLen]byte
+	body   []byte
+	tag    [frameTagLen]byte
+}
+
+// readFrame reads an encrypted frame from r.
+func readFrame(r io.Reader) (*frame, error) {
+	var f frame
+	if _, err := io.ReadFull(r, f.header[:]); err != nil {
+		return nil, err
+	}
+
+	if f.header[0] != frameTypeEncrypted {
+		return nil, fmt.Errorf("hds: unsupported frame type %d", f.header[0])
+	}
+
+	n := int(f.header[1])<<16 | int(f.header[2])<<8 | int(f.header[3])
+	if n > maxFramePayload {
+		return nil, fmt.Errorf("hds: frame too large (%d bytes)", n)
+	}
+
+	f.body = make([]byte, n)
+	if _, err := io.ReadFull(r, f.body); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(r, f.tag[:]); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
@@ -0,0 +1,130 @@
+package hds
+
+import (
+	"github.com/brutella/hap/opack"
+
+	"fmt"
+)
+
+// Message types
+const (
+	MessageTypeEvent    = 0
+	MessageTypeRequest  = 1
+	MessageTypeResponse = 2
+)
+
+// Message status codes
+const (
+	StatusSuccess          = 0
+	StatusOutOfMemory      = 1
+	StatusTimeout          = 2
+	StatusHeaderError      = 3
+	StatusPayloadError     = 4
+	StatusMissingProtocol  = 5
+	StatusProtocolSpecific = 6
+)
+
+// A Message is an event, request or response sent over a data stream.
+type Message struct {
+	Type     int
+	Protocol string // e.g. "control" or "dataSend"
+	Topic    string // e.g. "hello" or "open"
+	Id       int64  // request id; only for requests and responses
+	Status   int64  // only for responses
+
+	Body map[string]interface{}
+
+	// after is called after the response to the request was sent.
+	after func()
+}
+
+// encodeMessage returns the frame payload of m.
+func encodeMessage(m *Message) ([]byte, error) {
+	header := map[string]interface{}{
+		"protocol": m.Protocol,
+	}
+
+	switch m.Type {
+	case MessageTypeEvent:
+		header["event"] = m.Topic
+	case MessageTypeRequest:
+		header["request"] = m.Topic
+		header["id"] = m.Id
+	case MessageTypeResponse:
+		header["response"] = m.Topic
+		header["id"] = m.Id
+		header["status"] = m.Status
+	default:
+		return nil, fmt.Errorf("hds: invalid message type %d", m.Type)
+	}
+
+	h, err := opack.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h) > 0xFF {
+		return nil, fmt.Errorf("hds: header too large")
+	}
+
+	body := m.Body
+	if body == nil {
+		body = map[string]interface{}{}
+	}
+
+	b, err := opack.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, 0, 1+len(h)+len(b))
+	payload = append(payload, byte(len(h)))
+	payload = append(payload, h...)
+	return append(payload, b...), nil
+}
+
+// decodeMessage returns the message of the frame payload p.
+func decodeMessage(p []byte) (*Message, error) {
+	if len(p) == 0 || int(p[0]) >= len(p) {
+		return nil, fmt.Errorf("hds: invalid payload")
+	}
+
+	n := int(p[0])
+	var hv interface{}
+	if err := opack.Unmarshal(p[1:1+n], &hv); err != nil {
+		return nil, err
+	}
+
+	header, ok := hv.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("hds: invalid header %v", hv)
+	}
+
+	var m Message
+	m.Protocol, _ = header["protocol"].(string)
+	if topic, ok := header["event"].(string); ok {
+		m.Type = MessageTypeEvent
+		m.Topic = topic
+	} else if topic, ok := header["request"].(string); ok {
+		m.Type = MessageTypeRequest
+		m.Topic = topic
+	} else if topic, ok := header["response"].(string); ok {
+		m.Type = MessageTypeResponse
+		m.Topic = topic
+		m.Status, _ = header["status"].(int64)
+	} else {
+		return nil, fmt.Errorf("hds: invalid header %v", header)
+	}
+	m.Id, _ = header["id"].(int64)
+
+	var bv interface{}
+	if err := opack.Unmarshal(p[1+n:], &bv); err != nil {
+		return nil, err
+	}
+
+	if m.Body, ok = bv.(map[string]interface{}); !ok && bv != nil {
+		return nil, fmt.Errorf("hds: invalid message body %v", bv)
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,300 @@
+// Package hds implements the HomeKit Data Stream (HDS) protocol.
+//
+// A controller sets up a data stream by writing to the setup data
+// stream transport characteristic (see TransportManagement). The
+// accessory responds with the port of its tcp listener and the
+// controller connects to it. The frames on the connection are
+// encrypted with keys derived from the shared secret of the HAP
+// session. Messages are OPACK encoded.
+package hds
+
+import (
+	"github.com/brutella/hap/log"
+
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// keySaltLen is the length of the key salts.
+	keySaltLen = 32
+
+	// defaultHandshakeTimeout is the time within which a controller
+	// must connect to a prepared data stream.
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+// A RequestFunc handles a request and returns the
+// status and body of the response.
+type RequestFunc func(c *Conn, req *Message) (status int, body map[string]interface{})
+
+// An EventFunc handles an event.
+type EventFunc func(c *Conn, ev *Message)
+
+// Server accepts data stream connections from controllers.
+type Server struct {
+	// Addr is the tcp address on which the server listens.
+	// If empty, the server listens on a random port.
+	Addr string
+
+	// HandshakeTimeout is the time within which a controller must
+	// connect to a prepared data stream. The default is 10 seconds.
+	HandshakeTimeout time.Duration
+
+	// ConnectedFunc is called when a controller connected.
+	ConnectedFunc func(c *Conn)
+
+	// DisconnectedFunc is called when a connection was closed.
+	DisconnectedFunc func(c *Conn)
+
+	mu       sync.Mutex
+	ln       net.Listener
+	prepared []*prepared
+	conns    map[*Conn]struct{}
+	requests map[string]RequestFunc
+	events   map[string]EventFunc
+	dataSend map[string]DataSendFunc
+}
+
+// prepared is a data stream, to which a controller will connect.
+type prepared struct {
+	name    string
+	enc     [32]byte
+	dec     [32]byte
+	expires time.Time
+}
+
+// NewServer returns a data stream server.
+func NewServer() *Server {
+	return &Server{
+		conns:    map[*Conn]struct{}{},
+		requests: map[string]RequestFunc{},
+		events:   map[string]EventFunc{},
+		dataSend: map[string]DataSendFunc{},
+	}
+}
+
+// HandleRequest sets the function, which handles the requests
+// of the protocol with the topic. The function is called from the
+// read loop of the connection and must not wait for responses.
+func (s *Server) HandleRequest(protocol, topic string, fn RequestFunc) {
+	s.mu.Lock()
+	s.requests[protocol+"/"+topic] = fn
+	s.mu.Unlock()
+}
+
+// HandleEvent sets the function, which handles the events
+// of the protocol with the topic.
+func (s *Server) HandleEvent(protocol, topic string, fn EventFunc) {
+	s.mu.Lock()
+	s.events[protocol+"/"+topic] = fn
+	s.mu.Unlock()
+}
+
+func (s *Server) requestFunc(protocol, topic string) RequestFunc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[protocol+"/"+topic]
+}
+
+func (s *Server) eventFunc(protocol, topic string) EventFunc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.events[protocol+"/"+topic]
+}
+
+// Conns returns the open data stream connections.
+func (s *Server) Conns() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cs []*Conn
+	for c := range s.conns {
+		cs = append(cs, c)
+	}
+
+	return cs
+}
+
+// Prepare prepares a data stream for the controller with the pairing
+// name and the shared secret of its HAP session. It returns the key salt
+// of the accessory and the port, to which the controller must connect.
+func (s *Server) Prepare(shared, controllerSalt []byte, name string) ([]byte, uint16, error) {
+	if len(controllerSalt) != keySaltLen {
+		return nil, 0, fmt.Errorf("hds: invalid key salt length %d", len(controllerSalt))
+	}
+
+	salt := make([]byte, keySaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, 0, err
+	}
+
+	enc, dec, err := deriveKeys(shared, controllerSalt, salt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ln, err := s.listen()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.Lock()
+	s.prepared = append(s.prepared, &prepared{
+		name:    name,
+		enc:     enc,
+		dec:     dec,
+		expires: time.Now().Add(s.handshakeTimeout()),
+	})
+	s.mu.Unlock()
+
+	return salt, uint16(ln.Addr().(*net.TCPAddr).Port), nil
+}
+
+// listen starts listening, if the server doesn't listen yet.
+func (s *Server) listen() (net.Listener, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ln != nil {
+		return s.ln, nil
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = ":0"
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ln = ln
+	go s.serve(ln)
+
+	return ln, nil
+}
+
+// Close stops listening and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	ln := s.ln
+	s.ln = nil
+	s.prepared = nil
+	var cs []*Conn
+	for c := range s.conns {
+		cs = append(cs, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range cs {
+		c.Close()
+	}
+
+	if ln != nil {
+		return ln.Close()
+	}
+
+	return nil
+}
+
+func (s *Server) serve(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			log.Debug.Println("hds:", err)
+			return
+		}
+
+		go s.handle(c)
+	}
+}
+
+// handle identifies the prepared data stream of the connection
+// by decrypting the first frame and serves the connection.
+func (s *Server) handle(c net.Conn) {
+	c.SetReadDeadline(time.Now().Add(s.handshakeTimeout()))
+	f, err := readFrame(c)
+	if err != nil {
+		log.Debug.Println("hds:", err)
+		c.Close()
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+
+	conn, p := s.identify(c, f)
+	if conn == nil {
+		log.Info.Printf("hds: unknown data stream from %s\n", c.RemoteAddr())
+		c.Close()
+		return
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	if s.ConnectedFunc != nil {
+		s.ConnectedFunc(conn)
+	}
+
+	if err := conn.handlePayload(p); err != nil {
+		log.Info.Println("hds:", err)
+		conn.Close()
+	} else {
+		conn.serve()
+	}
+
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	if s.DisconnectedFunc != nil {
+		s.DisconnectedFunc(conn)
+	}
+}
+
+// identify returns the connection of the prepared data stream,
+// whose keys decrypt the frame f, and the decrypted payload.
+func (s *Server) identify(c net.Conn, f *frame) (*Conn, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var prepared []*prepared
+	var conn *Conn
+	var payload []byte
+	for _, p := range s.prepared {
+		if now.After(p.expires) {
+			continue
+		}
+
+		if conn == nil {
+			cs := cipherState{key: p.dec}
+			if b, err := cs.open(f); err == nil {
+				conn = newConn(c, s, p)
+				conn.dec = cs
+				payload = b
+				continue
+			}
+		}
+
+		prepared = append(prepared, p)
+	}
+	s.prepared = prepared
+
+	return conn, payload
+}
+
+func (s *Server) handshakeTimeout() time.Duration {
+	if s.HandshakeTimeout > 0 {
+		return s.HandshakeTimeout
+	}
+
+	return defaultHandshakeTimeout
+}
@@ -0,0 +1,177 @@
+package hds
+
+import (
+	"github.com/brutella/hap/tlv8"
+
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// setupStream sets up a data stream by writing to the setup
+// characteristic and returns the keys of the controller.
+func setupStream(t *testing.T, tm *TransportManagement) (port uint16, enc, dec cipherState) {
+	shared := bytes.Repeat([]byte{0x11}, 32)
+	controllerSalt := bytes.Repeat([]byte{0x22}, keySaltLen)
+
+	b, err := tlv8.Marshal(setupRequest{sessionCommandStart, transportTypeTCP, controllerSalt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, "/characteristics", nil)
+	req = req.WithContext(WithSharedSecret(context.Background(), shared))
+	v, code := tm.Setup.SetValueRequest(base64.StdEncoding.EncodeToString(b), req)
+	if is, want := code, 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	b, _ = base64.StdEncoding.DecodeString(v.(string))
+	var resp setupResponse
+	if err := tlv8.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := resp.Status, byte(setupStatusSuccess); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// the controller reads with the key the accessory writes with
+	read, write, err := deriveKeys(shared, controllerSalt, resp.AccessorySalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.Parameters.Port, cipherState{key: write}, cipherState{key: read}
+}
+
+// controller is the controller side of a data stream.
+type controller struct {
+	t    *testing.T
+	conn net.Conn
+	enc  cipherState
+	dec  cipherState
+}
+
+func connect(t *testing.T, srv *Server) *controller {
+	tm := NewTransportManagement(srv)
+	port, enc, dec := setupStream(t, tm)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return &controller{t, conn, enc, dec}
+}
+
+func (c *controller) send(m *Message) {
+	p, err := encodeMessage(m)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	b, err := c.enc.seal(p)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if _, err := c.conn.Write(b); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *controller) receive() *Message {
+	f, err := readFrame(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	p, err := c.dec.open(f)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	m, err := decodeMessage(p)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return m
+}
+
+func (c *controller) request(m *Message) *Message {
+	c.send(m)
+	return c.receive()
+}
+
+func TestDataStreamHello(t *testing.T) {
+	srv := NewServer()
+	srv.Addr = "127.0.0.1:0"
+	defer srv.Close()
+
+	srv.HandleRequest("test", "echo", func(c *Conn, req *Message) (int, map[string]interface{}) {
+		return StatusSuccess, req.Body
+	})
+
+	c := connect(t, srv)
+	defer c.conn.Close()
+
+	resp := c.request(&Message{Type: MessageTypeRequest, Protocol: ProtocolControl, Topic: TopicHello, Id: 1})
+	if is, want := resp.Type, MessageTypeResponse; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := resp.Status, int64(StatusSuccess); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	resp = c.request(&Message{Type: MessageTypeRequest, Protocol: "test", Topic: "echo", Id: 2, Body: map[string]interface{}{"value": "abc"}})
+	if is, want := resp.Id, int64(2); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := resp.Body["value"], "abc"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	resp = c.request(&Message{Type: MessageTypeRequest, Protocol: "unknown", Topic: "x", Id: 3})
+	if is, want := resp.Status, int64(StatusMissingProtocol); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(srv.Conns()), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestDataStreamUnknownKeys(t *testing.T) {
+	srv := NewServer()
+	srv.Addr = "127.0.0.1:0"
+	defer srv.Close()
+
+	tm := NewTransportManagement(srv)
+	port, _, dec := setupStream(t, tm)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// encrypt with the wrong key
+	p, _ := encodeMessage(&Message{Type: MessageTypeRequest, Protocol: ProtocolControl, Topic: TopicHello, Id: 1})
+	b, _ := dec.seal(p)
+	conn.Write(b)
+
+	if _, err := readFrame(conn); err == nil {
+		t.Fatal("expected closed connection")
+	}
+}
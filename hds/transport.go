@@ -0,0 +1,121 @@
+package hds
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"context"
+	"fmt"
+)
+
+const (
+	TypeDataStreamTransportManagement             = "129"
+	TypeSupportedDataStreamTransportConfiguration = "130"
+	TypeSetupDataStreamTransport                  = "131"
+)
+
+// Version is the supported version of the data stream protocol.
+const Version = "1.0"
+
+const (
+	transportTypeTCP = 0
+
+	sessionCommandStart = 0
+
+	setupStatusSuccess      = 0
+	setupStatusGenericError = 1
+)
+
+type transportConfiguration struct {
+	Transport transportType `tlv8:"1"`
+}
+
+type transportType struct {
+	Type byte `tlv8:"1"`
+}
+
+type setupRequest struct {
+	Command        byte   `tlv8:"1"`
+	Transport      byte   `tlv8:"2"`
+	ControllerSalt []byte `tlv8:"3"`
+}
+
+type setupResponse struct {
+	Status        byte             `tlv8:"1"`
+	Parameters    sessionParameter `tlv8:"2"`
+	AccessorySalt []byte           `tlv8:"3"`
+}
+
+type sessionParameter struct {
+	Port uint16 `tlv8:"1"`
+}
+
+// TransportManagement is the data stream transport management service,
+// with which controllers set up data streams to the server.
+type TransportManagement struct {
+	*service.S
+
+	SupportedConfiguration *characteristic.Bytes
+	Setup                  *characteristic.Bytes
+	Version                *characteristic.Version
+
+	Server *Server
+}
+
+// NewTransportManagement returns a data stream transport
+// management service for the server srv.
+func NewTransportManagement(srv *Server) *TransportManagement {
+	t := TransportManagement{Server: srv}
+	t.S = service.New(TypeDataStreamTransportManagement)
+
+	t.SupportedConfiguration = characteristic.NewBytes(TypeSupportedDataStreamTransportConfiguration)
+	t.SupportedConfiguration.Permissions = []string{characteristic.PermissionRead}
+	if b, err := tlv8.Marshal(transportConfiguration{transportType{transportTypeTCP}}); err != nil {
+		log.Info.Println(err)
+	} else {
+		t.SupportedConfiguration.SetValue(b)
+	}
+	t.AddC(t.SupportedConfiguration.C)
+
+	t.Setup = characteristic.NewBytes(TypeSetupDataStreamTransport)
+	t.Setup.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionWrite, characteristic.PermissionWriteResponse}
+	t.Setup.SetValue([]byte{})
+	t.Setup.OnWriteResponse(t.setup)
+	t.AddC(t.Setup.C)
+
+	t.Version = characteristic.NewVersion()
+	t.Version.SetValue(Version)
+	t.AddC(t.Version.C)
+
+	return &t
+}
+
+// setup prepares a data stream for the controller,
+// which wrote the setup request b.
+func (t *TransportManagement) setup(ctx context.Context, b []byte) ([]byte, error) {
+	var req setupRequest
+	if err := tlv8.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+
+	if req.Command != sessionCommandStart || req.Transport != transportTypeTCP {
+		return nil, fmt.Errorf("hds: unsupported setup %d/%d", req.Command, req.Transport)
+	}
+
+	resp := setupResponse{Status: setupStatusSuccess}
+	shared, ok := SharedSecret(ctx)
+	if !ok {
+		log.Info.Println("hds: no shared secret")
+		resp.Status = setupStatusGenericError
+	} else if salt, port, err := t.Server.Prepare(shared, req.ControllerSalt, characteristic.PairingName(ctx)); err != nil {
+		log.Info.Println(err)
+		resp.Status = setupStatusGenericError
+	} else {
+		resp.Parameters = sessionParameter{port}
+		resp.AccessorySalt = salt
+	}
+
+	return tlv8.Marshal(resp)
+}
@@ -0,0 +1,85 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Health is the health status of a server.
+type Health struct {
+	// Listening is true if the server accepts connections.
+	Listening bool `json:"listening"`
+	// Advertising is true if the accessory is announced via dnssd.
+	Advertising bool `json:"advertising"`
+	// Store is true if the store is reachable (and writable
+	// unless it is a read-only store).
+	Store bool `json:"store"`
+	// StoreError is the error of the store check.
+	StoreError string `json:"storeError,omitempty"`
+	// Paired is true if the accessory is paired with a controller.
+	Paired bool `json:"paired"`
+	// Sessions is the number of active encrypted sessions.
+	Sessions int `json:"sessions"`
+}
+
+// Ready returns true if the server is listening and advertising
+// and the store is reachable.
+func (h Health) Ready() bool {
+	return h.Listening && h.Advertising && h.Store
+}
+
+// Health returns the current health status of the server.
+func (s *Server) Health() Health {
+	s.mux.Lock()
+	h := Health{
+		Listening:   s.ln != nil,
+		Advertising: s.advertising,
+	}
+	s.mux.Unlock()
+
+	if err := s.storeHealthy(); err != nil {
+		h.StoreError = err.Error()
+	} else {
+		h.Store = true
+	}
+
+	h.Paired = s.IsPaired()
+	h.Sessions = s.Metrics().Sessions
+
+	return h
+}
+
+// HealthHandler returns an http handler which responds with the health
+// status as json. The status code is 503 (service unavailable)
+// if the server is not ready.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		h := s.Health()
+
+		res.Header().Set("Content-Type", "application/json")
+		if !h.Ready() {
+			res.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		json.NewEncoder(res).Encode(h)
+	})
+}
+
+// serveHealth serves the health status at addr until ctx is done.
+func (s *Server) serveHealth(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", s.HealthHandler())
+	ss := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		ss.Close()
+	}()
+
+	if err := ss.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info.Println("health:", err)
+	}
+}
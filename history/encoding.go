@@ -0,0 +1,91 @@
+package history
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// signature returns the fields of the entries of kind:
+// the number of fields followed by the type and length of every field.
+func signature(kind Kind) []byte {
+	switch kind {
+	case Weather:
+		return []byte{0x03, 0x01, 0x02, 0x02, 0x02, 0x03, 0x02}
+	case Energy:
+		return []byte{0x04, 0x01, 0x02, 0x02, 0x02, 0x07, 0x02, 0x0f, 0x03}
+	case Motion:
+		return []byte{0x02, 0x13, 0x01, 0x1c, 0x01}
+	case Door:
+		return []byte{0x01, 0x06, 0x01}
+	default:
+		return []byte{0x00}
+	}
+}
+
+// appendReference appends the entry n, which contains
+// the reference time t in seconds since the epoch.
+func appendReference(b []byte, n uint32, t time.Time) []byte {
+	b = append(b, 0x15)
+	b = appendUint32(b, n)
+	b = appendUint32(b, 1)
+	b = append(b, 0x81)
+	b = appendUint32(b, uint32(t.Sub(epoch).Seconds()))
+	b = append(b, make([]byte, 7)...)
+
+	return b
+}
+
+// appendEntry appends the entry n with the values of sample
+// measured sec seconds after the first sample.
+func appendEntry(b []byte, kind Kind, n uint32, sec uint32, sample Sample) []byte {
+	var v []byte
+	switch kind {
+	case Weather:
+		v = append(v, 0x07) // temperature, humidity and pressure
+		v = appendUint16(v, uint16(int16(math.Round(sample.Temperature*100))))
+		v = appendUint16(v, uint16(math.Round(sample.Humidity*100)))
+		v = appendUint16(v, uint16(math.Round(sample.Pressure*10)))
+	case Energy:
+		v = append(v, 0x1f)
+		v = appendUint16(v, 0)
+		v = appendUint16(v, 0)
+		v = appendUint16(v, uint16(math.Round(sample.Power*10)))
+		v = appendUint16(v, 0)
+		v = appendUint16(v, 0)
+	case Motion:
+		v = append(v, 0x02)
+		v = append(v, boolByte(sample.Status))
+	case Door:
+		v = append(v, 0x01)
+		v = append(v, boolByte(sample.Status))
+	}
+
+	// length, entry number and time are followed by the values
+	b = append(b, byte(1+4+4+len(v)))
+	b = appendUint32(b, n)
+	b = appendUint32(b, sec)
+	b = append(b, v...)
+
+	return b
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 0x01
+	}
+
+	return 0x00
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,293 @@
+// Package history implements the history service of the Eve app.
+//
+// Eve reads the history of an accessory with the characteristics of
+// the history service and shows the samples as graphs. The samples
+// are stored in a ring buffer in the store of the server.
+//
+//	h, err := history.New(history.Weather, store, "history.1", 4032)
+//	a.AddS(h.S)
+//	…
+//	h.Add(history.Sample{Time: time.Now(), Temperature: 21.5, Humidity: 40})
+package history
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/service"
+
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	TypeService = "E863F007-079E-48FF-8F27-9C2605A29F52"
+
+	TypeStatus  = "E863F116-079E-48FF-8F27-9C2605A29F52" // S2R1
+	TypeEntries = "E863F117-079E-48FF-8F27-9C2605A29F52" // S2R2
+	TypeRequest = "E863F11C-079E-48FF-8F27-9C2605A29F52" // S2W1
+	TypeSetTime = "E863F121-079E-48FF-8F27-9C2605A29F52" // S2W2
+)
+
+// epoch is the reference time of the Eve app (2001-01-01).
+var epoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// entriesPerRead is the maximum number of entries returned by a read.
+const entriesPerRead = 11
+
+// Kind is the kind of samples.
+type Kind int
+
+const (
+	Weather Kind = iota // temperature, humidity and air pressure
+	Energy              // power consumption
+	Motion              // motion detected
+	Door                // contact sensor state
+)
+
+// A Sample is a measurement at a specific time.
+// Only the values of the kind of the history are stored.
+type Sample struct {
+	Time        time.Time
+	Temperature float64 // °C
+	Humidity    float64 // %
+	Pressure    float64 // hPa
+	Power       float64 // W
+	Status      bool    // motion detected or contact open
+}
+
+// Service is the history service.
+type Service struct {
+	*service.S
+
+	Status  *characteristic.Bytes
+	Entries *characteristic.Bytes
+	Request *characteristic.Bytes
+	SetTime *characteristic.Bytes
+
+	kind Kind
+	st   hap.Store
+	key  string
+
+	mu   sync.Mutex
+	d    data
+	next uint32 // next entry returned by Entries
+}
+
+// data is the persisted history.
+type data struct {
+	Initial time.Time // time of the first sample
+	First   uint32    // entry number of the oldest sample
+	Last    uint32    // entry number of the newest sample
+	Samples []Sample  // ring buffer
+}
+
+// New returns a history service which stores up to size samples
+// of kind in st under key. The stored samples are restored.
+func New(kind Kind, st hap.Store, key string, size int) (*Service, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid history size %d", size)
+	}
+
+	s := &Service{
+		S:    service.New(TypeService),
+		kind: kind,
+		st:   st,
+		key:  key,
+		d: data{
+			Samples: make([]Sample, size),
+		},
+	}
+	s.Hidden = true
+
+	if b, err := st.Get(key); err == nil {
+		var d data
+		if err := json.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+
+		// keep the samples if the size didn't change
+		if len(d.Samples) == size {
+			s.d = d
+		}
+	}
+
+	s.Status = newBytes(TypeStatus, characteristic.PermissionRead, characteristic.PermissionEvents, characteristic.PermissionHidden)
+	s.Status.OnValueRequestContext(func(ctx context.Context) ([]byte, error) {
+		return s.status(time.Now()), nil
+	})
+	s.AddC(s.Status.C)
+
+	s.Entries = newBytes(TypeEntries, characteristic.PermissionRead, characteristic.PermissionEvents, characteristic.PermissionHidden)
+	s.Entries.ValueRequestFunc = func(r *http.Request) (interface{}, int) {
+		// the accessory database is serialized without request
+		if r == nil {
+			return s.Entries.C.Value(), 0
+		}
+		return base64.StdEncoding.EncodeToString(s.entries()), 0
+	}
+	s.AddC(s.Entries.C)
+
+	s.Request = newBytes(TypeRequest, characteristic.PermissionWrite, characteristic.PermissionHidden)
+	s.Request.OnSetRemoteValue(func(b []byte) error {
+		return s.request(b)
+	})
+	// reset the value, so that the same request is handled again
+	s.Request.OnCValueUpdate(func(c *characteristic.C, new, old interface{}, r *http.Request) {
+		if r != nil {
+			s.Request.SetValue([]byte{})
+		}
+	})
+	s.AddC(s.Request.C)
+
+	s.SetTime = newBytes(TypeSetTime, characteristic.PermissionWrite, characteristic.PermissionHidden)
+	s.AddC(s.SetTime.C)
+
+	return s, nil
+}
+
+func newBytes(typ string, perms ...string) *characteristic.Bytes {
+	c := characteristic.NewBytes(typ)
+	c.Format = characteristic.FormatData
+	c.Permissions = perms
+	c.SetValue([]byte{})
+
+	return c
+}
+
+// Add adds a sample to the history and saves the history in the store.
+// If the history is full, the oldest sample is removed.
+func (s *Service) Add(sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sample.Time.IsZero() {
+		sample.Time = time.Now()
+	}
+
+	if s.d.Last == 0 {
+		s.d.Initial = sample.Time
+		s.d.First = 1
+	}
+
+	s.d.Last++
+	s.d.Samples[s.index(s.d.Last)] = sample
+
+	if size := uint32(len(s.d.Samples)); s.d.Last-s.d.First >= size {
+		s.d.First = s.d.Last - size + 1
+	}
+
+	b, err := json.Marshal(s.d)
+	if err != nil {
+		return err
+	}
+
+	return s.st.Set(s.key, b)
+}
+
+// Samples returns the samples in the history, the oldest first.
+func (s *Service) Samples() []Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ss []Sample
+	for n := s.d.First; n != 0 && n <= s.d.Last; n++ {
+		ss = append(ss, s.d.Samples[s.index(n)])
+	}
+
+	return ss
+}
+
+// index returns the index of the entry n in the ring buffer.
+func (s *Service) index(n uint32) int {
+	return int((n - 1) % uint32(len(s.d.Samples)))
+}
+
+// status returns the value of the history status characteristic.
+func (s *Service) status(now time.Time) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		b        []byte
+		elapsed  uint32
+		initial  uint32
+		used     uint16
+		size     = uint16(len(s.d.Samples))
+		first    uint32
+		reserved = []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x01}
+	)
+
+	if s.d.Last > 0 {
+		elapsed = uint32(now.Sub(s.d.Initial).Seconds())
+		initial = uint32(s.d.Initial.Sub(epoch).Seconds())
+		used = uint16(s.d.Last - s.d.First + 1)
+		first = s.d.First
+	}
+
+	b = appendUint32(b, elapsed)
+	b = appendUint32(b, 0) // negative offset
+	b = appendUint32(b, initial)
+	b = append(b, signature(s.kind)...)
+	b = appendUint16(b, used)
+	b = appendUint16(b, size)
+	b = appendUint32(b, first)
+	b = append(b, reserved...)
+
+	return b
+}
+
+// request handles a write to the history request characteristic,
+// which contains the number of the next entry to read.
+func (s *Service) request(b []byte) error {
+	if len(b) < 6 {
+		return fmt.Errorf("invalid history request %x", b)
+	}
+
+	n := binary.LittleEndian.Uint32(b[2:6])
+	if n == 0 {
+		n = 1
+	}
+	log.Debug.Printf("history request from entry %d\n", n)
+
+	s.mu.Lock()
+	s.next = n
+	s.mu.Unlock()
+
+	return nil
+}
+
+// entries returns the next entries, which were requested by
+// writing to the history request characteristic.
+func (s *Service) entries() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next < s.d.First {
+		s.next = s.d.First
+	}
+
+	if s.d.Last == 0 || s.next > s.d.Last {
+		return []byte{0x00}
+	}
+
+	var b []byte
+	if s.next == s.d.First {
+		// the first entry contains the reference time
+		b = appendReference(b, s.next, s.d.Initial)
+	}
+
+	for i := 0; i < entriesPerRead && s.next <= s.d.Last; i++ {
+		sample := s.d.Samples[s.index(s.next)]
+		b = appendEntry(b, s.kind, s.next, uint32(sample.Time.Sub(s.d.Initial).Seconds()), sample)
+		s.next++
+	}
+
+	return b
+}
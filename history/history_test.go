@@ -0,0 +1,83 @@
+package history
+
+import (
+	"github.com/brutella/hap"
+
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	st := hap.NewMemStore()
+	h, err := New(Weather, st, "history", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := h.Add(Sample{Time: now.Add(time.Duration(i) * time.Minute), Temperature: float64(20 + i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ss := h.Samples()
+	if is, want := len(ss), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := ss[0].Temperature, float64(21); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// the samples are restored from the store
+	h, err = New(Weather, st, "history", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(h.Samples()), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := h.request([]byte{0x01, 0x14, 0x01, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := h.entries()
+	// reference entry followed by 2 weather entries
+	if is, want := len(b), 0x15+2*0x10; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// entry 3 measured 120 seconds after the first sample with 22.00°C
+	if is, want := b[0x15+0x10:0x15+0x10+12], []byte{0x10, 0x03, 0x00, 0x00, 0x00, 0x78, 0x00, 0x00, 0x00, 0x07, 0x98, 0x08}; !bytes.Equal(is, want) {
+		t.Fatalf("%x != %x", is, want)
+	}
+
+	if is, want := h.entries(), []byte{0x00}; !bytes.Equal(is, want) {
+		t.Fatalf("%x != %x", is, want)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	h, err := New(Motion, hap.NewMemStore(), "history", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	h.Add(Sample{Time: now, Status: true})
+
+	b := h.status(now.Add(10 * time.Second))
+	if is, want := b[0], byte(10); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// used and total memory follow the signature
+	off := 12 + len(signature(Motion))
+	if is, want := b[off:off+4], []byte{0x01, 0x00, 0x64, 0x00}; !bytes.Equal(is, want) {
+		t.Fatalf("%x != %x", is, want)
+	}
+}
@@ -1,18 +1,18 @@
 package hkdf
 
 import (
-	"crypto/sha512"
 	"golang.org/x/crypto/hkdf"
+
+	"crypto/sha512"
 	"io"
 )
 
-// Sha512 returns a 256-bit hash from a key, salt and info.
+// Sha512 returns a 256-bit key derived from a key, salt and info using HKDF-SHA-512.
 func Sha512(key, salt, info []byte) ([32]byte, error) {
-	hash := sha512.New
-	hkdf := hkdf.New(hash, key, salt, info)
+	r := hkdf.New(sha512.New, key, salt, info)
 
 	var buf [32]byte
-	_, err := io.ReadFull(hkdf, buf[:])
+	_, err := io.ReadFull(r, buf[:])
 
 	return buf, err
 }
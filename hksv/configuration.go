@@ -0,0 +1,160 @@
+package hksv
+
+import (
+	"github.com/brutella/hap/rtp"
+)
+
+// Event triggers of recordings
+const (
+	EventTriggerMotion   uint64 = 0x01
+	EventTriggerDoorbell uint64 = 0x02
+)
+
+const MediaContainerTypeFragmentedMP4 byte = 0
+
+const (
+	AudioRecordingCodecTypeAAC_LC  byte = 0
+	AudioRecordingCodecTypeAAC_ELD byte = 1
+
+	AudioRecordingSampleRate8Khz  byte = 0
+	AudioRecordingSampleRate16Khz byte = 1
+	AudioRecordingSampleRate24Khz byte = 2
+	AudioRecordingSampleRate32Khz byte = 3
+	AudioRecordingSampleRate44Khz byte = 4 // 44.1 kHz
+	AudioRecordingSampleRate48Khz byte = 5
+)
+
+// CameraRecordingConfiguration is the general recording configuration.
+type CameraRecordingConfiguration struct {
+	PrebufferLength uint32                      `tlv8:"1"` // in milliseconds
+	EventTriggers   uint64                      `tlv8:"2"` // e.g. EventTriggerMotion
+	MediaContainer  MediaContainerConfiguration `tlv8:"3"`
+}
+
+type MediaContainerConfiguration struct {
+	Type       byte                     `tlv8:"1"`
+	Parameters MediaContainerParameters `tlv8:"2"`
+}
+
+type MediaContainerParameters struct {
+	FragmentLength uint32 `tlv8:"1"` // in milliseconds
+}
+
+// VideoRecordingConfiguration is the supported video recording configuration.
+type VideoRecordingConfiguration struct {
+	Codec VideoRecordingCodecConfiguration `tlv8:"1"`
+}
+
+type VideoRecordingCodecConfiguration struct {
+	Type       byte                          `tlv8:"1"`
+	Parameters VideoRecordingCodecParameters `tlv8:"2"`
+	Attributes []rtp.VideoCodecAttributes    `tlv8:"3"`
+}
+
+type VideoRecordingCodecParameters struct {
+	Profiles []rtp.VideoCodecProfile `tlv8:"-"`
+	Levels   []rtp.VideoCodecLevel   `tlv8:"-"`
+}
+
+// AudioRecordingConfiguration is the supported audio recording configuration.
+type AudioRecordingConfiguration struct {
+	Codec AudioRecordingCodecConfiguration `tlv8:"1"`
+}
+
+type AudioRecordingCodecConfiguration struct {
+	Type       byte                          `tlv8:"1"`
+	Parameters AudioRecordingCodecParameters `tlv8:"2"`
+}
+
+type AudioRecordingCodecParameters struct {
+	Channels    byte `tlv8:"1"`
+	BitrateMode byte `tlv8:"2"` // e.g. rtp.AudioCodecBitrateVariable
+	SampleRate  byte `tlv8:"3"` // e.g. AudioRecordingSampleRate32Khz
+}
+
+// SelectedRecordingConfiguration is the recording
+// configuration selected by the controller.
+type SelectedRecordingConfiguration struct {
+	General CameraRecordingConfiguration        `tlv8:"1"`
+	Video   SelectedVideoRecordingConfiguration `tlv8:"2"`
+	Audio   SelectedAudioRecordingConfiguration `tlv8:"3"`
+}
+
+type SelectedVideoRecordingConfiguration struct {
+	CodecType  byte                             `tlv8:"1"`
+	Parameters SelectedVideoRecordingParameters `tlv8:"2"`
+	Attributes rtp.VideoCodecAttributes         `tlv8:"3"`
+}
+
+type SelectedVideoRecordingParameters struct {
+	Profile        byte   `tlv8:"1"`
+	Level          byte   `tlv8:"2"`
+	Bitrate        uint32 `tlv8:"3"` // in kbit/s
+	IFrameInterval uint32 `tlv8:"4"` // in milliseconds
+}
+
+type SelectedAudioRecordingConfiguration struct {
+	CodecType  byte                             `tlv8:"1"`
+	Parameters SelectedAudioRecordingParameters `tlv8:"2"`
+}
+
+type SelectedAudioRecordingParameters struct {
+	Channels    byte   `tlv8:"1"`
+	BitrateMode byte   `tlv8:"2"`
+	SampleRate  byte   `tlv8:"3"`
+	MaxBitrate  uint32 `tlv8:"4"` // in kbit/s
+}
+
+// Configuration is the recording configuration supported by a camera.
+type Configuration struct {
+	Camera CameraRecordingConfiguration
+	Video  VideoRecordingConfiguration
+	Audio  AudioRecordingConfiguration
+}
+
+// DefaultConfiguration returns a configuration with a prebuffer
+// of 4 seconds, which records on motion in H.264 (up to 1080p)
+// and AAC-LC.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Camera: CameraRecordingConfiguration{
+			PrebufferLength: 4000,
+			EventTriggers:   EventTriggerMotion,
+			MediaContainer: MediaContainerConfiguration{
+				Type:       MediaContainerTypeFragmentedMP4,
+				Parameters: MediaContainerParameters{FragmentLength: 4000},
+			},
+		},
+		Video: VideoRecordingConfiguration{
+			Codec: VideoRecordingCodecConfiguration{
+				Type: rtp.VideoCodecType_H264,
+				Parameters: VideoRecordingCodecParameters{
+					Profiles: []rtp.VideoCodecProfile{
+						{Id: rtp.VideoCodecProfileMain},
+						{Id: rtp.VideoCodecProfileHigh},
+					},
+					Levels: []rtp.VideoCodecLevel{
+						{Level: rtp.VideoCodecLevel3_1},
+						{Level: rtp.VideoCodecLevel3_2},
+						{Level: rtp.VideoCodecLevel4},
+					},
+				},
+				Attributes: []rtp.VideoCodecAttributes{
+					{Width: 1920, Height: 1080, Framerate: 30},
+					{Width: 1280, Height: 720, Framerate: 30},
+					{Width: 640, Height: 360, Framerate: 30},
+				},
+			},
+		},
+		Audio: AudioRecordingConfiguration{
+			Codec: AudioRecordingCodecConfiguration{
+				Type: AudioRecordingCodecTypeAAC_LC,
+				Parameters: AudioRecordingCodecParameters{
+					Channels:    1,
+					BitrateMode: rtp.AudioCodecBitrateVariable,
+					SampleRate:  AudioRecordingSampleRate32Khz,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package hksv
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/rtp"
+	"github.com/brutella/hap/service"
+)
+
+// Events reports the motion and doorbell events of a camera and
+// enforces the operating mode of the camera as expected by controllers:
+// if the camera is disabled (HomeKitCameraActive is 0), no motion is
+// reported and no snapshots or streams are provided.
+// Snapshots of event notifications and periodic snapshots are only
+// provided if EventSnapshotsActive and PeriodicSnapshotsActive are set.
+type Events struct {
+	OperatingMode *OperatingMode
+
+	// MotionSensor and Doorbell are optional.
+	MotionSensor *service.MotionSensor
+	Doorbell     *service.Doorbell
+}
+
+// NewEvents returns events of a camera with the operating mode.
+// The motion sensor and doorbell services may be nil.
+func NewEvents(mode *OperatingMode, motion *service.MotionSensor, doorbell *service.Doorbell) *Events {
+	e := Events{
+		OperatingMode: mode,
+		MotionSensor:  motion,
+		Doorbell:      doorbell,
+	}
+
+	mode.HomeKitCameraActive.OnValueRemoteUpdate(func(v int) {
+		if v == 0 && e.MotionSensor != nil {
+			e.MotionSensor.MotionDetected.SetValue(false)
+		}
+	})
+
+	return &e
+}
+
+// IsCameraActive returns true if the camera is enabled by the controllers.
+func (e *Events) IsCameraActive() bool {
+	return e.OperatingMode.HomeKitCameraActive.Value() == 1
+}
+
+// Motion reports whether motion is detected. Motion is
+// not reported while the camera is disabled.
+func (e *Events) Motion(detected bool) {
+	if e.MotionSensor == nil {
+		return
+	}
+
+	if detected && !e.IsCameraActive() {
+		return
+	}
+
+	e.MotionSensor.MotionDetected.SetValue(detected)
+}
+
+// Ring notifies the controllers that the doorbell was pressed.
+// Rings are always reported; the controllers only request
+// a snapshot of the ring if event snapshots are enabled.
+func (e *Events) Ring() {
+	if e.Doorbell == nil {
+		return
+	}
+
+	e.Doorbell.ProgrammableSwitchEvent.SetValue(characteristic.ProgrammableSwitchEventSinglePress)
+}
+
+// SnapshotAllowed returns true if a snapshot with
+// the reason (e.g. hap.SnapshotReasonEvent) is allowed.
+// It can be used as hap.Server.SnapshotAllowedFunc.
+func (e *Events) SnapshotAllowed(reason int) bool {
+	if !e.IsCameraActive() {
+		return false
+	}
+
+	switch reason {
+	case hap.SnapshotReasonEvent:
+		return e.OperatingMode.EventSnapshotsActive.Value() == 1
+	case hap.SnapshotReasonPeriodic:
+		return e.OperatingMode.PeriodicSnapshotsActive.Value() == 1
+	}
+
+	return true
+}
+
+// Enforce configures the server and stream manager to enforce the
+// operating mode before snapshots are taken and streams are started.
+// It must be called after the stream functions of m are set.
+func (e *Events) Enforce(s *hap.Server, m *rtp.StreamManager) {
+	if s != nil {
+		s.SnapshotAllowedFunc = e.SnapshotAllowed
+	}
+
+	if m != nil {
+		start := m.StartStreamFunc
+		m.StartStreamFunc = func(s *rtp.Session) error {
+			if !e.IsCameraActive() {
+				return &characteristic.StatusError{Code: hap.JsonStatusNotAllowedInCurrentState}
+			}
+
+			if start == nil {
+				return nil
+			}
+
+			return start(s)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package hksv
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/service"
+
+	"net/http"
+	"testing"
+)
+
+func TestEventsCameraInactive(t *testing.T) {
+	mode := NewOperatingMode()
+	e := NewEvents(mode, service.NewMotionSensor(), nil)
+
+	e.Motion(true)
+	if is, want := e.MotionSensor.MotionDetected.Value(), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// disabled by a controller
+	req, _ := http.NewRequest(http.MethodPut, "/characteristics", nil)
+	mode.HomeKitCameraActive.SetValueRequest(0, req)
+
+	if is, want := e.MotionSensor.MotionDetected.Value(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	e.Motion(true)
+	if is, want := e.MotionSensor.MotionDetected.Value(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if e.SnapshotAllowed(hap.SnapshotReasonUnknown) {
+		t.Fatal("snapshot of inactive camera")
+	}
+}
+
+func TestEventsSnapshotAllowed(t *testing.T) {
+	mode := NewOperatingMode()
+	e := NewEvents(mode, nil, nil)
+
+	mode.EventSnapshotsActive.SetValue(0)
+	if e.SnapshotAllowed(hap.SnapshotReasonEvent) {
+		t.Fatal("event snapshot not allowed")
+	}
+
+	if !e.SnapshotAllowed(hap.SnapshotReasonPeriodic) {
+		t.Fatal("periodic snapshot allowed")
+	}
+
+	mode.PeriodicSnapshotsActive.SetValue(0)
+	if e.SnapshotAllowed(hap.SnapshotReasonPeriodic) {
+		t.Fatal("periodic snapshot not allowed")
+	}
+}
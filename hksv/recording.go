@@ -0,0 +1,267 @@
+// Package hksv implements HomeKit Secure Video recording.
+//
+// A controller selects a recording configuration and opens a recording
+// stream over a HomeKit Data Stream (see package hds) when an event
+// (e.g. motion) was triggered. The application supplies the recording
+// as fragmented MP4.
+package hksv
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/hds"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	TypeCameraOperatingMode     = "21A"
+	TypeHomeKitCameraActive     = "21B"
+	TypeEventSnapshotsActive    = "223"
+	TypePeriodicSnapshotsActive = "225"
+	TypeRecordingAudioActive    = "226"
+)
+
+// dataSendTypeRecording is the type of dataSend streams of recordings.
+const dataSendTypeRecording = "ipcamera.recording"
+
+// Data types of the recording packets
+const (
+	dataTypeInit     = "mediaInitialization"
+	dataTypeFragment = "mediaFragment"
+)
+
+// RecordingManagement is the camera recording management service.
+type RecordingManagement struct {
+	*service.CameraRecordingManagement
+
+	Active               *characteristic.Active
+	RecordingAudioActive *characteristic.Int
+}
+
+// NewRecordingManagement returns a camera recording management
+// service, which supports the recording configuration cfg.
+func NewRecordingManagement(cfg Configuration) *RecordingManagement {
+	m := RecordingManagement{}
+	m.CameraRecordingManagement = service.NewCameraRecordingManagement()
+
+	setTLV8(m.SupportedCameraRecordingConfiguration.Bytes, cfg.Camera)
+	setTLV8(m.SupportedVideoRecordingConfiguration.Bytes, cfg.Video)
+	setTLV8(m.SupportedAudioRecordingConfiguration.Bytes, cfg.Audio)
+
+	m.Active = characteristic.NewActive()
+	m.AddC(m.Active.C)
+
+	m.RecordingAudioActive = newSwitch(TypeRecordingAudioActive)
+	m.AddC(m.RecordingAudioActive.C)
+
+	return &m
+}
+
+// SelectedConfiguration returns the recording configuration
+// selected by a controller. It returns false, if no configuration
+// was selected yet.
+func (m *RecordingManagement) SelectedConfiguration() (SelectedRecordingConfiguration, bool) {
+	var cfg SelectedRecordingConfiguration
+	b := m.SelectedCameraRecordingConfiguration.Value()
+	if len(b) == 0 {
+		return cfg, false
+	}
+
+	if err := tlv8.Unmarshal(b, &cfg); err != nil {
+		log.Info.Println(err)
+		return cfg, false
+	}
+
+	return cfg, true
+}
+
+// OperatingMode is the camera operating mode service. Controllers
+// enable and disable the camera and its snapshots with it.
+type OperatingMode struct {
+	*service.S
+
+	EventSnapshotsActive    *characteristic.Int
+	HomeKitCameraActive     *characteristic.Int
+	PeriodicSnapshotsActive *characteristic.Int
+}
+
+// NewOperatingMode returns a camera operating mode service.
+// The camera and its snapshots are active by default.
+func NewOperatingMode() *OperatingMode {
+	o := OperatingMode{}
+	o.S = service.New(TypeCameraOperatingMode)
+
+	o.EventSnapshotsActive = newSwitch(TypeEventSnapshotsActive)
+	o.EventSnapshotsActive.SetValue(1)
+	o.AddC(o.EventSnapshotsActive.C)
+
+	o.HomeKitCameraActive = newSwitch(TypeHomeKitCameraActive)
+	o.HomeKitCameraActive.SetValue(1)
+	o.AddC(o.HomeKitCameraActive.C)
+
+	o.PeriodicSnapshotsActive = newSwitch(TypePeriodicSnapshotsActive)
+	o.PeriodicSnapshotsActive.SetValue(1)
+	o.AddC(o.PeriodicSnapshotsActive.C)
+
+	return &o
+}
+
+// newSwitch returns a writable characteristic with the values 0 and 1.
+func newSwitch(t string) *characteristic.Int {
+	c := characteristic.NewInt(t)
+	c.Format = characteristic.FormatUInt8
+	c.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionWrite, characteristic.PermissionEvents}
+	c.ValidVals = []int{0, 1}
+	c.SetValue(0)
+
+	return c
+}
+
+// A Recording is a recording stream to a controller. The application
+// writes the initialization segment first and then the media fragments.
+type Recording struct {
+	// Config is the recording configuration selected by the controller.
+	Config SelectedRecordingConfiguration
+
+	s   *hds.DataSendStream
+	seq int
+}
+
+// Context returns the context of the recording,
+// which is canceled when the controller stops the recording.
+func (r *Recording) Context() context.Context {
+	return r.s.Context()
+}
+
+// WriteInit sends the initialization segment of the fragmented MP4
+// (ftyp and moov boxes).
+func (r *Recording) WriteInit(b []byte) error {
+	if r.seq != 0 {
+		return fmt.Errorf("hksv: initialization already sent")
+	}
+
+	return r.write(dataTypeInit, b, false)
+}
+
+// WriteFragment sends a media fragment of the fragmented MP4 (moof and
+// mdat boxes). The recording ends after the fragment, if last is true.
+func (r *Recording) WriteFragment(b []byte, last bool) error {
+	if r.seq == 0 {
+		return fmt.Errorf("hksv: initialization not sent")
+	}
+
+	return r.write(dataTypeFragment, b, last)
+}
+
+func (r *Recording) write(typ string, b []byte, last bool) error {
+	r.seq++
+	md := map[string]interface{}{
+		"dataType":           typ,
+		"dataSequenceNumber": r.seq,
+	}
+
+	return r.s.SendChunked(b, md, last)
+}
+
+// Recorder adds HomeKit Secure Video to a camera accessory.
+type Recorder struct {
+	Management    *RecordingManagement
+	OperatingMode *OperatingMode
+	DataStream    *hds.TransportManagement
+
+	// RecordFunc is called when a controller opens a recording stream.
+	// The function writes the recording to r until r.Context() is done
+	// or the recording ended. The prebuffered video should be included.
+	RecordFunc func(r *Recording) error
+
+	// ConfigurationFunc is called when a controller
+	// selects a recording configuration.
+	ConfigurationFunc func(cfg SelectedRecordingConfiguration)
+
+	mu        sync.Mutex
+	recording bool
+}
+
+// AddRecorder adds the recording management, operating mode and data
+// stream transport management services to the camera accessory a.
+// The data streams of the accessory are served by srv.
+func AddRecorder(a *accessory.A, srv *hds.Server, cfg Configuration) *Recorder {
+	r := Recorder{
+		Management:    NewRecordingManagement(cfg),
+		OperatingMode: NewOperatingMode(),
+		DataStream:    hds.NewTransportManagement(srv),
+	}
+
+	r.Management.SelectedCameraRecordingConfiguration.OnValueRemoteUpdate(func(b []byte) {
+		if cfg, ok := r.Management.SelectedConfiguration(); ok && r.ConfigurationFunc != nil {
+			r.ConfigurationFunc(cfg)
+		}
+	})
+
+	srv.HandleDataSend(dataSendTypeRecording, r.record)
+
+	a.AddS(r.Management.S)
+	a.AddS(r.OperatingMode.S)
+	a.AddS(r.DataStream.S)
+
+	return &r
+}
+
+// IsActive returns true if recording is enabled by the controllers.
+func (r *Recorder) IsActive() bool {
+	return r.Management.Active.Value() == characteristic.ActiveActive &&
+		r.OperatingMode.HomeKitCameraActive.Value() == 1
+}
+
+// record sends a recording over the stream s.
+func (r *Recorder) record(s *hds.DataSendStream) error {
+	if !r.IsActive() || r.RecordFunc == nil {
+		s.Close(hds.CloseReasonNotAllowed)
+		return nil
+	}
+
+	cfg, ok := r.Management.SelectedConfiguration()
+	if !ok {
+		s.Close(hds.CloseReasonInvalidConfiguration)
+		return nil
+	}
+
+	r.mu.Lock()
+	if r.recording {
+		r.mu.Unlock()
+		s.Close(hds.CloseReasonBusy)
+		return nil
+	}
+	r.recording = true
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.recording = false
+		r.mu.Unlock()
+	}()
+
+	err := r.RecordFunc(&Recording{Config: cfg, s: s})
+	if err != nil && s.Context().Err() != nil {
+		// stopped by the controller
+		return nil
+	}
+
+	return err
+}
+
+func setTLV8(c *characteristic.Bytes, v interface{}) {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		log.Info.Println(err)
+		return
+	}
+
+	c.SetValue(b)
+}
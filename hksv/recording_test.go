@@ -0,0 +1,96 @@
+package hksv
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/hds"
+	"github.com/brutella/hap/rtp"
+	"github.com/brutella/hap/tlv8"
+
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestSelectedConfiguration(t *testing.T) {
+	a := accessory.NewCamera(accessory.Info{Name: "Camera"})
+	srv := hds.NewServer()
+	r := AddRecorder(a.A, srv, DefaultConfiguration())
+
+	if _, ok := r.Management.SelectedConfiguration(); ok {
+		t.Fatal("no configuration selected")
+	}
+
+	var selected *SelectedRecordingConfiguration
+	r.ConfigurationFunc = func(cfg SelectedRecordingConfiguration) {
+		selected = &cfg
+	}
+
+	cfg := SelectedRecordingConfiguration{
+		General: DefaultConfiguration().Camera,
+		Video: SelectedVideoRecordingConfiguration{
+			CodecType:  rtp.VideoCodecType_H264,
+			Parameters: SelectedVideoRecordingParameters{Profile: rtp.VideoCodecProfileHigh, Level: rtp.VideoCodecLevel4, Bitrate: 2000, IFrameInterval: 4000},
+			Attributes: rtp.VideoCodecAttributes{Width: 1920, Height: 1080, Framerate: 30},
+		},
+		Audio: SelectedAudioRecordingConfiguration{
+			CodecType:  AudioRecordingCodecTypeAAC_LC,
+			Parameters: SelectedAudioRecordingParameters{Channels: 1, SampleRate: AudioRecordingSampleRate32Khz, MaxBitrate: 64},
+		},
+	}
+
+	b, err := tlv8.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// written by a controller
+	req, _ := http.NewRequest(http.MethodPut, "/characteristics", nil)
+	_, code := r.Management.SelectedCameraRecordingConfiguration.SetValueRequest(base64.StdEncoding.EncodeToString(b), req)
+	if is, want := code, 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if selected == nil {
+		t.Fatal("ConfigurationFunc not called")
+	}
+
+	got, ok := r.Management.SelectedConfiguration()
+	if !ok {
+		t.Fatal("configuration not selected")
+	}
+
+	if is, want := got.Video.Attributes.Width, uint16(1920); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := got.General.PrebufferLength, uint32(4000); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := got.Audio.Parameters.MaxBitrate, uint32(64); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := selected.Video.Parameters.Bitrate, uint32(2000); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestRecorderActive(t *testing.T) {
+	a := accessory.NewCamera(accessory.Info{Name: "Camera"})
+	r := AddRecorder(a.A, hds.NewServer(), DefaultConfiguration())
+
+	if r.IsActive() {
+		t.Fatal("recording must be inactive by default")
+	}
+
+	r.Management.Active.SetValue(1)
+	if !r.IsActive() {
+		t.Fatal("recording must be active")
+	}
+
+	r.OperatingMode.HomeKitCameraActive.SetValue(0)
+	if r.IsActive() {
+		t.Fatal("recording must be inactive if the camera is disabled")
+	}
+}
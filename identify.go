@@ -1,21 +1,58 @@
 package hap
 
 import (
-	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/accessory"
 
 	"net/http"
 )
 
+// OnIdentify sets fn, which is called when a controller identifies the
+// accessory a, e.g. when the user taps Identify in the Home app. This
+// works for bridged accessories too, which are identified by writing to
+// their identify characteristic. remote is the pairing of the controller
+// and empty for an unpaired controller, which identifies the primary
+// accessory via the /identify endpoint. fn is called instead of
+// a.IdentifyFunc.
+func (s *Server) OnIdentify(a *accessory.A, fn func(remote Pairing)) {
+	s.mux.Lock()
+	if fn == nil {
+		delete(s.idFuncs, a)
+	} else {
+		s.idFuncs[a] = fn
+	}
+	s.mux.Unlock()
+}
+
+// identifyAccessory calls the identify callback of a.
+func (s *Server) identifyAccessory(a *accessory.A, req *http.Request) {
+	s.mux.Lock()
+	fn := s.idFuncs[a]
+	s.mux.Unlock()
+
+	if fn == nil {
+		if a.IdentifyFunc != nil {
+			a.IdentifyFunc(req)
+		}
+		return
+	}
+
+	var remote Pairing
+	if req != nil {
+		remote, _ = ContextPairing(req.Context())
+		s.logInfo(req).Printf("identify %s", a.Name())
+	}
+
+	fn(remote)
+}
+
 func (srv *Server) identify(res http.ResponseWriter, req *http.Request) {
 	if srv.IsPaired() {
-		log.Info.Printf("request only valid if unpaired")
+		srv.logInfo(req).Printf("request only valid if unpaired")
 		JsonError(res, JsonStatusInsufficientPrivileges)
 		return
 	}
 
-	if srv.a.IdentifyFunc != nil {
-		srv.a.IdentifyFunc(req)
-	}
+	srv.identifyAccessory(srv.a, req)
 
 	res.WriteHeader(http.StatusNoContent)
 }
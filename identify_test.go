@@ -0,0 +1,80 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdentifyBridgedAccessory(t *testing.T) {
+	b := accessory.NewBridge(accessory.Info{Name: "Bridge"})
+	a := accessory.NewLightbulb(accessory.Info{Name: "Lightbulb"})
+
+	s, err := NewServer(NewMemStore(), b.A, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identified []string
+	s.OnIdentify(b.A, func(remote Pairing) {
+		t.Fatal("bridge must not be identified")
+	})
+	s.OnIdentify(a.A, func(remote Pairing) {
+		identified = append(identified, remote.Name)
+	})
+
+	// identify the accessory twice
+	for i := 0; i < 2; i++ {
+		body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true}]}", a.Id, a.Info.Identify.Id)
+		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+		w := httptest.NewRecorder()
+
+		s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+		s.ss.Handler.ServeHTTP(w, req)
+
+		if is, want := w.Code, http.StatusNoContent; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+
+	if is, want := len(identified), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := identified[0], "Controller"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestIdentifyUnpaired(t *testing.T) {
+	a := accessory.NewLightbulb(accessory.Info{Name: "Lightbulb"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identified bool
+	s.OnIdentify(a.A, func(remote Pairing) {
+		if is, want := remote.Name, ""; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+		identified = true
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/identify", nil)
+	w := httptest.NewRecorder()
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Code, http.StatusNoContent; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := identified, true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,73 @@
+package hap
+
+import (
+	"github.com/brutella/hap/ed25519"
+
+	"errors"
+)
+
+// identity returns the device id and a copy of the public key
+// of the accessory, which change when the identity is rotated.
+func (s *Server) identity() (string, []byte) {
+	s.kmu.RLock()
+	defer s.kmu.RUnlock()
+
+	return s.uuid, append([]byte{}, s.Key.Public...)
+}
+
+// sign returns the signature of data using the long-term private key.
+func (s *Server) sign(data []byte) ([]byte, error) {
+	s.kmu.RLock()
+	defer s.kmu.RUnlock()
+
+	return ed25519.Signature(s.Key.Private, data)
+}
+
+// RotateIdentity generates a new device id and long-term key pair
+// for the accessory and saves them in the store. All pairings are
+// removed because controllers only know the previous identity.
+// The accessory is then announced with the new device id and can
+// be paired again.
+//
+// Use it for factory-reset flows or if the private key was leaked.
+func (s *Server) RotateIdentity() error {
+	if s.st.readOnly() {
+		return errors.New("identity can't be rotated with a read-only store")
+	}
+
+	kp, err := generateKeyPair()
+	if err != nil {
+		return err
+	}
+	uuid := mac48Address(randHex())
+
+	// The new identity is saved before the pairings are removed,
+	// which keeps the accessory paired if the store fails.
+	s.kmu.RLock()
+	old := s.Key
+	s.kmu.RUnlock()
+
+	if err := s.st.SaveKeyPair(kp); err != nil {
+		return err
+	}
+
+	if err := s.st.SetString("uuid", uuid); err != nil {
+		s.st.SaveKeyPair(old)
+		return err
+	}
+
+	if s.Paranoid {
+		s.lockKeyPair(kp)
+	}
+
+	s.kmu.Lock()
+	zero(s.Key.Private)
+	s.Key = kp
+	s.uuid = uuid
+	s.kmu.Unlock()
+
+	err = s.unpair("identity rotated")
+	s.updateTxtRecords()
+
+	return err
+}
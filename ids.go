@@ -0,0 +1,191 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// An IDAllocator assigns accessory ids (aid) and instance ids (iid)
+// to accessories, services and characteristics which have no id.
+//
+// Accessories, services and characteristics are identified by a key,
+// which doesn't depend on their position. An accessory is identified by
+// its serial number (or name), a service by its type and a characteristic
+// by the key of its service and its type. If keys are not unique,
+// "#2", "#3", … is appended.
+//
+// An allocator should return the same id for the same key every time.
+// Otherwise controllers lose the automations and scenes of the
+// accessory after a restart.
+type IDAllocator interface {
+	// Aid returns the id of the bridged accessory with key.
+	// The id 1 is reserved for the main accessory.
+	Aid(key string) (uint64, error)
+
+	// Iid returns the id of the service or characteristic
+	// with key within the accessory aid.
+	Iid(aid uint64, key string) (uint64, error)
+}
+
+// keyIDs is the store key of the assigned ids.
+const keyIDs = "ids"
+
+// storeIDAllocator persists the assigned ids in the store.
+// New ids are assigned in ascending order starting at 1, which
+// results in the same ids the server assigned in previous versions.
+type storeIDAllocator struct {
+	st *storer
+
+	aids  map[string]uint64
+	iids  map[uint64]map[string]uint64
+	dirty bool
+	mu    sync.Mutex
+}
+
+// storedIDs is the stored representation of the assigned ids.
+type storedIDs struct {
+	Aids map[string]uint64            `json:"aids"`
+	Iids map[string]map[string]uint64 `json:"iids"`
+}
+
+func newStoreIDAllocator(st *storer) *storeIDAllocator {
+	ids := &storeIDAllocator{
+		st:   st,
+		aids: map[string]uint64{},
+		iids: map[uint64]map[string]uint64{},
+	}
+
+	b, err := st.Get(keyIDs)
+	if err != nil || len(b) == 0 {
+		return ids
+	}
+
+	var v storedIDs
+	if err := json.Unmarshal(b, &v); err != nil {
+		return ids
+	}
+
+	for k, id := range v.Aids {
+		ids.aids[k] = id
+	}
+
+	for k, m := range v.Iids {
+		aid, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids.iids[aid] = m
+	}
+
+	return ids
+}
+
+func (ids *storeIDAllocator) Aid(key string) (uint64, error) {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+
+	if id, ok := ids.aids[key]; ok {
+		return id, nil
+	}
+
+	var max uint64 = 1
+	for _, id := range ids.aids {
+		if id > max {
+			max = id
+		}
+	}
+
+	ids.aids[key] = max + 1
+	ids.dirty = true
+
+	return max + 1, nil
+}
+
+func (ids *storeIDAllocator) Iid(aid uint64, key string) (uint64, error) {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+
+	m, ok := ids.iids[aid]
+	if !ok {
+		m = map[string]uint64{}
+		ids.iids[aid] = m
+	}
+
+	if id, ok := m[key]; ok {
+		return id, nil
+	}
+
+	var max uint64
+	for _, id := range m {
+		if id > max {
+			max = id
+		}
+	}
+
+	m[key] = max + 1
+	ids.dirty = true
+
+	return max + 1, nil
+}
+
+// save stores the assigned ids if new ids were assigned.
+func (ids *storeIDAllocator) save() error {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+
+	if !ids.dirty || ids.st.readOnly() {
+		return nil
+	}
+
+	v := storedIDs{
+		Aids: ids.aids,
+		Iids: map[string]map[string]uint64{},
+	}
+	for aid, m := range ids.iids {
+		v.Iids[strconv.FormatUint(aid, 10)] = m
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := ids.st.Set(keyIDs, b); err != nil {
+		return err
+	}
+	ids.dirty = false
+
+	return nil
+}
+
+// saveIDs stores the assigned ids if the server uses the default allocator.
+func (s *Server) saveIDs() error {
+	if ids, ok := s.ids.(*storeIDAllocator); ok {
+		return ids.save()
+	}
+
+	return nil
+}
+
+// accessoryKey returns the key which identifies a.
+func accessoryKey(a *accessory.A) string {
+	if sn := a.Info.SerialNumber.Value(); sn != "" && sn != "-" {
+		return sn
+	}
+
+	return "name:" + a.Name()
+}
+
+// uniqueKey returns key and appends "#n" if key is already in keys.
+func uniqueKey(keys map[string]int, key string) string {
+	keys[key]++
+	if n := keys[key]; n > 1 {
+		return fmt.Sprintf("%s#%d", key, n)
+	}
+
+	return key
+}
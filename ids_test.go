@@ -0,0 +1,107 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/service"
+
+	"testing"
+)
+
+func TestStableIDs(t *testing.T) {
+	st := NewMemStore()
+
+	b := accessory.NewBridge(accessory.Info{Name: "Bridge"})
+	l := accessory.NewLightbulb(accessory.Info{Name: "Lightbulb", SerialNumber: "L1"})
+	o := accessory.NewOutlet(accessory.Info{Name: "Outlet", SerialNumber: "O1"})
+	if _, err := NewServer(st, b.A, l.A, o.A); err != nil {
+		t.Fatal(err)
+	}
+
+	// The accessories and services are reordered in the next release.
+	b = accessory.NewBridge(accessory.Info{Name: "Bridge"})
+	o2 := accessory.NewOutlet(accessory.Info{Name: "Outlet", SerialNumber: "O1"})
+	l2 := accessory.NewLightbulb(accessory.Info{Name: "Lightbulb", SerialNumber: "L1"})
+	l2.A.Ss[0], l2.A.Ss[1] = l2.A.Ss[1], l2.A.Ss[0]
+	if _, err := NewServer(st, b.A, o2.A, l2.A); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := o2.A.Id, o.A.Id; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := l2.A.Id, l.A.Id; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := l2.Lightbulb.On.Id, l.Lightbulb.On.Id; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := l2.Info.Name.Id, l.Info.Name.Id; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestStableIDsNewService(t *testing.T) {
+	st := NewMemStore()
+
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	a.AddS(service.NewOutlet().S)
+	if _, err := NewServer(st, a); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new service is added in front of the existing one.
+	a2 := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	sw := service.NewSwitch()
+	o := service.NewOutlet()
+	a2.AddS(sw.S)
+	a2.AddS(o.S)
+	if _, err := NewServer(st, a2); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := o.Id, a.Ss[1].Id; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if sw.Id <= a.Ss[1].Cs[len(a.Ss[1].Cs)-1].Id {
+		t.Fatalf("id %d already used", sw.Id)
+	}
+}
+
+type seqIDs struct {
+	aid, iid uint64
+}
+
+func (ids *seqIDs) Aid(key string) (uint64, error) {
+	ids.aid += 10
+	return ids.aid, nil
+}
+
+func (ids *seqIDs) Iid(aid uint64, key string) (uint64, error) {
+	ids.iid++
+	return aid*100 + ids.iid, nil
+}
+
+func TestIDAllocator(t *testing.T) {
+	b := accessory.NewBridge(accessory.Info{Name: "Bridge"})
+	l := accessory.NewLightbulb(accessory.Info{Name: "Lightbulb"})
+
+	if _, err := New(b.A, WithStore(NewMemStore()), WithBridged(l.A), WithIDAllocator(&seqIDs{})); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := b.A.Id, uint64(1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := l.A.Id, uint64(10); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := l.Info.S.Id/100, uint64(10); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,102 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"encoding/json"
+	"fmt"
+)
+
+// keyJournal is the store key of the pairing journal.
+const keyJournal = "pairing.journal"
+
+const (
+	journalOpSave   = "save"
+	journalOpDelete = "delete"
+)
+
+// journalEntry describes a pairing mutation which is in progress.
+type journalEntry struct {
+	Op      string
+	Pairing Pairing
+}
+
+// journaled writes the journal entry e, applies it and removes the
+// journal entry afterwards. If the process crashes in between,
+// the mutation is applied again when the server starts.
+func (st *storer) journaled(e journalEntry) error {
+	b, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+
+	if err := st.Set(keyJournal, b); err != nil {
+		return fmt.Errorf("journal: %v", err)
+	}
+
+	if err := st.apply(e); err != nil {
+		return err
+	}
+
+	return st.Delete(keyJournal)
+}
+
+// apply applies the mutation of a journal entry.
+// Applying an entry multiple times has the same effect as once.
+func (st *storer) apply(e journalEntry) error {
+	switch e.Op {
+	case journalOpSave:
+		b, err := json.Marshal(&e.Pairing)
+		if err != nil {
+			return err
+		}
+		return st.Set(keyForPairingName(e.Pairing.Name), b)
+	case journalOpDelete:
+		return st.Delete(keyForPairingName(e.Pairing.Name))
+	default:
+		return fmt.Errorf("journal: unknown operation %q", e.Op)
+	}
+}
+
+// recoverJournal applies an interrupted pairing mutation.
+func (st *storer) recoverJournal(l *log.Entry) error {
+	b, err := st.Get(keyJournal)
+	if err != nil || len(b) == 0 {
+		// no interrupted mutation
+		return nil
+	}
+
+	var e journalEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		l.Println("journal: discarding invalid entry:", err)
+		return st.Delete(keyJournal)
+	}
+
+	l.Printf("journal: recovering interrupted %s of pairing %s\n", e.Op, e.Pairing.Name)
+	if err := st.apply(e); err != nil {
+		return err
+	}
+
+	return st.Delete(keyJournal)
+}
+
+// validatePairings removes all pairings if no admin pairing exists.
+// This can happen if the process crashed while the last admin
+// pairing was removed but before the other pairings were removed.
+func (st *storer) validatePairings(l *log.Entry) error {
+	ps := st.Pairings()
+	for _, p := range ps {
+		if p.Permission == PermissionAdmin {
+			return nil
+		}
+	}
+
+	for _, p := range ps {
+		l.Printf("removing pairing %s because no admin is paired\n", p.Name)
+		if err := st.DeletePairing(p.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
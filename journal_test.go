@@ -0,0 +1,42 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"encoding/json"
+	"testing"
+)
+
+func TestRecoverJournal(t *testing.T) {
+	st := NewMemStore()
+	s := &storer{st}
+	s.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+	s.SavePairing(Pairing{Name: "user", Permission: PermissionUser})
+
+	// Simulate a crash while the admin pairing was removed.
+	b, _ := json.Marshal(journalEntry{journalOpDelete, Pairing{Name: "admin"}})
+	st.Set(keyJournal, b)
+
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+	h := &testLogHandler{}
+	if _, err := New(a.A, WithStore(st), WithLogHandler(h)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recovery is logged with the handler of the server.
+	if is, want := len(h.msgs), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := h.msgs[0], "INFO journal: recovering interrupted delete of pairing admin"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(s.Pairings()), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := st.Get(keyJournal); err == nil {
+		t.Fatal("journal not removed")
+	}
+}
@@ -0,0 +1,65 @@
+package hap
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultMaxRequestSize is the maximum size of a request body.
+	defaultMaxRequestSize = 1 << 20
+
+	// defaultSessionPacketLimit is the number of packets
+	// after which the keys of a session are renegotiated.
+	defaultSessionPacketLimit = 1 << 20
+
+	// defaultReceiveTimeout is the maximum duration of receiving a request.
+	defaultReceiveTimeout = 10 * time.Second
+
+	// maxHeaderBytes is the maximum size of the request header.
+	maxHeaderBytes = 16 << 10
+)
+
+func (s *Server) maxRequestSize() int {
+	if s.MaxRequestSize > 0 {
+		return s.MaxRequestSize
+	}
+
+	return defaultMaxRequestSize
+}
+
+func (s *Server) sessionPacketLimit() uint64 {
+	if s.SessionPacketLimit > 0 {
+		return s.SessionPacketLimit
+	}
+
+	return defaultSessionPacketLimit
+}
+
+func (s *Server) receiveTimeout() time.Duration {
+	switch {
+	case s.ReceiveTimeout > 0:
+		return s.ReceiveTimeout
+	case s.ReceiveTimeout < 0:
+		return 0
+	}
+
+	return defaultReceiveTimeout
+}
+
+// limitRequestSize returns a handler which limits the size of the
+// request body. Reading more than the maximum size fails and the
+// connection is closed after the response.
+func (s *Server) limitRequestSize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		max := int64(s.maxRequestSize())
+		if req.ContentLength > max {
+			res.Header().Set("Connection", "close")
+			res.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		req.Body = http.MaxBytesReader(res, req.Body, max)
+		next.ServeHTTP(res, req)
+	})
+}
@@ -0,0 +1,142 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testSessions returns the session of the accessory and
+// the session of a controller, which encrypts for it.
+func testSessions(t *testing.T) (*session, *session) {
+	shared := bytes.Repeat([]byte{0x01}, 32)
+	ss, err := newSession(shared, Pairing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl, err := newSession(shared, Pairing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl.encryptKey = ctl.decryptKey
+
+	return ss, ctl
+}
+
+func TestDecryptLimits(t *testing.T) {
+	ss, ctl := testSessions(t)
+
+	data := bytes.Repeat([]byte{0xaa}, 3*packetLengthMax+10)
+	r, err := ctl.Encrypt(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+
+	is, err := ss.Decrypt(bytes.NewReader(b), len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(is, data) {
+		t.Fatal("invalid data")
+	}
+
+	// message too long
+	ss, _ = testSessions(t)
+	if _, err := ss.Decrypt(bytes.NewReader(b), len(data)-1); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// packet too long
+	var packet [2]byte
+	binary.LittleEndian.PutUint16(packet[:], packetLengthMax+1)
+	if _, err := ss.Decrypt(bytes.NewReader(packet[:]), len(data)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	ss, _ := testSessions(t)
+	c := newConn(c1)
+	c.receiveTimeout = 50 * time.Millisecond
+	c.Upgrade(ss)
+
+	// The controller sends the beginning of a packet.
+	go c2.Write([]byte{0x10, 0x00, 0x01})
+
+	if _, err := c.Read(make([]byte, 10)); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The connection is closed.
+	if _, err := c2.Write([]byte{0x00}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestIdleConnection(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	ss, ctl := testSessions(t)
+	c := newConn(c1)
+	c.receiveTimeout = 50 * time.Millisecond
+	c.Upgrade(ss)
+
+	// Read deadlines while waiting for a message don't close the connection.
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := c.Read(make([]byte, 10)); err == nil {
+		t.Fatal("expected error")
+	}
+	c.SetReadDeadline(time.Time{})
+
+	r, _ := ctl.Encrypt(bytes.NewReader([]byte("hello")))
+	b, _ := ioutil.ReadAll(r)
+	go c2.Write(b)
+
+	buf := make([]byte, 10)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(buf[:n]), "hello"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxRequestSize = 100
+
+	for _, path := range []string{"/pair-setup", "/characteristics"} {
+		method := http.MethodPost
+		if path == "/characteristics" {
+			method = http.MethodPut
+		}
+
+		req := httptest.NewRequest(method, path, bytes.NewReader(make([]byte, 101)))
+		w := httptest.NewRecorder()
+		s.ss.Handler.ServeHTTP(w, req)
+
+		if is, want := w.Code, http.StatusRequestEntityTooLarge; is != want {
+			t.Fatalf("%s: %v != %v", path, is, want)
+		}
+	}
+}
@@ -5,11 +5,12 @@ import (
 )
 
 type listener struct {
-	*net.TCPListener
+	net.Listener
+	m *metrics
 }
 
 func (ln *listener) Accept() (con net.Conn, err error) {
-	con, err = ln.AcceptTCP()
+	con, err = ln.Listener.Accept()
 	if err != nil {
 		return
 	}
@@ -19,16 +20,16 @@ func (ln *listener) Accept() (con net.Conn, err error) {
 		tcpconn.SetKeepAlive(false)
 	}
 
-	conn := newConn(con)
-	setConn(conn.RemoteAddr().String(), conn)
+	c := newConn(con)
+	c.metrics = ln.m
 
-	return conn, err
+	return c, err
 }
 
 func (ln *listener) Close() error {
-	return ln.TCPListener.Close()
+	return ln.Listener.Close()
 }
 
 func (ln *listener) Addr() net.Addr {
-	return ln.TCPListener.Addr()
+	return ln.Listener.Addr()
 }
@@ -1,9 +1,12 @@
 package log
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"sync"
 )
 
 var (
@@ -31,3 +34,160 @@ func (l *Logger) Disable() {
 func (l *Logger) Enable() {
 	l.SetOutput(os.Stdout)
 }
+
+// Print logs the message like fmt.Print.
+func (l *Logger) Print(v ...interface{}) {
+	l.output(nil, nil, fmt.Sprint(v...))
+}
+
+// Printf logs the message like fmt.Printf.
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.output(nil, nil, fmt.Sprintf(format, v...))
+}
+
+// Println logs the message like fmt.Println.
+func (l *Logger) Println(v ...interface{}) {
+	l.output(nil, nil, fmt.Sprintln(v...))
+}
+
+// With returns an entry which attaches fields to every message.
+func (l *Logger) With(fields ...Field) *Entry {
+	return &Entry{l: l, fields: fields}
+}
+
+// enabled returns false if the messages are written to /dev/null.
+func (l *Logger) enabled() bool {
+	return l.Writer() != ioutil.Discard
+}
+
+// level returns the level of the messages of l.
+func (l *Logger) level() Level {
+	if strings.TrimSpace(l.Prefix()) == "DEBUG" {
+		return LevelDebug
+	}
+
+	return LevelInfo
+}
+
+func (l *Logger) output(h Handler, fields []Field, msg string) {
+	if !l.enabled() {
+		return
+	}
+
+	if h == nil {
+		h = handler()
+	}
+
+	if h != nil {
+		h.Handle(l.level(), strings.TrimSuffix(msg, "\n"), fields)
+		return
+	}
+
+	if len(fields) > 0 {
+		var b strings.Builder
+		b.WriteString(strings.TrimSuffix(msg, "\n"))
+		for _, f := range fields {
+			fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+		}
+		msg = b.String()
+	}
+
+	// Report the caller of Print, Printf or Println.
+	l.Logger.Output(3, msg)
+}
+
+// Level is the level of a log message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// Field is a key-value pair attached to log messages.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field with key and value.
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// A Handler handles log messages, e.g. to send them to journald or
+// to a log aggregator. A handler must be safe for concurrent use.
+// Messages of a disabled logger are not sent to the handler.
+type Handler interface {
+	Handle(level Level, msg string, fields []Field)
+}
+
+var (
+	h  Handler
+	mu sync.RWMutex
+)
+
+// SetHandler makes Debug and Info send messages to h instead
+// of writing them as text lines. If h is nil, the messages
+// are written as text lines again.
+func SetHandler(handler Handler) {
+	mu.Lock()
+	h = handler
+	mu.Unlock()
+}
+
+func handler() Handler {
+	mu.RLock()
+	defer mu.RUnlock()
+	return h
+}
+
+// An Entry logs messages with fields.
+type Entry struct {
+	l       *Logger
+	handler Handler
+	fields  []Field
+}
+
+// With returns an entry with additional fields.
+func (e *Entry) With(fields ...Field) *Entry {
+	return &Entry{
+		l:       e.l,
+		handler: e.handler,
+		fields:  append(e.fields[:len(e.fields):len(e.fields)], fields...),
+	}
+}
+
+// WithHandler returns an entry which sends messages to h.
+// If h is nil, the handler set with SetHandler is used.
+func (e *Entry) WithHandler(h Handler) *Entry {
+	ne := e.With()
+	ne.handler = h
+	return ne
+}
+
+// Print logs the message like fmt.Print.
+func (e *Entry) Print(v ...interface{}) {
+	e.l.output(e.handler, e.fields, fmt.Sprint(v...))
+}
+
+// Printf logs the message like fmt.Printf.
+func (e *Entry) Printf(format string, v ...interface{}) {
+	e.l.output(e.handler, e.fields, fmt.Sprintf(format, v...))
+}
+
+// Println logs the message like fmt.Println.
+func (e *Entry) Println(v ...interface{}) {
+	e.l.output(e.handler, e.fields, fmt.Sprintln(v...))
+}
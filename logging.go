@@ -0,0 +1,31 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"net/http"
+)
+
+// logInfo returns an info log entry with the remote address
+// and the pairing of the controller which sent req.
+// If req is nil, the entry has no fields.
+func (s *Server) logInfo(req *http.Request) *log.Entry {
+	return s.logEntry(log.Info, req)
+}
+
+// logDebug returns a debug log entry like logInfo.
+func (s *Server) logDebug(req *http.Request) *log.Entry {
+	return s.logEntry(log.Debug, req)
+}
+
+func (s *Server) logEntry(l *log.Logger, req *http.Request) *log.Entry {
+	var fields []log.Field
+	if req != nil {
+		fields = append(fields, log.F("addr", req.RemoteAddr))
+		if p, ok := ContextPairing(req.Context()); ok {
+			fields = append(fields, log.F("pairing", p.Name))
+		}
+	}
+
+	return l.With(fields...).WithHandler(s.LogHandler)
+}
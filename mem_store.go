@@ -3,36 +3,55 @@ package hap
 import (
 	"fmt"
 	"strings"
+	"sync"
 )
 
-type memStore map[string][]byte
+// MemStore is a Store which keeps all key-value pairs in memory.
+// It is safe for concurrent use.
+type MemStore struct {
+	kv map[string][]byte
+	mu sync.RWMutex
+}
 
-func NewMemStore() Store {
-	return memStore{}
+// NewMemStore returns an empty in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		kv: map[string][]byte{},
+	}
 }
 
-func (fs memStore) Set(key string, value []byte) error {
-	fs[key] = value
+func (ms *MemStore) Set(key string, value []byte) error {
+	ms.mu.Lock()
+	ms.kv[key] = clone(value)
+	ms.mu.Unlock()
 
 	return nil
 }
 
-func (fs memStore) Get(key string) ([]byte, error) {
-	if v, ok := fs[key]; ok {
-		return v, nil
+func (ms *MemStore) Get(key string) ([]byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if v, ok := ms.kv[key]; ok {
+		return clone(v), nil
 	}
 
 	return nil, fmt.Errorf("no entry for key %s", key)
 }
 
-func (fs memStore) Delete(key string) error {
-	delete(fs, key)
+func (ms *MemStore) Delete(key string) error {
+	ms.mu.Lock()
+	delete(ms.kv, key)
+	ms.mu.Unlock()
 
 	return nil
 }
 
-func (fs memStore) KeysWithSuffix(s string) (keys []string, err error) {
-	for k, _ := range fs {
+func (ms *MemStore) KeysWithSuffix(s string) (keys []string, err error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	for k := range ms.kv {
 		if strings.HasSuffix(k, s) {
 			keys = append(keys, k)
 		}
@@ -40,3 +59,38 @@ func (fs memStore) KeysWithSuffix(s string) (keys []string, err error) {
 
 	return
 }
+
+// Snapshot returns a copy of all key-value pairs.
+func (ms *MemStore) Snapshot() map[string][]byte {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	m := make(map[string][]byte, len(ms.kv))
+	for k, v := range ms.kv {
+		m[k] = clone(v)
+	}
+
+	return m
+}
+
+// Export writes all key-value pairs to dst.
+// This lets you persist an ephemeral accessory later on.
+func (ms *MemStore) Export(dst Store) error {
+	for k, v := range ms.Snapshot() {
+		if err := dst.Set(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
@@ -0,0 +1,319 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+	"github.com/go-chi/chi/middleware"
+
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// LatencyBuckets are the upper bounds (in seconds) of the latency histograms.
+	LatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// SizeBuckets are the upper bounds (in bytes) of the payload size histograms.
+	SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+)
+
+// Histogram is a snapshot of a histogram.
+type Histogram struct {
+	// Bounds are the upper bounds of the buckets.
+	Bounds []float64
+	// Counts are the number of observations per bucket.
+	// The last element counts the observations greater than
+	// the largest bound. Counts are not cumulative.
+	Counts []uint64
+	// Count is the total number of observations.
+	Count uint64
+	// Sum is the sum of all observed values.
+	Sum float64
+}
+
+// Mean returns the mean of all observed values.
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+
+	return h.Sum / float64(h.Count)
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+	mu     sync.Mutex
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+func (h *histogram) snapshot() Histogram {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+
+	return Histogram{
+		Bounds: h.bounds,
+		Counts: counts,
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+}
+
+// EndpointMetrics contains the metrics of an http endpoint.
+type EndpointMetrics struct {
+	// Latency is the time (in seconds) it takes to handle a request.
+	Latency Histogram
+	// RequestSize is the size of the (decrypted) request body in bytes.
+	RequestSize Histogram
+	// ResponseSize is the size of the (unencrypted) response body in bytes.
+	ResponseSize Histogram
+}
+
+type endpointMetrics struct {
+	latency  *histogram
+	reqSize  *histogram
+	respSize *histogram
+}
+
+func newEndpointMetrics() *endpointMetrics {
+	return &endpointMetrics{
+		latency:  newHistogram(LatencyBuckets),
+		reqSize:  newHistogram(SizeBuckets),
+		respSize: newHistogram(SizeBuckets),
+	}
+}
+
+type metrics struct {
+	endpoints map[string]*endpointMetrics
+	mu        sync.Mutex
+
+	reads  *histogram // latency of characteristic reads
+	writes *histogram // latency of characteristic writes
+
+	// counters are updated atomically
+	pairSetups        uint64
+	pairSetupFailures uint64
+	events            uint64
+	droppedEvents     uint64
+	decryptFailures   uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		endpoints: map[string]*endpointMetrics{},
+		reads:     newHistogram(LatencyBuckets),
+		writes:    newHistogram(LatencyBuckets),
+	}
+}
+
+func (m *metrics) inc(counter *uint64) {
+	atomic.AddUint64(counter, 1)
+}
+
+func (m *metrics) endpoint(pattern string) *endpointMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	em, ok := m.endpoints[pattern]
+	if !ok {
+		em = newEndpointMetrics()
+		m.endpoints[pattern] = em
+	}
+
+	return em
+}
+
+// handler returns an http handler which records the latency
+// and the payload sizes of every request to pattern.
+func (m *metrics) handler(pattern string, next http.Handler) http.Handler {
+	em := m.endpoint(pattern)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		body := &countingReader{r: req.Body}
+		req.Body = body
+		ww := middleware.NewWrapResponseWriter(res, req.ProtoMajor)
+
+		next.ServeHTTP(ww, req)
+
+		em.latency.observe(time.Since(start).Seconds())
+		em.reqSize.observe(float64(body.n))
+		em.respSize.observe(float64(ww.BytesWritten()))
+	})
+}
+
+// EndpointMetrics returns the metrics of the http endpoints
+// by route pattern (e.g. "/characteristics").
+func (s *Server) EndpointMetrics() map[string]EndpointMetrics {
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+
+	res := map[string]EndpointMetrics{}
+	for pattern, em := range s.metrics.endpoints {
+		res[pattern] = EndpointMetrics{
+			Latency:      em.latency.snapshot(),
+			RequestSize:  em.reqSize.snapshot(),
+			ResponseSize: em.respSize.snapshot(),
+		}
+	}
+
+	return res
+}
+
+// Metrics is a snapshot of the metrics of a server.
+type Metrics struct {
+	// Sessions is the number of active encrypted sessions.
+	Sessions int
+	// PairSetups is the number of started pair-setups.
+	PairSetups uint64
+	// PairSetupFailures is the number of pair-setups with an invalid pincode.
+	PairSetupFailures uint64
+	// Events is the number of sent event notifications.
+	Events uint64
+	// DroppedEvents is the number of event notifications, which were
+	// dropped because the controller didn't read the previous ones.
+	DroppedEvents uint64
+	// DecryptFailures is the number of messages which could not be decrypted.
+	DecryptFailures uint64
+	// Reads is the time (in seconds) it takes to read a characteristic value.
+	Reads Histogram
+	// Writes is the time (in seconds) it takes to write a characteristic value.
+	Writes Histogram
+	// Endpoints are the metrics of the http endpoints (see EndpointMetrics).
+	Endpoints map[string]EndpointMetrics
+}
+
+// Metrics returns a snapshot of the metrics.
+func (s *Server) Metrics() Metrics {
+	var n int
+	for _, v := range s.sessions() {
+		if _, ok := v.(*session); ok {
+			n++
+		}
+	}
+
+	return Metrics{
+		Sessions:          n,
+		PairSetups:        atomic.LoadUint64(&s.metrics.pairSetups),
+		PairSetupFailures: atomic.LoadUint64(&s.metrics.pairSetupFailures),
+		Events:            atomic.LoadUint64(&s.metrics.events),
+		DroppedEvents:     atomic.LoadUint64(&s.metrics.droppedEvents),
+		DecryptFailures:   atomic.LoadUint64(&s.metrics.decryptFailures),
+		Reads:             s.metrics.reads.snapshot(),
+		Writes:            s.metrics.writes.snapshot(),
+		Endpoints:         s.EndpointMetrics(),
+	}
+}
+
+// MetricsHandler returns an http handler which responds
+// with the metrics in the Prometheus text format.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(res, s.Metrics())
+	})
+}
+
+func writeMetrics(w io.Writer, m Metrics) {
+	fmt.Fprintf(w, "# TYPE hap_sessions gauge\nhap_sessions %d\n", m.Sessions)
+	fmt.Fprintf(w, "# TYPE hap_pair_setups_total counter\nhap_pair_setups_total %d\n", m.PairSetups)
+	fmt.Fprintf(w, "# TYPE hap_pair_setup_failures_total counter\nhap_pair_setup_failures_total %d\n", m.PairSetupFailures)
+	fmt.Fprintf(w, "# TYPE hap_events_total counter\nhap_events_total %d\n", m.Events)
+	fmt.Fprintf(w, "# TYPE hap_events_dropped_total counter\nhap_events_dropped_total %d\n", m.DroppedEvents)
+	fmt.Fprintf(w, "# TYPE hap_decrypt_failures_total counter\nhap_decrypt_failures_total %d\n", m.DecryptFailures)
+
+	fmt.Fprintf(w, "# TYPE hap_characteristic_read_seconds histogram\n")
+	writeHistogram(w, "hap_characteristic_read_seconds", "", m.Reads)
+	fmt.Fprintf(w, "# TYPE hap_characteristic_write_seconds histogram\n")
+	writeHistogram(w, "hap_characteristic_write_seconds", "", m.Writes)
+
+	var patterns []string
+	for p := range m.Endpoints {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	fmt.Fprintf(w, "# TYPE hap_http_request_duration_seconds histogram\n")
+	for _, p := range patterns {
+		writeHistogram(w, "hap_http_request_duration_seconds", fmt.Sprintf("endpoint=%q", p), m.Endpoints[p].Latency)
+	}
+}
+
+// writeHistogram writes h with cumulative buckets.
+func writeHistogram(w io.Writer, name, labels string, h Histogram) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+
+	var n uint64
+	for i, b := range h.Bounds {
+		n += h.Counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, b, n)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.Count)
+
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, h.Sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.Count)
+}
+
+// serveMetrics serves the metrics at addr until ctx is done.
+func (s *Server) serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.MetricsHandler())
+	ss := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		ss.Close()
+	}()
+
+	if err := ss.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info.Println("metrics:", err)
+	}
+}
+
+// countingReader counts the number of bytes read.
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.r.Close()
+}
@@ -0,0 +1,55 @@
+package hap
+
+import (
+	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/hkdf"
+	"github.com/brutella/hap/tlv8"
+)
+
+// An Authenticator signs challenges during pair-setup with an MFi
+// certificate. Implementations typically talk to an Apple
+// authentication coprocessor via i2c or use a software token.
+type Authenticator interface {
+	// Sign returns the MFi certificate and the signature of the challenge.
+	Sign(challenge []byte) (cert, sig []byte, err error)
+}
+
+type pairSetupMFiPayload struct {
+	Certificate []byte `tlv8:"9"`
+	Signature   []byte `tlv8:"10"`
+}
+
+type pairSetupM4MFiPayload struct {
+	Proof         []byte `tlv8:"4"`
+	EncryptedData []byte `tlv8:"5"`
+	State         byte   `tlv8:"6"`
+}
+
+// mfiEncryptedData returns the encrypted certificate and signature
+// of the MFi challenge, which is derived from the srp shared secret.
+func mfiEncryptedData(a Authenticator, ses *pairSetupSession) ([]byte, error) {
+	challenge, err := hkdf.Sha512(ses.PrivateKey, []byte("MFi-Pair-Setup-Salt"), []byte("MFi-Pair-Setup-Info"))
+	if err != nil {
+		return nil, err
+	}
+
+	cert, sig, err := a.Sign(challenge[:])
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := tlv8.Marshal(pairSetupMFiPayload{
+		Certificate: cert,
+		Signature:   sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, mac, err := chacha20poly1305.EncryptAndSeal(ses.EncryptionKey[:], []byte("PS-Msg04"), b, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(encrypted, mac[:]...), nil
+}
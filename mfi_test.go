@@ -0,0 +1,58 @@
+package hap
+
+import (
+	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/hkdf"
+	"github.com/brutella/hap/tlv8"
+
+	"bytes"
+	"testing"
+)
+
+type testAuthenticator struct {
+	challenge []byte
+}
+
+func (a *testAuthenticator) Sign(challenge []byte) (cert, sig []byte, err error) {
+	a.challenge = challenge
+	return []byte("cert"), []byte("sig"), nil
+}
+
+func TestMFiEncryptedData(t *testing.T) {
+	ses := &pairSetupSession{PrivateKey: []byte("secret")}
+	if err := ses.SetupEncryptionKey([]byte("Pair-Setup-Encrypt-Salt"), []byte("Pair-Setup-Encrypt-Info")); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &testAuthenticator{}
+	b, err := mfiEncryptedData(a, ses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, _ := hkdf.Sha512(ses.PrivateKey, []byte("MFi-Pair-Setup-Salt"), []byte("MFi-Pair-Setup-Info"))
+	if is, want := a.challenge, challenge[:]; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	msg := b[:len(b)-16]
+	var mac [16]byte
+	copy(mac[:], b[len(msg):])
+	decrypted, err := chacha20poly1305.DecryptAndVerify(ses.EncryptionKey[:], []byte("PS-Msg04"), msg, mac, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data pairSetupMFiPayload
+	if err := tlv8.Unmarshal(decrypted, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(data.Certificate), "cert"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := string(data.Signature), "sig"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
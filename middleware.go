@@ -0,0 +1,39 @@
+package hap
+
+import (
+	"net/http"
+)
+
+// A Middleware wraps an http handler.
+type Middleware func(http.Handler) http.Handler
+
+// Use appends middlewares which wrap the handlers of the
+// HomeKit Accessory Protocol routes (/pair-setup, /accessories, …).
+// The first middleware is the outermost one.
+// Use can be called at any time, also while the server is running.
+//
+// Middlewares see the decrypted requests and can use IsAuthorized
+// to check if a request comes from a paired controller.
+// Custom routes are registered with ServeMux and are not wrapped.
+func (s *Server) Use(mws ...Middleware) {
+	s.mux.Lock()
+	s.mws = append(s.mws[:len(s.mws):len(s.mws)], mws...)
+	s.mux.Unlock()
+}
+
+// middlewares returns a handler which calls h wrapped
+// by the middlewares registered with Use.
+func (s *Server) middlewares(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		s.mux.Lock()
+		mws := s.mws
+		s.mux.Unlock()
+
+		next := h
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
@@ -0,0 +1,50 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				calls = append(calls, name+" "+req.URL.Path)
+				next.ServeHTTP(res, req)
+			})
+		}
+	}
+	s.Use(mw("1"), mw("2"))
+
+	s.ServeMux().HandleFunc("/status", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("ok"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/accessories", nil)
+	w := httptest.NewRecorder()
+	s.ss.Handler.ServeHTTP(w, req)
+
+	req = httptest.NewRequest(http.MethodGet, "/status", nil)
+	w = httptest.NewRecorder()
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Body.String(), "ok"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := strings.Join(calls, ","), "1 /accessories,2 /accessories"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
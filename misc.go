@@ -12,26 +12,82 @@ import (
 	"strings"
 )
 
+// configHash returns a hash of the attribute database of the accessories as.
+// The values of the characteristics are not part of the hash and are not
+// read, which makes sure that value getters are not called. The firmware and
+// hardware revisions are the exception, because the configuration number
+// must be incremented when they change.
 func configHash(as []*accessory.A) []byte {
-	data := struct {
-		As []*accessory.A `json:"accessories"`
-	}{
-		As: as,
+	type char struct {
+		Id          uint64      `json:"iid"`
+		Type        string      `json:"type"`
+		Permissions []string    `json:"perms"`
+		Format      string      `json:"format"`
+		Description string      `json:"description,omitempty"`
+		Unit        string      `json:"unit,omitempty"`
+		MaxLen      int         `json:"maxLen,omitempty"`
+		MaxValue    interface{} `json:"maxValue,omitempty"`
+		MinValue    interface{} `json:"minValue,omitempty"`
+		StepValue   interface{} `json:"minStep,omitempty"`
+		ValidValues []int       `json:"valid-values,omitempty"`
+		ValidRange  []int       `json:"valid-values-range,omitempty"`
+		Value       interface{} `json:"value,omitempty"`
 	}
 
-	b, err := json.Marshal(data)
-	if err != nil {
-		log.Info.Panic(err)
+	type svc struct {
+		Id      uint64   `json:"iid"`
+		Type    string   `json:"type"`
+		Cs      []char   `json:"characteristics"`
+		Hidden  bool     `json:"hidden,omitempty"`
+		Primary bool     `json:"primary,omitempty"`
+		Linked  []uint64 `json:"linked,omitempty"`
 	}
 
-	val := map[string]interface{}{}
-	if err := json.Unmarshal(b, &val); err != nil {
-		log.Info.Panic(err)
+	type acc struct {
+		Id uint64 `json:"aid"`
+		Ss []svc  `json:"services"`
 	}
 
-	deleteFieldFromDict(&val, "value")
+	data := struct {
+		As []acc `json:"accessories"`
+	}{}
+
+	for _, a := range as {
+		da := acc{Id: a.Id}
+		for _, s := range a.Ss {
+			ds := svc{Id: s.Id, Type: s.Type, Hidden: s.Hidden, Primary: s.Primary}
+			for _, l := range s.Linked {
+				ds.Linked = append(ds.Linked, l.Id)
+			}
+
+			for _, c := range s.Cs {
+				var v interface{}
+				if isRevision(c) {
+					v = c.Value()
+				}
+				ds.Cs = append(ds.Cs, char{
+					Id:          c.Id,
+					Type:        c.Type,
+					Permissions: c.Permissions,
+					Format:      c.Format,
+					Description: c.Description,
+					Unit:        c.Unit,
+					MaxLen:      c.MaxLen,
+					MaxValue:    c.MaxVal,
+					MinValue:    c.MinVal,
+					StepValue:   c.StepVal,
+					ValidValues: c.ValidVals,
+					ValidRange:  c.ValidRange,
+					Value:       v,
+				})
+			}
+			da.Ss = append(da.Ss, ds)
+		}
+		data.As = append(data.As, da)
+	}
 
-	if b, err = json.Marshal(val); err != nil {
+	b, err := json.Marshal(data)
+	if err != nil {
 		log.Info.Panic(err)
 	}
 
@@ -40,34 +96,6 @@ func configHash(as []*accessory.A) []byte {
 	return h.Sum(nil)
 }
 
-func deleteFieldFromDict(val *map[string]interface{}, field string) {
-	for k, v := range *val {
-		if k == field {
-			delete(*val, k)
-		} else {
-			deleteFieldFromInterface(&v, field)
-		}
-	}
-}
-
-func deleteFieldFromArray(val *[]interface{}, field string) {
-	for _, v := range *val {
-		deleteFieldFromInterface(&v, field)
-	}
-}
-
-func deleteFieldFromInterface(val *interface{}, field string) {
-	v := *val
-
-	if dict, ok := v.(map[string]interface{}); ok == true {
-		deleteFieldFromDict(&dict, field)
-	}
-
-	if array, ok := v.([]interface{}); ok == true {
-		deleteFieldFromArray(&array, field)
-	}
-}
-
 // generateKeyPair generates random public and private key pair
 func generateKeyPair() (KeyPair, error) {
 	str := randHex()
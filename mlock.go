@@ -0,0 +1,16 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+)
+
+// lockKeyPair locks the memory of the key pair kp.
+// Failures are logged because the server works without.
+func (s *Server) lockKeyPair(kp KeyPair) {
+	if err := mlock(kp.Private); err != nil {
+		log.Info.Println("locking private key failed:", err)
+		return
+	}
+
+	log.Debug.Println("private key locked in memory")
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package hap
+
+import (
+	"errors"
+)
+
+// mlock is not supported on this platform.
+func mlock(b []byte) error {
+	return errors.New("mlock not supported")
+}
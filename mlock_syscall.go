@@ -0,0 +1,17 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package hap
+
+import (
+	"syscall"
+)
+
+// mlock locks the pages containing b in memory.
+func mlock(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	return syscall.Mlock(b)
+}
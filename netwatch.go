@@ -0,0 +1,120 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultInterfaceWatchInterval is the default interval
+// in which the network interfaces are checked for changes.
+const defaultInterfaceWatchInterval = 5 * time.Second
+
+func (s *Server) interfaceWatchInterval() time.Duration {
+	if s.InterfaceWatchInterval == 0 {
+		return defaultInterfaceWatchInterval
+	}
+
+	return s.InterfaceWatchInterval
+}
+
+// watchInterfaces announces the service again when an interface
+// goes up or down or its addresses change (e.g. after a DHCP renew
+// or Wi-Fi roam), until ctx is done.
+func (s *Server) watchInterfaces(ctx context.Context) {
+	interval := s.interfaceWatchInterval()
+	if interval < 0 {
+		return
+	}
+
+	state := s.interfaceState
+	if state == nil {
+		state = func() string {
+			return interfaceState(s.Ifaces)
+		}
+	}
+
+	last := state()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			current := state()
+			if current == last {
+				continue
+			}
+			last = current
+
+			s.advertisementEvent(AdvertisementEvent{State: AdvertisementInterfacesChanged, Name: s.AdvertisedName()})
+			s.reannounce()
+		}
+	}
+}
+
+// interfaceState returns a description of the interfaces with the
+// names (or the multicast interfaces) including their addresses.
+func interfaceState(names []string) string {
+	var b strings.Builder
+	for _, ifi := range interfaces(names) {
+		fmt.Fprintf(&b, "%s/%d/%v:", ifi.Name, ifi.Index, ifi.Flags&net.FlagUp != 0)
+
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			log.Debug.Println(err)
+		}
+
+		var as []string
+		for _, a := range addrs {
+			as = append(as, a.String())
+		}
+		sort.Strings(as)
+		b.WriteString(strings.Join(as, ","))
+		b.WriteString(";")
+	}
+
+	return b.String()
+}
+
+// reannounce withdraws the service and announces it
+// again with the current interfaces and addresses.
+func (s *Server) reannounce() error {
+	s.dmux.Lock()
+	defer s.dmux.Unlock()
+
+	s.mux.Lock()
+	advertising := s.advertising
+	s.mux.Unlock()
+
+	if !advertising {
+		return nil
+	}
+
+	return s.announce(s.service())
+}
+
+// announce announces the service again. dmux must be locked.
+// Errors are also reported as advertisement events.
+func (s *Server) announce(service DNSSDService) error {
+	resp := s.responder()
+	if err := resp.Withdraw(); err != nil {
+		return s.advertisementFailed(err)
+	}
+
+	if err := resp.Announce(service); err != nil {
+		return s.advertisementFailed(err)
+	}
+
+	s.announced = service
+	s.advertisementEvent(AdvertisementEvent{State: AdvertisementAnnounced, Name: service.Name})
+
+	return nil
+}
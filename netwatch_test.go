@@ -0,0 +1,101 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchInterfaces(t *testing.T) {
+	r := &testResponder{}
+	a := accessory.New(accessory.Info{Name: "Outlet"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), WithAddr("127.0.0.1:0"), WithResponder(r), WithInterfaceWatchInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	state := "eth0/1/true:192.168.0.2/24;"
+	s.interfaceState = func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return state
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ListenAndServe(ctx)
+	waitRunning(t, s)
+
+	r.mu.Lock()
+	r.announced, r.withdrawn = nil, false
+	r.mu.Unlock()
+
+	mu.Lock()
+	state = "eth0/1/true:192.168.0.3/24;"
+	mu.Unlock()
+
+	for i := 0; i < 100; i++ {
+		r.mu.Lock()
+		announced, withdrawn := r.announced, r.withdrawn
+		r.mu.Unlock()
+
+		if announced != nil {
+			if !withdrawn {
+				t.Fatal("service not withdrawn before announcing")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("service not announced again")
+}
+
+// TestReannounceDuringShutdown must be run with -race.
+func TestReannounceDuringShutdown(t *testing.T) {
+	r := &testResponder{}
+	a := accessory.New(accessory.Info{Name: "Outlet"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), WithAddr("127.0.0.1:0"), WithResponder(r), WithInterfaceWatchInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The interfaces change on every check.
+	var n int64
+	s.interfaceState = func() string {
+		return fmt.Sprint(atomic.AddInt64(&n, 1))
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ListenAndServe(context.Background())
+	}()
+	waitRunning(t, s)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			s.reannounce()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("server still running")
+	}
+}
@@ -0,0 +1,93 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	setupFlagIP = 1 << 28 // accessory supports HAP over IP
+)
+
+// SetupURI returns the setup payload of the accessory ("X-HM://…").
+// The payload is encoded in QR codes and NFC tags and contains the
+// setup code, the category of the accessory and the setup id.
+func (s *Server) SetupURI() (string, error) {
+	code, err := strconv.ParseUint(s.Pin, 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid pin %s: %v", s.Pin, err)
+	}
+
+	if len(s.SetupId) != 4 {
+		return "", fmt.Errorf("invalid setup id %s", s.SetupId)
+	}
+
+	v := code | setupFlagIP | uint64(s.a.Type)<<31
+	payload := strings.ToUpper(strconv.FormatUint(v, 36))
+	if n := len(payload); n < 9 {
+		payload = strings.Repeat("0", 9-n) + payload
+	}
+
+	return "X-HM://" + payload + s.SetupId, nil
+}
+
+// SetupNDEF returns the setup payload as NDEF message, which
+// contains a single URI record. The message can be written to
+// an NFC tag to allow tap-to-pair.
+func (s *Server) SetupNDEF() ([]byte, error) {
+	uri, err := s.SetupURI()
+	if err != nil {
+		return nil, err
+	}
+
+	return ndefURIRecord(uri), nil
+}
+
+// ndefURIRecord returns a short NDEF record of well-known type "U".
+func ndefURIRecord(uri string) []byte {
+	payload := append([]byte{0x00}, uri...) // 0x00 = no uri prefix abbreviation
+
+	var b []byte
+	b = append(b, 0xD1) // MB | ME | SR | TNF well-known
+	b = append(b, 0x01) // type length
+	b = append(b, byte(len(payload)))
+	b = append(b, 'U')
+	b = append(b, payload...)
+
+	return b
+}
+
+// updateNFC calls NFCFunc when the pairing state changed.
+func (s *Server) updateNFC() {
+	if s.NFCFunc == nil {
+		return
+	}
+
+	paired := s.IsPaired()
+
+	s.mux.Lock()
+	changed := s.nfcPaired == nil || *s.nfcPaired != paired
+	s.nfcPaired = &paired
+	s.mux.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if paired {
+		// The setup payload must not be shown once paired.
+		s.NFCFunc(nil)
+		return
+	}
+
+	b, err := s.SetupNDEF()
+	if err != nil {
+		log.Info.Println("nfc:", err)
+		return
+	}
+
+	s.NFCFunc(b)
+}
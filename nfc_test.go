@@ -0,0 +1,44 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestSetupNDEF(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeLightbulb)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pin = "03145154"
+	s.SetupId = "ABCD"
+
+	uri, err := s.SetupURI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := uri, "X-HM://00522H1VMABCD"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	var ndef []byte
+	s.NFCFunc = func(b []byte) {
+		ndef = b
+	}
+	s.updateNFC()
+
+	want := append([]byte{0xD1, 0x01, byte(len(uri) + 1), 'U', 0x00}, uri...)
+	if !bytes.Equal(ndef, want) {
+		t.Fatalf("%v != %v", ndef, want)
+	}
+
+	s.savePairing(context.Background(), Pairing{Name: "ctrl", Permission: PermissionAdmin})
+	if ndef != nil {
+		t.Fatalf("%v != nil", ndef)
+	}
+}
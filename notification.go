@@ -12,7 +12,29 @@ import (
 	"strings"
 )
 
-func sendNotification(a *accessory.A, c *characteristic.C, req *http.Request) error {
+// OnCharacteristicEvent sets fn, which is called when the value of
+// any characteristic of the accessories changes – by a controller
+// or by the application. Use it to mirror the state of the accessories
+// to other systems (e.g. MQTT) without registering a callback for every
+// characteristic. fn is called synchronously and should not block.
+func (srv *Server) OnCharacteristicEvent(fn func(aid, iid uint64, value interface{})) {
+	srv.mux.Lock()
+	srv.eventFunc = fn
+	srv.mux.Unlock()
+}
+
+// characteristicEvent calls the function set with OnCharacteristicEvent.
+func (srv *Server) characteristicEvent(a *accessory.A, c *characteristic.C, v interface{}) {
+	srv.mux.Lock()
+	fn := srv.eventFunc
+	srv.mux.Unlock()
+
+	if fn != nil {
+		fn(a.Id, c.Id, v)
+	}
+}
+
+func (srv *Server) sendNotification(a *accessory.A, c *characteristic.C, req *http.Request) error {
 	pl := struct {
 		Cs []characteristicData `json:"characteristics"`
 	}{
@@ -53,8 +75,8 @@ func sendNotification(a *accessory.A, c *characteristic.C, req *http.Request) er
 	b, err := ioutil.ReadAll(buffer)
 	b = []byte(strings.Replace(string(b), "HTTP/1.0", "EVENT/1.0", 1))
 
-	for _, conn := range conns() {
-		if req != nil && req.RemoteAddr == conn.RemoteAddr().String() {
+	for nc, conn := range srv.conns() {
+		if req != nil && reqConn(req) == nc {
 			// Don't send notification to the client
 			// who updated the value.
 			log.Debug.Printf("skip notification for %s\n", conn.RemoteAddr())
@@ -64,9 +86,70 @@ func sendNotification(a *accessory.A, c *characteristic.C, req *http.Request) er
 		// Check which connection has events enabled.
 		if c.HasEventsEnabled(conn.RemoteAddr().String()) {
 			log.Debug.Printf("send event to %s:\n%s\n", conn.RemoteAddr(), string(b))
-			conn.Write(b)
+			if !conn.sendEvent(b) {
+				log.Debug.Printf("event queue of %s is full\n", conn.RemoteAddr())
+			}
 		}
 	}
 
 	return nil
 }
+
+// refresh notifies the subscribed clients about the current
+// values of all observable characteristics of an accessory.
+// Event only characteristics are skipped, because a notification
+// would be interpreted as a new event (e.g. a doorbell ring).
+func (srv *Server) refresh(a *accessory.A) {
+	for _, s := range a.Ss {
+		for _, c := range s.Cs {
+			if !c.IsObservable() || c.IsEventOnly() || c.Type == characteristic.TypeIdentify {
+				continue
+			}
+
+			if err := srv.sendNotification(a, c, nil); err != nil {
+				log.Info.Println(err)
+			}
+		}
+	}
+}
+
+// hasSubscriptions returns true if the controller at addr
+// has events enabled for at least one characteristic.
+func (srv *Server) hasSubscriptions(addr string) bool {
+	for _, a := range srv.accessories() {
+		for _, s := range a.Ss {
+			for _, c := range s.Cs {
+				if c.HasEventsEnabled(addr) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// unsubscribeAll disables all events for the controller at addr.
+// It returns true if the controller had events enabled.
+func (srv *Server) unsubscribeAll(addr string) bool {
+	var had bool
+	for _, a := range srv.accessories() {
+		for _, s := range a.Ss {
+			for _, c := range s.Cs {
+				if c.HasEventsEnabled(addr) {
+					had = true
+				}
+				c.SetEvent(addr, false)
+			}
+		}
+	}
+
+	return had
+}
+
+func (srv *Server) unsubscribed(addr string, p Pairing) {
+	log.Debug.Printf("%s unsubscribed from all events\n", addr)
+	if srv.UnsubscribedFunc != nil {
+		srv.UnsubscribedFunc(addr, p)
+	}
+}
@@ -0,0 +1,361 @@
+package opack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+var errTerminator = errors.New("opack: unexpected terminator")
+
+type decoder struct {
+	r    *bytes.Reader
+	refs []interface{} // values which can be referenced
+}
+
+func newDecoder(b []byte) *decoder {
+	return &decoder{r: bytes.NewReader(b)}
+}
+
+func (d *decoder) decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+
+	value, err := d.value()
+	if err != nil {
+		return err
+	}
+
+	return assign(rv.Elem(), value)
+}
+
+// value returns the next value.
+func (d *decoder) value() (interface{}, error) {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tag == tagTrue:
+		return true, nil
+	case tag == tagFalse:
+		return false, nil
+	case tag == tagTerminator:
+		return nil, errTerminator
+	case tag == tagNull:
+		return nil, nil
+	case tag == tagUUID:
+		return d.track(d.read(16))
+	case tag == tagDate:
+		var f float64
+		if err := binary.Read(d.r, binary.LittleEndian, &f); err != nil {
+			return nil, err
+		}
+		sec, frac := math.Modf(f)
+		return d.track(referenceDate.Add(time.Duration(sec)*time.Second+time.Duration(frac*float64(time.Second))), nil)
+	case tag == tagIntMinusOne:
+		return int64(-1), nil
+	case tag >= tagIntStart && tag < tagInt8:
+		return int64(tag - tagIntStart), nil
+	case tag >= tagInt8 && tag <= tagInt64:
+		return d.track(d.readInt(1 << (tag - tagInt8)))
+	case tag == tagFloat32:
+		var f float32
+		err := binary.Read(d.r, binary.LittleEndian, &f)
+		return d.track(float64(f), err)
+	case tag == tagFloat64:
+		var f float64
+		err := binary.Read(d.r, binary.LittleEndian, &f)
+		return d.track(f, err)
+	case tag >= tagStringStart && tag <= tagString64:
+		n, err := d.readLength(tag, tagStringStart, tagString8)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(n)
+		return d.track(string(b), err)
+	case tag == tagStringNull:
+		var b []byte
+		for {
+			c, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if c == 0 {
+				break
+			}
+			b = append(b, c)
+		}
+		return d.track(string(b), nil)
+	case tag >= tagDataStart && tag <= tagData64:
+		n, err := d.readLength(tag, tagDataStart, tagData8)
+		if err != nil {
+			return nil, err
+		}
+		return d.track(d.read(n))
+	case tag >= tagRefStart && tag <= tagRefEnd:
+		i := int(tag - tagRefStart)
+		if i >= len(d.refs) {
+			return nil, fmt.Errorf("opack: invalid reference %d", i)
+		}
+		return d.refs[i], nil
+	case tag >= tagArrayStart && tag <= tagArrayTerm:
+		arr := []interface{}{}
+		for i := 0; tag == tagArrayTerm || i < int(tag-tagArrayStart); i++ {
+			v, err := d.value()
+			if err == errTerminator && tag == tagArrayTerm {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case tag >= tagDictStart && tag <= tagDictTerm:
+		m := map[string]interface{}{}
+		for i := 0; tag == tagDictTerm || i < int(tag-tagDictStart); i++ {
+			k, err := d.value()
+			if err == errTerminator && tag == tagDictTerm {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("opack: unsupported key %v", k)
+			}
+
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("opack: unknown tag %x", tag)
+}
+
+func (d *decoder) track(v interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	d.refs = append(d.refs, v)
+	return v, nil
+}
+
+func (d *decoder) read(n uint64) ([]byte, error) {
+	if n > uint64(d.r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	return b, err
+}
+
+func (d *decoder) readInt(size int) (int64, error) {
+	b, err := d.read(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return int64(int8(b[0])), nil
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	default:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	}
+}
+
+// readLength returns the length of a string or data with the tag.
+func (d *decoder) readLength(tag, inline, tag8 byte) (uint64, error) {
+	if tag < tag8 {
+		return uint64(tag - inline), nil
+	}
+
+	size := 1 << (tag - tag8)
+	b, err := d.read(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for i := size - 1; i >= 0; i-- {
+		n = n<<8 | uint64(b[i])
+	}
+
+	return n, nil
+}
+
+// assign stores the decoded value in dst.
+func assign(dst reflect.Value, value interface{}) error {
+	if value == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	src := reflect.ValueOf(value)
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(src)
+		return nil
+	}
+
+	if dst.Type() == timeType {
+		if t, ok := value.(time.Time); ok {
+			dst.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return &UnmarshalTypeError{value, dst.Type()}
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), value)
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := value.(int64)
+		if !ok || dst.OverflowInt(i) {
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := value.(int64)
+		if !ok || i < 0 || dst.OverflowUint(uint64(i)) {
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+		dst.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		switch f := value.(type) {
+		case float64:
+			dst.SetFloat(f)
+		case int64:
+			dst.SetFloat(float64(f))
+		default:
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+		dst.SetString(s)
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			b, ok := value.([]byte)
+			if !ok {
+				return &UnmarshalTypeError{value, dst.Type()}
+			}
+			dst.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+
+		arr, ok := value.([]interface{})
+		if !ok {
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+
+		s := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, v := range arr {
+			if err := assign(s.Index(i), v); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		for k, v := range m {
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(ev, v); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), ev)
+		}
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return &UnmarshalTypeError{value, dst.Type()}
+		}
+
+		t := dst.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+
+			name, _ := parseTag(f)
+			if name == "-" {
+				continue
+			}
+
+			if v, ok := m[name]; ok {
+				if err := assign(dst.Field(i), v); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return &UnmarshalTypeError{value, dst.Type()}
+	}
+
+	return nil
+}
+
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "opack: Unmarshal(nil)"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return "opack: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+
+	return "opack: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// An UnmarshalTypeError describes a value,
+// which cannot be stored in a Go type.
+type UnmarshalTypeError struct {
+	Value interface{}
+	Type  reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("opack: cannot unmarshal %T into %s", e.Value, e.Type)
+}
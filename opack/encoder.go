@@ -0,0 +1,298 @@
+package opack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OPACK tags
+const (
+	tagTrue          = 0x01
+	tagFalse         = 0x02
+	tagTerminator    = 0x03
+	tagNull          = 0x04
+	tagUUID          = 0x05
+	tagDate          = 0x06
+	tagIntMinusOne   = 0x07
+	tagIntStart      = 0x08 // 0x08–0x2F are the integers 0–39
+	tagInt8          = 0x30
+	tagInt16         = 0x31
+	tagInt32         = 0x32
+	tagInt64         = 0x33
+	tagFloat32       = 0x35
+	tagFloat64       = 0x36
+	tagStringStart   = 0x40 // 0x40–0x60 are strings with length 0–32
+	tagString8       = 0x61
+	tagString64      = 0x64
+	tagStringNull    = 0x6F
+	tagDataStart     = 0x70 // 0x70–0x90 are data with length 0–32
+	tagData8         = 0x91
+	tagData64        = 0x94
+	tagRefStart      = 0xA0 // 0xA0–0xCF reference previous values
+	tagRefEnd        = 0xCF
+	tagArrayStart    = 0xD0 // 0xD0–0xDE are arrays with 0–14 elements
+	tagArrayTerm     = 0xDF
+	tagDictStart     = 0xE0 // 0xE0–0xEE are dictionaries with 0–14 entries
+	tagDictTerm      = 0xEF
+	maxInlineInt     = 39
+	maxInlineLength  = 32
+	maxInlineEntries = 14
+)
+
+// referenceDate is the reference date of OPACK dates.
+var referenceDate = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type encoder struct {
+	buf bytes.Buffer
+	err error
+}
+
+func newEncoder() *encoder {
+	return &encoder{}
+}
+
+func (e *encoder) encode(v interface{}) {
+	e.err = e.write(reflect.ValueOf(v))
+}
+
+func (e *encoder) write(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(tagNull)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		e.buf.WriteByte(tagDate)
+		t := v.Interface().(time.Time)
+		return binary.Write(&e.buf, binary.LittleEndian, t.Sub(referenceDate).Seconds())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			e.buf.WriteByte(tagNull)
+			return nil
+		}
+		return e.write(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(tagTrue)
+		} else {
+			e.buf.WriteByte(tagFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.writeInt(int64(v.Uint()))
+	case reflect.Float32:
+		e.buf.WriteByte(tagFloat32)
+		binary.Write(&e.buf, binary.LittleEndian, float32(v.Float()))
+	case reflect.Float64:
+		e.buf.WriteByte(tagFloat64)
+		binary.Write(&e.buf, binary.LittleEndian, v.Float())
+	case reflect.String:
+		e.writeLength(tagStringStart, tagString8, len(v.String()))
+		e.buf.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.writeLength(tagDataStart, tagData8, len(b))
+			e.buf.Write(b)
+			return nil
+		}
+
+		vs := make([]reflect.Value, v.Len())
+		for i := range vs {
+			vs[i] = v.Index(i)
+		}
+		return e.writeArray(vs)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return &UnsupportedTypeError{v.Type()}
+		}
+
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		var entries []entry
+		for _, k := range keys {
+			entries = append(entries, entry{k.String(), v.MapIndex(k)})
+		}
+		return e.writeDict(entries)
+	case reflect.Struct:
+		return e.writeDict(structEntries(v))
+	default:
+		return &UnsupportedTypeError{v.Type()}
+	}
+
+	return nil
+}
+
+// entry is a key and value of a dictionary.
+type entry struct {
+	key   string
+	value reflect.Value
+}
+
+// structEntries returns the dictionary entries of the struct v.
+func structEntries(v reflect.Value) []entry {
+	var entries []entry
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name, omitEmpty := parseTag(f)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		entries = append(entries, entry{name, fv})
+	}
+
+	return entries
+}
+
+// parseTag returns the key of the struct field and
+// whether the field is omitted if empty.
+func parseTag(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("opack")
+	if !ok {
+		return f.Name, false
+	}
+
+	values := strings.Split(tag, ",")
+	name := values[0]
+	if name == "" {
+		name = f.Name
+	}
+
+	return name, len(values) > 1 && values[1] == "omitempty"
+}
+
+func (e *encoder) writeArray(vs []reflect.Value) error {
+	n := len(vs)
+	if n <= maxInlineEntries {
+		e.buf.WriteByte(byte(tagArrayStart + n))
+	} else {
+		e.buf.WriteByte(tagArrayTerm)
+	}
+
+	for _, v := range vs {
+		if err := e.write(v); err != nil {
+			return err
+		}
+	}
+
+	if n > maxInlineEntries {
+		e.buf.WriteByte(tagTerminator)
+	}
+
+	return nil
+}
+
+func (e *encoder) writeDict(entries []entry) error {
+	n := len(entries)
+	if n <= maxInlineEntries {
+		e.buf.WriteByte(byte(tagDictStart + n))
+	} else {
+		e.buf.WriteByte(tagDictTerm)
+	}
+
+	for _, en := range entries {
+		if err := e.write(reflect.ValueOf(en.key)); err != nil {
+			return err
+		}
+		if err := e.write(en.value); err != nil {
+			return err
+		}
+	}
+
+	if n > maxInlineEntries {
+		e.buf.WriteByte(tagTerminator)
+	}
+
+	return nil
+}
+
+func (e *encoder) writeInt(i int64) {
+	switch {
+	case i == -1:
+		e.buf.WriteByte(tagIntMinusOne)
+	case i >= 0 && i <= maxInlineInt:
+		e.buf.WriteByte(byte(tagIntStart + i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		e.buf.WriteByte(tagInt8)
+		e.buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		e.buf.WriteByte(tagInt16)
+		binary.Write(&e.buf, binary.LittleEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		e.buf.WriteByte(tagInt32)
+		binary.Write(&e.buf, binary.LittleEndian, int32(i))
+	default:
+		e.buf.WriteByte(tagInt64)
+		binary.Write(&e.buf, binary.LittleEndian, i)
+	}
+}
+
+// writeLength writes the tag of a string or data with length n.
+func (e *encoder) writeLength(inline, tag8 byte, n int) {
+	switch {
+	case n <= maxInlineLength:
+		e.buf.WriteByte(inline + byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(tag8)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(tag8 + 1)
+		binary.Write(&e.buf, binary.LittleEndian, uint16(n))
+	default:
+		e.buf.WriteByte(tag8 + 2)
+		binary.Write(&e.buf, binary.LittleEndian, uint32(n))
+	}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "opack: unsupported type " + e.Type.String()
+}
@@ -0,0 +1,14 @@
+package opack
+
+// Marshal returns the OPACK encoding of v.
+//
+// Structs are encoded as dictionaries. The key of a field is the name
+// in its opack tag (e.g. `opack:"streamId"`) or the field name.
+// Fields with the tag "-" are skipped, fields with the option
+// "omitempty" are skipped if empty. Maps must have string keys.
+// A time.Time is encoded as date.
+func Marshal(v interface{}) ([]byte, error) {
+	e := newEncoder()
+	e.encode(v)
+	return e.buf.Bytes(), e.err
+}
@@ -0,0 +1,78 @@
+package opack
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want []byte
+	}{
+		{true, []byte{0x01}},
+		{nil, []byte{0x04}},
+		{-1, []byte{0x07}},
+		{39, []byte{0x2F}},
+		{40, []byte{0x30, 0x28}},
+		{1000, []byte{0x31, 0xE8, 0x03}},
+		{"abc", []byte{0x43, 'a', 'b', 'c'}},
+		{[]byte{1, 2}, []byte{0x72, 1, 2}},
+		{[]interface{}{1, "a"}, []byte{0xD2, 0x09, 0x41, 'a'}},
+		{map[string]interface{}{"id": 1}, []byte{0xE1, 0x42, 'i', 'd', 0x09}},
+	}
+
+	for _, test := range tests {
+		b, err := Marshal(test.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := b, test.want; !bytes.Equal(is, want) {
+			t.Fatalf("%v: %X != %X", test.v, is, want)
+		}
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	v := map[string]interface{}{
+		"protocol": "control",
+		"id":       int64(123456789),
+		"negative": int64(-300),
+		"float":    1.5,
+		"data":     bytes.Repeat([]byte{0xAB}, 300),
+		"long":     strings.Repeat("x", 40),
+		"array":    []interface{}{true, false, nil, int64(0)},
+		"nested":   map[string]interface{}{},
+	}
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var d interface{}
+	if err := Unmarshal(b, &d); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(d, v) {
+		t.Fatalf("%v != %v", d, v)
+	}
+}
+
+func TestUnmarshalReference(t *testing.T) {
+	// ["abc", <reference to "abc">] in a terminated array
+	b := []byte{0xDF, 0x43, 'a', 'b', 'c', 0xA0, 0x03}
+
+	var v interface{}
+	if err := Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := v, []interface{}{"abc", "abc"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,25 @@
+package opack
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+func UnmarshalReader(r io.Reader, v interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return Unmarshal(b, v)
+}
+
+// Unmarshal decodes the OPACK encoded data and stores the result
+// in the value pointed to by v. If v points to an empty interface,
+// dictionaries are stored as map[string]interface{}, arrays as
+// []interface{}, integers as int64, floats as float64, data as []byte
+// and dates as time.Time.
+func Unmarshal(data []byte, v interface{}) error {
+	d := newDecoder(data)
+	return d.decode(v)
+}
@@ -0,0 +1,93 @@
+package opack
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type packet struct {
+	Data     []byte            `opack:"data"`
+	Metadata map[string]string `opack:"metadata,omitempty"`
+}
+
+type stream struct {
+	Id      int64     `opack:"streamId"`
+	End     bool      `opack:"endOfStream,omitempty"`
+	Packets []packet  `opack:"packets"`
+	Date    time.Time `opack:"date"`
+	Ignored string    `opack:"-"`
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	date := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := stream{
+		Id:      42,
+		Packets: []packet{{Data: []byte{1, 2, 3}, Metadata: map[string]string{"dataType": "mediaFragment"}}},
+		Date:    date,
+		Ignored: "x",
+	}
+
+	b, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v map[string]interface{}
+	if err := Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := v["endOfStream"]; ok {
+		t.Fatal("empty field not omitted")
+	}
+
+	if _, ok := v["Ignored"]; ok {
+		t.Fatal("ignored field encoded")
+	}
+
+	var is stream
+	if err := Unmarshal(b, &is); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := is.Id, int64(42); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(is.Packets), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := is.Packets[0].Data, []byte{1, 2, 3}; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := is.Packets[0].Metadata["dataType"], "mediaFragment"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := is.Date, date; !is.Equal(want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	var s string
+	if err := Unmarshal([]byte{0x09}, &s); err == nil {
+		t.Fatal("expected type error")
+	}
+
+	if err := Unmarshal([]byte{0x43, 'a'}, &s); err == nil {
+		t.Fatal("expected error for truncated string")
+	}
+
+	if err := Unmarshal([]byte{0x41, 'a'}, s); err == nil {
+		t.Fatal("expected error for non-pointer")
+	}
+
+	var i uint8
+	if err := Unmarshal([]byte{0x31, 0xE8, 0x03}, &i); err == nil {
+		t.Fatal("expected overflow error")
+	}
+}
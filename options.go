@@ -0,0 +1,379 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/audit"
+	"github.com/brutella/hap/log"
+
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// An Option configures a server created with New.
+type Option func(*options)
+
+type options struct {
+	store     Store
+	namespace string
+	bridged   []*accessory.A
+	ids       IDAllocator
+	log       log.Handler
+	fns       []func(*Server)
+}
+
+// serverOption returns an option which sets up the server with fn.
+func serverOption(fn func(*Server)) Option {
+	return func(o *options) {
+		o.fns = append(o.fns, fn)
+	}
+}
+
+// New returns a new server for the accessory a configured with opts.
+// A store must be provided with WithStore.
+//
+//	s, err := hap.New(a, hap.WithStore(st), hap.WithPin("12344321"))
+func New(a *accessory.A, opts ...Option) (*Server, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.store == nil {
+		return nil, errors.New("missing store")
+	}
+
+	st := o.store
+	if o.namespace != "" {
+		st = PrefixStore(st, o.namespace+"/")
+	}
+
+	s, err := newServer(st, o.ids, o.log, a, o.bridged...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fn := range o.fns {
+		fn(s)
+	}
+
+	return s, nil
+}
+
+// WithStore sets the store in which the server persists data.
+func WithStore(st Store) Option {
+	return func(o *options) {
+		o.store = st
+	}
+}
+
+// WithStoreNamespace prefixes all keys in the store with
+// "namespace/" (see PrefixStore). Use it to share a store
+// between multiple servers.
+func WithStoreNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithBridged adds bridged accessories. The main accessory then acts as bridge.
+func WithBridged(as ...*accessory.A) Option {
+	return func(o *options) {
+		o.bridged = append(o.bridged, as...)
+	}
+}
+
+// WithIDAllocator sets the allocator which assigns accessory
+// and instance ids. By default the assigned ids are persisted
+// in the store.
+func WithIDAllocator(ids IDAllocator) Option {
+	return func(o *options) {
+		o.ids = ids
+	}
+}
+
+// WithPin sets the pincode (see Server.Pin).
+func WithPin(pin string) Option {
+	return serverOption(func(s *Server) {
+		s.Pin = pin
+	})
+}
+
+// WithPinProvider sets the function which returns the pincode
+// for every pair-setup (see Server.PinFunc).
+func WithPinProvider(fn func() string) Option {
+	return serverOption(func(s *Server) {
+		s.PinFunc = fn
+	})
+}
+
+// WithSnapshotFunc sets the function which returns
+// the snapshot of a camera (see Server.SnapshotFunc).
+func WithSnapshotFunc(fn func(width, height int) ([]byte, error)) Option {
+	return serverOption(func(s *Server) {
+		s.SnapshotFunc = fn
+	})
+}
+
+// WithSRPVerifier sets the pre-computed srp salt and verifier
+// of the pincode (see Server.Verifier).
+func WithSRPVerifier(salt, verifier []byte) Option {
+	return serverOption(func(s *Server) {
+		s.Verifier = &SRPVerifier{Salt: salt, Verifier: verifier}
+	})
+}
+
+// WithSetupId sets the setup id.
+func WithSetupId(id string) Option {
+	return serverOption(func(s *Server) {
+		s.SetupId = id
+	})
+}
+
+// WithAddr sets the tcp address ("host:port") to listen to.
+func WithAddr(addr string) Option {
+	return serverOption(func(s *Server) {
+		s.Addr = addr
+	})
+}
+
+// WithPort sets the port to listen to.
+func WithPort(port int) Option {
+	return serverOption(func(s *Server) {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		s.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	})
+}
+
+// WithNetwork sets the network to listen to ("tcp", "tcp4" or "tcp6").
+func WithNetwork(network string) Option {
+	return serverOption(func(s *Server) {
+		s.Network = network
+	})
+}
+
+// WithInterface sets the network interfaces at which
+// the accessory is announced.
+func WithInterface(names ...string) Option {
+	return serverOption(func(s *Server) {
+		s.Ifaces = append(s.Ifaces, names...)
+	})
+}
+
+// WithInterfaceWatchInterval sets the interval in which the network
+// interfaces are checked for changes (see Server.InterfaceWatchInterval).
+func WithInterfaceWatchInterval(d time.Duration) Option {
+	return serverOption(func(s *Server) {
+		s.InterfaceWatchInterval = d
+	})
+}
+
+// WithResponder sets the responder, which announces
+// the accessory on the local network (see Server.Responder).
+func WithResponder(r Responder) Option {
+	return serverOption(func(s *Server) {
+		s.Responder = r
+	})
+}
+
+// WithMFiAuthenticator enables pair-setup with MFi authentication.
+func WithMFiAuthenticator(a Authenticator) Option {
+	return serverOption(func(s *Server) {
+		s.Authenticator = a
+		s.MfiCompliant = true
+	})
+}
+
+// WithLogHandler sends the log messages of the server to h (see Server.LogHandler).
+// This includes the messages about the recovery of the store in New.
+func WithLogHandler(h log.Handler) Option {
+	return func(o *options) {
+		o.log = h
+	}
+}
+
+// WithAudit records audit events to sink (see Server.Audit).
+func WithAudit(sink audit.Sink) Option {
+	return serverOption(func(s *Server) {
+		s.Audit = sink
+	})
+}
+
+// WithMetricsAddr serves the metrics at addr (see Server.MetricsAddr).
+func WithMetricsAddr(addr string) Option {
+	return serverOption(func(s *Server) {
+		s.MetricsAddr = addr
+	})
+}
+
+// WithHealthAddr serves the health status at addr (see Server.HealthAddr).
+func WithHealthAddr(addr string) Option {
+	return serverOption(func(s *Server) {
+		s.HealthAddr = addr
+	})
+}
+
+// WithSystemd enables the systemd integration (see Server.Systemd).
+func WithSystemd() Option {
+	return serverOption(func(s *Server) {
+		s.Systemd = true
+	})
+}
+
+// Paranoid locks the memory of the long-term
+// key pair (see Server.Paranoid).
+func Paranoid() Option {
+	return serverOption(func(s *Server) {
+		s.Paranoid = true
+	})
+}
+
+// WithPersistValues enables saving characteristic values
+// in the store (see Server.PersistValues).
+func WithPersistValues() Option {
+	return serverOption(func(s *Server) {
+		s.PersistValues = true
+	})
+}
+
+// WithPersistSubscriptions enables saving the event subscriptions
+// of the controllers in the store (see Server.PersistSubscriptions).
+func WithPersistSubscriptions() Option {
+	return serverOption(func(s *Server) {
+		s.PersistSubscriptions = true
+	})
+}
+
+// WithRejectOutOfRange makes the server reject written values
+// which are out of range (see Server.RejectOutOfRange).
+func WithRejectOutOfRange() Option {
+	return serverOption(func(s *Server) {
+		s.RejectOutOfRange = true
+	})
+}
+
+// WithStoreTimeout sets the timeout of store operations
+// while handling http requests.
+func WithStoreTimeout(d time.Duration) Option {
+	return serverOption(func(s *Server) {
+		s.StoreTimeout = d
+	})
+}
+
+// WithReadTimeout sets the maximum duration of
+// reading the value of a characteristic.
+func WithReadTimeout(d time.Duration) Option {
+	return serverOption(func(s *Server) {
+		s.ReadTimeout = d
+	})
+}
+
+// WithNotificationInterval sets the minimum interval
+// between notifications of a characteristic.
+func WithNotificationInterval(d time.Duration) Option {
+	return serverOption(func(s *Server) {
+		s.NotificationInterval = d
+	})
+}
+
+// WithPairSetupTimeout sets the maximum duration of a pair-setup.
+func WithPairSetupTimeout(d time.Duration) Option {
+	return serverOption(func(s *Server) {
+		s.PairSetupTimeout = d
+	})
+}
+
+// WithPairSetupLimit sets the number of failed pair-setup attempts
+// after which pair-setup is disabled and the initial backoff after
+// a failed attempt.
+func WithPairSetupLimit(attempts int, backoff time.Duration) Option {
+	return serverOption(func(s *Server) {
+		s.MaxPairSetupAttempts = attempts
+		s.PairSetupBackoff = backoff
+	})
+}
+
+// WithSessionPacketLimit sets the number of packets after
+// which the keys of a session are renegotiated.
+func WithSessionPacketLimit(n uint64) Option {
+	return serverOption(func(s *Server) {
+		s.SessionPacketLimit = n
+	})
+}
+
+// WithRequestLimits sets the maximum size of a request body
+// and the maximum duration of receiving a request.
+func WithRequestLimits(maxSize int, timeout time.Duration) Option {
+	return serverOption(func(s *Server) {
+		s.MaxRequestSize = maxSize
+		s.ReceiveTimeout = timeout
+	})
+}
+
+// Config is a snapshot of the configuration of a server.
+// It doesn't contain any secrets (e.g. the pincode).
+type Config struct {
+	DeviceId             string // device id ("id" in txt records)
+	Name                 string
+	Category             byte
+	Addr                 string
+	Port                 int // listening port; 0 if the server doesn't run
+	Network              string
+	Ifaces               []string
+	SetupId              string
+	Protocol             string
+	ConfigurationNumber  uint16
+	StateNumber          uint16
+	Paired               bool
+	MFi                  bool
+	Systemd              bool
+	PersistValues        bool
+	PersistSubscriptions bool
+	RejectOutOfRange     bool
+	StoreTimeout         time.Duration
+	ReadTimeout          time.Duration
+	PairSetupTimeout     time.Duration
+	NotificationInterval time.Duration
+	MaxRequestSize       int
+	ReceiveTimeout       time.Duration
+	SessionPacketLimit   uint64
+}
+
+// Config returns the current configuration of the server.
+func (s *Server) Config() Config {
+	s.mux.Lock()
+	port := 0
+	if s.ln != nil {
+		port = s.port
+	}
+	s.mux.Unlock()
+	uuid, _ := s.identity()
+
+	return Config{
+		DeviceId:             uuid,
+		Name:                 s.a.Name(),
+		Category:             s.a.Type,
+		Addr:                 s.Addr,
+		Port:                 port,
+		Network:              s.network(),
+		Ifaces:               append([]string{}, s.Ifaces...),
+		SetupId:              s.SetupId,
+		Protocol:             s.Protocol,
+		ConfigurationNumber:  s.ConfigurationNumber(),
+		StateNumber:          s.StateNumber(),
+		Paired:               s.IsPaired(),
+		MFi:                  s.Authenticator != nil,
+		Systemd:              s.Systemd,
+		PersistValues:        s.PersistValues,
+		PersistSubscriptions: s.PersistSubscriptions,
+		RejectOutOfRange:     s.RejectOutOfRange,
+		StoreTimeout:         s.StoreTimeout,
+		ReadTimeout:          s.ReadTimeout,
+		PairSetupTimeout:     s.pairSetupTimeout(),
+		NotificationInterval: s.minNotificationInterval(),
+		MaxRequestSize:       s.maxRequestSize(),
+		ReceiveTimeout:       s.receiveTimeout(),
+		SessionPacketLimit:   s.sessionPacketLimit(),
+	}
+}
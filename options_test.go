@@ -0,0 +1,54 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(accessory.NewBridge(accessory.Info{Name: "Bridge"}).A); err == nil {
+		t.Fatal("expected error")
+	}
+
+	st := NewMemStore()
+	b := accessory.NewBridge(accessory.Info{Name: "Bridge"})
+	l := accessory.NewLightbulb(accessory.Info{Name: "Light"})
+	s, err := New(b.A,
+		WithStore(st),
+		WithStoreNamespace("bridge"),
+		WithBridged(l.A),
+		WithPin("12344321"),
+		WithAddr("127.0.0.1:0"),
+		WithPort(12345),
+		WithInterface("en0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.Pin, "12344321"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(s.accessories()), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := st.Get("bridge/uuid"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := s.Config()
+	if is, want := cfg.Addr, "127.0.0.1:12345"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := cfg.DeviceId, s.uuid; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(cfg.Ifaces), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
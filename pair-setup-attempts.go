@@ -0,0 +1,143 @@
+package hap
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	// keyPairSetupAttempts is the store key of the failed pair-setup attempts.
+	keyPairSetupAttempts = "pairsetup.attempts"
+
+	defaultMaxPairSetupAttempts = 100
+	defaultPairSetupBackoff     = time.Second
+	maxPairSetupBackoff         = time.Hour
+)
+
+// pairSetupAttempts are the failed pair-setup attempts.
+type pairSetupAttempts struct {
+	Failures int
+	Last     time.Time
+}
+
+// delay returns the duration a controller has to wait after the
+// last failed attempt. The delay doubles with every failed attempt.
+func (a pairSetupAttempts) delay(base time.Duration) time.Duration {
+	if a.Failures == 0 {
+		return 0
+	}
+
+	d := base
+	for i := 1; i < a.Failures && d < maxPairSetupBackoff; i++ {
+		d *= 2
+	}
+
+	if d > maxPairSetupBackoff {
+		d = maxPairSetupBackoff
+	}
+
+	return d
+}
+
+func (st *storer) pairSetupAttempts() pairSetupAttempts {
+	var a pairSetupAttempts
+	if b, err := st.Get(keyPairSetupAttempts); err == nil {
+		json.Unmarshal(b, &a)
+	}
+
+	return a
+}
+
+func (st *storer) savePairSetupAttempts(a pairSetupAttempts) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	return st.Set(keyPairSetupAttempts, b)
+}
+
+func (s *Server) maxPairSetupAttempts() int {
+	if s.MaxPairSetupAttempts > 0 {
+		return s.MaxPairSetupAttempts
+	}
+
+	return defaultMaxPairSetupAttempts
+}
+
+func (s *Server) pairSetupBackoff() time.Duration {
+	if s.PairSetupBackoff > 0 {
+		return s.PairSetupBackoff
+	}
+
+	return defaultPairSetupBackoff
+}
+
+// checkPairSetupAttempts returns false and writes an error response
+// if pair-setup is not allowed because of previous failed attempts.
+func (srv *Server) checkPairSetupAttempts(res http.ResponseWriter, req *http.Request) bool {
+	a := srv.storer(req.Context()).pairSetupAttempts()
+	if a.Failures >= srv.maxPairSetupAttempts() {
+		srv.logInfo(req).Printf("pair-setup disabled after %d failed attempts\n", a.Failures)
+		tlv8Error(res, M2, TlvErrorMaxTries)
+		return false
+	}
+
+	if wait := a.Last.Add(a.delay(srv.pairSetupBackoff())).Sub(time.Now()); wait > 0 {
+		srv.logInfo(req).Printf("pair-setup not allowed for %v\n", wait)
+		resp := struct {
+			State      byte   `tlv8:"6"`
+			Error      byte   `tlv8:"7"`
+			RetryDelay uint16 `tlv8:"8"`
+		}{
+			State:      M2,
+			Error:      TlvErrorBackoff,
+			RetryDelay: uint16((wait + time.Second - 1) / time.Second),
+		}
+		tlv8OK(res, resp)
+		return false
+	}
+
+	return true
+}
+
+// pairSetupFailed records a failed pair-setup attempt.
+func (srv *Server) pairSetupFailed(req *http.Request) {
+	srv.metrics.inc(&srv.metrics.pairSetupFailures)
+
+	srv.pmu.Lock()
+	defer srv.pmu.Unlock()
+
+	st := srv.storer(req.Context())
+	a := st.pairSetupAttempts()
+	a.Failures++
+	a.Last = time.Now()
+	if err := st.savePairSetupAttempts(a); err != nil {
+		srv.logInfo(req).Println("pair-setup:", err)
+	}
+}
+
+// pairSetupSucceeded resets the failed pair-setup attempts.
+func (srv *Server) pairSetupSucceeded(req *http.Request) {
+	srv.pmu.Lock()
+	defer srv.pmu.Unlock()
+
+	st := srv.storer(req.Context())
+	if a := st.pairSetupAttempts(); a.Failures == 0 {
+		return
+	}
+
+	if err := st.Delete(keyPairSetupAttempts); err != nil {
+		srv.logInfo(req).Println("pair-setup:", err)
+	}
+}
+
+// ResetPairSetupAttempts resets the failed pair-setup attempts,
+// which enables pair-setup after it was disabled.
+func (s *Server) ResetPairSetupAttempts() error {
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+
+	return s.st.Delete(keyPairSetupAttempts)
+}
@@ -2,18 +2,26 @@ package hap
 
 import (
 	"github.com/brutella/hap/hkdf"
+	"github.com/brutella/hap/log"
 	"github.com/tadglines/go-pkgs/crypto/srp"
 
+	"context"
 	"crypto/sha512"
+	"encoding/json"
 	"errors"
+	"time"
 )
 
 type pairSetupSession struct {
+	Method        byte   // MethodPair or MethodPairMFi
+	Flags         uint32 // see PairingFlagTransient and PairingFlagSplit
 	Identifier    []byte
 	Salt          []byte   // s
+	Verifier      []byte   // v
 	PublicKey     []byte   // A
 	PrivateKey    []byte   // S
 	EncryptionKey [32]byte // K
+	Created       time.Time
 
 	session *srp.ServerSession
 }
@@ -32,8 +40,10 @@ func newPairSetupSession(id, pin string) (*pairSetupSession, error) {
 			pairing := pairSetupSession{
 				session:    session,
 				Salt:       salt,
+				Verifier:   v,
 				PublicKey:  session.GetB(),
 				Identifier: []byte(id),
+				Created:    time.Now(),
 			}
 			return &pairing, nil
 		}
@@ -42,6 +52,51 @@ func newPairSetupSession(id, pin string) (*pairSetupSession, error) {
 	return nil, err
 }
 
+// newVerifierPairSetupSession returns a new setup server session
+// which uses a pre-computed salt and verifier.
+func newVerifierPairSetupSession(id string, v SRPVerifier) (*pairSetupSession, error) {
+	pairName := []byte("Pair-Setup")
+	srp, err := srp.NewSRP(srpGroup, sha512.New, keyDerivativeFuncRFC2945(sha512.New, []byte(pairName)))
+	if err != nil {
+		return nil, err
+	}
+
+	session := srp.NewServerSession([]byte(pairName), v.Salt, v.Verifier)
+	pairing := pairSetupSession{
+		session:    session,
+		Salt:       v.Salt,
+		Verifier:   v.Verifier,
+		PublicKey:  session.GetB(),
+		Identifier: []byte(id),
+		Created:    time.Now(),
+	}
+
+	return &pairing, nil
+}
+
+// Expired returns true if the session is older than ttl.
+func (p *pairSetupSession) Expired(ttl time.Duration) bool {
+	return time.Since(p.Created) > ttl
+}
+
+// clear zeros the srp secret and the encryption key and
+// releases the srp session, which contains the private key.
+func (p *pairSetupSession) clear() {
+	zero(p.PrivateKey)
+	zero(p.EncryptionKey[:])
+	p.session = nil
+}
+
+// IsTransient returns true if the session was requested as transient pair-setup.
+func (p *pairSetupSession) IsTransient() bool {
+	return p.Flags&PairingFlagTransient != 0
+}
+
+// IsSplit returns true if the session was requested as split pair-setup.
+func (p *pairSetupSession) IsSplit() bool {
+	return p.Flags&PairingFlagSplit != 0
+}
+
 // ProofFromClientProof validates client proof (`M1`) and returns authenticator or error if proof is not valid.
 func (p *pairSetupSession) ProofFromClientProof(clientProof []byte) ([]byte, error) {
 	if !p.session.VerifyClientAuthenticator(clientProof) { // Validates M1 based on S and A
@@ -96,3 +151,95 @@ func keyDerivativeFuncRFC2945(h srp.HashFunc, id []byte) srp.KeyDerivationFunc {
 		return h.Sum(nil)
 	}
 }
+
+const keySplitVerifier = "pairsetup.split"
+
+// An SRPVerifier is the srp salt and verifier of a pincode.
+type SRPVerifier struct {
+	Salt     []byte
+	Verifier []byte
+}
+
+// NewSRPVerifier returns a random salt and the verifier for pin.
+// Use it while manufacturing a device to compute the verifier,
+// which is then used instead of the pincode (see Server.Verifier).
+func NewSRPVerifier(pin string) (SRPVerifier, error) {
+	if err := validatePin(pin); err != nil {
+		return SRPVerifier{}, err
+	}
+
+	pairName := []byte("Pair-Setup")
+	srp, err := srp.NewSRP(srpGroup, sha512.New, keyDerivativeFuncRFC2945(sha512.New, pairName))
+	if err != nil {
+		return SRPVerifier{}, err
+	}
+
+	srp.SaltLength = 16
+	salt, v, err := srp.ComputeVerifier([]byte(fmtPin(pin)))
+	if err != nil {
+		return SRPVerifier{}, err
+	}
+
+	return SRPVerifier{Salt: salt, Verifier: v}, nil
+}
+
+func (st *storer) splitVerifier() (v SRPVerifier, err error) {
+	var b []byte
+	if b, err = st.Get(keySplitVerifier); err == nil {
+		err = json.Unmarshal(b, &v)
+	}
+
+	return
+}
+
+func (st *storer) saveSplitVerifier(v SRPVerifier) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return st.Set(keySplitVerifier, b)
+}
+
+const defaultPairSetupTimeout = time.Minute
+
+func (s *Server) pairSetupTimeout() time.Duration {
+	if s.PairSetupTimeout > 0 {
+		return s.PairSetupTimeout
+	}
+
+	return defaultPairSetupTimeout
+}
+
+// removeExpiredPairSetupSessions removes pair-setup sessions
+// which exceeded the pair-setup timeout.
+func (s *Server) removeExpiredPairSetupSessions() {
+	ttl := s.pairSetupTimeout()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for c, v := range s.sess {
+		if ses, ok := v.(*pairSetupSession); ok && ses.Expired(ttl) {
+			log.Debug.Println("pair-setup timed out")
+			ses.clear()
+			delete(s.sess, c)
+		}
+	}
+}
+
+// reapPairSetupSessions periodically removes expired
+// pair-setup sessions until ctx is canceled.
+func (s *Server) reapPairSetupSessions(ctx context.Context) {
+	t := time.NewTicker(s.pairSetupTimeout() / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.removeExpiredPairSetupSessions()
+		}
+	}
+}
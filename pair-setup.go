@@ -4,9 +4,9 @@ import (
 	"github.com/brutella/hap/chacha20poly1305"
 	"github.com/brutella/hap/ed25519"
 	"github.com/brutella/hap/hkdf"
-	"github.com/brutella/hap/log"
 	"github.com/brutella/hap/tlv8"
 
+	"fmt"
 	"net/http"
 )
 
@@ -32,37 +32,58 @@ type pairSetupPayload struct {
 	Certificate   []byte `tlv8:"9,optional"`
 	Signature     []byte `tlv8:"10,optional"`
 	Permissions   byte   `tlv8:"11,optional"`
-	FragmentData  []byte `tlv8:"13,optional"`
-	FragmentLast  []byte `tlv8:"14,optional"`
+	FragmentData  []byte `tlv8:"12,optional"`
+	FragmentLast  []byte `tlv8:"13,optional"`
+	Flags         uint32 `tlv8:"19,optional"`
 }
 
 func (srv *Server) pairSetup(res http.ResponseWriter, req *http.Request) {
-	// pairing is only allowed if the accessory is not paired yet
-	if srv.IsPaired() {
-		log.Info.Println("pairing is not allowed")
+	data := pairSetupPayload{}
+	if err := tlv8.UnmarshalReader(req.Body, &data); err != nil {
+		srv.logInfo(req).Println("tlv8:", err)
+		res.WriteHeader(http.StatusBadRequest)
+		tlv8Error(res, M2, TlvErrorUnknown)
+		return
+	}
+
+	// pairing is only allowed if the accessory is not paired yet,
+	// which also applies to transient pair-setups
+	if len(srv.storer(req.Context()).Pairings()) > 0 {
+		srv.logInfo(req).Println("pairing is not allowed")
+		tlv8Error(res, M2, TlvErrorUnavailable)
+		return
+	}
+
+	// pairings cannot be saved in a read-only store
+	if srv.st.readOnly() {
+		srv.logInfo(req).Println("pairing is not allowed with a read-only store")
 		tlv8Error(res, M2, TlvErrorUnavailable)
 		return
 	}
 
 	// pair-setup can only be run by one controller simultaneously
-	for addr, _ := range srv.sessions() {
-		if addr != req.RemoteAddr {
-			log.Info.Printf("simulatenous pairings are not allowed")
+	srv.removeExpiredPairSetupSessions()
+	for c, v := range srv.sessions() {
+		if _, ok := v.(*pairSetupSession); ok && c != reqConn(req) {
+			srv.logInfo(req).Printf("simulatenous pairings are not allowed")
 			tlv8Error(res, M2, TlvErrorBusy)
 			return
 		}
 	}
 
-	data := pairSetupPayload{}
-	if err := tlv8.UnmarshalReader(req.Body, &data); err != nil {
-		log.Info.Println("tlv8:", err)
-		res.WriteHeader(http.StatusBadRequest)
-		tlv8Error(res, M2, TlvErrorUnknown)
-		return
-	}
+	srv.handlePairSetup(res, req, data)
+}
 
+func (srv *Server) handlePairSetup(res http.ResponseWriter, req *http.Request, data pairSetupPayload) {
 	switch data.Method {
-	case MethodPair:
+	case MethodPair, MethodPairMFi:
+		if data.Method == MethodPairMFi && srv.Authenticator == nil {
+			srv.logInfo(req).Println("pair setup: mfi authentication not supported")
+			res.WriteHeader(http.StatusBadRequest)
+			tlv8Error(res, M2, TlvErrorInvalidRequest)
+			return
+		}
+
 		switch data.State {
 		case M1:
 			srv.pairSetupM1(res, req, data)
@@ -71,15 +92,12 @@ func (srv *Server) pairSetup(res http.ResponseWriter, req *http.Request) {
 		case M5:
 			srv.pairSetupM5(res, req, data)
 		default:
-			log.Info.Println("invalid state", data.State)
+			srv.logInfo(req).Println("invalid state", data.State)
 			res.WriteHeader(http.StatusBadRequest)
 			tlv8Error(res, data.State+1, TlvErrorUnknown)
 		}
-	case MethodPairMFi:
-		res.WriteHeader(http.StatusBadRequest)
-		tlv8Error(res, M2, TlvErrorInvalidRequest)
 	default:
-		log.Info.Println("pair setup: invalid method", data.Method)
+		srv.logInfo(req).Println("pair setup: invalid method", data.Method)
 		res.WriteHeader(http.StatusBadRequest)
 		tlv8Error(res, 0, TlvErrorInvalidRequest)
 	}
@@ -91,6 +109,13 @@ type pairSetupM2Payload struct {
 	State     byte   `tlv8:"6"`
 }
 
+type pairSetupM2SplitPayload struct {
+	Salt      []byte `tlv8:"2"`
+	PublicKey []byte `tlv8:"3"`
+	State     byte   `tlv8:"6"`
+	Flags     uint32 `tlv8:"19"`
+}
+
 type pairSetupM4Payload struct {
 	Proof []byte `tlv8:"4"`
 	State byte   `tlv8:"6"`
@@ -108,14 +133,33 @@ type pairSetupM6Payload struct {
 }
 
 func (srv *Server) pairSetupM1(res http.ResponseWriter, req *http.Request, data pairSetupPayload) {
+	srv.metrics.inc(&srv.metrics.pairSetups)
+
+	if !srv.checkPairSetupAttempts(res, req) {
+		return
+	}
+
 	// Create a new session.
-	ss, err := newPairSetupSession(srv.uuid, srv.fmtPin())
+	ss, err := srv.newPairSetupSession(req, data.Flags)
 	if err != nil {
+		srv.logInfo(req).Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
 		tlv8Error(res, M2, TlvErrorUnknown)
 		return
 	}
-	srv.setSession(req.RemoteAddr, ss)
+	ss.Method = data.Method
+	ss.Flags = data.Flags
+	srv.setSession(reqConn(req), ss)
+
+	if ss.IsSplit() {
+		tlv8OK(res, pairSetupM2SplitPayload{
+			Salt:      ss.Salt,
+			PublicKey: ss.PublicKey,
+			State:     M2,
+			Flags:     data.Flags,
+		})
+		return
+	}
 
 	resp := pairSetupM2Payload{
 		Salt:      ss.Salt,
@@ -125,10 +169,33 @@ func (srv *Server) pairSetupM1(res http.ResponseWriter, req *http.Request, data
 	tlv8OK(res, resp)
 }
 
+// newPairSetupSession returns a new pair-setup session.
+// A transient split pair-setup uses the verifier of the
+// previous split pair-setup, if available.
+func (srv *Server) newPairSetupSession(req *http.Request, flags uint32) (*pairSetupSession, error) {
+	uuid, _ := srv.identity()
+	if flags&PairingFlagTransient != 0 && flags&PairingFlagSplit != 0 {
+		if v, err := srv.storer(req.Context()).splitVerifier(); err == nil {
+			return newVerifierPairSetupSession(uuid, v)
+		}
+	}
+
+	if srv.Verifier != nil && srv.PinFunc == nil {
+		return newVerifierPairSetupSession(uuid, *srv.Verifier)
+	}
+
+	pin, err := srv.setupPin()
+	if err != nil {
+		return nil, err
+	}
+
+	return newPairSetupSession(uuid, fmtPin(pin))
+}
+
 func (srv *Server) pairSetupM3(res http.ResponseWriter, req *http.Request, data pairSetupPayload) {
-	ses, err := srv.getPairSetupSession(req.RemoteAddr)
+	ses, err := srv.getPairSetupSession(reqConn(req))
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
 		tlv8Error(res, M2, TlvErrorUnknown)
 		return
@@ -136,47 +203,103 @@ func (srv *Server) pairSetupM3(res http.ResponseWriter, req *http.Request, data
 
 	err = ses.SetupPrivateKeyFromClientPublicKey(data.PublicKey)
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		tlv8Error(res, M4, TlvErrorInvalidRequest)
 		return
 	}
 	proof, err := ses.ProofFromClientProof(data.Proof)
 	if err != nil {
-		log.Info.Println(err)
-		tlv8Error(res, M4, TlvErrorInvalidRequest)
+		srv.logInfo(req).Println(err)
+		srv.pairSetupFailed(req)
+		srv.authFailed(req, "", "pair setup: invalid setup code")
+		tlv8Error(res, M4, TlvErrorAuthentication)
 		return
 	}
+	srv.pairSetupSucceeded(req)
 
 	err = ses.SetupEncryptionKey([]byte("Pair-Setup-Encrypt-Salt"), []byte("Pair-Setup-Encrypt-Info"))
 	if err != nil {
-		log.Info.Println("pair-setup:", err)
+		srv.logInfo(req).Println("pair-setup:", err)
 		tlv8Error(res, M4, TlvErrorInvalidRequest)
 		return
 	}
 
-	resp := pairSetupM4Payload{
-		Proof: proof,
-		State: M4,
+	if ses.Method == MethodPairMFi {
+		// The controller verifies the MFi certificate
+		// and the signature of the challenge.
+		b, err := mfiEncryptedData(srv.Authenticator, ses)
+		if err != nil {
+			srv.logInfo(req).Println("mfi:", err)
+			tlv8Error(res, M4, TlvErrorAuthentication)
+			return
+		}
+
+		tlv8OK(res, pairSetupM4MFiPayload{
+			Proof:         proof,
+			EncryptedData: b,
+			State:         M4,
+		})
+	} else {
+		tlv8OK(res, pairSetupM4Payload{
+			Proof: proof,
+			State: M4,
+		})
+	}
+
+	if ses.IsTransient() {
+		srv.finishTransientPairSetup(req, ses)
+	}
+}
+
+// finishTransientPairSetup upgrades the connection to use encryption
+// with keys derived from the srp shared secret. No pairing is saved.
+func (srv *Server) finishTransientPairSetup(req *http.Request, ses *pairSetupSession) {
+	if ses.IsSplit() {
+		srv.saveSplitVerifier(req, ses)
+	}
+
+	ss, err := newTransientSession(ses.PrivateKey)
+	if err != nil {
+		srv.logInfo(req).Println(err)
+		return
+	}
+
+	srv.setSession(reqConn(req), ss)
+
+	conn := srv.getConn(req)
+	if conn == nil {
+		srv.logInfo(req).Printf("no connection for %s\n", req.RemoteAddr)
+		return
+	}
+
+	conn.Upgrade(ss)
+}
+
+// saveSplitVerifier saves the salt and verifier of the session
+// to be used by subsequent transient split pair-setups.
+func (srv *Server) saveSplitVerifier(req *http.Request, ses *pairSetupSession) {
+	v := SRPVerifier{
+		Salt:     ses.Salt,
+		Verifier: ses.Verifier,
+	}
+	if err := srv.storer(req.Context()).saveSplitVerifier(v); err != nil {
+		srv.logInfo(req).Println("split pair-setup:", err)
 	}
-	tlv8OK(res, resp)
 }
 
 func (srv *Server) pairSetupM5(res http.ResponseWriter, req *http.Request, data pairSetupPayload) {
-	ses, err := srv.getPairSetupSession(req.RemoteAddr)
+	ses, err := srv.getPairSetupSession(reqConn(req))
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
 		tlv8Error(res, M6, TlvErrorUnknown)
 		return
 	}
 
-	msg := data.EncryptedData[:len(data.EncryptedData)-16]
-	var mac [16]byte
-	copy(mac[:], data.EncryptedData[len(msg):]) // 16 byte (MAC)
-
-	decrypted, err := chacha20poly1305.DecryptAndVerify(ses.EncryptionKey[:], []byte("PS-Msg05"), msg, mac, nil)
-
+	decrypted, err := decryptAndVerify(ses.EncryptionKey, "PS-Msg05", data.EncryptedData)
+	defer zero(decrypted)
 	if err != nil {
+		srv.logInfo(req).Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
 		tlv8Error(res, M6, TlvErrorUnknown)
 		return
@@ -188,31 +311,33 @@ func (srv *Server) pairSetupM5(res http.ResponseWriter, req *http.Request, data
 		Signature  []byte `tlv8:"10"`
 	}{}
 	if err := tlv8.Unmarshal(decrypted, &encData); err != nil {
-		log.Info.Println("tlv8:", err)
+		srv.logInfo(req).Println("tlv8:", err)
 		res.WriteHeader(http.StatusBadRequest)
 		tlv8Error(res, M6, TlvErrorUnknown)
 		return
 	}
 
-	log.Debug.Println(toJSON(encData))
+	srv.logDebug(req).Println(toJSON(encData))
 
 	hash, _ := hkdf.Sha512(ses.PrivateKey, []byte("Pair-Setup-Controller-Sign-Salt"), []byte("Pair-Setup-Controller-Sign-Info"))
+	defer zero(hash[:])
 	var buf []byte
 	buf = append(buf, hash[:]...)
 	buf = append(buf, encData.Identifier[:]...)
 	buf = append(buf, encData.PublicKey[:]...)
 
 	if !ed25519.ValidateSignature(encData.PublicKey[:], buf, encData.Signature) {
-		log.Info.Println("ed25519 signature invalid")
+		srv.logInfo(req).Println("ed25519 signature invalid")
+		srv.authFailed(req, encData.Identifier, "pair setup: invalid signature")
 		tlv8Error(res, M6, TlvErrorInvalidRequest)
 		return
 	}
 
-	log.Debug.Println("ed25519 signature valid")
+	srv.logDebug(req).Println("ed25519 signature valid")
 
 	hash, err = hkdf.Sha512(ses.PrivateKey, []byte("Pair-Setup-Accessory-Sign-Salt"), []byte("Pair-Setup-Accessory-Sign-Info"))
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		tlv8Error(res, M6, TlvErrorInvalidRequest)
 		return
 	}
@@ -220,23 +345,24 @@ func (srv *Server) pairSetupM5(res http.ResponseWriter, req *http.Request, data
 	buf = make([]byte, 0)
 	buf = append(buf, hash[:]...)
 	buf = append(buf, ses.Identifier[:]...)
-	buf = append(buf, srv.Key.Public[:]...)
+	_, public := srv.identity()
+	buf = append(buf, public...)
 
-	signature, err := ed25519.Signature(srv.Key.Private[:], buf)
+	signature, err := srv.sign(buf)
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		tlv8Error(res, M6, TlvErrorInvalidRequest)
 		return
 	}
 
 	privateData := pairSetupM6EncryptedPayload{
 		Identifier: ses.Identifier,
-		PublicKey:  srv.Key.Public[:],
+		PublicKey:  public,
 		Signature:  signature,
 	}
 	b, err := tlv8.Marshal(privateData)
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		tlv8Error(res, M6, TlvErrorInvalidRequest)
 		return
 	}
@@ -249,12 +375,32 @@ func (srv *Server) pairSetupM5(res http.ResponseWriter, req *http.Request, data
 	}
 	tlv8OK(res, resp)
 
-	log.Debug.Println("storing public key for", encData.Identifier)
+	srv.logDebug(req).Println("storing public key for", encData.Identifier)
 
 	p := Pairing{
 		Name:       encData.Identifier,
 		PublicKey:  encData.PublicKey,
 		Permission: PermissionAdmin, // controller is admin by default
 	}
-	srv.savePairing(p)
+	if err := srv.savePairing(req.Context(), p); err != nil {
+		srv.logInfo(req).Println(err)
+	}
+
+	if ses.IsSplit() {
+		srv.saveSplitVerifier(req, ses)
+	}
+}
+
+// decryptAndVerify decrypts the encrypted data of a pairing message,
+// which ends with the 16 byte MAC.
+func decryptAndVerify(key [32]byte, nonce string, data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("encrypted data too short (%d bytes)", len(data))
+	}
+
+	msg := data[:len(data)-16]
+	var mac [16]byte
+	copy(mac[:], data[len(msg):])
+
+	return chacha20poly1305.DecryptAndVerify(key[:], []byte(nonce), msg, mac, nil)
 }
@@ -0,0 +1,346 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/tlv8"
+	"github.com/tadglines/go-pkgs/crypto/srp"
+	"golang.org/x/crypto/hkdf"
+
+	"bytes"
+	"crypto/sha512"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func pairSetupRequest(t *testing.T, s *Server, v interface{}, resp interface{}) {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/pair-setup", bytes.NewReader(b))
+	w := httptest.NewRecorder()
+	s.pairSetup(w, req)
+
+	if err := tlv8.UnmarshalReader(w.Result().Body, resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// transientPairSetup runs a transient pair-setup with the given flags.
+func transientPairSetup(t *testing.T, s *Server, pin string, flags uint32) bool {
+	ok, _ := transientPairSetupKey(t, s, pin, flags)
+	return ok
+}
+
+// transientPairSetupKey runs a transient pair-setup and
+// returns the srp shared secret of the controller.
+func transientPairSetupKey(t *testing.T, s *Server, pin string, flags uint32) (bool, []byte) {
+	pairName := []byte("Pair-Setup")
+	client, err := srp.NewSRP(srpGroup, sha512.New, keyDerivativeFuncRFC2945(sha512.New, pairName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := client.NewClientSession(pairName, []byte(pin))
+
+	m2 := struct {
+		Salt      []byte `tlv8:"2"`
+		PublicKey []byte `tlv8:"3"`
+		State     byte   `tlv8:"6"`
+	}{}
+	pairSetupRequest(t, s, struct {
+		Method byte   `tlv8:"0"`
+		State  byte   `tlv8:"6"`
+		Flags  uint32 `tlv8:"19"`
+	}{MethodPair, M1, flags}, &m2)
+
+	key, err := cs.ComputeKey(m2.Salt, m2.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m4 := struct {
+		Proof []byte `tlv8:"4,optional"`
+		State byte   `tlv8:"6"`
+		Error byte   `tlv8:"7,optional"`
+	}{}
+	pairSetupRequest(t, s, struct {
+		PublicKey []byte `tlv8:"3"`
+		Proof     []byte `tlv8:"4"`
+		State     byte   `tlv8:"6"`
+	}{cs.GetA(), cs.ComputeAuthenticator(), M3}, &m4)
+
+	return m4.Error == 0 && cs.VerifyServerAuthenticator(m4.Proof), key
+}
+
+func TestTransientPairSetup(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pin = "00102003"
+
+	ok, key := transientPairSetupKey(t, s, "001-02-003", PairingFlagTransient|PairingFlagSplit)
+	if is, want := ok, true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// requests created by httptest have no connection
+	ss, err := s.getSession(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The session has no pairing and isn't authorized.
+	if is, want := ss.Pairing.Name, ""; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accessories", nil)
+	if is, want := s.IsAuthorized(req), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := s.authorized(req, 1, 1, OpRead), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The keys are derived with the split setup salt.
+	derive := func(info string) []byte {
+		b := make([]byte, 32)
+		r := hkdf.New(sha512.New, key, []byte("SplitSetupSalt"), []byte(info))
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	if is, want := ss.encryptKey[:], derive("AccessoryEncrypt-Control"); !bytes.Equal(is, want) {
+		t.Fatalf("%x != %x", is, want)
+	}
+
+	if is, want := ss.decryptKey[:], derive("ControllerEncrypt-Control"); !bytes.Equal(is, want) {
+		t.Fatalf("%x != %x", is, want)
+	}
+
+	if is, want := len(s.st.Pairings()), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// A transient split pair-setup uses the previous setup code.
+	s.Pin = "11122333"
+	if is, want := transientPairSetup(t, s, "001-02-003", PairingFlagTransient|PairingFlagSplit), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := transientPairSetup(t, s, "001-02-003", PairingFlagTransient), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestTransientPairSetupPaired(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pin = "00102003"
+
+	if err := s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	m2 := struct {
+		State byte `tlv8:"6"`
+		Error byte `tlv8:"7,optional"`
+	}{}
+	pairSetupRequest(t, s, struct {
+		Method byte   `tlv8:"0"`
+		State  byte   `tlv8:"6"`
+		Flags  uint32 `tlv8:"19"`
+	}{MethodPair, M1, PairingFlagTransient}, &m2)
+
+	if is, want := m2.Error, byte(TlvErrorUnavailable); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestPairSetupAttempts(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pin = "00102003"
+	s.MaxPairSetupAttempts = 2
+	s.PairSetupBackoff = time.Millisecond
+
+	if is, want := transientPairSetup(t, s, "111-22-333", PairingFlagTransient), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	m2 := struct {
+		State      byte   `tlv8:"6"`
+		Error      byte   `tlv8:"7"`
+		RetryDelay uint16 `tlv8:"8,optional"`
+	}{}
+	m1 := struct {
+		Method byte `tlv8:"0"`
+		State  byte `tlv8:"6"`
+	}{MethodPair, M1}
+
+	s.PairSetupBackoff = time.Minute
+	pairSetupRequest(t, s, m1, &m2)
+	if is, want := m2.Error, byte(TlvErrorBackoff); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if is, want := m2.RetryDelay, uint16(60); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.PairSetupBackoff = time.Millisecond
+	time.Sleep(time.Millisecond)
+	if is, want := transientPairSetup(t, s, "111-22-333", PairingFlagTransient), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	pairSetupRequest(t, s, m1, &m2)
+	if is, want := m2.Error, byte(TlvErrorMaxTries); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.ResetPairSetupAttempts()
+	if is, want := transientPairSetup(t, s, "001-02-003", PairingFlagTransient), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+// slowStore delays returning read values, which makes lost updates likely.
+type slowStore struct {
+	Store
+}
+
+func (st slowStore) Get(key string) ([]byte, error) {
+	b, err := st.Store.Get(key)
+	time.Sleep(time.Millisecond)
+	return b, err
+}
+
+func TestPairSetupAttemptsConcurrent(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(slowStore{NewMemStore()}, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.pairSetupFailed(httptest.NewRequest(http.MethodPost, "/pair-setup", nil))
+		}()
+	}
+	wg.Wait()
+
+	if is, want := s.st.pairSetupAttempts().Failures, 50; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestPinFunc(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	s.PinFunc = func() string {
+		n++
+		return "31415926"
+	}
+
+	if is, want := transientPairSetup(t, s, "314-15-926", PairingFlagTransient), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := n, 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := validatePin(RandomPin()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSRPVerifier(t *testing.T) {
+	v, err := NewSRPVerifier("31415926")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Verifier = &v
+
+	if err := s.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.Pin, ""; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := transientPairSetup(t, s, "314-15-926", PairingFlagTransient), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestPairSetupTimeout(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pin = "00102003"
+
+	c, _ := net.Pipe()
+	s.setSession(c, &pairSetupSession{Created: time.Now()})
+
+	m2 := struct {
+		State byte `tlv8:"6"`
+		Error byte `tlv8:"7,optional"`
+	}{}
+	m1 := struct {
+		Method byte `tlv8:"0"`
+		State  byte `tlv8:"6"`
+	}{MethodPair, M1}
+
+	s.PairSetupTimeout = time.Minute
+	pairSetupRequest(t, s, m1, &m2)
+	if is, want := m2.Error, byte(TlvErrorBusy); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.PairSetupTimeout = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	m2.Error = 0
+	pairSetupRequest(t, s, m1, &m2)
+	if is, want := m2.Error, byte(0); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := s.getPairSetupSession(c); err == nil {
+		t.Fatal("expected error")
+	}
+}
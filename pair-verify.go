@@ -5,7 +5,6 @@ import (
 	"github.com/brutella/hap/curve25519"
 	"github.com/brutella/hap/ed25519"
 	"github.com/brutella/hap/hkdf"
-	"github.com/brutella/hap/log"
 	"github.com/brutella/hap/tlv8"
 
 	"net/http"
@@ -28,10 +27,17 @@ type pairVerifySession struct {
 	EncryptionKey  [32]byte
 }
 
+// clear zeros the private key and the derived keys.
+func (s *pairVerifySession) clear() {
+	zero(s.PrivateKey[:])
+	zero(s.SharedKey[:])
+	zero(s.EncryptionKey[:])
+}
+
 func (srv *Server) pairVerify(res http.ResponseWriter, req *http.Request) {
 	data := pairVerifyPayload{}
 	if err := tlv8.UnmarshalReader(req.Body, &data); err != nil {
-		log.Info.Println("tlv8:", err)
+		srv.logInfo(req).Println("tlv8:", err)
 		tlv8Error(res, data.State+1, TlvErrorUnknown)
 		return
 	}
@@ -44,12 +50,12 @@ func (srv *Server) pairVerify(res http.ResponseWriter, req *http.Request) {
 		case M3:
 			srv.pairVerifyM3(res, req, data)
 		default:
-			log.Info.Println("invalid state", data.State)
+			srv.logInfo(req).Println("invalid state", data.State)
 			res.WriteHeader(http.StatusBadRequest)
 			tlv8Error(res, data.State+1, TlvErrorUnknown)
 		}
 	default:
-		log.Info.Println("pair verify: invalid method", data.Method)
+		srv.logInfo(req).Println("pair verify: invalid method", data.Method)
 		res.WriteHeader(http.StatusBadRequest)
 		tlv8Error(res, 0, TlvErrorInvalidRequest)
 	}
@@ -57,27 +63,42 @@ func (srv *Server) pairVerify(res http.ResponseWriter, req *http.Request) {
 }
 
 func (srv *Server) pairVerifyM1(res http.ResponseWriter, req *http.Request, data pairVerifyPayload) {
+	if len(data.PublicKey) != 32 {
+		srv.logInfo(req).Printf("invalid public key length %d\n", len(data.PublicKey))
+		res.WriteHeader(http.StatusBadRequest)
+		tlv8Error(res, M2, TlvErrorUnknown)
+		return
+	}
+
 	var otherPublicKey [32]byte
 	copy(otherPublicKey[:], data.PublicKey)
 
 	// Generate the key pair.
 	publicKey, privateKey := curve25519.GenerateKeyPair()
-	sharedKey := curve25519.SharedSecret(privateKey, otherPublicKey)
+	sharedKey, err := curve25519.SharedSecret(privateKey, otherPublicKey)
+	if err != nil {
+		srv.logInfo(req).Println(err)
+		res.WriteHeader(http.StatusBadRequest)
+		tlv8Error(res, M2, TlvErrorAuthentication)
+		return
+	}
 	encKey, err := hkdf.Sha512(sharedKey[:], []byte("Pair-Verify-Encrypt-Salt"), []byte("Pair-Verify-Encrypt-Info"))
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
 		tlv8Error(res, M2, TlvErrorUnknown)
 		return
 	}
 
+	uuid, _ := srv.identity()
+
 	var buf []byte
 	buf = append(buf, publicKey[:]...)
-	buf = append(buf, srv.uuid...)
+	buf = append(buf, uuid...)
 	buf = append(buf, data.PublicKey[:]...)
-	signature, err := ed25519.Signature(srv.Key.Private[:], buf)
+	signature, err := srv.sign(buf)
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		tlv8Error(res, M2, TlvErrorUnknown)
 		return
 	}
@@ -86,13 +107,13 @@ func (srv *Server) pairVerifyM1(res http.ResponseWriter, req *http.Request, data
 		Identifier string `tlv8:"1"`
 		Signature  []byte `tlv8:"10"`
 	}{
-		Identifier: srv.uuid,
+		Identifier: uuid,
 		Signature:  signature,
 	}
 
 	b, err := tlv8.Marshal(enData)
 	if err != nil {
-		log.Info.Println("tlv8:", err)
+		srv.logInfo(req).Println("tlv8:", err)
 		res.WriteHeader(http.StatusBadRequest)
 		tlv8Error(res, M2, TlvErrorUnknown)
 		return
@@ -118,40 +139,39 @@ func (srv *Server) pairVerifyM1(res http.ResponseWriter, req *http.Request, data
 		SharedKey:      sharedKey,
 		EncryptionKey:  encKey,
 	}
-	srv.setSession(req.RemoteAddr, ses)
+	srv.setSession(reqConn(req), ses)
 }
 
 func (srv *Server) pairVerifyM3(res http.ResponseWriter, req *http.Request, data pairVerifyPayload) {
 	// Get the session for the request.
-	ses, err := srv.getPairVerifySession(req.RemoteAddr)
+	ses, err := srv.getPairVerifySession(reqConn(req))
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
 		tlv8Error(res, M4, TlvErrorUnknown)
 		return
 	}
 
-	msg := data.EncryptedData[:len(data.EncryptedData)-16]
-	var mac [16]byte
-	copy(mac[:], data.EncryptedData[len(msg):]) // 16 byte (MAC)
-
-	enc, err := chacha20poly1305.DecryptAndVerify(ses.EncryptionKey[:], []byte("PV-Msg03"), msg, mac, nil)
+	enc, err := decryptAndVerify(ses.EncryptionKey, "PV-Msg03", data.EncryptedData)
+	defer zero(enc)
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
+		srv.authFailed(req, "", "pair verify: invalid encrypted data")
 		tlv8Error(res, M4, TlvErrorAuthentication)
 		return
 	}
 
 	encData := pairVerifyPayload{}
 	if err := tlv8.Unmarshal(enc, &encData); err != nil {
-		log.Info.Println("tlv8:", err)
+		srv.logInfo(req).Println("tlv8:", err)
 		tlv8Error(res, M4, TlvErrorUnknown)
 		return
 	}
 
-	pairing, err := srv.st.Pairing(encData.Identifier)
+	pairing, err := srv.verifiedPairing(req.Context(), encData.Identifier)
 	if err != nil {
-		log.Info.Printf("not paired with %s yet\n", encData.Identifier)
+		srv.logInfo(req).Printf("not paired with %s yet\n", encData.Identifier)
+		srv.authFailed(req, encData.Identifier, "pair verify: unknown controller")
 		tlv8Error(res, M4, TlvErrorAuthentication)
 		return
 	}
@@ -162,7 +182,8 @@ func (srv *Server) pairVerifyM3(res http.ResponseWriter, req *http.Request, data
 	buf = append(buf, ses.PublicKey[:]...)
 
 	if !ed25519.ValidateSignature(pairing.PublicKey[:], buf, encData.Signature) {
-		log.Info.Println("signature is invalid")
+		srv.logInfo(req).Println("signature is invalid")
+		srv.authFailed(req, pairing.Name, "pair verify: invalid signature")
 		tlv8Error(res, M4, TlvErrorUnknownPeer)
 		return
 	}
@@ -175,21 +196,24 @@ func (srv *Server) pairVerifyM3(res http.ResponseWriter, req *http.Request, data
 	tlv8OK(res, resp)
 
 	// Store the negotiated keys in a session.
-	ss, err := newSession(ses.SharedKey, pairing)
+	ss, err := newSession(ses.SharedKey[:], pairing)
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		return
 	}
 
 	// Store the session for the request.
-	srv.setSession(req.RemoteAddr, ss)
+	srv.setSession(reqConn(req), ss)
 
-	conn := getConn(req)
+	conn := srv.getConn(req)
 	if conn == nil {
-		log.Info.Printf("no connection for %s\n", req.RemoteAddr)
+		srv.logInfo(req).Printf("no connection for %s\n", req.RemoteAddr)
 		return
 	}
 
 	// Upgrade the connection to use encryption.
 	conn.Upgrade(ss)
+
+	// Restore the subscriptions of the controller.
+	srv.resubscribe(req.RemoteAddr, pairing)
 }
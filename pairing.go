@@ -1,8 +1,59 @@
 package hap
 
+import (
+	"context"
+	"fmt"
+)
+
 // Pairing is the pairing of a controller with the server.
 type Pairing struct {
 	Name       string
 	PublicKey  []byte
 	Permission byte
 }
+
+// Pairings returns the pairings of all controllers.
+func (s *Server) Pairings() []Pairing {
+	return s.st.Pairings()
+}
+
+// RemovePairing removes the pairing of the controller with name and
+// closes its connections. If the last admin controller is removed,
+// all pairings are removed and the accessory becomes unpaired.
+func (s *Server) RemovePairing(name string) error {
+	p, err := s.st.Pairing(name)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deletePairing(context.Background(), p); err != nil {
+		return err
+	}
+
+	if !s.pairedWithAdmin(context.Background()) {
+		s.closeAllConnections()
+		s.deleteAllPairings("no admin pairing left")
+		return nil
+	}
+
+	s.closeConnections(name)
+	return nil
+}
+
+// Unpair removes all pairings and closes all connections.
+// The accessory is then announced as unpaired and can be
+// paired again.
+func (s *Server) Unpair() error {
+	return s.unpair("unpaired")
+}
+
+func (s *Server) unpair(reason string) error {
+	s.closeAllConnections()
+	s.deleteAllPairings(reason)
+
+	if ps := s.st.Pairings(); len(ps) > 0 {
+		return fmt.Errorf("%d pairings could not be removed", len(ps))
+	}
+
+	return nil
+}
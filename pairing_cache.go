@@ -0,0 +1,80 @@
+package hap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// pairingCache caches the decoded pairings of verified controllers
+// in memory. This avoids decoding pairings every time a controller
+// reconnects. The cached pairing is only used as long as the stored
+// value didn't change, because pairings can be removed out-of-band
+// (e.g. by deleting a file), which a store doesn't have to report.
+type pairingCache struct {
+	ps map[string]cachedPairing
+	mu sync.Mutex
+}
+
+type cachedPairing struct {
+	p Pairing
+	b []byte // stored value of p
+}
+
+func newPairingCache() *pairingCache {
+	return &pairingCache{
+		ps: map[string]cachedPairing{},
+	}
+}
+
+func (c *pairingCache) get(name string) (cachedPairing, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.ps[name]
+	return p, ok
+}
+
+func (c *pairingCache) set(p Pairing, b []byte) {
+	c.mu.Lock()
+	c.ps[p.Name] = cachedPairing{p, b}
+	c.mu.Unlock()
+}
+
+func (c *pairingCache) delete(name string) {
+	c.mu.Lock()
+	delete(c.ps, name)
+	c.mu.Unlock()
+}
+
+func (c *pairingCache) clear() {
+	c.mu.Lock()
+	c.ps = map[string]cachedPairing{}
+	c.mu.Unlock()
+}
+
+// verifiedPairing returns the pairing of a controller during pair-verify.
+// The pairing is read from the store every time, which makes sure that
+// removed pairings are rejected. It is only decoded if the stored
+// value differs from the cached one.
+func (s *Server) verifiedPairing(ctx context.Context, name string) (Pairing, error) {
+	b, err := s.storer(ctx).Get(keyForPairingName(name))
+	if err != nil {
+		s.pcache.delete(name)
+		return Pairing{}, err
+	}
+
+	if c, ok := s.pcache.get(name); ok && bytes.Equal(c.b, b) {
+		return c.p, nil
+	}
+
+	var p Pairing
+	if err := json.Unmarshal(b, &p); err != nil {
+		s.pcache.delete(name)
+		return p, err
+	}
+	s.pcache.set(p, b)
+
+	return p, nil
+}
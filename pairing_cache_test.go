@@ -0,0 +1,62 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"context"
+	"testing"
+)
+
+func TestVerifiedPairingRemovedOutOfBand(t *testing.T) {
+	st := NewMemStore()
+	s, err := NewServer(st, accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	p := Pairing{Name: "admin", PublicKey: make([]byte, 32), Permission: PermissionAdmin}
+	if err := s.savePairing(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.verifiedPairing(ctx, p.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pairing is removed without the server knowing.
+	if err := st.Delete(keyForPairingName(p.Name)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.verifiedPairing(ctx, p.Name); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestVerifiedPairingChangedOutOfBand(t *testing.T) {
+	st := NewMemStore()
+	s, err := NewServer(st, accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	p := Pairing{Name: "admin", PublicKey: make([]byte, 32), Permission: PermissionAdmin}
+	s.savePairing(ctx, p)
+	s.verifiedPairing(ctx, p.Name)
+
+	p.Permission = PermissionUser
+	if err := (&storer{st}).SavePairing(p); err != nil {
+		t.Fatal(err)
+	}
+
+	is, err := s.verifiedPairing(ctx, p.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := byte(PermissionUser); is.Permission != want {
+		t.Fatalf("%v != %v", is.Permission, want)
+	}
+}
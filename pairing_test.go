@@ -0,0 +1,273 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/tlv8"
+
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemovePairing(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+	s.st.SavePairing(Pairing{Name: "user", Permission: PermissionUser})
+
+	var removed []string
+	s.PairingRemovedFunc = func(p Pairing) {
+		removed = append(removed, p.Name)
+	}
+
+	if err := s.RemovePairing("user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(s.Pairings()), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := s.RemovePairing("user"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	s.st.SavePairing(Pairing{Name: "user", Permission: PermissionUser})
+
+	// Removing the last admin removes all pairings.
+	if err := s.RemovePairing("admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.IsPaired(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(removed), 3; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestUnpair(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+
+	if err := s.Unpair(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.IsPaired(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestPairingCallbacks(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var added []string
+	var paired, unpaired int
+	s.PairingAddedFunc = func(p Pairing) {
+		added = append(added, p.Name)
+	}
+	s.PairedFunc = func() {
+		paired++
+	}
+	s.UnpairedFunc = func() {
+		unpaired++
+	}
+
+	ctx := context.Background()
+	s.savePairing(ctx, Pairing{Name: "admin", Permission: PermissionAdmin})
+	s.savePairing(ctx, Pairing{Name: "user", Permission: PermissionUser})
+
+	if is, want := len(added), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := s.Unpair(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := paired, 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := unpaired, 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestAllowAddPairing(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := Pairing{Name: "admin", Permission: PermissionAdmin}
+	s.st.SavePairing(admin)
+
+	var by Pairing
+	s.AllowAddPairing = func(p Pairing, b Pairing) bool {
+		by = b
+		return false
+	}
+
+	b, err := tlv8.Marshal(struct {
+		Method     byte   `tlv8:"0"`
+		Identifier string `tlv8:"1"`
+		PublicKey  []byte `tlv8:"3"`
+		State      byte   `tlv8:"6"`
+		Permission byte   `tlv8:"11"`
+	}{MethodAddPairing, "user", []byte{0x1}, M1, PermissionUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/pairings", bytes.NewReader(b))
+	w := httptest.NewRecorder()
+	s.setSession(reqConn(req), &session{Pairing: admin})
+	s.pairings(w, req)
+
+	resp := struct {
+		State  byte `tlv8:"6"`
+		Status byte `tlv8:"7"`
+	}{}
+	if err := tlv8.UnmarshalReader(w.Result().Body, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := resp.Status, byte(TlvErrorUnavailable); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := by.Name, admin.Name; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(s.Pairings()), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestRotateIdentity(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	st := NewMemStore()
+	s, err := NewServer(st, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	uuid, key := s.uuid, s.Key
+	s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+
+	if err := s.RotateIdentity(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.uuid == uuid || bytes.Equal(s.Key.Public, key.Public) {
+		t.Fatal("identity not changed")
+	}
+
+	if is, want := s.IsPaired(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The new identity is used after a restart.
+	uuid, key = s.uuid, s.Key
+	s, err = NewServer(st, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.uuid, uuid; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := s.Key.Public, key.Public; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestRotateIdentityReadOnly(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	st := NewMemStore()
+	s, err := NewServer(st, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.prepare()
+	s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+
+	s, err = NewServer(ReadOnlyStore(st), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.prepare()
+	uuid := s.uuid
+
+	if err := s.RotateIdentity(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if is, want := s.uuid, uuid; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := s.IsPaired(), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestRotateIdentityConcurrent(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.prepare()
+
+	private := s.Key.Private
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			s.identity()
+			s.sign([]byte("data"))
+			s.txtRecords()
+		}
+	}()
+
+	if err := s.RotateIdentity(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	// The previous private key is zeroed.
+	if !allZero(private) {
+		t.Fatal("private key not zeroed")
+	}
+}
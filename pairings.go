@@ -1,11 +1,10 @@
 package hap
 
 import (
-	"github.com/brutella/hap/log"
 	"github.com/brutella/hap/tlv8"
 
+	"crypto/subtle"
 	"net/http"
-	"reflect"
 )
 
 type pairingPayload struct {
@@ -16,14 +15,15 @@ type pairingPayload struct {
 
 func (srv *Server) pairings(res http.ResponseWriter, req *http.Request) {
 	if !srv.IsAuthorized(req) {
-		log.Info.Printf("request from %s not authorized\n", req.RemoteAddr)
+		srv.logInfo(req).Printf("request from %s not authorized\n", req.RemoteAddr)
+		srv.authFailed(req, "", "pairings: request not verified")
 		JsonError(res, JsonStatusInsufficientPrivileges)
 		return
 	}
 
-	ss, err := srv.getSession(req.RemoteAddr)
+	ss, err := srv.getSession(reqConn(req))
 	if err != nil {
-		log.Info.Println(err)
+		srv.logInfo(req).Println(err)
 		res.WriteHeader(http.StatusInternalServerError)
 		tlv8Error(res, M2, TlvErrorUnknown)
 		return
@@ -31,30 +31,40 @@ func (srv *Server) pairings(res http.ResponseWriter, req *http.Request) {
 
 	d := struct {
 		Method     byte   `tlv8:"0"`
-		Identifier string `tlv8:"1"`
+		Identifier string `tlv8:"1,optional"`
 		PublicKey  []byte `tlv8:"3,optional"`
 		Permission byte   `tlv8:"11,optional"`
 		State      byte   `tlv8:"6"`
 	}{}
 
 	if err := tlv8.UnmarshalReader(req.Body, &d); err != nil {
-		log.Info.Println("tlv8:", err)
+		srv.logInfo(req).Println("tlv8:", err)
 		res.WriteHeader(http.StatusBadRequest)
 		tlv8Error(res, M2, TlvErrorUnknown)
 		return
 	}
 
+	st := srv.storer(req.Context())
+
+	// Pairings cannot be added or removed in a read-only store.
+	if (d.Method == MethodAddPairing || d.Method == MethodDeletePairing) && srv.st.readOnly() {
+		srv.logInfo(req).Println("changing pairings is not allowed with a read-only store")
+		tlv8Error(res, M2, TlvErrorUnavailable)
+		return
+	}
+
 	switch d.Method {
 	case MethodAddPairing:
-		log.Debug.Println("add pairing", d.Identifier)
+		srv.logDebug(req).Println("add pairing", d.Identifier)
 
 		if ss.Pairing.Permission != PermissionAdmin {
-			log.Info.Println("operation not allowed for non-admin controllers")
+			srv.logInfo(req).Println("operation not allowed for non-admin controllers")
+			srv.authFailed(req, ss.Pairing.Name, "admin permission required")
 			tlv8Error(res, M2, TlvErrorAuthentication)
 			return
 		}
 
-		p, err := srv.st.Pairing(d.Identifier)
+		p, err := st.Pairing(d.Identifier)
 		if err != nil {
 			p = Pairing{
 				Name:       d.Identifier,
@@ -62,8 +72,8 @@ func (srv *Server) pairings(res http.ResponseWriter, req *http.Request) {
 				Permission: d.Permission,
 			}
 		} else {
-			if !reflect.DeepEqual(p.PublicKey, d.PublicKey) {
-				log.Info.Println("invalid public key")
+			if subtle.ConstantTimeCompare(p.PublicKey, d.PublicKey) != 1 {
+				srv.logInfo(req).Println("invalid public key")
 				tlv8Error(res, M2, TlvErrorUnknown)
 				return
 			}
@@ -71,9 +81,15 @@ func (srv *Server) pairings(res http.ResponseWriter, req *http.Request) {
 			p.Permission = d.Permission
 		}
 
-		err = srv.savePairing(p)
+		if srv.AllowAddPairing != nil && !srv.AllowAddPairing(p, ss.Pairing) {
+			srv.logInfo(req).Printf("adding pairing %s not allowed\n", p.Name)
+			tlv8Error(res, M2, TlvErrorUnavailable)
+			return
+		}
+
+		err = srv.savePairing(req.Context(), p)
 		if err != nil {
-			log.Info.Println(err)
+			srv.logInfo(req).Println(err)
 			tlv8Error(res, M2, TlvErrorUnknown)
 			return
 		}
@@ -86,23 +102,24 @@ func (srv *Server) pairings(res http.ResponseWriter, req *http.Request) {
 		tlv8OK(res, resp)
 
 	case MethodDeletePairing:
-		log.Debug.Println("delete pairing", d.Identifier)
+		srv.logDebug(req).Println("delete pairing", d.Identifier)
 
 		if ss.Pairing.Permission != PermissionAdmin {
-			log.Info.Println("operation not allowed for non-admin controllers")
+			srv.logInfo(req).Println("operation not allowed for non-admin controllers")
+			srv.authFailed(req, ss.Pairing.Name, "admin permission required")
 			tlv8Error(res, M2, TlvErrorAuthentication)
 			return
 		}
 
-		p, err := srv.st.Pairing(d.Identifier)
+		p, err := st.Pairing(d.Identifier)
 		if err != nil {
-			log.Info.Println(err)
+			srv.logInfo(req).Println(err)
 			tlv8Error(res, M2, TlvErrorUnknown)
 			return
 		}
 
-		if err = srv.deletePairing(p); err != nil {
-			log.Info.Println(err)
+		if err = srv.deletePairing(req.Context(), p); err != nil {
+			srv.logInfo(req).Println(err)
 			tlv8Error(res, M2, TlvErrorUnknown)
 			return
 		}
@@ -116,30 +133,17 @@ func (srv *Server) pairings(res http.ResponseWriter, req *http.Request) {
 
 		// If no admin controller is paired anymore,
 		// close all connections and delete all pairings
-		if !srv.pairedWithAdmin() {
-			for addr, conn := range conns() {
-				log.Debug.Println("Closing connection to", addr)
-				conn.Close()
-			}
-			srv.deleteAllPairings()
+		if !srv.pairedWithAdmin(req.Context()) {
+			srv.closeAllConnections()
+			srv.deleteAllPairings("no admin pairing left")
 		}
 
 		// Close connection of deleted controller
-		for addr, conn := range conns() {
-			ss, err := srv.getSession(addr)
-			if err != nil {
-				log.Debug.Println("no session for", addr, err)
-				continue
-			}
-			if ss.Pairing.Name == p.Name {
-				log.Debug.Println("closing connection of removed controller", d.Identifier)
-				conn.Close()
-			}
-		}
+		srv.closeConnections(p.Name)
 
 	case MethodListPairings:
-		log.Debug.Println("list pairings")
-		ps := srv.st.Pairings()
+		srv.logDebug(req).Println("list pairings")
+		ps := st.Pairings()
 		resp := make([]pairingPayload, len(ps))
 		for i, p := range ps {
 			resp[i] = pairingPayload{
@@ -0,0 +1,81 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
+
+	"encoding/json"
+	"fmt"
+)
+
+// keyForValue returns the store key for the value of a characteristic.
+func keyForValue(aid, iid uint64) string {
+	return fmt.Sprintf("%d.%d.value", aid, iid)
+}
+
+// isPersistent returns true if the value of c is persisted
+// when the server option PersistValues is enabled.
+func isPersistent(c *characteristic.C) bool {
+	return c.IsWritable() && c.IsReadable() && c.Type != characteristic.TypeIdentify
+}
+
+// saveValue stores the value of c.
+func (s *Server) saveValue(a *accessory.A, c *characteristic.C) error {
+	b, err := json.Marshal(c.Value())
+	if err != nil {
+		return err
+	}
+
+	return s.st.Set(keyForValue(a.Id, c.Id), b)
+}
+
+// restoreValues sets the values of the characteristics
+// to the values which were persisted before.
+func (s *Server) restoreValues() {
+	for _, a := range s.accessories() {
+		for _, svc := range a.Ss {
+			for _, c := range svc.Cs {
+				if !isPersistent(c) {
+					continue
+				}
+
+				b, err := s.st.Get(keyForValue(a.Id, c.Id))
+				if err != nil {
+					continue
+				}
+
+				var v interface{}
+				if err := json.Unmarshal(b, &v); err != nil {
+					log.Info.Printf("restoring value of %d.%d failed: %v\n", a.Id, c.Id, err)
+					continue
+				}
+
+				// The value is converted to the format of
+				// the characteristic and clamped if needed.
+				if _, code := c.SetValueRequest(v, nil); code != 0 {
+					log.Info.Printf("restoring value of %d.%d failed: %d\n", a.Id, c.Id, code)
+				}
+			}
+		}
+	}
+}
+
+// saveValues saves the values of all persistent characteristics.
+func (s *Server) saveValues() error {
+	for _, a := range s.accessories() {
+		for _, svc := range a.Ss {
+			for _, c := range svc.Cs {
+				if !isPersistent(c) {
+					continue
+				}
+
+				if err := s.saveValue(a, c); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
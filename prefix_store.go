@@ -0,0 +1,53 @@
+package hap
+
+import (
+	"strings"
+)
+
+type prefixStore struct {
+	Store
+	prefix string
+}
+
+// PrefixStore returns a store which prepends prefix to every key
+// before delegating to st. This lets multiple servers share the
+// same store without key collisions.
+//
+//	s1, _ := hap.NewServer(hap.PrefixStore(st, "livingroom/"), a1)
+//	s2, _ := hap.NewServer(hap.PrefixStore(st, "kitchen/"), a2)
+//
+// If servers share a store, every server should use a prefix.
+// Otherwise a server without prefix sees the pairings of the
+// other servers.
+func PrefixStore(st Store, prefix string) Store {
+	return &prefixStore{st, prefix}
+}
+
+func (ps *prefixStore) Set(key string, value []byte) error {
+	return ps.Store.Set(ps.prefix+key, value)
+}
+
+func (ps *prefixStore) Get(key string) ([]byte, error) {
+	return ps.Store.Get(ps.prefix + key)
+}
+
+func (ps *prefixStore) Delete(key string) error {
+	return ps.Store.Delete(ps.prefix + key)
+}
+
+// KeysWithSuffix returns the keys (without prefix) with the given suffix.
+func (ps *prefixStore) KeysWithSuffix(suffix string) ([]string, error) {
+	ks, err := ps.Store.KeysWithSuffix(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, k := range ks {
+		if strings.HasPrefix(k, ps.prefix) {
+			keys = append(keys, strings.TrimPrefix(k, ps.prefix))
+		}
+	}
+
+	return keys, nil
+}
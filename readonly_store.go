@@ -0,0 +1,48 @@
+package hap
+
+import (
+	"errors"
+)
+
+// ErrReadOnly is returned when writing to a read-only store.
+var ErrReadOnly = errors.New("store is read-only")
+
+// A ReadOnlier is a Store which can be read-only.
+type ReadOnlier interface {
+	// ReadOnly returns true if the store rejects writes.
+	ReadOnly() bool
+}
+
+type readOnlyStore struct {
+	Store
+}
+
+// ReadOnlyStore returns a store which rejects all writes with ErrReadOnly.
+// Use it for immutable deployments (e.g. a store baked into a container
+// image or a factory-provisioned device). The store must already contain
+// the identity (uuid and keypair) of the accessory. Pairing and unpairing
+// controllers is rejected while established pairings keep working.
+func ReadOnlyStore(st Store) Store {
+	return &readOnlyStore{st}
+}
+
+func (ro *readOnlyStore) Set(key string, value []byte) error {
+	return ErrReadOnly
+}
+
+func (ro *readOnlyStore) Delete(key string) error {
+	return ErrReadOnly
+}
+
+func (ro *readOnlyStore) ReadOnly() bool {
+	return true
+}
+
+// readOnly returns true if the store is read-only.
+func (st *storer) readOnly() bool {
+	if ro, ok := st.Store.(ReadOnlier); ok {
+		return ro.ReadOnly()
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/tlv8"
+
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadOnlyStore(t *testing.T) {
+	st := NewMemStore()
+	a := accessory.NewLightbulb(accessory.Info{Name: "ABC"})
+	if _, err := NewServer(st, a.A); err != nil {
+		t.Fatal(err)
+	}
+
+	ro := ReadOnlyStore(st)
+	if is, want := ro.Set("key", []byte("value")), ErrReadOnly; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s, err := NewServer(ro, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := tlv8.Marshal(pairSetupPayload{Method: MethodPair, State: M1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/pair-setup", bytes.NewReader(b))
+	w := httptest.NewRecorder()
+	s.pairSetup(w, req)
+
+	resp := struct {
+		State  byte `tlv8:"6"`
+		Status byte `tlv8:"7"`
+	}{}
+	if err := tlv8.UnmarshalReader(w.Result().Body, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := resp.Status, byte(TlvErrorUnavailable); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestReadOnlyStoreWithoutIdentity(t *testing.T) {
+	a := accessory.NewLightbulb(accessory.Info{Name: "ABC"})
+	if _, err := NewServer(ReadOnlyStore(NewMemStore()), a.A); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,141 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// AccessoryConfig is the configuration of an accessory
+// which is created by a registered AccessoryFactory.
+type AccessoryConfig struct {
+	// Type is the name under which the factory is registered.
+	Type string `json:"type"`
+
+	// Id is the accessory id. If zero, the server assigns an id.
+	Id uint64 `json:"id,omitempty"`
+
+	// Info contains the accessory information.
+	Info accessory.Info `json:"info"`
+
+	// Config is the factory specific configuration.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// An AccessoryFactory creates an accessory from a configuration.
+type AccessoryFactory func(cfg AccessoryConfig) (*accessory.A, error)
+
+// An AccessoryRegistry maps accessory type names to factories.
+// It is safe for concurrent use, which lets plugins register
+// their factories from init functions.
+type AccessoryRegistry struct {
+	fs map[string]AccessoryFactory
+	mu sync.RWMutex
+}
+
+// NewAccessoryRegistry returns an empty registry.
+func NewAccessoryRegistry() *AccessoryRegistry {
+	return &AccessoryRegistry{
+		fs: map[string]AccessoryFactory{},
+	}
+}
+
+// DefaultAccessoryRegistry is the registry used by RegisterAccessory.
+var DefaultAccessoryRegistry = NewAccessoryRegistry()
+
+// RegisterAccessory registers a factory for the type name
+// in the DefaultAccessoryRegistry.
+func RegisterAccessory(name string, f AccessoryFactory) error {
+	return DefaultAccessoryRegistry.Register(name, f)
+}
+
+func init() {
+	DefaultAccessoryRegistry.Register("bridge", func(cfg AccessoryConfig) (*accessory.A, error) {
+		return accessory.NewBridge(cfg.Info).A, nil
+	})
+}
+
+// Register registers the factory f for the type name.
+// An error is returned if a factory is already registered
+// for the same name.
+func (r *AccessoryRegistry) Register(name string, f AccessoryFactory) error {
+	if name == "" || f == nil {
+		return fmt.Errorf("invalid accessory factory %q", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.fs[name]; ok {
+		return fmt.Errorf("accessory factory %q already registered", name)
+	}
+	r.fs[name] = f
+
+	return nil
+}
+
+// Types returns the sorted names of the registered factories.
+func (r *AccessoryRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.fs))
+	for name := range r.fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New returns a new accessory created by the factory for cfg.Type.
+func (r *AccessoryRegistry) New(cfg AccessoryConfig) (*accessory.A, error) {
+	r.mu.RLock()
+	f, ok := r.fs[cfg.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown accessory type %q", cfg.Type)
+	}
+
+	a, err := f(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", cfg.Type, err)
+	}
+
+	if a == nil {
+		return nil, fmt.Errorf("%s: factory returned no accessory", cfg.Type)
+	}
+
+	if cfg.Id != 0 {
+		a.Id = cfg.Id
+	}
+
+	return a, nil
+}
+
+// NewServerFromConfig returns a new server whose accessories are created
+// by the factories in r. The first config describes the main accessory.
+// If r is nil, the DefaultAccessoryRegistry is used.
+func NewServerFromConfig(store Store, r *AccessoryRegistry, cfg AccessoryConfig, cfgs ...AccessoryConfig) (*Server, error) {
+	if r == nil {
+		r = DefaultAccessoryRegistry
+	}
+
+	a, err := r.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	as := make([]*accessory.A, len(cfgs))
+	for i, cfg := range cfgs {
+		if as[i], err = r.New(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewServer(store, a, as...)
+}
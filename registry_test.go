@@ -0,0 +1,45 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"reflect"
+	"testing"
+)
+
+func TestAccessoryRegistry(t *testing.T) {
+	r := NewAccessoryRegistry()
+	r.Register("bridge", func(cfg AccessoryConfig) (*accessory.A, error) {
+		return accessory.NewBridge(cfg.Info).A, nil
+	})
+	err := r.Register("outlet", func(cfg AccessoryConfig) (*accessory.A, error) {
+		return accessory.NewOutlet(cfg.Info).A, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Register("outlet", nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if is, want := r.Types(), []string{"bridge", "outlet"}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s, err := NewServerFromConfig(NewMemStore(), r,
+		AccessoryConfig{Type: "bridge", Info: accessory.Info{Name: "Bridge"}},
+		AccessoryConfig{Type: "outlet", Id: 5, Info: accessory.Info{Name: "Outlet"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.as[0].Id, uint64(5); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := r.New(AccessoryConfig{Type: "unknown"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
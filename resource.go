@@ -0,0 +1,77 @@
+package hap
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// resourceTypeImage is the resource type of a snapshot request.
+const resourceTypeImage = "image"
+
+// Reasons of snapshot requests
+const (
+	SnapshotReasonUnknown  = -1 // sent by older controllers
+	SnapshotReasonPeriodic = 0
+	SnapshotReasonEvent    = 1
+)
+
+type resourceRequest struct {
+	Type   string `json:"resource-type"`
+	Aid    uint64 `json:"aid,omitempty"`
+	Width  int    `json:"image-width"`
+	Height int    `json:"image-height"`
+	Reason *int   `json:"reason,omitempty"`
+}
+
+// resource returns a snapshot image of a camera.
+func (srv *Server) resource(res http.ResponseWriter, req *http.Request) {
+	if !srv.IsAuthorized(req) {
+		srv.logInfo(req).Printf("request from %s not authorized\n", req.RemoteAddr)
+		srv.resourceError(res, JsonStatusInsufficientPrivileges)
+		return
+	}
+
+	var r resourceRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		srv.resourceError(res, JsonStatusInvalidValueInRequest)
+		return
+	}
+
+	srv.logDebug(req).Println(toJSON(r))
+
+	if r.Type != resourceTypeImage || r.Width <= 0 || r.Height <= 0 {
+		srv.resourceError(res, JsonStatusInvalidValueInRequest)
+		return
+	}
+
+	if srv.SnapshotFunc == nil {
+		srv.resourceError(res, JsonStatusResourceDoesNotExist)
+		return
+	}
+
+	reason := SnapshotReasonUnknown
+	if r.Reason != nil {
+		reason = *r.Reason
+	}
+
+	if srv.SnapshotAllowedFunc != nil && !srv.SnapshotAllowedFunc(reason) {
+		srv.resourceError(res, JsonStatusNotAllowedInCurrentState)
+		return
+	}
+
+	b, err := srv.SnapshotFunc(r.Width, r.Height)
+	if err != nil {
+		srv.logInfo(req).Println("snapshot:", err)
+		srv.resourceError(res, JsonStatusServiceCommunicationFailure)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	wr := NewChunkedWriter(res, 2048)
+	wr.Write(b)
+}
+
+func (srv *Server) resourceError(res http.ResponseWriter, status int) {
+	res.Header().Set("Content-Type", HTTPContentTypeHAPJson)
+	JsonError(res, status)
+}
@@ -0,0 +1,111 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResourceSnapshot(t *testing.T) {
+	a := accessory.NewCamera(accessory.Info{Name: "Camera"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	var width, height int
+	s.SnapshotFunc = func(w, h int) ([]byte, error) {
+		width, height = w, h
+		return jpeg, nil
+	}
+
+	body := `{"resource-type":"image","image-width":640,"image-height":360}`
+	req := httptest.NewRequest(http.MethodPost, "/resource", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Code, http.StatusOK; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := w.Header().Get("Content-Type"), HTTPContentTypeImageJPEG; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := w.Body.Bytes(), jpeg; !bytes.Equal(is, want) {
+		t.Fatalf("%X != %X", is, want)
+	}
+
+	if width != 640 || height != 360 {
+		t.Fatalf("%dx%d != 640x360", width, height)
+	}
+}
+
+func TestResourceNotAuthorized(t *testing.T) {
+	a := accessory.NewCamera(accessory.Info{Name: "Camera"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SnapshotFunc = func(w, h int) ([]byte, error) {
+		t.Fatal("snapshot of unauthorized request")
+		return nil, nil
+	}
+
+	body := `{"resource-type":"image","image-width":640,"image-height":360}`
+	req := httptest.NewRequest(http.MethodPost, "/resource", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Code, http.StatusBadRequest; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := w.Header().Get("Content-Type"), HTTPContentTypeHAPJson; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestResourceSnapshotNotAllowed(t *testing.T) {
+	a := accessory.NewCamera(accessory.Info{Name: "Camera"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SnapshotFunc = func(w, h int) ([]byte, error) {
+		t.Fatal("snapshot not allowed")
+		return nil, nil
+	}
+
+	var reason int
+	s.SnapshotAllowedFunc = func(r int) bool {
+		reason = r
+		return false
+	}
+
+	body := `{"resource-type":"image","image-width":640,"image-height":360,"reason":1}`
+	req := httptest.NewRequest(http.MethodPost, "/resource", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Code, http.StatusBadRequest; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := reason, SnapshotReasonEvent; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
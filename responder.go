@@ -0,0 +1,259 @@
+package hap
+
+import (
+	"github.com/brutella/dnssd"
+	"github.com/brutella/hap/log"
+
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// A Responder announces the accessory as DNS-SD service on the
+// local network. The default responder is a built-in mDNS responder
+// (github.com/brutella/dnssd). On Linux systems running avahi-daemon,
+// the responder of the package avahi should be used instead.
+type Responder interface {
+	// Announce announces the service. It returns once the
+	// service is registered; the service is announced until
+	// Withdraw is called.
+	Announce(s DNSSDService) error
+
+	// UpdateText updates the txt records of the announced service.
+	UpdateText(txt map[string]string) error
+
+	// Withdraw removes the announced service from the network.
+	Withdraw() error
+}
+
+// A ResponderChecker is a responder, which can check whether it is able
+// to announce services without announcing one. SelfTest calls Check.
+type ResponderChecker interface {
+	Check() error
+}
+
+// DNSSDService describes the DNS-SD service of an accessory.
+type DNSSDService struct {
+	Name   string
+	Type   string // e.g. "_hap._tcp"
+	Domain string // e.g. "local"
+	Host   string // host name without domain
+	Text   map[string]string
+	Port   int
+
+	// IPs and Ifaces restrict the announced addresses and
+	// network interfaces. If empty, all are announced.
+	IPs    []net.IP
+	Ifaces []string
+}
+
+// dnssdResponder is the default responder.
+type dnssdResponder struct {
+	mu     sync.Mutex
+	resp   dnssd.Responder
+	handle dnssd.ServiceHandle
+	text   map[string]string
+	cancel context.CancelFunc
+	done   chan struct{}
+	fn     func(AdvertisementEvent)
+}
+
+func newDNSSDResponder() *dnssdResponder {
+	return &dnssdResponder{}
+}
+
+// Announce probes and announces the service in the background.
+func (r *dnssdResponder) Announce(s DNSSDService) error {
+	resp, err := dnssd.NewResponder()
+	if err != nil {
+		return fmt.Errorf("dnssd: %s", err)
+	}
+
+	service, err := dnssd.NewService(dnssd.Config{
+		Name:   s.Name,
+		Type:   s.Type,
+		Domain: s.Domain,
+		Host:   s.Host,
+		Text:   s.Text,
+		Port:   s.Port,
+		IPs:    s.IPs,
+		Ifaces: s.Ifaces,
+	})
+	if err != nil {
+		return fmt.Errorf("dnssd: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	r.mu.Lock()
+	r.resp, r.handle, r.text, r.cancel, r.done = resp, nil, s.Text, cancel, done
+	r.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		if err := r.respond(ctx, resp, service); err != nil && ctx.Err() == nil {
+			r.notify(AdvertisementEvent{State: AdvertisementFailed, Err: fmt.Errorf("dnssd: %s", err)})
+		}
+		log.Debug.Println("dnssd responder stopped")
+	}()
+
+	return nil
+}
+
+func (r *dnssdResponder) respond(ctx context.Context, resp dnssd.Responder, service dnssd.Service) error {
+	// The service is probed before it is added to the responder,
+	// to find out whether it is renamed because of a name conflict.
+	probed, err := dnssd.ProbeService(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	if probed.Name != service.Name {
+		r.notify(AdvertisementEvent{State: AdvertisementRenamed, Name: probed.Name})
+	}
+
+	r.mu.Lock()
+	if r.resp != resp {
+		// withdrawn in the meantime
+		r.mu.Unlock()
+		return nil
+	}
+	probed.Text = r.text
+	h, err := resp.Add(probed)
+	r.handle = h
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return resp.Respond(ctx)
+}
+
+// Check opens and closes the multicast sockets.
+func (r *dnssdResponder) Check() error {
+	conn, err := dnssd.NewMDNSConn()
+	if err != nil {
+		return fmt.Errorf("dnssd: %s", err)
+	}
+	conn.Close()
+
+	return nil
+}
+
+// Notify sets the function, which is called when the
+// service is renamed or the responder fails.
+func (r *dnssdResponder) Notify(fn func(AdvertisementEvent)) {
+	r.mu.Lock()
+	r.fn = fn
+	r.mu.Unlock()
+}
+
+func (r *dnssdResponder) notify(e AdvertisementEvent) {
+	r.mu.Lock()
+	fn := r.fn
+	r.mu.Unlock()
+
+	if fn != nil {
+		fn(e)
+	}
+}
+
+func (r *dnssdResponder) UpdateText(txt map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.text = txt
+	if r.handle != nil {
+		r.handle.UpdateText(txt, r.resp)
+	}
+
+	return nil
+}
+
+// Withdraw stops the responder, which unannounces the service.
+func (r *dnssdResponder) Withdraw() error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.resp, r.handle, r.text, r.cancel, r.done = nil, nil, nil, nil, nil
+	r.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	return nil
+}
+
+// NewMulticastResponder returns the built-in mDNS responder,
+// which is used by default.
+func NewMulticastResponder() Responder {
+	return newDNSSDResponder()
+}
+
+// Responders returns a responder, which announces the service with
+// all responders; e.g. via multicast and a unicast DNS server.
+func Responders(rs ...Responder) Responder {
+	return multiResponder(rs)
+}
+
+type multiResponder []Responder
+
+func (rs multiResponder) Announce(s DNSSDService) error {
+	for _, r := range rs {
+		if err := r.Announce(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rs multiResponder) UpdateText(txt map[string]string) error {
+	for _, r := range rs {
+		if err := r.UpdateText(txt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Withdraw withdraws the service from all responders
+// and returns the first error.
+func (rs multiResponder) Withdraw() error {
+	var err error
+	for _, r := range rs {
+		if e := r.Withdraw(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Notify forwards the function to the responders,
+// which implement AdvertisementNotifier.
+func (rs multiResponder) Notify(fn func(AdvertisementEvent)) {
+	for _, r := range rs {
+		if n, ok := r.(AdvertisementNotifier); ok {
+			n.Notify(fn)
+		}
+	}
+}
+
+// Check checks the responders, which implement ResponderChecker.
+func (rs multiResponder) Check() error {
+	for _, r := range rs {
+		if c, ok := r.(ResponderChecker); ok {
+			if err := c.Check(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testResponder struct {
+	mu        sync.Mutex
+	announced *DNSSDService
+	texts     []map[string]string
+	withdrawn bool
+}
+
+func (r *testResponder) Announce(s DNSSDService) error {
+	r.mu.Lock()
+	r.announced = &s
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *testResponder) UpdateText(txt map[string]string) error {
+	r.mu.Lock()
+	r.texts = append(r.texts, txt)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *testResponder) Withdraw() error {
+	r.mu.Lock()
+	r.withdrawn = true
+	r.mu.Unlock()
+	return nil
+}
+
+func TestCustomResponder(t *testing.T) {
+	r := &testResponder{}
+	a := accessory.New(accessory.Info{Name: "My Outlet"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), WithAddr("127.0.0.1:0"), WithResponder(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ListenAndServe(context.Background())
+	}()
+	waitRunning(t, s)
+
+	r.mu.Lock()
+	announced := r.announced
+	r.mu.Unlock()
+
+	if announced == nil {
+		t.Fatal("service not announced")
+	}
+
+	if is, want := announced.Type, "_hap._tcp"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := announced.Port, s.port; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	v, err := s.IncrementConfigurationNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.mu.Lock()
+	texts := r.texts
+	r.mu.Unlock()
+
+	if is, want := len(texts), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := texts[0]["c#"], strconv.Itoa(int(v)); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-errs
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.withdrawn {
+		t.Fatal("service not withdrawn")
+	}
+}
+
+func TestUpdateAdvertisement(t *testing.T) {
+	r := &testResponder{}
+	a := accessory.New(accessory.Info{Name: "Outlet"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), WithAddr("127.0.0.1:0"), WithResponder(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ListenAndServe(ctx)
+	waitRunning(t, s)
+
+	// unchanged txt records are not republished
+	if err := s.UpdateAdvertisement(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.mu.Lock()
+	if is, want := len(r.texts), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	r.mu.Unlock()
+
+	sh := s.setupHash()
+	s.SetupId = "ABCD"
+	if err := s.UpdateAdvertisement(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.mu.Lock()
+	if is, want := len(r.texts), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if r.texts[0]["sh"] == sh {
+		t.Fatal("setup hash not updated")
+	}
+	r.mu.Unlock()
+
+	a.Info.Name.SetValue("Kitchen Outlet")
+	if err := s.UpdateAdvertisement(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if is, want := r.announced.Name, "Kitchen_Outlet"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestResponders(t *testing.T) {
+	r1, r2 := &testResponder{}, &testResponder{}
+	r := Responders(r1, r2)
+
+	if err := r.Announce(DNSSDService{Name: "Outlet"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.UpdateText(map[string]string{"c#": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Withdraw(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []*testResponder{r1, r2} {
+		if r.announced == nil || len(r.texts) != 1 || !r.withdrawn {
+			t.Fatal("service not announced, updated and withdrawn")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package hap
+
+import (
+	"github.com/go-chi/chi/middleware"
+
+	"net/http"
+)
+
+// A Router routes http requests to handlers.
+// By default the server uses a chi router. You can use
+// your own router (e.g. gorilla/mux) by implementing
+// this interface and calling Server.SetRouter.
+type Router interface {
+	http.Handler
+
+	// Method registers the handler for the http method and pattern.
+	Method(method, pattern string, handler http.Handler)
+}
+
+type route struct {
+	method      string
+	pattern     string
+	contentType string
+	handler     http.HandlerFunc
+}
+
+// routes returns the routes required by the HomeKit Accessory Protocol.
+func (s *Server) routes() []route {
+	return []route{
+		// tlv8 encoded content
+		{http.MethodPost, "/pair-setup", HTTPContentTypePairingTLV8, s.pairSetup},
+		{http.MethodPost, "/pair-verify", HTTPContentTypePairingTLV8, s.pairVerify},
+		{http.MethodPost, "/identify", HTTPContentTypePairingTLV8, s.identify},
+		{http.MethodPost, "/pairings", HTTPContentTypePairingTLV8, s.pairings},
+
+		// The json encoded content is encrypted. The encryption keys
+		// are stored in a session. The de-/encryption is done by a Conn.
+		{http.MethodGet, "/accessories", HTTPContentTypeHAPJson, s.getAccessories},
+		{http.MethodGet, "/characteristics", HTTPContentTypeHAPJson, s.getCharacteristics},
+		{http.MethodPut, "/characteristics", HTTPContentTypeHAPJson, s.putCharacteristics},
+		{http.MethodPut, "/prepare", HTTPContentTypeHAPJson, s.prepareCharacteristics},
+		{http.MethodPost, "/resource", HTTPContentTypeImageJPEG, s.resource},
+	}
+}
+
+// register registers the HomeKit Accessory Protocol routes at r.
+func (s *Server) register(r Router) {
+	for _, rt := range s.routes() {
+		var h http.Handler = rt.handler
+		if rt.contentType == HTTPContentTypePairingTLV8 {
+			h = s.fragmented(h)
+		}
+		h = middleware.SetHeader("Content-Type", rt.contentType)(h)
+		h = s.middlewares(h)
+		h = s.limitRequestSize(h)
+		h = s.withPairing(h)
+		h = s.metrics.handler(rt.pattern, h)
+		r.Method(rt.method, rt.pattern, h)
+	}
+}
+
+// SetRouter makes the server use r to route http requests.
+// The routes required by the HomeKit Accessory Protocol are
+// registered at r. Any other routes and middlewares are
+// up to you. SetRouter must be called before ListenAndServe.
+func (s *Server) SetRouter(r Router) {
+	s.register(r)
+	s.ss.Handler = r
+}
@@ -0,0 +1,69 @@
+package rtp
+
+import (
+	"encoding/binary"
+)
+
+// aacEldFrameSamples is the number of samples of an AAC-ELD frame.
+const aacEldFrameSamples = 480
+
+// AudioSender packetizes AAC-ELD frames (RFC 3640, mode AAC-hbr)
+// and sends them as srtp packets to the controller of a session.
+type AudioSender struct {
+	s  *sender
+	ts uint32
+}
+
+// NewAudioSender returns a sender for the audio stream of the session.
+// The stream must be started (s.Config is set).
+func NewAudioSender(s *Session) (*AudioSender, error) {
+	params := s.Config.Audio.RTP
+	params.Ssrc = s.AudioSsrc
+	snd, err := newSender(s.AudioConn, s.ControllerAddr.IPAddr, s.ControllerAddr.AudioRtpPort, s.Audio, params, SampleRate(s.Config.Audio.CodecParams.Samplerate))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AudioSender{s: snd}, nil
+}
+
+// WriteFrame sends the raw AAC-ELD frame (without ADTS header).
+func (a *AudioSender) WriteFrame(frame []byte) error {
+	if err := a.s.send(packetizeAAC(frame), a.ts, true); err != nil {
+		return err
+	}
+
+	a.ts += aacEldFrameSamples
+
+	return nil
+}
+
+// Close stops sending rtcp sender reports.
+func (a *AudioSender) Close() {
+	a.s.close()
+}
+
+// packetizeAAC returns the rtp payload for the frame.
+// The payload has one access unit header with
+// a 13-bit size and a 3-bit index.
+func packetizeAAC(frame []byte) []byte {
+	p := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint16(p[0:2], 16) // length of the headers in bits
+	binary.BigEndian.PutUint16(p[2:4], uint16(len(frame)<<3))
+	copy(p[4:], frame)
+
+	return p
+}
+
+// SampleRate returns the sample rate in Hz of
+// the sample rate value (e.g. AudioCodecSampleRate16Khz).
+func SampleRate(v byte) uint32 {
+	switch v {
+	case AudioCodecSampleRate8Khz:
+		return 8000
+	case AudioCodecSampleRate24Khz:
+		return 24000
+	default:
+		return 16000
+	}
+}
@@ -0,0 +1,193 @@
+package rtp
+
+import (
+	"github.com/brutella/hap/log"
+
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+// FFmpegCommand is the name or path of the ffmpeg executable.
+var FFmpegCommand = "ffmpeg"
+
+// FFmpegVideoArgs returns the ffmpeg arguments to encode the input
+// with the video parameters to a H.264 Annex-B stream on stdout.
+func FFmpegVideoArgs(input []string, p VideoParameters) []string {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, input...)
+	args = append(args,
+		"-an",
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+		"-preset", "ultrafast",
+		"-tune", "zerolatency",
+	)
+
+	if ps := p.CodecParams.Profiles; len(ps) > 0 {
+		args = append(args, "-profile:v", h264Profile(ps[0].Id))
+	}
+
+	if ls := p.CodecParams.Levels; len(ls) > 0 {
+		args = append(args, "-level:v", h264Level(ls[0].Level))
+	}
+
+	if a := p.Attributes; a.Width > 0 && a.Height > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", a.Width, a.Height))
+	}
+
+	if fps := p.Attributes.Framerate; fps > 0 {
+		args = append(args, "-r", strconv.Itoa(int(fps)))
+	}
+
+	if br := p.RTP.Bitrate; br > 0 {
+		rate := fmt.Sprintf("%dk", br)
+		args = append(args, "-b:v", rate, "-maxrate", rate, "-bufsize", fmt.Sprintf("%dk", 2*int(br)))
+	}
+
+	return append(args, "-f", "h264", "-")
+}
+
+func h264Profile(id byte) string {
+	switch id {
+	case VideoCodecProfileMain:
+		return "main"
+	case VideoCodecProfileHigh:
+		return "high"
+	default:
+		return "baseline"
+	}
+}
+
+func h264Level(l byte) string {
+	switch l {
+	case VideoCodecLevel3_2:
+		return "3.2"
+	case VideoCodecLevel4:
+		return "4.0"
+	default:
+		return "3.1"
+	}
+}
+
+// Pipeline streams the video of an ffmpeg process to the controller
+// of a session. Audio frames can be sent with an AudioSender.
+type Pipeline struct {
+	Video *VideoSender
+
+	input []string
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+}
+
+// StartFFmpeg starts ffmpeg with the input arguments (e.g. "-f", "v4l2",
+// "-i", "/dev/video0") and streams the encoded video to the controller
+// of the session.
+func StartFFmpeg(s *Session, input ...string) (*Pipeline, error) {
+	v, err := NewVideoSender(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pipeline{Video: v, input: input}
+	if err := p.start(s.Config.Video); err != nil {
+		v.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Pipeline) start(params VideoParameters) error {
+	cmd := exec.Command(FFmpegCommand, FFmpegVideoArgs(p.input, params)...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	log.Debug.Println(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.mu.Unlock()
+
+	go func() {
+		if _, err := p.Video.ReadFrom(out); err != nil {
+			log.Debug.Println(err)
+		}
+		cmd.Wait()
+	}()
+
+	return nil
+}
+
+func (p *Pipeline) kill() {
+	p.mu.Lock()
+	cmd := p.cmd
+	p.cmd = nil
+	p.mu.Unlock()
+
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// Reconfigure restarts ffmpeg with the video parameters of the session.
+func (p *Pipeline) Reconfigure(s *Session) error {
+	p.kill()
+	return p.start(s.Config.Video)
+}
+
+// Close stops ffmpeg and the video sender.
+func (p *Pipeline) Close() {
+	p.kill()
+	p.Video.Close()
+}
+
+// UseFFmpeg sets the stream functions of m to stream
+// the video of ffmpeg with the input arguments.
+func (m *StreamManager) UseFFmpeg(input ...string) {
+	var mu sync.Mutex
+	ps := map[*Session]*Pipeline{}
+
+	m.StartStreamFunc = func(s *Session) error {
+		p, err := StartFFmpeg(s, input...)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		ps[s] = p
+		mu.Unlock()
+
+		return nil
+	}
+
+	m.StopStreamFunc = func(s *Session) {
+		mu.Lock()
+		p, ok := ps[s]
+		delete(ps, s)
+		mu.Unlock()
+
+		if ok {
+			p.Close()
+		}
+	}
+
+	m.ReconfigureStreamFunc = func(s *Session) error {
+		mu.Lock()
+		p, ok := ps[s]
+		mu.Unlock()
+
+		if !ok {
+			return fmt.Errorf("stream not running")
+		}
+
+		return p.Reconfigure(s)
+	}
+}
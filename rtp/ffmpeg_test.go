@@ -0,0 +1,24 @@
+package rtp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFFmpegVideoArgs(t *testing.T) {
+	p := VideoParameters{
+		CodecParams: VideoCodecParameters{
+			Profiles: []VideoCodecProfile{{VideoCodecProfileMain}},
+			Levels:   []VideoCodecLevel{{VideoCodecLevel4}},
+		},
+		Attributes: VideoCodecAttributes{1280, 720, 30},
+		RTP:        RTPParams{Bitrate: 299},
+	}
+
+	args := strings.Join(FFmpegVideoArgs([]string{"-i", "in.mp4"}, p), " ")
+	for _, want := range []string{"-i in.mp4", "-profile:v main", "-level:v 4.0", "-vf scale=1280:720", "-r 30", "-b:v 299k", "-f h264 -"} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("%s does not contain %s", args, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package rtp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	h264ClockRate = 90000
+
+	naluTypeIDR  = 5
+	naluTypeFUA  = 28
+	naluTypeMask = 0x1F
+
+	// defaultMTU is used if the controller doesn't specify a mtu.
+	defaultMTU = 1378
+
+	// maxNALUSize is the maximum size of a NAL unit
+	// read by VideoSender.ReadFrom.
+	maxNALUSize = 4 << 20
+)
+
+var annexBStartCode = []byte{0, 0, 1}
+
+// VideoSender packetizes H.264 NAL units (RFC 6184) and sends
+// them as srtp packets to the controller of a session.
+type VideoSender struct {
+	s   *sender
+	mtu int
+
+	mu    sync.Mutex
+	ts    uint32
+	newAU bool // true if the next NAL unit starts a new access unit
+}
+
+// NewVideoSender returns a sender for the video stream of the session.
+// The stream must be started (s.Config is set).
+func NewVideoSender(s *Session) (*VideoSender, error) {
+	params := s.Config.Video.RTP
+	params.Ssrc = s.VideoSsrc
+	snd, err := newSender(s.VideoConn, s.ControllerAddr.IPAddr, s.ControllerAddr.VideoRtpPort, s.Video, params, h264ClockRate)
+	if err != nil {
+		return nil, err
+	}
+
+	mtu := int(params.MTU)
+	if mtu == 0 {
+		mtu = defaultMTU
+	}
+
+	return &VideoSender{s: snd, mtu: mtu, newAU: true}, nil
+}
+
+// ReadFrom reads a H.264 Annex-B byte stream from r and sends
+// the NAL units until r returns an error or io.EOF.
+// The timestamps of the access units are taken from the wall clock,
+// which requires r to be a live source.
+func (v *VideoSender) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxNALUSize)
+	scanner.Split(splitAnnexB)
+	for scanner.Scan() {
+		nalu := scanner.Bytes()
+		n += int64(len(nalu))
+		if len(nalu) == 0 {
+			continue
+		}
+
+		if err := v.WriteNALU(nalu); err != nil {
+			return n, err
+		}
+	}
+
+	return n, scanner.Err()
+}
+
+// WriteNALU sends the NAL unit without start code.
+// A NAL unit with a coded slice ends an access unit.
+func (v *VideoSender) WriteNALU(nalu []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.newAU {
+		v.ts = v.s.timestamp(time.Now())
+		v.newAU = false
+	}
+
+	typ := nalu[0] & naluTypeMask
+	last := typ >= 1 && typ <= naluTypeIDR
+	ps := packetizeH264(nalu, v.mtu)
+	for i, p := range ps {
+		marker := last && i == len(ps)-1
+		if err := v.s.send(p, v.ts, marker); err != nil {
+			return err
+		}
+	}
+
+	v.newAU = last
+
+	return nil
+}
+
+// Close stops sending rtcp sender reports.
+func (v *VideoSender) Close() {
+	v.s.close()
+}
+
+// packetizeH264 returns the rtp payloads for the NAL unit. NAL units
+// larger than mtu are split into fragmentation units (FU-A).
+func packetizeH264(nalu []byte, mtu int) [][]byte {
+	// rtp header and srtp auth tag
+	max := mtu - 12 - srtpAuthTagLen
+	if len(nalu) <= max {
+		return [][]byte{nalu}
+	}
+
+	indicator := nalu[0]&0xE0 | naluTypeFUA
+	typ := nalu[0] & naluTypeMask
+
+	var ps [][]byte
+	data := nalu[1:]
+	for start := true; len(data) > 0; start = false {
+		n := max - 2
+		if n > len(data) {
+			n = len(data)
+		}
+
+		header := typ
+		if start {
+			header |= 0x80
+		}
+		if n == len(data) {
+			header |= 0x40
+		}
+
+		p := make([]byte, 2+n)
+		p[0] = indicator
+		p[1] = header
+		copy(p[2:], data[:n])
+		ps = append(ps, p)
+
+		data = data[n:]
+	}
+
+	return ps
+}
+
+// splitAnnexB is a bufio.SplitFunc, which returns the
+// NAL units of a H.264 Annex-B byte stream.
+func splitAnnexB(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.Index(data, annexBStartCode)
+	if start < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	}
+
+	begin := start + len(annexBStartCode)
+	end := bytes.Index(data[begin:], annexBStartCode)
+	if end < 0 {
+		if atEOF {
+			return len(data), bytes.TrimRight(data[begin:], "\x00"), nil
+		}
+		return 0, nil, nil
+	}
+
+	// trailing zeros belong to the next start code
+	return begin + end, bytes.TrimRight(data[begin:begin+end], "\x00"), nil
+}
@@ -0,0 +1,77 @@
+package rtp
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestSplitAnnexB(t *testing.T) {
+	stream := []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 1, 0x68, 0xCE, 0, 0, 0, 1, 0x65, 0x88, 0x84}
+
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Split(splitAnnexB)
+
+	var nalus [][]byte
+	for scanner.Scan() {
+		nalus = append(nalus, append([]byte{}, scanner.Bytes()...))
+	}
+
+	want := [][]byte{{0x67, 0x42}, {0x68, 0xCE}, {0x65, 0x88, 0x84}}
+	if is, want := len(nalus), len(want); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	for i := range want {
+		if is, want := nalus[i], want[i]; !bytes.Equal(is, want) {
+			t.Fatalf("%X != %X", is, want)
+		}
+	}
+}
+
+func TestPacketizeH264(t *testing.T) {
+	nalu := make([]byte, 2500)
+	nalu[0] = 0x65
+	for i := 1; i < len(nalu); i++ {
+		nalu[i] = byte(i)
+	}
+
+	mtu := 1000
+	ps := packetizeH264(nalu, mtu)
+	if is, want := len(ps), 3; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	var data []byte
+	for i, p := range ps {
+		if len(p)+12+srtpAuthTagLen > mtu {
+			t.Fatalf("packet %d exceeds mtu", i)
+		}
+
+		if is, want := p[0], byte(0x60|naluTypeFUA); is != want {
+			t.Fatalf("%X != %X", is, want)
+		}
+
+		if is, want := p[1]&0x80 != 0, i == 0; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		if is, want := p[1]&0x40 != 0, i == len(ps)-1; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		if is, want := p[1]&naluTypeMask, byte(naluTypeIDR); is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		data = append(data, p[2:]...)
+	}
+
+	if is, want := data, nalu[1:]; !bytes.Equal(is, want) {
+		t.Fatal("reassembled nal unit differs")
+	}
+
+	if is, want := len(packetizeH264(nalu[:100], mtu)), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,164 @@
+package rtp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	rtpVersion   = 2
+	rtcpTypeSR   = 200
+	rtpMarkerBit = 0x80
+
+	// ntpEpochOffset is the number of seconds
+	// between 1900 (NTP) and 1970 (Unix).
+	ntpEpochOffset = 2208988800
+)
+
+// rtpHeaderLen returns the length of the header of the rtp packet p.
+func rtpHeaderLen(p []byte) int {
+	return 12 + 4*int(p[0]&0x0F)
+}
+
+// sender sends srtp packets of one source to the controller.
+// Rtcp sender reports are sent over the same connection (rtcp-mux).
+type sender struct {
+	conn      *net.UDPConn
+	addr      *net.UDPAddr
+	ctx       *srtpContext
+	pt        uint8
+	ssrc      uint32
+	clockRate uint32
+
+	mu      sync.Mutex
+	seq     uint16
+	roc     uint32
+	ts      uint32 // timestamp of the last packet
+	packets uint32
+	octets  uint32
+	start   time.Time
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newSender(conn *net.UDPConn, ip string, port uint16, suite CryptoSuite, params RTPParams, clockRate uint32) (*sender, error) {
+	ctx, err := newSRTPContext(suite)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ip, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 2)
+	rand.Read(b)
+
+	s := &sender{
+		conn:      conn,
+		addr:      addr,
+		ctx:       ctx,
+		pt:        params.PayloadType,
+		ssrc:      params.Ssrc,
+		clockRate: clockRate,
+		seq:       binary.BigEndian.Uint16(b),
+		start:     time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	interval := time.Duration(float64(params.Interval) * float64(time.Second))
+	if interval <= 0 {
+		interval = time.Second
+	}
+	go s.sendReports(interval)
+
+	return s, nil
+}
+
+// timestamp returns the rtp timestamp for the time t.
+func (s *sender) timestamp(t time.Time) uint32 {
+	return uint32(t.Sub(s.start).Seconds() * float64(s.clockRate))
+}
+
+// send sends the payload in an srtp packet with the timestamp ts.
+func (s *sender) send(payload []byte, ts uint32, marker bool) error {
+	s.mu.Lock()
+	p := make([]byte, 12+len(payload))
+	p[0] = rtpVersion << 6
+	p[1] = s.pt & 0x7F
+	if marker {
+		p[1] |= rtpMarkerBit
+	}
+	binary.BigEndian.PutUint16(p[2:4], s.seq)
+	binary.BigEndian.PutUint32(p[4:8], ts)
+	binary.BigEndian.PutUint32(p[8:12], s.ssrc)
+	copy(p[12:], payload)
+
+	b := s.ctx.encryptRTP(p, s.roc)
+
+	s.seq++
+	if s.seq == 0 {
+		s.roc++
+	}
+	s.ts = ts
+	s.packets++
+	s.octets += uint32(len(payload))
+	s.mu.Unlock()
+
+	_, err := s.conn.WriteToUDP(b, s.addr)
+	return err
+}
+
+// sendReports sends a sender report every interval.
+func (s *sender) sendReports(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.sendReport(time.Now())
+		}
+	}
+}
+
+func (s *sender) sendReport(now time.Time) error {
+	s.mu.Lock()
+	p := make([]byte, 28)
+	p[0] = rtpVersion << 6
+	p[1] = rtcpTypeSR
+	binary.BigEndian.PutUint16(p[2:4], uint16(len(p)/4-1))
+	binary.BigEndian.PutUint32(p[4:8], s.ssrc)
+	binary.BigEndian.PutUint64(p[8:16], ntpTime(now))
+	binary.BigEndian.PutUint32(p[16:20], s.timestamp(now))
+	binary.BigEndian.PutUint32(p[20:24], s.packets)
+	binary.BigEndian.PutUint32(p[24:28], s.octets)
+	b := s.ctx.encryptRTCP(p)
+	s.mu.Unlock()
+
+	_, err := s.conn.WriteToUDP(b, s.addr)
+	return err
+}
+
+// close stops sending sender reports.
+func (s *sender) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// ntpTime returns t as 64-bit NTP timestamp.
+func ntpTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+
+	return sec<<32 | frac
+}
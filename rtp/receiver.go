@@ -0,0 +1,164 @@
+package rtp
+
+import (
+	"github.com/brutella/hap/log"
+
+	"encoding/binary"
+	"net"
+)
+
+// A Packet is a decrypted rtp packet sent by a controller.
+type Packet struct {
+	PayloadType uint8
+	Marker      bool
+	Seq         uint16
+	Timestamp   uint32
+	Ssrc        uint32
+	Payload     []byte
+}
+
+// receiver decrypts srtp packets of one source.
+type receiver struct {
+	ctx *srtpContext
+
+	started bool
+	seq     uint16 // highest received sequence number
+	roc     uint32
+}
+
+func newReceiver(suite CryptoSuite) (*receiver, error) {
+	ctx, err := newSRTPContext(suite)
+	if err != nil {
+		return nil, err
+	}
+
+	return &receiver{ctx: ctx}, nil
+}
+
+// decrypt returns the packet of the srtp packet b.
+func (r *receiver) decrypt(b []byte) (Packet, error) {
+	if len(b) < 12 {
+		return Packet{}, errInvalidPacket
+	}
+
+	seq := binary.BigEndian.Uint16(b[2:4])
+	roc := r.estimateRoc(seq)
+	p, err := r.ctx.decryptRTP(b, roc)
+	if err != nil {
+		return Packet{}, err
+	}
+
+	switch {
+	case !r.started:
+		r.started = true
+		r.seq = seq
+	case roc == r.roc+1:
+		r.roc = roc
+		r.seq = seq
+	case roc == r.roc && seq > r.seq:
+		r.seq = seq
+	}
+
+	return Packet{
+		PayloadType: p[1] & 0x7F,
+		Marker:      p[1]&rtpMarkerBit != 0,
+		Seq:         seq,
+		Timestamp:   binary.BigEndian.Uint32(p[4:8]),
+		Ssrc:        binary.BigEndian.Uint32(p[8:12]),
+		Payload:     p[rtpHeaderLen(p):],
+	}, nil
+}
+
+// estimateRoc returns the rollover counter of the
+// sequence number seq (RFC 3711 Appendix A).
+func (r *receiver) estimateRoc(seq uint16) uint32 {
+	if !r.started {
+		return r.roc
+	}
+
+	if r.seq < 0x8000 {
+		if seq > r.seq && seq-r.seq > 0x8000 && r.roc > 0 {
+			return r.roc - 1
+		}
+	} else if r.seq-0x8000 > seq {
+		return r.roc + 1
+	}
+
+	return r.roc
+}
+
+// isRTCP returns true if b is a rtcp packet (RFC 5761 4).
+func isRTCP(b []byte) bool {
+	return len(b) > 1 && b[1] >= 192 && b[1] <= 223
+}
+
+// AudioReceiver receives the audio stream, which a controller sends
+// to the accessory during a two-way audio session.
+type AudioReceiver struct {
+	conn *net.UDPConn
+	r    *receiver
+}
+
+// NewAudioReceiver returns a receiver for the audio stream
+// of the session. The stream must be started (s.Config is set).
+func NewAudioReceiver(s *Session) (*AudioReceiver, error) {
+	r, err := newReceiver(s.Audio)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AudioReceiver{conn: s.AudioConn, r: r}, nil
+}
+
+// Receive calls fn for every audio packet until the audio
+// connection of the session is closed. Rtcp packets and packets,
+// which can't be authenticated, are ignored.
+func (a *AudioReceiver) Receive(fn func(p Packet)) error {
+	b := make([]byte, 2048)
+	for {
+		n, _, err := a.conn.ReadFromUDP(b)
+		if err != nil {
+			return err
+		}
+
+		if isRTCP(b[:n]) {
+			continue
+		}
+
+		p, err := a.r.decrypt(b[:n])
+		if err != nil {
+			log.Debug.Println("audio:", err)
+			continue
+		}
+
+		fn(p)
+	}
+}
+
+// AACFrames returns the access units of the rtp payload
+// of an AAC-ELD packet (RFC 3640, mode AAC-hbr).
+func AACFrames(payload []byte) [][]byte {
+	if len(payload) < 2 {
+		return nil
+	}
+
+	n := int(binary.BigEndian.Uint16(payload[0:2])+7) / 8
+	if len(payload) < 2+n {
+		return nil
+	}
+
+	headers := payload[2 : 2+n]
+	data := payload[2+n:]
+
+	var frames [][]byte
+	for i := 0; i+1 < len(headers); i += 2 {
+		size := int(binary.BigEndian.Uint16(headers[i:i+2]) >> 3)
+		if size > len(data) {
+			break
+		}
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+
+	return frames
+}
@@ -0,0 +1,132 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func testRTPPacket(seq uint16, payload []byte) []byte {
+	p := make([]byte, 12+len(payload))
+	p[0] = rtpVersion << 6
+	p[1] = 110
+	binary.BigEndian.PutUint16(p[2:4], seq)
+	binary.BigEndian.PutUint32(p[4:8], uint32(seq)*480)
+	binary.BigEndian.PutUint32(p[8:12], 7)
+	copy(p[12:], payload)
+
+	return p
+}
+
+func TestReceiverDecrypt(t *testing.T) {
+	ctx, _ := newSRTPContext(testCryptoSuite())
+	r, err := newReceiver(testCryptoSuite())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte{0x01, 0x02, 0x03}
+	b := ctx.encryptRTP(testRTPPacket(5, payload), 0)
+
+	p, err := r.decrypt(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := p.Payload, payload; !bytes.Equal(is, want) {
+		t.Fatalf("%X != %X", is, want)
+	}
+
+	if is, want := p.Seq, uint16(5); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := p.PayloadType, uint8(110); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	b[len(b)-1] ^= 0xFF
+	if _, err := r.decrypt(b); err != errAuthentication {
+		t.Fatalf("%v != %v", err, errAuthentication)
+	}
+}
+
+func TestReceiverRollover(t *testing.T) {
+	ctx, _ := newSRTPContext(testCryptoSuite())
+	r, _ := newReceiver(testCryptoSuite())
+
+	packets := []struct {
+		seq uint16
+		roc uint32
+	}{
+		{0xFFFE, 0},
+		{0xFFFF, 0},
+		{0x0000, 1},
+		{0xFFFF, 0}, // late packet
+		{0x0001, 1},
+	}
+
+	for _, p := range packets {
+		if _, err := r.decrypt(ctx.encryptRTP(testRTPPacket(p.seq, []byte{0xAA}), p.roc)); err != nil {
+			t.Fatalf("seq %d: %v", p.seq, err)
+		}
+	}
+
+	if is, want := r.roc, uint32(1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestAACFrames(t *testing.T) {
+	frame := []byte{0x10, 0x20, 0x30}
+	frames := AACFrames(packetizeAAC(frame))
+
+	if is, want := len(frames), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := frames[0], frame; !bytes.Equal(is, want) {
+		t.Fatalf("%X != %X", is, want)
+	}
+}
+
+func TestAudioReceiver(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctrl.Close()
+
+	r, err := NewAudioReceiver(&Session{Audio: testCryptoSuite(), AudioConn: conn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan Packet, 1)
+	go r.Receive(func(p Packet) {
+		ch <- p
+	})
+
+	ctx, _ := newSRTPContext(testCryptoSuite())
+	// rtcp receiver reports are ignored
+	ctrl.Write(ctx.encryptRTCP([]byte{rtpVersion << 6, 201, 0, 1, 0, 0, 0, 7}))
+	ctrl.Write(ctx.encryptRTP(testRTPPacket(1, []byte{0xBB}), 0))
+
+	select {
+	case p := <-ch:
+		if is, want := p.Payload, []byte{0xBB}; !bytes.Equal(is, want) {
+			t.Fatalf("%X != %X", is, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	conn.Close()
+}
@@ -0,0 +1,205 @@
+package rtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+const (
+	srtpAuthTagLen = 10 // HMAC_SHA1_80
+	srtpAuthKeyLen = 20
+	srtpSaltLen    = 14
+)
+
+var (
+	errInvalidPacket  = errors.New("invalid srtp packet")
+	errAuthentication = errors.New("srtp authentication failed")
+)
+
+// Key derivation labels (RFC 3711 4.3.1)
+const (
+	labelRTPEncryption  byte = 0x00
+	labelRTPAuth        byte = 0x01
+	labelRTPSalt        byte = 0x02
+	labelRTCPEncryption byte = 0x03
+	labelRTCPAuth       byte = 0x04
+	labelRTCPSalt       byte = 0x05
+)
+
+// srtpContext encrypts and authenticates rtp and rtcp packets
+// of one source (RFC 3711) with AES_CM_128_HMAC_SHA1_80 or
+// AES_256_CM_HMAC_SHA1_80, depending on the length of the master key.
+type srtpContext struct {
+	rtp  srtpKeys
+	rtcp srtpKeys
+
+	rtcpIndex uint32
+}
+
+type srtpKeys struct {
+	block cipher.Block
+	salt  []byte
+	auth  hash.Hash
+}
+
+func newSRTPContext(s CryptoSuite) (*srtpContext, error) {
+	if len(s.MasterSalt) != srtpSaltLen {
+		return nil, fmt.Errorf("invalid master salt length %d", len(s.MasterSalt))
+	}
+
+	rtp, err := deriveSRTPKeys(s.MasterKey, s.MasterSalt, labelRTPEncryption, labelRTPAuth, labelRTPSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	rtcp, err := deriveSRTPKeys(s.MasterKey, s.MasterSalt, labelRTCPEncryption, labelRTCPAuth, labelRTCPSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &srtpContext{rtp: rtp, rtcp: rtcp}, nil
+}
+
+func deriveSRTPKeys(key, salt []byte, enc, auth, slt byte) (srtpKeys, error) {
+	encKey, err := deriveSRTPKey(key, salt, enc, len(key))
+	if err != nil {
+		return srtpKeys{}, err
+	}
+
+	authKey, err := deriveSRTPKey(key, salt, auth, srtpAuthKeyLen)
+	if err != nil {
+		return srtpKeys{}, err
+	}
+
+	sessionSalt, err := deriveSRTPKey(key, salt, slt, srtpSaltLen)
+	if err != nil {
+		return srtpKeys{}, err
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return srtpKeys{}, err
+	}
+
+	return srtpKeys{
+		block: block,
+		salt:  sessionSalt,
+		auth:  hmac.New(sha1.New, authKey),
+	}, nil
+}
+
+// deriveSRTPKey returns a session key of length n
+// with a key derivation rate of 0.
+func deriveSRTPKey(key, salt []byte, label byte, n int) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, salt)
+	iv[7] ^= label
+
+	out := make([]byte, n)
+	cipher.NewCTR(block, iv).XORKeyStream(out, out)
+
+	return out, nil
+}
+
+// encryptRTP encrypts the payload of the rtp packet p with the
+// rollover counter roc and returns the packet with the auth tag.
+func (ctx *srtpContext) encryptRTP(p []byte, roc uint32) []byte {
+	n := rtpHeaderLen(p)
+	out := make([]byte, len(p), len(p)+srtpAuthTagLen)
+	copy(out, p[:n])
+	cipher.NewCTR(ctx.rtp.block, ctx.rtpIV(p, roc)).XORKeyStream(out[n:], p[n:])
+
+	return append(out, authTag(ctx.rtp.auth, out, rocBytes(roc))...)
+}
+
+// decryptRTP authenticates the srtp packet p with the rollover
+// counter roc and returns the decrypted rtp packet.
+func (ctx *srtpContext) decryptRTP(p []byte, roc uint32) ([]byte, error) {
+	if len(p) < 12+srtpAuthTagLen || len(p)-srtpAuthTagLen < rtpHeaderLen(p) {
+		return nil, errInvalidPacket
+	}
+
+	m := len(p) - srtpAuthTagLen
+	if !hmac.Equal(p[m:], authTag(ctx.rtp.auth, p[:m], rocBytes(roc))) {
+		return nil, errAuthentication
+	}
+
+	n := rtpHeaderLen(p)
+	out := make([]byte, m)
+	copy(out, p[:n])
+	cipher.NewCTR(ctx.rtp.block, ctx.rtpIV(p, roc)).XORKeyStream(out[n:], p[n:m])
+
+	return out, nil
+}
+
+// rtpIV returns the counter of the rtp packet p (RFC 3711 4.1.1).
+func (ctx *srtpContext) rtpIV(p []byte, roc uint32) []byte {
+	ssrc := binary.BigEndian.Uint32(p[8:12])
+	seq := binary.BigEndian.Uint16(p[2:4])
+
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, ctx.rtp.salt)
+	xorUint32(iv[4:8], ssrc)
+	xorUint32(iv[8:12], roc)
+	iv[12] ^= byte(seq >> 8)
+	iv[13] ^= byte(seq)
+
+	return iv
+}
+
+func rocBytes(roc uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, roc)
+	return b
+}
+
+// encryptRTCP encrypts the rtcp packet p and returns the
+// packet with the SRTCP index and the auth tag.
+func (ctx *srtpContext) encryptRTCP(p []byte) []byte {
+	ssrc := binary.BigEndian.Uint32(p[4:8])
+	index := ctx.rtcpIndex
+	ctx.rtcpIndex = (ctx.rtcpIndex + 1) & 0x7FFFFFFF
+
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, ctx.rtcp.salt)
+	xorUint32(iv[4:8], ssrc)
+	xorUint32(iv[10:14], index)
+
+	out := make([]byte, len(p), len(p)+4+srtpAuthTagLen)
+	copy(out, p[:8])
+	cipher.NewCTR(ctx.rtcp.block, iv).XORKeyStream(out[8:], p[8:])
+
+	// E flag is set, the packet is encrypted
+	e := make([]byte, 4)
+	binary.BigEndian.PutUint32(e, index|0x80000000)
+	out = append(out, e...)
+
+	return append(out, authTag(ctx.rtcp.auth, out)...)
+}
+
+func authTag(h hash.Hash, bs ...[]byte) []byte {
+	h.Reset()
+	for _, b := range bs {
+		h.Write(b)
+	}
+
+	return h.Sum(nil)[:srtpAuthTagLen]
+}
+
+func xorUint32(b []byte, v uint32) {
+	b[0] ^= byte(v >> 24)
+	b[1] ^= byte(v >> 16)
+	b[2] ^= byte(v >> 8)
+	b[3] ^= byte(v)
+}
@@ -0,0 +1,154 @@
+package rtp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+func hexBytes(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// Test vectors from RFC 3711 B.3
+func TestSRTPKeyDerivation(t *testing.T) {
+	key := hexBytes(t, "E1F97A0D3E018BE0D64FA32C06DE4139")
+	salt := hexBytes(t, "0EC675AD498AFEEBB6960B3AABE6")
+
+	tests := []struct {
+		label byte
+		n     int
+		want  string
+	}{
+		{labelRTPEncryption, 16, "C61E7A93744F39EE10734AFE3FF7A087"},
+		{labelRTPSalt, 14, "30CBBC08863D8C85D49DB34A9AE1"},
+		{labelRTPAuth, 20, "CEBE321F6FF7716B6FD4AB49AF256A156D38BAA4"},
+	}
+
+	for _, test := range tests {
+		b, err := deriveSRTPKey(key, salt, test.label, test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := b, hexBytes(t, test.want); !bytes.Equal(is, want) {
+			t.Fatalf("%X != %X", is, want)
+		}
+	}
+}
+
+func testCryptoSuite() CryptoSuite {
+	return CryptoSuite{
+		Type:       CryptoSuite_AES_CM_128_HMAC_SHA1_80,
+		MasterKey:  bytes.Repeat([]byte{0x01}, 16),
+		MasterSalt: bytes.Repeat([]byte{0x02}, 14),
+	}
+}
+
+// decryptRTP decrypts the srtp packet p; AES-CM is symmetric.
+func decryptRTP(t *testing.T, ctx *srtpContext, p []byte, roc uint32) []byte {
+	n := len(p) - srtpAuthTagLen
+	if is, want := p[n:], authTag(ctx.rtp.auth, p[:n], []byte{byte(roc >> 24), byte(roc >> 16), byte(roc >> 8), byte(roc)}); !bytes.Equal(is, want) {
+		t.Fatalf("%X != %X", is, want)
+	}
+
+	seq := binary.BigEndian.Uint16(p[2:4])
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, ctx.rtp.salt)
+	xorUint32(iv[4:8], binary.BigEndian.Uint32(p[8:12]))
+	xorUint32(iv[8:12], roc)
+	iv[12] ^= byte(seq >> 8)
+	iv[13] ^= byte(seq)
+
+	out := make([]byte, n)
+	copy(out, p[:12])
+	cipher.NewCTR(ctx.rtp.block, iv).XORKeyStream(out[12:], p[12:n])
+
+	return out
+}
+
+func TestSenderSendsSRTP(t *testing.T) {
+	recv, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recv.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	port := uint16(recv.LocalAddr().(*net.UDPAddr).Port)
+	s, err := newSender(conn, "127.0.0.1", port, testCryptoSuite(), RTPParams{PayloadType: 99, Ssrc: 42, Interval: 10}, h264ClockRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	seq := s.seq
+
+	payload := []byte{0x65, 0x01, 0x02, 0x03}
+	if err := s.send(payload, 1000, true); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 1500)
+	recv.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := recv.ReadFromUDP(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, _ := newSRTPContext(testCryptoSuite())
+	p := decryptRTP(t, ctx, b[:n], 0)
+
+	if is, want := p[1], byte(rtpMarkerBit|99); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := binary.BigEndian.Uint16(p[2:4]), seq; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := binary.BigEndian.Uint32(p[4:8]), uint32(1000); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := binary.BigEndian.Uint32(p[8:12]), uint32(42); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := p[12:], payload; !bytes.Equal(is, want) {
+		t.Fatalf("%X != %X", is, want)
+	}
+}
+
+func TestSRTCPIndex(t *testing.T) {
+	ctx, err := newSRTPContext(testCryptoSuite())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := make([]byte, 28)
+	for i := uint32(0); i < 2; i++ {
+		b := ctx.encryptRTCP(p)
+		if is, want := len(b), len(p)+4+srtpAuthTagLen; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		if is, want := binary.BigEndian.Uint32(b[len(p):]), i|0x80000000; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+}
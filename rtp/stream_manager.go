@@ -0,0 +1,374 @@
+package rtp
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Session is a rtp streaming session, which is negotiated
+// by a controller with the setup endpoints characteristic.
+type Session struct {
+	Id []byte
+
+	// ControllerAddr is the address to which the accessory
+	// sends the video and audio rtp packets.
+	ControllerAddr Addr
+
+	// AccessoryAddr is the address on which the accessory
+	// receives rtcp packets from the controller.
+	AccessoryAddr Addr
+
+	// Video and Audio contain the SRTP keys
+	// negotiated with the controller.
+	Video CryptoSuite
+	Audio CryptoSuite
+
+	VideoSsrc uint32
+	AudioSsrc uint32
+
+	// VideoConn and AudioConn are bound to the ports of AccessoryAddr.
+	// They are closed when the session ends.
+	VideoConn *net.UDPConn
+	AudioConn *net.UDPConn
+
+	// Config is the selected stream configuration.
+	// It is set before the stream starts.
+	Config StreamConfiguration
+}
+
+func (s *Session) close() {
+	if s.VideoConn != nil {
+		s.VideoConn.Close()
+	}
+	if s.AudioConn != nil {
+		s.AudioConn.Close()
+	}
+}
+
+// StreamManager implements the camera rtp stream management service.
+// It handles the setup of the endpoints and the selected stream
+// configuration, and calls the stream functions with the
+// parsed parameters.
+type StreamManager struct {
+	*service.CameraRTPStreamManagement
+
+	// StartStreamFunc is called when a controller starts the stream
+	// of a session. The function must send the video and audio stream
+	// to s.ControllerAddr as configured in s.Config.
+	// If the function returns an error, the stream is not started.
+	StartStreamFunc func(s *Session) error
+
+	// StopStreamFunc is called when a controller ends the stream of
+	// a session. The connections of the session are closed afterwards.
+	StopStreamFunc func(s *Session)
+
+	// ReconfigureStreamFunc is called when a controller changes the
+	// video parameters of a running stream. s.Config contains the
+	// new parameters.
+	ReconfigureStreamFunc func(s *Session) error
+
+	// AudioFunc is called for every audio packet, which a controller
+	// sends to the accessory during a stream (two-way audio).
+	// The payload is encoded as selected in s.Config.Audio;
+	// use AACFrames to get the frames of AAC-ELD packets.
+	// Controllers only send audio if the accessory has a speaker service.
+	AudioFunc func(s *Session, p Packet)
+
+	// MaxStreams is the number of streams which can run at the same time.
+	// The default is 1.
+	MaxStreams int
+
+	mu       sync.Mutex
+	sessions map[string]*Session // sessions by id
+	active   map[string]*Session // running streams by session id
+	resp     []byte              // latest setup endpoints response
+}
+
+// NewStreamManager returns a stream manager for the service s,
+// which supports the default video and audio configurations.
+func NewStreamManager(s *service.CameraRTPStreamManagement) *StreamManager {
+	return NewStreamManagerConfiguration(s, DefaultVideoStreamConfiguration(), DefaultAudioStreamConfiguration(), CryptoSuite_AES_CM_128_HMAC_SHA1_80)
+}
+
+// NewStreamManagerConfiguration returns a stream manager for the service s,
+// which supports the video and audio configurations and crypto suite.
+func NewStreamManagerConfiguration(s *service.CameraRTPStreamManagement, video VideoStreamConfiguration, audio AudioStreamConfiguration, suite byte) *StreamManager {
+	m := StreamManager{
+		CameraRTPStreamManagement: s,
+		MaxStreams:                1,
+		sessions:                  map[string]*Session{},
+		active:                    map[string]*Session{},
+	}
+
+	setTLV8(s.SupportedVideoStreamConfiguration.Bytes, video)
+	setTLV8(s.SupportedAudioStreamConfiguration.Bytes, audio)
+	setTLV8(s.SupportedRTPConfiguration.Bytes, NewConfiguration(suite))
+	m.updateStatus()
+
+	s.SetupEndpoints.OnSetRemoteValueContext(func(ctx context.Context, b []byte) error {
+		return m.setupEndpoints(b)
+	})
+	s.SetupEndpoints.OnValueRequestContext(func(ctx context.Context) ([]byte, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.resp, nil
+	})
+	s.SelectedRTPStreamConfiguration.OnSetRemoteValueContext(func(ctx context.Context, b []byte) error {
+		return m.selectStreamConfiguration(b)
+	})
+
+	return &m
+}
+
+// Sessions returns the sessions with running streams.
+func (m *StreamManager) Sessions() []*Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ss []*Session
+	for _, s := range m.active {
+		ss = append(ss, s)
+	}
+
+	return ss
+}
+
+// setupEndpoints prepares a new session for the setup endpoints request b.
+func (m *StreamManager) setupEndpoints(b []byte) error {
+	var req SetupEndpoints
+	if err := tlv8.Unmarshal(b, &req); err != nil {
+		return err
+	}
+
+	s, err := newSession(req)
+	status := SessionStatusSuccess
+	if err != nil {
+		log.Info.Println("setup endpoints:", err)
+		status = SessionStatusError
+	} else if m.isBusy() {
+		s.close()
+		status = SessionStatusBusy
+	}
+
+	resp := SetupEndpointsResponse{
+		SessionId: req.SessionId,
+		Status:    status,
+	}
+
+	if status == SessionStatusSuccess {
+		resp.AccessoryAddr = s.AccessoryAddr
+		resp.Video = s.Video
+		resp.Audio = s.Audio
+		resp.SsrcVideo = int32(s.VideoSsrc)
+		resp.SsrcAudio = int32(s.AudioSsrc)
+	}
+
+	rb, err := tlv8.Marshal(resp)
+	if err != nil {
+		if s != nil {
+			s.close()
+		}
+		return err
+	}
+
+	m.mu.Lock()
+	if status == SessionStatusSuccess {
+		key := hex.EncodeToString(s.Id)
+		if old, ok := m.sessions[key]; ok && m.active[key] == nil {
+			old.close()
+		}
+		m.sessions[key] = s
+	}
+	m.resp = rb
+	m.mu.Unlock()
+
+	return nil
+}
+
+// selectStreamConfiguration handles the session control command of the
+// selected stream configuration b.
+func (m *StreamManager) selectStreamConfiguration(b []byte) error {
+	var cfg StreamConfiguration
+	if err := tlv8.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+
+	key := hex.EncodeToString(cfg.Command.Identifier)
+	m.mu.Lock()
+	s, ok := m.sessions[key]
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown session %s", key)
+	}
+
+	switch cfg.Command.Type {
+	case SessionControlCommandTypeStart:
+		return m.start(key, s, cfg)
+	case SessionControlCommandTypeEnd:
+		m.stop(key, s)
+	case SessionControlCommandTypeReconfigure:
+		return m.reconfigure(s, cfg)
+	default:
+		log.Debug.Printf("session %s: command %d not supported\n", key, cfg.Command.Type)
+	}
+
+	return nil
+}
+
+func (m *StreamManager) start(key string, s *Session, cfg StreamConfiguration) error {
+	if m.isBusy() {
+		return &characteristic.StatusError{Code: -70403}
+	}
+
+	s.Config = cfg
+	if m.StartStreamFunc != nil {
+		if err := m.StartStreamFunc(s); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.active[key] = s
+	m.mu.Unlock()
+	m.updateStatus()
+
+	if m.AudioFunc != nil {
+		go m.receiveAudio(s)
+	}
+
+	return nil
+}
+
+// receiveAudio calls AudioFunc for the audio packets
+// of the session until the session is closed.
+func (m *StreamManager) receiveAudio(s *Session) {
+	r, err := NewAudioReceiver(s)
+	if err != nil {
+		log.Info.Println("audio:", err)
+		return
+	}
+
+	r.Receive(func(p Packet) {
+		m.AudioFunc(s, p)
+	})
+}
+
+func (m *StreamManager) stop(key string, s *Session) {
+	m.mu.Lock()
+	_, running := m.active[key]
+	delete(m.active, key)
+	delete(m.sessions, key)
+	m.mu.Unlock()
+
+	if running && m.StopStreamFunc != nil {
+		m.StopStreamFunc(s)
+	}
+	s.close()
+	m.updateStatus()
+}
+
+func (m *StreamManager) reconfigure(s *Session, cfg StreamConfiguration) error {
+	// only the video parameters are included on reconfigure
+	s.Config.Video = cfg.Video
+	if m.ReconfigureStreamFunc != nil {
+		return m.ReconfigureStreamFunc(s)
+	}
+
+	return nil
+}
+
+func (m *StreamManager) isBusy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.active) >= m.MaxStreams
+}
+
+// updateStatus sets the streaming status from the running streams.
+func (m *StreamManager) updateStatus() {
+	status := StreamingStatusAvailable
+	if m.isBusy() {
+		status = StreamingStatusBusy
+	}
+
+	setTLV8(m.StreamingStatus.Bytes, StreamingStatus{status})
+}
+
+// newSession returns a session for the setup endpoints request.
+// The video and audio connections of the session listen on
+// the local address, which routes to the controller.
+func newSession(req SetupEndpoints) (*Session, error) {
+	ip, err := localIP(req.ControllerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Session{
+		Id:             req.SessionId,
+		ControllerAddr: req.ControllerAddr,
+		Video:          req.Video,
+		Audio:          req.Audio,
+		VideoSsrc:      randomSsrc(),
+		AudioSsrc:      randomSsrc(),
+	}
+
+	if s.VideoConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: ip}); err != nil {
+		return nil, err
+	}
+
+	if s.AudioConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: ip}); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	s.AccessoryAddr = Addr{
+		IPVersion:    req.ControllerAddr.IPVersion,
+		IPAddr:       ip.String(),
+		VideoRtpPort: uint16(s.VideoConn.LocalAddr().(*net.UDPAddr).Port),
+		AudioRtpPort: uint16(s.AudioConn.LocalAddr().(*net.UDPAddr).Port),
+	}
+
+	return &s, nil
+}
+
+// localIP returns the local ip address, which is used to
+// send packets to the controller address.
+func localIP(addr Addr) (net.IP, error) {
+	port := strconv.Itoa(int(addr.VideoRtpPort))
+	// dialing udp doesn't send any packets
+	conn, err := net.Dial("udp", net.JoinHostPort(addr.IPAddr, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+func randomSsrc() uint32 {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return binary.BigEndian.Uint32(b)
+}
+
+func setTLV8(c *characteristic.Bytes, v interface{}) {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		log.Info.Println(err)
+		return
+	}
+
+	c.SetValue(b)
+}
@@ -0,0 +1,126 @@
+package rtp
+
+import (
+	"testing"
+
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"encoding/base64"
+	"net/http"
+)
+
+func writeTLV8(t *testing.T, c interface {
+	SetValueRequest(interface{}, *http.Request) (interface{}, int)
+}, v interface{}) int {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("PUT", "/characteristics", nil)
+	_, code := c.SetValueRequest(base64.StdEncoding.EncodeToString(b), req)
+	return code
+}
+
+func TestStreamManager(t *testing.T) {
+	m := NewStreamManager(service.NewCameraRTPStreamManagement())
+
+	var started, stopped *Session
+	m.StartStreamFunc = func(s *Session) error {
+		started = s
+		return nil
+	}
+	m.StopStreamFunc = func(s *Session) {
+		stopped = s
+	}
+
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	key := CryptoSuite{
+		Type:       CryptoSuite_AES_CM_128_HMAC_SHA1_80,
+		MasterKey:  make([]byte, 16),
+		MasterSalt: make([]byte, 14),
+	}
+	setup := SetupEndpoints{
+		SessionId: id,
+		ControllerAddr: Addr{
+			IPVersion:    IPAddrVersionv4,
+			IPAddr:       "127.0.0.1",
+			VideoRtpPort: 50000,
+			AudioRtpPort: 50002,
+		},
+		Video: key,
+		Audio: key,
+	}
+
+	if is, want := writeTLV8(t, m.SetupEndpoints, setup), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	v, _ := m.SetupEndpoints.ValueRequest(nil)
+	b, _ := base64.StdEncoding.DecodeString(v.(string))
+	var resp SetupEndpointsResponse
+	if err := tlv8.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := resp.Status, SessionStatusSuccess; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := resp.AccessoryAddr.IPAddr, "127.0.0.1"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if resp.AccessoryAddr.VideoRtpPort == 0 || resp.AccessoryAddr.AudioRtpPort == 0 {
+		t.Fatal("invalid accessory ports")
+	}
+
+	cfg := StreamConfiguration{
+		Command: SessionControlCommand{id, SessionControlCommandTypeStart},
+		Video: VideoParameters{
+			CodecType:  VideoCodecType_H264,
+			Attributes: VideoCodecAttributes{1280, 720, 30},
+			RTP:        RTPParams{PayloadType: 99, Ssrc: 1, Bitrate: 299, Interval: 0.5, MTU: 1378},
+		},
+	}
+	if is, want := writeTLV8(t, m.SelectedRTPStreamConfiguration, cfg), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if started == nil {
+		t.Fatal("stream not started")
+	}
+
+	if is, want := started.Config.Video.Attributes.Width, uint16(1280); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := started.VideoSsrc, uint32(resp.SsrcVideo); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	var status StreamingStatus
+	tlv8.Unmarshal(m.StreamingStatus.Value(), &status)
+	if is, want := status.Status, StreamingStatusBusy; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	cfg = StreamConfiguration{Command: SessionControlCommand{id, SessionControlCommandTypeEnd}}
+	if is, want := writeTLV8(t, m.SelectedRTPStreamConfiguration, cfg), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if stopped != started {
+		t.Fatal("stream not stopped")
+	}
+
+	tlv8.Unmarshal(m.StreamingStatus.Value(), &status)
+	if is, want := status.Status, StreamingStatusAvailable; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := len(m.Sessions()), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
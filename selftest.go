@@ -0,0 +1,293 @@
+package hap
+
+import (
+	"github.com/brutella/hap/ed25519"
+	"github.com/brutella/hap/tlv8"
+
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// SelfTestResult is the result of a single self-test check.
+type SelfTestResult struct {
+	// Name is the name of the check (e.g. "store").
+	Name string
+	// Err is nil if the check succeeded.
+	Err error
+	// Duration is the time it took to run the check.
+	Duration time.Duration
+}
+
+// SelfTestReport contains the results of all self-test checks.
+type SelfTestReport struct {
+	Results []SelfTestResult
+}
+
+// OK returns true if all checks succeeded.
+func (r SelfTestReport) OK() bool {
+	return r.Err() == nil
+}
+
+// Err returns an error describing all failed checks or nil.
+func (r SelfTestReport) Err() error {
+	var msgs []string
+	for _, res := range r.Results {
+		if res.Err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", res.Name, res.Err))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+func (r SelfTestReport) String() string {
+	var b strings.Builder
+	for _, res := range r.Results {
+		status := "ok"
+		if res.Err != nil {
+			status = "FAIL " + res.Err.Error()
+		}
+		fmt.Fprintf(&b, "%-12s %-8s %s\n", res.Name, res.Duration.Round(time.Microsecond), status)
+	}
+
+	return b.String()
+}
+
+// SelfTest runs a series of local checks and returns a report.
+// The checks include validating the configuration, reading and
+// writing the store, signing with the accessory key, encoding tlv8
+// data, binding to the listen address and checking the responder.
+// SelfTest doesn't change the configuration or the stored data.
+// It is meant to be run when an appliance boots, to fail fast
+// instead of failing later during pairing.
+func (s *Server) SelfTest() SelfTestReport {
+	checks := []struct {
+		name string
+		fn   func() error
+	}{
+		{"config", s.selfTestConfig},
+		{"store", s.selfTestStore},
+		{"keypair", s.selfTestKeyPair},
+		{"tlv8", selfTestTLV8},
+		{"listen", s.selfTestListen},
+		{"mdns", s.selfTestMDNS},
+	}
+
+	var r SelfTestReport
+	for _, c := range checks {
+		start := time.Now()
+		err := c.fn()
+		r.Results = append(r.Results, SelfTestResult{
+			Name:     c.name,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+	}
+
+	return r
+}
+
+const keySelfTest = "selftest"
+
+// selfTestConfig checks the setup code, the ids of
+// the accessories and the stored configuration hash.
+func (s *Server) selfTestConfig() error {
+	if s.PinFunc == nil && s.Verifier == nil && s.Pin != "" {
+		if err := validatePin(s.Pin); err != nil {
+			return err
+		}
+	}
+
+	aids := map[uint64]bool{}
+	for _, a := range s.accessories() {
+		if a.Name() == "" {
+			return errors.New("invalid accessory name")
+		}
+
+		if aids[a.Id] {
+			return fmt.Errorf("accessory id %d already exists", a.Id)
+		}
+		aids[a.Id] = true
+
+		// Ids of 0 are assigned when the server starts.
+		iids := map[uint64]bool{}
+		for _, svc := range a.Ss {
+			if svc.Id != 0 && iids[svc.Id] {
+				return fmt.Errorf("service id %d already exists (%s)", svc.Id, a.Name())
+			}
+			iids[svc.Id] = true
+
+			for _, c := range svc.Cs {
+				if c.Id != 0 && iids[c.Id] {
+					return fmt.Errorf("characteristic id %d already exists (%s)", c.Id, a.Name())
+				}
+				iids[c.Id] = true
+			}
+		}
+	}
+
+	if ok, err := s.hasKey("configHash"); err != nil {
+		return err
+	} else if ok {
+		b, err := s.st.Get("configHash")
+		if err != nil {
+			return err
+		}
+
+		if len(b) != md5.Size {
+			return errors.New("invalid configuration hash")
+		}
+	}
+
+	return nil
+}
+
+// hasKey returns true if the store contains a value for key.
+func (s *Server) hasKey(key string) (bool, error) {
+	keys, err := s.st.KeysWithSuffix(key)
+	if err != nil {
+		return false, err
+	}
+
+	for _, k := range keys {
+		if k == key {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *Server) selfTestStore() error {
+	if s.st.readOnly() {
+		_, err := s.st.Get("uuid")
+		return err
+	}
+
+	want := []byte(randHex())
+	if err := s.st.Set(keySelfTest, want); err != nil {
+		return fmt.Errorf("write: %v", err)
+	}
+	defer s.st.Delete(keySelfTest)
+
+	is, err := s.st.Get(keySelfTest)
+	if err != nil {
+		return fmt.Errorf("read: %v", err)
+	}
+
+	if !bytes.Equal(is, want) {
+		return errors.New("read value differs from written value")
+	}
+
+	if err := s.st.Delete(keySelfTest); err != nil {
+		return fmt.Errorf("delete: %v", err)
+	}
+
+	return nil
+}
+
+// selfTestKeyPair checks the keypair of the server or, if the server
+// wasn't started yet, the stored keypair. A missing keypair is
+// generated when the server starts.
+func (s *Server) selfTestKeyPair() error {
+	s.kmu.RLock()
+	loaded := !allZero(s.Key.Private[:])
+	s.kmu.RUnlock()
+
+	data := []byte(randHex())
+	if loaded {
+		sig, err := s.sign(data)
+		if err != nil {
+			return err
+		}
+
+		if _, public := s.identity(); !ed25519.ValidateSignature(public, data, sig) {
+			return errors.New("public key doesn't match private key")
+		}
+
+		return nil
+	}
+
+	if ok, err := s.hasKey("keypair"); err != nil || !ok {
+		return err
+	}
+
+	kp, err := s.st.KeyPair()
+	defer zero(kp.Private[:])
+	if err != nil {
+		return fmt.Errorf("load: %v", err)
+	}
+
+	sig, err := ed25519.Signature(kp.Private[:], data)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.ValidateSignature(kp.Public[:], data, sig) {
+		return errors.New("public key doesn't match private key")
+	}
+
+	return nil
+}
+
+func selfTestTLV8() error {
+	want := pairSetupPayload{
+		Method:     MethodPair,
+		Identifier: "selftest",
+		PublicKey:  bytes.Repeat([]byte{0xAB}, 384), // longer than a single tlv8 item
+		State:      M1,
+	}
+
+	b, err := tlv8.Marshal(want)
+	if err != nil {
+		return err
+	}
+
+	var is pairSetupPayload
+	if err := tlv8.Unmarshal(b, &is); err != nil {
+		return err
+	}
+
+	if is.Identifier != want.Identifier || !bytes.Equal(is.PublicKey, want.PublicKey) || is.State != want.State {
+		return errors.New("decoded value differs from encoded value")
+	}
+
+	return nil
+}
+
+func (s *Server) selfTestListen() error {
+	s.mux.Lock()
+	running := s.ln != nil
+	s.mux.Unlock()
+
+	// The port is already bound by the server.
+	if running {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return ln.Close()
+}
+
+// selfTestMDNS checks the responder,
+// if it implements ResponderChecker.
+func (s *Server) selfTestMDNS() error {
+	if c, ok := s.responder().(ResponderChecker); ok {
+		return c.Check()
+	}
+
+	return nil
+}
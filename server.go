@@ -4,8 +4,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/brutella/dnssd"
 	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/audit"
 	"github.com/brutella/hap/characteristic"
 	"github.com/brutella/hap/log"
 	"github.com/go-chi/chi"
@@ -15,8 +15,10 @@ import (
 
 	"bytes"
 	"context"
+	"crypto/rand"
 	"crypto/sha512"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
@@ -33,38 +35,258 @@ type Server struct {
 	// with the accessory.
 	Pin string
 
+	// Verifier is the pre-computed srp salt and verifier of the
+	// pincode (see NewSRPVerifier). If set, Pin is ignored and the
+	// pincode doesn't have to be stored on the device.
+	Verifier *SRPVerifier
+
+	// PinFunc returns the pincode for a new pair-setup attempt.
+	// If set, PinFunc is called once for every pair-setup and
+	// Pin and Verifier are ignored. Use it to generate a random pincode per
+	// attempt (see RandomPin) and show it on a display.
+	PinFunc func() string
+
 	// Addr specifies the tcp address for the server
 	// to listen to in form of "host:port".
 	// If empty, a random port is used.
 	Addr string
 
+	// Network specifies the network to listen to:
+	// "tcp" (ipv4 and ipv6, default), "tcp4" or "tcp6".
+	// Only addresses of the network are announced via dnssd.
+	Network string
+
 	// Ifaces specifies at which interface the
 	// associated dnssd service is announced.
+	// If Addr contains a specific ip address,
+	// only this address is announced.
 	Ifaces []string
 
+	// InterfaceWatchInterval is the interval in which the network
+	// interfaces are checked for changes. When an interface goes up or
+	// down or its addresses change, the service is announced again.
+	// If zero, the interval is 5 seconds. A negative value disables it.
+	InterfaceWatchInterval time.Duration
+
+	// LogHandler receives the log messages of the server with fields
+	// like the remote address ("addr") and the pairing name ("pairing").
+	// If nil, the handler set with log.SetHandler is used.
+	LogHandler log.Handler
+
+	// Audit records characteristic writes, pairing changes and
+	// failed authentications with the pairing of the controller.
+	// Events are recorded synchronously. If nil, no events are recorded.
+	Audit audit.Sink
+
+	// MetricsAddr specifies the tcp address ("host:port") at which
+	// the metrics are served in the Prometheus text format at /metrics.
+	// If empty, the metrics are not served (see MetricsHandler).
+	MetricsAddr string
+
+	// HealthAddr specifies the tcp address ("host:port") at which the
+	// health of the server is served at /healthz (see Health).
+	// If empty, the health is not served.
+	HealthAddr string
+
+	// Systemd enables the systemd integration. If true, the server
+	// uses a socket passed by systemd (socket activation), notifies
+	// systemd when the accessory is announced and pings the
+	// systemd watchdog as long as the server is healthy.
+	Systemd bool
+
+	// Paranoid locks the memory of the long-term key pair (mlock),
+	// so that the private key is never swapped to disk. Locking is
+	// only supported on Linux and macOS and fails if the process
+	// exceeds its limit of locked memory (RLIMIT_MEMLOCK).
+	Paranoid bool
+
+	// UnsubscribedFunc is called when a controller has no event
+	// subscriptions anymore – because the controller disabled all
+	// events or because the connection was closed.
+	// You can use this function to tear down resources, which
+	// were set up when the controller subscribed to events.
+	UnsubscribedFunc func(addr string, p Pairing)
+
+	// PairingAddedFunc is called when a controller was paired
+	// or the permission of a pairing changed.
+	PairingAddedFunc func(p Pairing)
+
+	// AllowAddPairing is called when the admin controller *by* adds
+	// or updates the pairing p. If it returns false, the request is
+	// rejected. Use it to restrict the number of controllers or to
+	// require a physical button press before accepting a controller.
+	AllowAddPairing func(p Pairing, by Pairing) bool
+
+	// Authorize is called before a controller reads, writes or
+	// subscribes to the characteristic aid.iid. If it returns false,
+	// the operation is rejected with JsonStatusInsufficientPrivileges.
+	// Use it to restrict the access of non-admin controllers.
+	Authorize func(p Pairing, aid, iid uint64, op Op) bool
+
+	// PairingRemovedFunc is called when the pairing of a
+	// controller was removed.
+	PairingRemovedFunc func(p Pairing)
+
+	// PairedFunc is called when the accessory becomes paired.
+	PairedFunc func()
+
+	// UnpairedFunc is called when the last pairing was removed.
+	UnpairedFunc func()
+
+	// AdvertisementFunc is called when the state of the dnssd
+	// advertisement changes; e.g. when the service is announced
+	// under a different name because of a name conflict.
+	// The function must not block or call UpdateAdvertisement.
+	AdvertisementFunc func(e AdvertisementEvent)
+
+	// StoreTimeout is the maximum duration of a store operation
+	// while handling an http request. The timeout only applies
+	// to stores which implement StoreContext.
+	// If zero, there is no timeout.
+	StoreTimeout time.Duration
+
+	// ReadTimeout is the maximum duration of reading the value of
+	// a characteristic with ValueRequestFunc. The context of the request
+	// is canceled after the timeout and the read fails with
+	// JsonStatusOperationTimedOut. If zero, there is no timeout.
+	ReadTimeout time.Duration
+
+	// RejectOutOfRange specifies if written values, which are out of
+	// the range of a characteristic, are rejected with
+	// JsonStatusInvalidValueInRequest. By default the values are
+	// clamped to the min and max value of the characteristic.
+	RejectOutOfRange bool
+
+	// NotificationInterval is the minimum interval between notifications
+	// of a characteristic. Changes within the interval are coalesced into
+	// one notification with the latest value. Programmable switch events
+	// are never coalesced. If zero, the interval is 1 second, as recommended
+	// by HAP. A negative value disables coalescing.
+	// See also SetNotificationInterval.
+	NotificationInterval time.Duration
+
+	// PersistValues specifies if the values of writable characteristics
+	// are saved in the store when they change. The saved values are
+	// restored when the server starts.
+	PersistValues bool
+
+	// PersistSubscriptions specifies if the event subscriptions of the
+	// controllers are saved in the store. The subscriptions of a controller
+	// are restored when it connects again, even after a restart.
+	// Without persistence, they are only restored while the server runs.
+	PersistSubscriptions bool
+
+	// MaxPairSetupAttempts is the number of failed pair-setup attempts
+	// after which pair-setup is disabled until the failed attempts are
+	// reset. If zero, 100 attempts are allowed.
+	MaxPairSetupAttempts int
+
+	// PairSetupBackoff is the time a controller has to wait after a
+	// failed pair-setup attempt. The time doubles with every failed
+	// attempt up to one hour. If zero, the backoff starts with 1 second.
+	PairSetupBackoff time.Duration
+
+	// PairSetupTimeout is the maximum duration of a pair-setup.
+	// A pair-setup which doesn't finish in time is canceled and
+	// other controllers can start a pair-setup.
+	// If zero, the timeout is 1 minute.
+	PairSetupTimeout time.Duration
+
+	// MaxRequestSize is the maximum size of the body of a request in bytes.
+	// Larger requests are rejected and the connection is closed.
+	// If zero, the maximum size is 1 MiB.
+	MaxRequestSize int
+
+	// SessionPacketLimit is the number of packets, which are encrypted
+	// or decrypted with the keys of a session. When it is reached, the
+	// connection is closed after the current response or event and the
+	// controller verifies the pairing again, which results in new keys.
+	// If zero, the limit is 2^20 packets (at most 1 GiB).
+	SessionPacketLimit uint64
+
+	// ReceiveTimeout is the maximum duration of receiving a request.
+	// The connection is closed if a controller doesn't send the
+	// request completely in time. Idle connections are not affected.
+	// If zero, the timeout is 10 seconds. A negative value disables it.
+	ReceiveTimeout time.Duration
+
+	// Responder announces the accessory on the local network.
+	// If nil, the built-in mDNS responder is used.
+	Responder Responder
+
+	// Authenticator signs the MFi challenge during pair-setup.
+	// If nil, pair-setup with MFi authentication is rejected.
+	Authenticator Authenticator
+
+	// NFCFunc is called with the setup payload as NDEF message
+	// (see SetupNDEF) when the server starts and the accessory is
+	// not paired. When the accessory becomes paired, NFCFunc is
+	// called with nil and the NFC tag should be cleared.
+	NFCFunc func(ndef []byte)
+
+	// SnapshotFunc returns a JPEG image of the camera with the
+	// requested width and height. It is called when a controller
+	// requests a snapshot via the /resource endpoint, e.g. to show
+	// the preview of the camera in the Home app.
+	SnapshotFunc func(width, height int) ([]byte, error)
+
+	// SnapshotAllowedFunc is called before SnapshotFunc with the reason
+	// of the snapshot request (e.g. SnapshotReasonEvent). The request
+	// is rejected if the function returns false.
+	SnapshotAllowedFunc func(reason int) bool
+
 	MfiCompliant bool   // default false
 	Protocol     string // default "1.0"
 	SetupId      string
 	Key          KeyPair // public and private key (generated and stored on disk)
 
-	st *storer        // stores data
-	ss *http.Server   // http server
-	a  *accessory.A   // main accessory
-	as []*accessory.A // bridged accessories
+	st   *storer        // stores data
+	ss   *http.Server   // http server
+	a    *accessory.A   // main accessory
+	as   []*accessory.A // bridged accessories
+	amux *sync.RWMutex  // guards as and configured
 
-	version uint16 // version of accessory content – relates to configHash
-	uuid    string // internal identifier (generated and stored on disk)
+	configured map[interface{}]struct{} // accessories and characteristics with registered callbacks
+
+	ids     IDAllocator // assigns accessory and instance ids
+	version uint16      // version of accessory content – relates to configHash
+	uuid    string      // internal identifier (generated and stored on disk)
 
 	port int // listen port (can be different than in Addr)
-	ln   *net.TCPListener
+	ln   net.Listener
 
 	// for dnssd stuff
-	responder dnssd.Responder
-	handle    dnssd.ServiceHandle
-
-	mux  *sync.Mutex
-	sess map[string]interface{}
-	cons map[string]*conn
+	defaultResponder *dnssdResponder
+	advertising      bool         // true while the service is announced
+	announced        DNSSDService // guarded by dmux
+	advertisedName   string       // name of the announced service
+	dmux             sync.Mutex   // guards announcements
+	interfaceState   func() string
+
+	kmu sync.RWMutex // guards Key and uuid, which change in RotateIdentity
+	pmu sync.Mutex   // serializes updates of the failed pair-setup attempts
+
+	mux   *sync.Mutex
+	sess  map[net.Conn]interface{} // sessions by connection
+	cons  map[net.Conn]*conn       // open connections
+	frags map[net.Conn]*fragments  // fragmented tlv8 messages
+
+	mws       []Middleware                         // wrap the handlers of the protocol routes
+	batchFunc func([]CharacteristicWrite)          // called with the writes of a request
+	eventFunc func(aid, iid uint64, v interface{}) // called when a value changes
+	idFuncs   map[*accessory.A]func(Pairing)       // set with OnIdentify
+	metrics   *metrics                             // http endpoint metrics
+	pcache    *pairingCache                        // pairings of verified controllers
+	thr       *throttle                            // coalesces notifications
+	subs      subscriptions                        // event subscriptions by pairing name
+
+	stop        context.CancelFunc // stops the running server
+	done        chan struct{}      // closed when the running server stopped
+	shutdownCtx context.Context    // set while shutting down gracefully
+	restart     bool               // start again after stopping
+
+	nfcPaired *bool // last pairing state reported to NFCFunc
+	paired    bool  // last pairing state reported to PairedFunc and UnpairedFunc
 }
 
 // A ServeMux lets you attach handlers to http url paths.
@@ -80,31 +302,69 @@ type ServeMux interface {
 // NewServer returns a new server given a store (to persist data) and accessories.
 // If more than one accessory is added to the server, *a* acts as a bridge.
 func NewServer(store Store, a *accessory.A, as ...*accessory.A) (*Server, error) {
+	return newServer(store, nil, nil, a, as...)
+}
+
+// newServer returns a new server which assigns ids with ids.
+// If ids is nil, the assigned ids are persisted in the store.
+// The recovery of the store is logged with h.
+func newServer(store Store, ids IDAllocator, h log.Handler, a *accessory.A, as ...*accessory.A) (*Server, error) {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.Debug, NoColor: true}))
 
 	st := &storer{store}
+	if err := st.verify(); err != nil {
+		return nil, err
+	}
+
 	if err := migrate(st); err != nil {
 		log.Info.Panic(err)
 	}
 
+	if !st.readOnly() {
+		l := log.Info.With().WithHandler(h)
+		if err := st.recoverJournal(l); err != nil {
+			return nil, err
+		}
+
+		if err := st.validatePairings(l); err != nil {
+			return nil, err
+		}
+	}
+
 	s := &Server{
-		st:   st,
-		a:    a,
-		as:   as,
-		mux:  &sync.Mutex{},
-		sess: make(map[string]interface{}),
-		cons: make(map[string]*conn),
+		st:         st,
+		a:          a,
+		as:         as,
+		amux:       &sync.RWMutex{},
+		configured: map[interface{}]struct{}{},
+		mux:        &sync.Mutex{},
+		sess:       make(map[net.Conn]interface{}),
+		cons:       make(map[net.Conn]*conn),
+		frags:      make(map[net.Conn]*fragments),
+		idFuncs:    make(map[*accessory.A]func(Pairing)),
+		subs:       subscriptions{},
+
+		metrics: newMetrics(),
+		pcache:  newPairingCache(),
+		thr:     newThrottle(),
+
+		LogHandler: h,
 	}
-	s.ss = &http.Server{
-		Handler:   r,
-		ConnState: s.connStateEvent,
+	s.paired = s.IsPaired()
+
+	s.ids = ids
+	if s.ids == nil {
+		s.ids = newStoreIDAllocator(st)
 	}
+	s.ss = s.newHTTPServer(r)
 
 	// Load the stored uuid or generate a new one.
 	if s.uuid == "" {
 		uuid, err := s.st.Get("uuid")
-		if err != nil {
+		if err != nil && s.st.readOnly() {
+			return nil, fmt.Errorf("read-only store contains no uuid: %v", err)
+		} else if err != nil {
 			uuid = []byte(mac48Address(randHex()))
 			if err := s.st.Set("uuid", uuid); err != nil {
 				return nil, err
@@ -116,12 +376,11 @@ func NewServer(store Store, a *accessory.A, as ...*accessory.A) (*Server, error)
 
 	// Load the stored version or set to 1.
 	if s.version == 0 {
-		b, err := s.st.Get("version")
-		if err == nil {
-			s.version = uint16(to.Uint64(string(b)))
-		} else {
-			s.version = 1
+		v, err := s.st.counter(keyConfigNumber)
+		if err != nil {
+			return nil, err
 		}
+		s.version = v
 	}
 
 	arr := []*accessory.A{a}
@@ -130,58 +389,54 @@ func NewServer(store Store, a *accessory.A, as ...*accessory.A) (*Server, error)
 		return nil, err
 	}
 
-	// Group handlers for tlv8 and json encoded content.
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.SetHeader("Content-Type", HTTPContentTypePairingTLV8))
-		r.Post("/pair-setup", s.pairSetup)
-		r.Post("/pair-verify", s.pairVerify)
-		r.Post("/identify", s.identify)
-		r.Post("/pairings", s.pairings)
-	})
-
-	// The json encoded content is encrypted. The encryption keys
-	// are stored in a session. The de-/encryption is done by a Conn.
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.SetHeader("Content-Type", HTTPContentTypeHAPJson))
-		r.Get("/accessories", s.getAccessories)
-		r.Get("/characteristics", s.getCharacteristics)
-		r.Put("/characteristics", s.putCharacteristics)
-		r.Put("/prepare", s.prepareCharacteristics)
-	})
+	s.register(r)
 
 	return s, nil
 }
 
 // ServeMux returns the http handler.
+// If a custom router is used (see SetRouter), which
+// doesn't implement ServeMux, nil is returned.
 func (s *Server) ServeMux() ServeMux {
-	return s.ss.Handler.(*chi.Mux)
+	mux, _ := s.ss.Handler.(ServeMux)
+	return mux
 }
 
 // IsAuthorized returns true if the provided
 // request is authorized to access accessory data.
 func (s *Server) IsAuthorized(request *http.Request) bool {
-	ss, _ := s.getSession(request.RemoteAddr)
-	return ss != nil
+	ss, _ := s.getSession(reqConn(request))
+	return ss != nil && ss.Pairing.Name != ""
 }
 
+// TimedWrite returns the timed write prepared in the session of the request.
 func (s *Server) TimedWrite(request *http.Request) *TimedWrite {
-	if ss, _ := s.getSession(request.RemoteAddr); ss != nil {
+	if ss, _ := s.getSession(reqConn(request)); ss != nil {
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
 		return ss.twr
 	}
 
 	return nil
 }
 
+// SetTimedWrite prepares a timed write with the transaction id pid,
+// which expires after ttl milliseconds.
 func (s *Server) SetTimedWrite(ttl, pid uint64, request *http.Request) {
-	if ss, _ := s.getSession(request.RemoteAddr); ss != nil {
+	if ss, _ := s.getSession(reqConn(request)); ss != nil {
 		t := time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		ss.mu.Lock()
 		ss.twr = &TimedWrite{t, pid}
+		ss.mu.Unlock()
 	}
 }
 
+// DelTimedWrite removes the prepared timed write.
 func (s *Server) DelTimedWrite(request *http.Request) {
-	if ss, _ := s.getSession(request.RemoteAddr); ss != nil {
+	if ss, _ := s.getSession(reqConn(request)); ss != nil {
+		ss.mu.Lock()
 		ss.twr = nil
+		ss.mu.Unlock()
 	}
 }
 
@@ -190,23 +445,100 @@ func (s *Server) IsPaired() bool {
 	return len(s.st.Pairings()) > 0
 }
 
-// ListenAndServe starts the server.
-func (s *Server) ListenAndServe(ctx context.Context) error {
-	err := s.prepare()
-	if err != nil {
+// storer returns the storer to use while handling a request with ctx.
+func (s *Server) storer(ctx context.Context) *storer {
+	return s.st.withContext(ctx, s.StoreTimeout)
+}
+
+// Serve starts the server and accepts connections on ln.
+// The listener is announced via mDNS with its port, which lets
+// tests and sandboxed environments listen on port 0.
+// ln is closed when ctx is done or the server is shut down.
+// Because the listener can't be reused, Restart stops the server.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if err := s.prepare(); err != nil {
 		return err
 	}
 
-	return s.listenAndServe(ctx)
+	err := s.listenAndServe(ctx, ln)
+
+	s.mux.Lock()
+	if s.restart {
+		log.Info.Println("restart is not supported with an external listener")
+	}
+	s.restart = false
+	s.mux.Unlock()
+
+	return err
 }
 
-func (s *Server) listenAndServe(ctx context.Context) error {
-	// Listen with a tcp socket on a given addr/port.
-	tcpLn, err := net.Listen("tcp", s.Addr)
-	if err != nil {
-		return err
+// ListenAndServe starts the server.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	for {
+		err := s.prepare()
+		if err != nil {
+			return err
+		}
+
+		err = s.listenAndServe(ctx, nil)
+
+		s.mux.Lock()
+		restart := s.restart
+		s.restart = false
+		s.mux.Unlock()
+
+		if !restart || ctx.Err() != nil {
+			return err
+		}
+
+		log.Debug.Println("restarting server")
 	}
-	ln := &listener{tcpLn.(*net.TCPListener)}
+}
+
+func (s *Server) listenAndServe(ctx context.Context, ext net.Listener) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	s.mux.Lock()
+	s.stop, s.done = stop, done
+	// A http server can't be reused after it was stopped.
+	s.ss = s.newHTTPServer(s.ss.Handler)
+	s.mux.Unlock()
+
+	defer func() {
+		s.mux.Lock()
+		s.stop, s.done = nil, nil
+		s.mux.Unlock()
+	}()
+
+	nl := ext
+	if nl == nil && s.Systemd {
+		l, err := sdListener()
+		if err != nil {
+			return err
+		}
+
+		if l != nil {
+			nl = l
+		}
+	}
+
+	if nl == nil {
+		// Listen with a tcp socket on a given addr/port.
+		l, err := net.Listen(s.network(), s.Addr)
+		if err != nil {
+			return err
+		}
+		nl = l
+	}
+	ln := &listener{nl, s.metrics}
+
+	s.mux.Lock()
+	s.ln = nl
+	s.mux.Unlock()
 
 	// Get the port from the listener address because it
 	// it might be different than specified in Port.
@@ -215,45 +547,84 @@ func (s *Server) listenAndServe(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	s.mux.Lock()
 	s.port = i
+	s.mux.Unlock()
 
-	// Announce the server using dnssd.
-	resp, err := dnssd.NewResponder()
-	if err != nil {
-		return fmt.Errorf("dnssd: %s", err)
-	}
-	s.responder = resp
+	s.updateNFC()
 
-	service, err := s.service()
-	if err != nil {
-		return fmt.Errorf("dnssd: %s", err)
+	// Announce the server using dnssd.
+	resp := s.responder()
+	if n, ok := resp.(AdvertisementNotifier); ok {
+		n.Notify(s.advertisementEvent)
 	}
 
-	h, err := resp.Add(service)
+	s.dmux.Lock()
+	s.announced = s.service()
+	err = resp.Announce(s.announced)
+	s.dmux.Unlock()
 	if err != nil {
-		return err
+		return s.advertisementFailed(err)
 	}
-	s.handle = h
+	s.advertisementEvent(AdvertisementEvent{State: AdvertisementAnnounced, Name: s.announced.Name})
 
 	dnsCtx, dnsCancel := context.WithCancel(ctx)
 	defer dnsCancel()
 
+	s.mux.Lock()
+	s.advertising = true
+	s.mux.Unlock()
+
 	dnsStop := make(chan struct{})
 	go func() {
-		resp.Respond(dnsCtx)
-		log.Debug.Println("dnssd responder stopped")
+		<-dnsCtx.Done()
+		s.dmux.Lock()
+		s.mux.Lock()
+		s.advertising = false
+		s.mux.Unlock()
+		if err := resp.Withdraw(); err != nil {
+			s.advertisementFailed(err)
+		} else {
+			s.advertisementEvent(AdvertisementEvent{State: AdvertisementWithdrawn})
+		}
+		s.dmux.Unlock()
 		dnsStop <- struct{}{}
 	}()
 
 	log.Debug.Println("listening at", ln.Addr())
 
+	go s.watchStore(dnsCtx)
+	go s.watchInterfaces(dnsCtx)
+
+	if s.MetricsAddr != "" {
+		go s.serveMetrics(dnsCtx, s.MetricsAddr)
+	}
+
+	if s.HealthAddr != "" {
+		go s.serveHealth(dnsCtx, s.HealthAddr)
+	}
+	go s.reapPairSetupSessions(dnsCtx)
+
+	if s.Systemd {
+		if err := sdNotify("READY=1"); err != nil {
+			log.Info.Println("systemd:", err)
+		}
+		go s.watchdog(dnsCtx)
+	}
+
 	serverCtx, serverCancel := context.WithCancel(ctx)
 	defer serverCancel()
 
 	serverStop := make(chan struct{})
 	go func() {
 		<-serverCtx.Done()
-		s.ss.Close()
+		if s.Systemd {
+			sdNotify("STOPPING=1")
+		}
+		s.mux.Lock()
+		s.ln = nil
+		s.mux.Unlock()
+		s.stopHTTPServer()
 		ln.Close()
 		log.Debug.Println("http server stopped")
 		serverStop <- struct{}{}
@@ -267,64 +638,145 @@ func (s *Server) listenAndServe(ctx context.Context) error {
 }
 
 func (s *Server) add(as []*accessory.A) error {
-	aid := uint64(1)
-	for _, a := range as {
-		if a.Name() == "" {
-			return errors.New("invalid accessory name")
+	aids := map[uint64]interface{}{}
+	keys := map[string]int{}
+	for i, a := range as {
+		key := uniqueKey(keys, accessoryKey(a))
+		if a.Id == 0 && i == 0 {
+			// The main accessory (bridge) has always the id 1.
+			a.Id = 1
+		} else if a.Id == 0 {
+			aid, err := s.ids.Aid(key)
+			if err != nil {
+				return err
+			}
+			a.Id = aid
 		}
 
-		if a.Id == 0 {
-			a.Id = aid
-			aid++
+		if _, alreadyExists := aids[a.Id]; alreadyExists {
+			return fmt.Errorf("accessory id %d already exists (%s)", a.Id, a.Name())
 		}
+		aids[a.Id] = struct{}{}
 
-		iids := map[uint64]interface{}{}
-		var iid uint64 = 1
-		for _, s := range a.Ss {
-			if s.Id == 0 {
-				s.Id = iid
-				iid++
-			}
+		if err := s.setup(a); err != nil {
+			return err
+		}
+	}
+
+	if err := s.saveIDs(); err != nil {
+		return err
+	}
 
-			if _, alreadyExists := iids[s.Id]; alreadyExists {
-				return fmt.Errorf("service id %d already exists (%s)", s.Id, a.Name())
+	return s.updateConfigHash(as)
+}
+
+// setup assigns the instance ids of the services and characteristics
+// of a and registers the callbacks to send notifications.
+func (s *Server) setup(a *accessory.A) error {
+	srv := s
+	if a.Name() == "" {
+		return errors.New("invalid accessory name")
+	}
+
+	iids := map[uint64]interface{}{}
+	keys := map[string]int{}
+	for _, s := range a.Ss {
+		skey := uniqueKey(keys, s.Type)
+		if s.Id == 0 {
+			iid, err := srv.ids.Iid(a.Id, skey)
+			if err != nil {
+				return err
 			}
-			iids[s.Id] = struct{}{}
+			s.Id = iid
+		}
 
-			for _, c := range s.Cs {
-				// Create a local variable before
-				// capturing them in a function.
-				a := a
+		if _, alreadyExists := iids[s.Id]; alreadyExists {
+			return fmt.Errorf("service id %d already exists (%s)", s.Id, a.Name())
+		}
+		iids[s.Id] = struct{}{}
 
-				if c.Id == 0 {
-					c.Id = iid
-					iid++
+		for _, c := range s.Cs {
+			if c.Id == 0 {
+				iid, err := srv.ids.Iid(a.Id, uniqueKey(keys, skey+"/"+c.Type))
+				if err != nil {
+					return err
 				}
+				c.Id = iid
+			}
 
-				if _, alreadyExists := iids[c.Id]; alreadyExists {
-					return fmt.Errorf("characteristic id %d already exists (%s)", c.Id, a.Name())
-				}
+			if _, alreadyExists := iids[c.Id]; alreadyExists {
+				return fmt.Errorf("characteristic id %d already exists (%s)", c.Id, a.Name())
+			}
 
-				iids[c.Id] = struct{}{}
+			iids[c.Id] = struct{}{}
 
-				// If the value of a characteristic changes, we notify all connected clients.
-				// The identify characteristic is a special case where we all accessory.IdentifyFunc.
-				if c.Type == characteristic.TypeIdentify {
-					c.OnCValueUpdate(func(c *characteristic.C, new, old interface{}, req *http.Request) {
-						if b, ok := new.(bool); ok && b && a.IdentifyFunc != nil {
-							a.IdentifyFunc(req)
-						}
-					})
-				} else {
+			// Callbacks are only registered once, even if
+			// the accessory is set up again after changes.
+			if _, ok := srv.configured[c]; ok {
+				continue
+			}
+			srv.configured[c] = struct{}{}
+
+			// If the value of a characteristic changes, we notify all connected clients.
+			// The identify characteristic is a special case where we identify the accessory.
+			if c.Type == characteristic.TypeIdentify {
+				c.OnCValueUpdate(func(c *characteristic.C, new, old interface{}, req *http.Request) {
+					if b, ok := new.(bool); ok && b {
+						srv.identifyAccessory(a, req)
+					}
+				})
+			} else {
+				// A new firmware or hardware revision
+				// increments the configuration number.
+				if isRevision(c) {
 					c.OnCValueUpdate(func(c *characteristic.C, new, old interface{}, req *http.Request) {
-						// send notification to all subscribed clients
-						sendNotification(a, c, req)
+						srv.revisionChanged()
 					})
 				}
+
+				c.OnCValueUpdate(func(c *characteristic.C, new, old interface{}, req *http.Request) {
+					srv.characteristicEvent(a, c, new)
+
+					if srv.PersistValues && isPersistent(c) && !srv.st.readOnly() {
+						if err := srv.saveValue(a, c); err != nil {
+							log.Info.Println(err)
+						}
+					}
+
+					// Events are paused while the accessory is in maintenance mode.
+					if a.InMaintenance() {
+						return
+					}
+					// send notification to all subscribed clients
+					srv.notify(a, c, req)
+				})
 			}
 		}
 	}
 
+	if _, ok := srv.configured[a]; ok {
+		return nil
+	}
+	srv.configured[a] = struct{}{}
+
+	// When the accessory leaves maintenance mode, the
+	// controllers are notified about the current state.
+	a.OnMaintenanceChange(func(on bool, reason string) {
+		if on {
+			log.Info.Printf("%s entered maintenance mode: %s\n", a.Name(), reason)
+			return
+		}
+
+		log.Info.Printf("%s left maintenance mode\n", a.Name())
+		srv.refresh(a)
+	})
+
+	return nil
+}
+
+// updateConfigHash increments the configuration number (c#)
+// if the accessory database as differs from the last published one.
+func (s *Server) updateConfigHash(as []*accessory.A) error {
 	// The server keeps track of previously published accessories.
 	// If the accessory changed (added service or characteristics)
 	// from last time, we have to update the version flag.
@@ -334,16 +786,30 @@ func (s *Server) add(as []*accessory.A) error {
 		oldHash = b
 	}
 	newHash = configHash(as)
-	if !reflect.DeepEqual(oldHash, newHash) {
-		s.version += 1
-		s.st.Set("version", []byte(fmt.Sprintf("%d", s.version)))
-		s.st.Set("configHash", newHash)
+	if !reflect.DeepEqual(oldHash, newHash) && s.st.readOnly() {
+		log.Info.Println("accessory configuration changed but the store is read-only")
+	} else if !reflect.DeepEqual(oldHash, newHash) {
+		// The version is persisted before the hash. If the process
+		// crashes in between, the version is incremented again on the
+		// next start, which is harmless – a stale version is not.
+		v, err := s.st.incrementCounter(keyConfigNumber)
+		if err != nil {
+			return err
+		}
+		s.version = v
+		if err := s.st.Set("configHash", newHash); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (s *Server) prepare() error {
+// prepareKeyPair loads the stored key pair or generates a new one.
+func (s *Server) prepareKeyPair() error {
+	s.kmu.Lock()
+	defer s.kmu.Unlock()
+
 	if allZero(s.Key.Public[:]) || allZero(s.Key.Private[:]) {
 		// Load keypair or generate a new one.
 		keypair, err := s.st.KeyPair()
@@ -361,7 +827,19 @@ func (s *Server) prepare() error {
 		}
 	}
 
-	if s.Pin == "" {
+	if s.Paranoid {
+		s.lockKeyPair(s.Key)
+	}
+
+	return nil
+}
+
+func (s *Server) prepare() error {
+	if err := s.prepareKeyPair(); err != nil {
+		return err
+	}
+
+	if s.Pin == "" && s.Verifier == nil && s.PinFunc == nil {
 		s.Pin = "00102003" // default pincode
 	}
 
@@ -369,75 +847,147 @@ func (s *Server) prepare() error {
 		s.Protocol = "1.0"
 	}
 
-	if len(s.Pin) != 8 {
-		return fmt.Errorf("invald pin length %d", len(s.Pin))
-	} else if _, found := InvalidPins[s.Pin]; found {
-		return fmt.Errorf("insecure pin %s", s.Pin)
+	// The accessories may have changed since the server was created.
+	if err := s.UpdateConfiguration(); err != nil {
+		return err
+	}
+
+	if s.PersistValues {
+		s.restoreValues()
+	}
+
+	if s.PersistSubscriptions {
+		s.loadSubscriptions()
+	}
+
+	if s.PinFunc == nil && s.Verifier == nil {
+		return validatePin(s.Pin)
 	}
 
 	return nil
 }
 
-func (s *Server) connStateEvent(conn net.Conn, event http.ConnState) {
-	if event == http.StateClosed {
-		addr := conn.RemoteAddr().String()
+func (s *Server) connStateEvent(nc net.Conn, event http.ConnState) {
+	switch event {
+	case http.StateNew:
+		if c, ok := nc.(*conn); ok {
+			c.maxMessageSize = s.maxRequestSize() + maxHeaderBytes
+			c.receiveTimeout = s.receiveTimeout()
+			c.packetLimit = s.sessionPacketLimit()
+			c.logHandler = s.LogHandler
+			s.mux.Lock()
+			s.cons[nc] = c
+			s.mux.Unlock()
+		}
+	case http.StateClosed:
+		addr := nc.RemoteAddr().String()
+		ss, _ := s.getSession(nc)
+
 		s.mux.Lock()
-		delete(s.sess, addr)
-		delete(s.cons, addr)
+		if v, ok := s.sess[nc]; ok {
+			clearSession(v)
+		}
+		delete(s.sess, nc)
+		delete(s.cons, nc)
+		delete(s.frags, nc)
 		s.mux.Unlock()
+
+		if s.unsubscribeAll(addr) && ss != nil {
+			s.unsubscribed(addr, ss.Pairing)
+		}
+	}
+}
+
+// getConn returns the connection on which the request was received.
+func (s *Server) getConn(req *http.Request) *conn {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.cons[reqConn(req)]
+}
+
+// conns returns the open connections.
+func (s *Server) conns() map[net.Conn]*conn {
+	copy := map[net.Conn]*conn{}
+	s.mux.Lock()
+	for k, v := range s.cons {
+		copy[k] = v
 	}
+	s.mux.Unlock()
+
+	return copy
 }
 
-func (s *Server) getSession(addr string) (*session, error) {
+func (s *Server) getSession(c net.Conn) (*session, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	if v, ok := s.sess[addr]; ok {
+	if v, ok := s.sess[c]; ok {
 		if s, ok := v.(*session); ok {
 			return s, nil
 		}
 		return nil, fmt.Errorf("unexpected session %T", v)
 	}
 
-	return nil, fmt.Errorf("no session for %s", addr)
+	return nil, errors.New("no session")
 }
 
-func (s *Server) getPairVerifySession(addr string) (*pairVerifySession, error) {
+func (s *Server) getPairVerifySession(c net.Conn) (*pairVerifySession, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	if v, ok := s.sess[addr]; ok {
+	if v, ok := s.sess[c]; ok {
 		if s, ok := v.(*pairVerifySession); ok {
 			return s, nil
 		}
 		return nil, fmt.Errorf("unexpected session %T", v)
 	}
 
-	return nil, fmt.Errorf("no session for %s", addr)
+	return nil, errors.New("no session")
 }
 
-func (s *Server) getPairSetupSession(addr string) (*pairSetupSession, error) {
+func (s *Server) getPairSetupSession(c net.Conn) (*pairSetupSession, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	if v, ok := s.sess[addr]; ok {
+	if v, ok := s.sess[c]; ok {
 		if s, ok := v.(*pairSetupSession); ok {
 			return s, nil
 		}
 		return nil, fmt.Errorf("unexpected session %T", v)
 	}
 
-	return nil, fmt.Errorf("no session for %s", addr)
+	return nil, errors.New("no session")
 }
 
-func (s *Server) setSession(addr string, v interface{}) {
+func (s *Server) setSession(c net.Conn, v interface{}) {
 	s.mux.Lock()
-	s.sess[addr] = v
+	// The encryption session of the connection might still be
+	// used to send the response and is cleared when it's closed.
+	if old, ok := s.sess[c]; ok && old != v {
+		if _, ok := old.(*session); !ok {
+			clearSession(old)
+		}
+	}
+	s.sess[c] = v
 	s.mux.Unlock()
 }
 
-func (s *Server) sessions() map[string]interface{} {
-	copy := map[string]interface{}{}
+// clearSession zeros the key material of a session,
+// which isn't used anymore.
+func clearSession(v interface{}) {
+	switch v := v.(type) {
+	case *session:
+		v.clear()
+	case *pairSetupSession:
+		v.clear()
+	case *pairVerifySession:
+		v.clear()
+	}
+}
+
+func (s *Server) sessions() map[net.Conn]interface{} {
+	copy := map[net.Conn]interface{}{}
 	s.mux.Lock()
 	for k, v := range s.sess {
 		copy[k] = v
@@ -447,35 +997,99 @@ func (s *Server) sessions() map[string]interface{} {
 	return copy
 }
 
-func (s *Server) savePairing(p Pairing) error {
-	err := s.st.SavePairing(p)
+func (s *Server) savePairing(ctx context.Context, p Pairing) error {
+	s.pcache.delete(p.Name)
+	err := s.storer(ctx).SavePairing(p)
 	if err != nil {
 		return err
 	}
 
 	s.updateTxtRecords()
+	s.record(ctx, audit.Event{
+		Kind:    audit.PairingAdded,
+		Subject: p.Name,
+		Admin:   p.Permission == PermissionAdmin,
+	})
+	s.pairingAdded(p)
 	return nil
 }
 
-func (s *Server) deletePairing(p Pairing) error {
-	err := s.st.DeletePairing(p.Name)
+func (s *Server) deletePairing(ctx context.Context, p Pairing) error {
+	s.pcache.delete(p.Name)
+	err := s.storer(ctx).DeletePairing(p.Name)
 	if err != nil {
 		return err
 	}
 
 	s.updateTxtRecords()
+	s.record(ctx, audit.Event{
+		Kind:    audit.PairingRemoved,
+		Subject: p.Name,
+	})
+	s.pairingRemoved(p)
 	return nil
 }
 
-func (s *Server) deleteAllPairings() {
+// deleteAllPairings removes all pairings. The reason is recorded
+// in the audit events of the removed pairings.
+func (s *Server) deleteAllPairings(reason string) {
+	s.pcache.clear()
 	for _, p := range s.st.Pairings() {
-		s.st.DeletePairing(p.Name)
+		if err := s.st.DeletePairing(p.Name); err == nil {
+			s.record(context.Background(), audit.Event{
+				Kind:    audit.PairingRemoved,
+				Subject: p.Name,
+				Reason:  reason,
+			})
+			s.pairingRemoved(p)
+		}
 	}
+	// A split pair-setup is not possible after unpairing.
+	s.st.Delete(keySplitVerifier)
 	s.updateTxtRecords()
 }
 
-func (s *Server) pairedWithAdmin() bool {
-	for _, p := range s.st.Pairings() {
+func (s *Server) pairingAdded(p Pairing) {
+	if s.PairingAddedFunc != nil {
+		s.PairingAddedFunc(p)
+	}
+
+	s.updatePairedState()
+}
+
+func (s *Server) pairingRemoved(p Pairing) {
+	s.removeSubscriptions(p.Name)
+
+	if s.PairingRemovedFunc != nil {
+		s.PairingRemovedFunc(p)
+	}
+
+	s.updatePairedState()
+}
+
+// updatePairedState calls PairedFunc or UnpairedFunc
+// when the pairing state of the accessory changed.
+func (s *Server) updatePairedState() {
+	paired := s.IsPaired()
+
+	s.mux.Lock()
+	changed := s.paired != paired
+	s.paired = paired
+	s.mux.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if paired && s.PairedFunc != nil {
+		s.PairedFunc()
+	} else if !paired && s.UnpairedFunc != nil {
+		s.UnpairedFunc()
+	}
+}
+
+func (s *Server) pairedWithAdmin(ctx context.Context) bool {
+	for _, p := range s.storer(ctx).Pairings() {
 		if p.Permission == PermissionAdmin {
 			return true
 		}
@@ -485,11 +1099,12 @@ func (s *Server) pairedWithAdmin() bool {
 }
 
 func (s *Server) txtRecords() map[string]string {
+	uuid, _ := s.identity()
 	return map[string]string{
 		"pv": s.Protocol,
-		"id": s.uuid,
+		"id": uuid,
 		"c#": fmt.Sprintf("%d", s.version),
-		"s#": "1",
+		"s#": fmt.Sprintf("%d", s.StateNumber()),
 		"sf": fmt.Sprintf("%d", to.Int64(!s.IsPaired())),
 		"ff": fmt.Sprintf("%d", to.Int64(s.MfiCompliant)),
 		"md": s.a.Name(),
@@ -499,7 +1114,8 @@ func (s *Server) txtRecords() map[string]string {
 }
 
 func (s *Server) setupHash() string {
-	hashvalue := fmt.Sprintf("%s%s", s.SetupId, s.uuid)
+	uuid, _ := s.identity()
+	hashvalue := fmt.Sprintf("%s%s", s.SetupId, uuid)
 	sum := sha512.Sum512([]byte(hashvalue))
 	// use only first 4 bytes
 	code := []byte{sum[0], sum[1], sum[2], sum[3]}
@@ -508,29 +1124,92 @@ func (s *Server) setupHash() string {
 }
 
 func (s *Server) updateTxtRecords() {
-	if s.handle != nil {
-		s.handle.UpdateText(s.txtRecords(), s.responder)
+	// errors are reported as advertisement events
+	s.UpdateAdvertisement()
+}
+
+// UpdateAdvertisement recomputes the txt records (c#, s#, sf, sh, …)
+// of the announced service and republishes them, if they changed.
+// If the name of the accessory changed, the service is announced again.
+// The server calls it when the configuration or the pairings change;
+// call it after changing fields like SetupId at runtime.
+func (s *Server) UpdateAdvertisement() error {
+	s.updateNFC()
+
+	s.dmux.Lock()
+	defer s.dmux.Unlock()
+
+	s.mux.Lock()
+	advertising := s.advertising
+	s.mux.Unlock()
+
+	if !advertising {
+		return nil
+	}
+
+	service := s.service()
+	switch {
+	case service.Name != s.announced.Name:
+		return s.announce(service)
+	case reflect.DeepEqual(service.Text, s.announced.Text):
+		return nil
+	default:
+		if err := s.responder().UpdateText(service.Text); err != nil {
+			return s.advertisementFailed(err)
+		}
+	}
+
+	s.announced = service
+
+	return nil
+}
+
+// responder returns the responder, which announces the server.
+func (s *Server) responder() Responder {
+	if s.Responder != nil {
+		return s.Responder
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.defaultResponder == nil {
+		s.defaultResponder = newDNSSDResponder()
 	}
+
+	return s.defaultResponder
 }
 
-func (s *Server) service() (dnssd.Service, error) {
+func (s *Server) service() DNSSDService {
 	// 2016-03-14(brutella): Replace whitespaces (" ") from service name
 	// with underscores ("_")to fix invalid http host header field value
 	// produces by iOS.
 	//
 	// [Radar] http://openradar.appspot.com/radar?id=4931940373233664
 	stripped := strings.Replace(s.a.Info.Name.Value(), " ", "_", -1)
-	cfg := dnssd.Config{
+	uuid, _ := s.identity()
+
+	// The listener is set to nil when the server stops.
+	s.mux.Lock()
+	ln, port := s.ln, s.port
+	s.mux.Unlock()
+
+	// Announce only the addresses the server listens on.
+	var ips []net.IP
+	ifaces := s.Ifaces
+	if ln != nil {
+		ips, ifaces = announcedAddrs(ln.Addr(), s.network(), s.Ifaces)
+	}
+
+	return DNSSDService{
 		Name:   normalize(stripped),
 		Type:   "_hap._tcp",
 		Domain: "local",
-		Host:   strings.Replace(s.uuid, ":", "", -1), // use the id (without the colons) to get unique hostnames
+		Host:   strings.Replace(uuid, ":", "", -1), // use the id (without the colons) to get unique hostnames
 		Text:   s.txtRecords(),
-		Port:   s.port,
-		Ifaces: s.Ifaces,
+		Port:   port,
+		IPs:    ips,
+		Ifaces: ifaces,
 	}
-
-	return dnssd.NewService(cfg)
 }
 
 var InvalidPins = map[string]bool{
@@ -548,8 +1227,47 @@ var InvalidPins = map[string]bool{
 	"87654321": true,
 }
 
-func (s *Server) fmtPin() string {
-	runes := bytes.Runes([]byte(s.Pin))
+// setupPin returns the pincode for a new pair-setup.
+func (s *Server) setupPin() (string, error) {
+	pin := s.Pin
+	if s.PinFunc != nil {
+		pin = s.PinFunc()
+	}
+
+	if err := validatePin(pin); err != nil {
+		return "", err
+	}
+
+	return pin, nil
+}
+
+func validatePin(pin string) error {
+	if len(pin) != 8 {
+		return fmt.Errorf("invald pin length %d", len(pin))
+	} else if _, found := InvalidPins[pin]; found {
+		return fmt.Errorf("insecure pin %s", pin)
+	}
+
+	return nil
+}
+
+// RandomPin returns a random pincode, which is not in InvalidPins.
+func RandomPin() string {
+	for {
+		var b [4]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+
+		pin := fmt.Sprintf("%08d", binary.BigEndian.Uint32(b[:])%100000000)
+		if _, found := InvalidPins[pin]; !found {
+			return pin
+		}
+	}
+}
+
+func fmtPin(pin string) string {
+	runes := bytes.Runes([]byte(pin))
 	first := string(runes[:3])
 	second := string(runes[3:5])
 	third := string(runes[5:])
@@ -3,14 +3,23 @@ package hap
 import (
 	"github.com/brutella/hap/accessory"
 	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/log"
 	"github.com/brutella/hap/service"
 
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // TestConfigHash tests if the server updates the config hash
@@ -51,7 +60,7 @@ func TestIdentify(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/identify", nil)
 	w := httptest.NewRecorder()
 
-	s.setSession(req.RemoteAddr, &session{})
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
 
 	var identified bool
 	a.IdentifyFunc = func(r *http.Request) {
@@ -85,7 +94,7 @@ func TestSetValueRequestSuccess(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
 	w := httptest.NewRecorder()
 
-	s.setSession(req.RemoteAddr, &session{})
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
 
 	var setValueRequestFunc, onValueUpdateFunc bool
 	a.Outlet.On.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
@@ -145,7 +154,7 @@ func TestWriteResponseCharacteristic(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
 		w := httptest.NewRecorder()
 
-		s.setSession(req.RemoteAddr, &session{})
+		s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
 
 		setValueRequestFunc := false
 		c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
@@ -179,6 +188,49 @@ func TestWriteResponseCharacteristic(t *testing.T) {
 			t.Fatalf("%v != %v", is, want)
 		}
 	})
+
+	t.Run("put same value", func(t *testing.T) {
+		body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":\"ABC\",\"r\":true}],\"pid\":0}", a.Id, c.Id)
+		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+		w := httptest.NewRecorder()
+
+		s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+
+		n := 0
+		c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
+			n++
+			return "GHI", 0
+		}
+
+		s.ss.Handler.ServeHTTP(w, req)
+
+		if is, want := n, 1; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+
+		body = fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":\"GHI\",\"status\":0}]}", a.Id, c.Id)
+		if is, want := w.Body.String(), body; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	})
+
+	t.Run("put without response", func(t *testing.T) {
+		body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":\"ABC\"}],\"pid\":0}", a.Id, c.Id)
+		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+		w := httptest.NewRecorder()
+
+		s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+
+		c.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
+			return "DEF", 0
+		}
+
+		s.ss.Handler.ServeHTTP(w, req)
+
+		if is, want := w.Code, http.StatusNoContent; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	})
 }
 
 func TestPrepareValueRequest(t *testing.T) {
@@ -193,7 +245,7 @@ func TestPrepareValueRequest(t *testing.T) {
 	t.Run("prepare", func(t *testing.T) {
 		body := fmt.Sprintf("{\"ttl\":500,\"pid\":123456789}")
 		req := httptest.NewRequest(http.MethodPut, "/prepare", bytes.NewBuffer([]byte(body)))
-		s.setSession(req.RemoteAddr, &session{})
+		s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
 
 		w := httptest.NewRecorder()
 
@@ -274,7 +326,7 @@ func TestSetValueRequestFailure(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
 	w := httptest.NewRecorder()
 
-	s.setSession(req.RemoteAddr, &session{})
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
 
 	a.Outlet.On.SetValueRequestFunc = func(v interface{}, r *http.Request) (interface{}, int) {
 		return nil, JsonStatusResourceBusy
@@ -315,7 +367,7 @@ func TestGetProgrammableSwitchEvent(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/characteristics?id=%d.%d", a.Id, c.Id), nil)
 	w := httptest.NewRecorder()
 
-	srv.setSession(req.RemoteAddr, &session{})
+	srv.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
 	srv.ss.Handler.ServeHTTP(w, req)
 
 	r := w.Result()
@@ -352,7 +404,7 @@ func TestGetValueRequestPartialFailure(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/characteristics?id=%d.%d,%[1]d.%[3]d", a.Id, sw1.Id, sw2.Id), nil)
 	w := httptest.NewRecorder()
 
-	srv.setSession(req.RemoteAddr, &session{})
+	srv.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
 	srv.ss.Handler.ServeHTTP(w, req)
 
 	r := w.Result()
@@ -371,6 +423,61 @@ func TestGetValueRequestPartialFailure(t *testing.T) {
 	}
 }
 
+func TestReadTimeout(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+	a.Outlet.On.OnValueRequestContext(func(ctx context.Context) (bool, error) {
+		<-ctx.Done()
+		return false, ctx.Err()
+	})
+
+	srv, err := New(a.A, WithStore(NewMemStore()), WithReadTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/characteristics?id=%d.%d", a.Id, a.Outlet.On.Id), nil)
+	w := httptest.NewRecorder()
+
+	srv.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	srv.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Code, http.StatusMultiStatus; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"status\":%d}]}", a.Id, a.Outlet.On.Id, JsonStatusOperationTimedOut)
+	if is, want := w.Body.String(), body; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestRejectOutOfRange(t *testing.T) {
+	a := accessory.NewLightbulb(accessory.Info{Name: "ABC"})
+	brightness := characteristic.NewBrightness()
+	a.Lightbulb.AddC(brightness.C)
+
+	s, err := New(a.A, WithStore(NewMemStore()), WithRejectOutOfRange())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":120}]}", a.Id, brightness.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	body = fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"status\":%d}]}", a.Id, brightness.Id, JsonStatusInvalidValueInRequest)
+	if is, want := w.Body.String(), body; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := brightness.Value(), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
 func TestStringNormalization(t *testing.T) {
 	tests := []struct {
 		is   string
@@ -386,3 +493,657 @@ func TestStringNormalization(t *testing.T) {
 		}
 	}
 }
+
+func TestMaintenanceMode(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	srv, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.SetMaintenance(true, "firmware update")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/characteristics?id=%d.%d", a.Id, a.Outlet.On.Id), nil)
+	w := httptest.NewRecorder()
+
+	srv.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	srv.ss.Handler.ServeHTTP(w, req)
+
+	r := w.Result()
+	if is, want := r.StatusCode, http.StatusMultiStatus; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"status\":%d}]}", a.Id, a.Outlet.On.Id, JsonStatusServiceCommunicationFailure)
+	if is, want := string(b), body; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	a.SetMaintenance(false, "")
+
+	w = httptest.NewRecorder()
+	srv.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Result().StatusCode, http.StatusOK; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestEndpointMetrics(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	srv, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accessories", nil)
+	w := httptest.NewRecorder()
+
+	srv.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	srv.ss.Handler.ServeHTTP(w, req)
+
+	m, ok := srv.EndpointMetrics()["/accessories"]
+	if !ok {
+		t.Fatal("no metrics for /accessories")
+	}
+
+	if is, want := m.Latency.Count, uint64(1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := m.ResponseSize.Sum, float64(w.Body.Len()); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	srv, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/characteristics?id=%d.%d", a.Id, a.Outlet.On.Id), nil)
+	w := httptest.NewRecorder()
+
+	srv.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	srv.ss.Handler.ServeHTTP(w, req)
+
+	m := srv.Metrics()
+	if is, want := m.Sessions, 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := m.Reads.Count, uint64(1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w = httptest.NewRecorder()
+	srv.MetricsHandler().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"hap_sessions 1\n",
+		"hap_characteristic_read_seconds_count 1\n",
+		"hap_http_request_duration_seconds_bucket{endpoint=\"/characteristics\",le=\"+Inf\"} 1\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("%q not in\n%s", line, body)
+		}
+	}
+}
+
+func TestUnsubscribedFunc(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	srv, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unsubscribed bool
+	srv.UnsubscribedFunc = func(addr string, p Pairing) {
+		if is, want := p.Name, "ctrl"; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+		unsubscribed = true
+	}
+
+	put := func(ev bool) {
+		body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"ev\":%t}]}", a.Id, a.Outlet.On.Id, ev)
+		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+		srv.setSession(reqConn(req), &session{Pairing: Pairing{Name: "ctrl"}})
+		srv.ss.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	put(true)
+	if is, want := unsubscribed, false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	put(false)
+	if is, want := unsubscribed, true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+type checkedResponder struct {
+	testResponder
+	checked bool
+}
+
+func (r *checkedResponder) Check() error {
+	r.checked = true
+	return nil
+}
+
+func TestSelfTest(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	st := NewMemStore()
+	srv, err := NewServer(st, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Addr = "127.0.0.1:0"
+	r := &checkedResponder{}
+	srv.Responder = r
+
+	before := st.Snapshot()
+
+	if err := srv.SelfTest().Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.checked {
+		t.Fatal("responder not checked")
+	}
+
+	// The self-test doesn't change the server or the store.
+	if is, want := srv.Pin, ""; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := st.Snapshot(), before; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The stored keypair is checked.
+	if err := srv.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Key = KeyPair{}
+	st.Set("keypair", []byte("{}"))
+	if err := srv.SelfTest().Err(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPersistValues(t *testing.T) {
+	st := NewMemStore()
+
+	a := accessory.NewLightbulb(accessory.Info{Name: "ABC"})
+	s, err := NewServer(st, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PersistValues = true
+	a.Lightbulb.On.SetValue(true)
+
+	b := accessory.NewLightbulb(accessory.Info{Name: "ABC"})
+	s, err = NewServer(st, b.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PersistValues = true
+	if err := s.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := b.Lightbulb.On.Value(), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestSessionsByConnection(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1, _ := net.Pipe()
+	c2, _ := net.Pipe()
+	conn1, conn2 := newConn(c1), newConn(c2)
+	s.connStateEvent(conn1, http.StateNew)
+	s.connStateEvent(conn2, http.StateNew)
+
+	req := httptest.NewRequest(http.MethodGet, "/accessories", nil)
+	req = req.WithContext(connContext(req.Context(), conn1))
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+
+	if is, want := s.getConn(req), conn1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := s.getSession(conn2); err == nil {
+		t.Fatal("expected error")
+	}
+
+	s.connStateEvent(conn1, http.StateClosed)
+	if _, err := s.getSession(conn1); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if is, want := len(s.conns()), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestEventQueue(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	m := newMetrics()
+	c := newConn(c1)
+	c.metrics = m
+
+	if is, want := c.sendEvent([]byte("event")), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c2, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(b), "event"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The controller doesn't read the events. The writer blocks
+	// on the first event and the queue fills up.
+	var dropped int
+	for i := 0; i < eventQueueSize+2; i++ {
+		if !c.sendEvent([]byte("event")) {
+			dropped++
+		}
+	}
+
+	if dropped == 0 {
+		t.Fatal("expected dropped events")
+	}
+
+	if is, want := atomic.LoadUint64(&m.droppedEvents), uint64(dropped); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// closing the connection stops the writer
+	c.Close()
+	if _, err := c2.Read(b); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEventDrain(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	c := newConn(c1)
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		c.sendEvent([]byte("event"))
+	}
+
+	// The controller doesn't read the events.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	c.drain(ctx)
+	cancel()
+
+	if atomic.LoadInt32(&c.pending) == 0 {
+		t.Fatal("expected pending events")
+	}
+
+	go io.Copy(ioutil.Discard, c2)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.drain(ctx)
+
+	if is, want := atomic.LoadInt32(&c.pending), int32(0); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []Op
+	s.Authorize = func(p Pairing, aid, iid uint64, op Op) bool {
+		ops = append(ops, op)
+		return p.Permission == PermissionAdmin || op == OpRead
+	}
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true}]}", a.Id, a.Outlet.On.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "user", Permission: PermissionUser}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Result().StatusCode, http.StatusMultiStatus; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := a.Outlet.On.Value(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/characteristics?id=%d.%d", a.Id, a.Outlet.On.Id), nil)
+	w = httptest.NewRecorder()
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Result().StatusCode, http.StatusOK; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := fmt.Sprint(ops), "[write read]"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestContextPairing(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	a.Outlet.On.OnSetRemoteValueContext(func(ctx context.Context, v bool) error {
+		p, _ := ContextPairing(ctx)
+		name = p.Name
+		return context.DeadlineExceeded
+	})
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true}]}", a.Id, a.Outlet.On.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "admin", Permission: PermissionAdmin}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := name, "admin"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := strings.Contains(w.Body.String(), "-70408"), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestChangeEventPairing(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e characteristic.ChangeEvent
+	a.Outlet.On.OnChange(func(ce characteristic.ChangeEvent) {
+		e = ce
+	})
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true}]}", a.Id, a.Outlet.On.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "admin", Permission: PermissionAdmin}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := e.Origin, characteristic.OriginRemote; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := e.Pairing, "admin"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestOnCharacteristicEvent(t *testing.T) {
+	b := accessory.NewBridge(accessory.Info{Name: "Bridge"})
+	a := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+
+	s, err := NewServer(NewMemStore(), b.A, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	s.OnCharacteristicEvent(func(aid, iid uint64, v interface{}) {
+		events = append(events, fmt.Sprintf("%d.%d=%v", aid, iid, v))
+	})
+
+	a.Outlet.OutletInUse.SetValue(true)
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true}]}", a.Id, a.Outlet.On.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	want := fmt.Sprintf("[%[1]d.%[2]d=true %[1]d.%[3]d=true]", a.Id, a.Outlet.OutletInUse.Id, a.Outlet.On.Id)
+	if is := fmt.Sprint(events); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+type testLogHandler struct {
+	msgs   []string
+	fields []log.Field
+}
+
+func (h *testLogHandler) Handle(level log.Level, msg string, fields []log.Field) {
+	h.msgs = append(h.msgs, level.String()+" "+msg)
+	h.fields = append(h.fields, fields...)
+}
+
+func TestLogHandler(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &testLogHandler{}
+	s.LogHandler = h
+
+	req := httptest.NewRequest(http.MethodGet, "/accessories", nil)
+	w := httptest.NewRecorder()
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := len(h.msgs), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := h.msgs[0], "INFO request from 192.0.2.1:1234 not authorized"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := h.fields[0], log.F("addr", "192.0.2.1:1234"); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestTimedWrite(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+	a.Outlet.On.Permissions = append(a.Outlet.On.Permissions, characteristic.PermissionTimedWrite)
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(pid uint64) string {
+		body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true}],\"pid\":%d}", a.Id, a.Outlet.On.Id, pid)
+		req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+		w := httptest.NewRecorder()
+		s.ss.Handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	prepare := func(ttl, pid uint64) {
+		body := fmt.Sprintf("{\"ttl\":%d,\"pid\":%d}", ttl, pid)
+		req := httptest.NewRequest(http.MethodPut, "/prepare", bytes.NewBuffer([]byte(body)))
+		w := httptest.NewRecorder()
+		s.ss.Handler.ServeHTTP(w, req)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/prepare", nil)
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+
+	// A standard write is not allowed.
+	if body := put(0); !strings.Contains(body, "-70410") {
+		t.Fatal(body)
+	}
+
+	// The transaction id must match.
+	prepare(1000, 1)
+	if body := put(2); !strings.Contains(body, "-70410") {
+		t.Fatal(body)
+	}
+
+	// The prepared write was consumed by the previous request.
+	if body := put(1); !strings.Contains(body, "-70410") {
+		t.Fatal(body)
+	}
+
+	// The ttl has expired.
+	prepare(1, 3)
+	time.Sleep(5 * time.Millisecond)
+	if body := put(3); !strings.Contains(body, "-70410") {
+		t.Fatal(body)
+	}
+
+	if is, want := a.Outlet.On.Value(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	prepare(1000, 4)
+	if body := put(4); body != "" {
+		t.Fatal(body)
+	}
+
+	if is, want := a.Outlet.On.Value(), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	a := accessory.NewLightbulb(accessory.Info{Name: "ABC"})
+	a.Lightbulb.On.OnSetRemoteValue(func(v bool) error {
+		return characteristic.NewStatusError(JsonStatusResourceBusy, nil)
+	})
+
+	brightness := characteristic.NewBrightness()
+	a.Lightbulb.AddC(brightness.C)
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"value\":true},{\"aid\":%d,\"iid\":%d,\"value\":50}]}", a.Id, a.Lightbulb.On.Id, a.Id, brightness.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := w.Code, http.StatusMultiStatus; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	body = fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"status\":-70403},{\"aid\":%d,\"iid\":%d,\"status\":0}]}", a.Id, a.Lightbulb.On.Id, a.Id, brightness.Id)
+	if is, want := w.Body.String(), body; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := a.Lightbulb.On.Value(), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := brightness.Value(), 50; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestLinkedServices(t *testing.T) {
+	a := accessory.NewTelevision(accessory.Info{Name: "TV"})
+	hdmi := a.AddInputSource(1, "HDMI 1", characteristic.InputSourceTypeHdmi)
+
+	// duplicate links are ignored
+	a.Television.AddLinkedService(hdmi.S)
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accessories", nil)
+	w := httptest.NewRecorder()
+	s.setSession(reqConn(req), &session{Pairing: Pairing{Name: "Controller"}})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	var resp struct {
+		As []struct {
+			Ss []struct {
+				Id     uint64   `json:"iid"`
+				Linked []uint64 `json:"linked"`
+			} `json:"services"`
+		} `json:"accessories"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var linked []uint64
+	for _, svc := range resp.As[0].Ss {
+		if svc.Id == a.Television.Id {
+			linked = svc.Linked
+		}
+	}
+
+	if is, want := fmt.Sprint(linked), fmt.Sprint([]uint64{a.Speaker.Id, hdmi.Id}); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// the json representation of the service
+	b, err := json.Marshal(a.Television.S)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := strings.Contains(string(b), fmt.Sprintf(`"linked":[%d,%d]`, a.Speaker.Id, hdmi.Id)), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"github.com/brutella/hap/characteristic"
+
+	"fmt"
+)
+
+// A Builder builds a custom service, e.g. to expose
+// vendor-specific characteristics.
+//
+//	s, err := service.NewBuilder("E863F007-079E-48FF-8F27-9C2605A29F52").
+//		AddC(c).
+//		Build()
+type Builder struct {
+	s *S
+}
+
+// NewBuilder returns a builder for a service of type typ.
+func NewBuilder(typ string) *Builder {
+	return &Builder{New(typ)}
+}
+
+// AddC adds characteristics to the service.
+func (b *Builder) AddC(cs ...*characteristic.C) *Builder {
+	for _, c := range cs {
+		b.s.AddC(c)
+	}
+	return b
+}
+
+// Hidden marks the service as hidden.
+func (b *Builder) Hidden() *Builder {
+	b.s.Hidden = true
+	return b
+}
+
+// Primary marks the service as primary service.
+func (b *Builder) Primary() *Builder {
+	b.s.Primary = true
+	return b
+}
+
+// Link links other services to the service.
+func (b *Builder) Link(others ...*S) *Builder {
+	for _, o := range others {
+		b.s.AddLinkedService(o)
+	}
+	return b
+}
+
+// Build returns the service or an error, if the type of the
+// service or of a characteristic is invalid.
+func (b *Builder) Build() (*S, error) {
+	if !characteristic.ValidType(b.s.Type) {
+		return nil, fmt.Errorf("invalid type %s", b.s.Type)
+	}
+
+	types := map[string]bool{}
+	for _, c := range b.s.Cs {
+		if !characteristic.ValidType(c.Type) {
+			return nil, fmt.Errorf("invalid characteristic type %s", c.Type)
+		}
+
+		typ := characteristic.TypeString(c.Type)
+		if types[typ] {
+			return nil, fmt.Errorf("duplicate characteristic type %s", c.Type)
+		}
+		types[typ] = true
+	}
+
+	return b.s, nil
+}
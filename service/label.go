@@ -0,0 +1,26 @@
+package service
+
+import (
+	"github.com/brutella/hap/characteristic"
+)
+
+// Label numbers the services ss (1, 2, …) with a service label index
+// and returns a service label with the namespace ns (e.g.
+// characteristic.ServiceLabelNamespaceArabicNumerals).
+// The service label must be added to the accessory of the services.
+// Use it for accessories with multiple buttons or outlets.
+func Label(ns int, ss ...*S) *ServiceLabel {
+	l := NewServiceLabel()
+	l.ServiceLabelNamespace.SetValue(ns)
+
+	for i, s := range ss {
+		c := s.C(characteristic.TypeServiceLabelIndex)
+		if c == nil {
+			c = characteristic.NewServiceLabelIndex().C
+			s.AddC(c)
+		}
+		c.SetValueRequest(i+1, nil)
+	}
+
+	return l
+}
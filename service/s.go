@@ -29,10 +29,30 @@ func (s *S) AddC(c *characteristic.C) {
 	s.Cs = append(s.Cs, c)
 }
 
-func (s *S) AddS(other *S) {
+// AddLinkedService links the service other to s. The instance ids
+// of the linked services are included in the "linked" array of s in
+// the json representation, e.g. the input sources of a television or
+// the valves of an irrigation system. Both services must be added to
+// the same accessory. Linking a service again has no effect.
+func (s *S) AddLinkedService(other *S) {
+	if other == s {
+		return
+	}
+
+	for _, l := range s.Linked {
+		if l == other {
+			return
+		}
+	}
+
 	s.Linked = append(s.Linked, other)
 }
 
+// AddS links the service other to s (see AddLinkedService).
+func (s *S) AddS(other *S) {
+	s.AddLinkedService(other)
+}
+
 func (s *S) C(typ string) *characteristic.C {
 	for _, c := range s.Cs {
 		if c.Type == typ {
@@ -58,7 +78,7 @@ func (s *S) MarshalJSON() ([]byte, error) {
 		Linked  []uint64            `json:"linked,omitempty"`
 	}{
 		Id:     s.Id,
-		Type:   s.Type,
+		Type:   characteristic.TypeString(s.Type),
 		Cs:     s.Cs,
 		Linked: linked,
 	}
@@ -4,54 +4,86 @@ import (
 	"time"
 
 	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/hds"
 	"github.com/brutella/hap/hkdf"
 
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"sync"
 )
 
-var mux = &sync.Mutex{}
-var cons = make(map[string]*conn)
+type connKey struct{}
 
-func setConn(addr string, conn *conn) {
-	mux.Lock()
-	defer mux.Unlock()
-	cons[addr] = conn
+// connContext returns a context for the requests
+// of a connection which contains the connection.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
 }
 
-func getConn(req *http.Request) *conn {
-	mux.Lock()
-	defer mux.Unlock()
+// reqConn returns the connection on which the request was received.
+func reqConn(req *http.Request) net.Conn {
+	c, _ := req.Context().Value(connKey{}).(net.Conn)
+	return c
+}
 
-	if con, ok := cons[req.RemoteAddr]; !ok {
-		return nil
-	} else {
-		return con
-	}
+type pairingKey struct{}
+
+// ContextPairing returns the pairing of the controller which sent
+// the request with the context ctx. The context of requests to
+// characteristics contains the pairing, which lets callbacks
+// (e.g. SetValueRequestFunc) know which controller made a change.
+func ContextPairing(ctx context.Context) (Pairing, bool) {
+	p, ok := ctx.Value(pairingKey{}).(Pairing)
+	return p, ok
 }
 
-func conns() map[string]*conn {
-	copy := map[string]*conn{}
-	mux.Lock()
-	for k, v := range cons {
-		copy[k] = v
-	}
-	mux.Unlock()
+// withPairing adds the pairing of the verified
+// controller to the context of the requests.
+func (s *Server) withPairing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ss, err := s.getSession(reqConn(req))
+		if err != nil {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		// Sessions of transient pair-setups have no pairing.
+		if ss.Pairing.Name != "" {
+			ctx := context.WithValue(req.Context(), pairingKey{}, ss.Pairing)
+			ctx = characteristic.WithPairingName(ctx, ss.Pairing.Name)
+			ctx = hds.WithSharedSecret(ctx, ss.shared[:])
+			req = req.WithContext(ctx)
+		}
+
+		// The http server closes the connection after the response.
+		// The controller has to verify the pairing again, which
+		// results in new session keys.
+		if ss.renegotiate(s.sessionPacketLimit()) {
+			s.logInfo(req).Println("closing connection to renegotiate session keys")
+			res.Header().Set("Connection", "close")
+		}
 
-	return copy
+		next.ServeHTTP(res, req)
+	})
 }
 
 type session struct {
 	Pairing Pairing
 
+	shared       [32]byte // shared secret of pair-verify
 	encryptKey   [32]byte
 	decryptKey   [32]byte
 	encryptCount uint64
 	decryptCount uint64
+	cleared      bool // keys were zeroed
 	mu           sync.Mutex
 
 	twr *TimedWrite
@@ -62,22 +94,37 @@ type TimedWrite struct {
 	pid      uint64
 }
 
-func newSession(shared [32]byte, p Pairing) (*session, error) {
+func newSession(shared []byte, p Pairing) (*session, error) {
 	salt := []byte("Control-Salt")
 	out := []byte("Control-Read-Encryption-Key")
 	in := []byte("Control-Write-Encryption-Key")
 
+	return newSessionWithKeys(shared, salt, out, in, p)
+}
+
+// newTransientSession returns a session for a transient pair-setup.
+// The keys are derived from the srp shared secret.
+func newTransientSession(shared []byte) (*session, error) {
+	salt := []byte("SplitSetupSalt")
+	out := []byte("AccessoryEncrypt-Control")
+	in := []byte("ControllerEncrypt-Control")
+
+	return newSessionWithKeys(shared, salt, out, in, Pairing{})
+}
+
+func newSessionWithKeys(shared, salt, out, in []byte, p Pairing) (*session, error) {
 	s := &session{
 		Pairing: p,
 	}
+	copy(s.shared[:], shared)
 	var err error
-	s.encryptKey, err = hkdf.Sha512(shared[:], salt, out)
+	s.encryptKey, err = hkdf.Sha512(shared, salt, out)
 	s.encryptCount = 0
 	if err != nil {
 		return nil, err
 	}
 
-	s.decryptKey, err = hkdf.Sha512(shared[:], salt, in)
+	s.decryptKey, err = hkdf.Sha512(shared, salt, in)
 	s.decryptCount = 0
 
 	return s, err
@@ -91,6 +138,15 @@ func (s *session) Encrypt(r io.Reader) (io.Reader, error) {
 	for _, p := range packets {
 		var nonce [8]byte
 		s.mu.Lock()
+		if s.cleared {
+			s.mu.Unlock()
+			return nil, errSessionCleared
+		}
+		if s.encryptCount >= nonceCountMax {
+			s.mu.Unlock()
+			return nil, errNonceExhausted
+		}
+		key := s.encryptKey
 		binary.LittleEndian.PutUint64(nonce[:], s.encryptCount)
 		s.encryptCount++
 		s.mu.Unlock()
@@ -98,7 +154,8 @@ func (s *session) Encrypt(r io.Reader) (io.Reader, error) {
 		bLength := make([]byte, 2)
 		binary.LittleEndian.PutUint16(bLength, uint16(p.length))
 
-		encrypted, mac, err := chacha20poly1305.EncryptAndSeal(s.encryptKey[:], nonce[:], p.value, bLength[:])
+		encrypted, mac, err := chacha20poly1305.EncryptAndSeal(key[:], nonce[:], p.value, bLength[:])
+		zero(key[:])
 		if err != nil {
 			return nil, err
 		}
@@ -111,44 +168,68 @@ func (s *session) Encrypt(r io.Reader) (io.Reader, error) {
 	return &buf, nil
 }
 
-// Decrypt returns the decrypted data
-func (s *session) Decrypt(r io.Reader) (io.Reader, error) {
+// Decrypt returns the decrypted data of the next message, which
+// consists of packets of the same format as in Encrypt. A message ends
+// with a packet shorter than packetLengthMax. An error is returned
+// for packets longer than packetLengthMax and for messages longer
+// than max bytes, before the packets are read.
+func (s *session) Decrypt(r io.Reader, max int) ([]byte, error) {
 	var buf bytes.Buffer
 	for {
-		var length uint16
-		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		var lengthBytes [2]byte
+		if _, err := io.ReadFull(r, lengthBytes[:]); err != nil {
 			if err == io.EOF {
 				break
 			}
 			return nil, err
 		}
 
+		length := int(binary.LittleEndian.Uint16(lengthBytes[:]))
+		if length > packetLengthMax {
+			return nil, fmt.Errorf("packet too long (%d bytes)", length)
+		}
+
+		if buf.Len()+length > max {
+			return nil, fmt.Errorf("message too long (more than %d bytes)", max)
+		}
+
 		var b = make([]byte, length)
-		if err := binary.Read(r, binary.LittleEndian, &b); err != nil {
+		if _, err := io.ReadFull(r, b); err != nil {
 			return nil, err
 		}
 
 		var mac [16]byte
-		if err := binary.Read(r, binary.LittleEndian, &mac); err != nil {
+		if _, err := io.ReadFull(r, mac[:]); err != nil {
 			return nil, err
 		}
 
 		var nonce [8]byte
 		s.mu.Lock()
+		if s.cleared {
+			s.mu.Unlock()
+			zero(buf.Bytes())
+			return nil, errSessionCleared
+		}
+		if s.decryptCount >= nonceCountMax {
+			s.mu.Unlock()
+			zero(buf.Bytes())
+			return nil, errNonceExhausted
+		}
+		key := s.decryptKey
 		binary.LittleEndian.PutUint64(nonce[:], s.decryptCount)
 		s.decryptCount++
 		s.mu.Unlock()
 
-		lengthBytes := make([]byte, 2)
-		binary.LittleEndian.PutUint16(lengthBytes, uint16(length))
-
-		decrypted, err := chacha20poly1305.DecryptAndVerify(s.decryptKey[:], nonce[:], b, mac, lengthBytes)
+		decrypted, err := chacha20poly1305.DecryptAndVerify(key[:], nonce[:], b, mac, lengthBytes[:])
+		zero(key[:])
 
 		if err != nil {
+			zero(buf.Bytes())
 			return nil, fmt.Errorf("Data encryption failed %s", err)
 		}
 
 		buf.Write(decrypted)
+		zero(decrypted)
 
 		// Finish when all bytes fit in b
 		if length < packetLengthMax {
@@ -156,7 +237,49 @@ func (s *session) Decrypt(r io.Reader) (io.Reader, error) {
 		}
 	}
 
-	return &buf, nil
+	return buf.Bytes(), nil
+}
+
+var (
+	errSessionCleared = errors.New("session keys were cleared")
+	errNonceExhausted = errors.New("session nonces exhausted")
+)
+
+const (
+	// nonceCountMax is the maximum number of packets, which are
+	// encrypted or decrypted with the keys of a session.
+	// Using more packets would reuse nonces. Sessions are
+	// renegotiated long before (see Server.SessionPacketLimit).
+	nonceCountMax uint64 = math.MaxUint64
+
+	// nonceCountReserve is the number of packets, which are left
+	// for the remaining messages, when a session is renegotiated.
+	nonceCountReserve uint64 = 1 << 20
+)
+
+// renegotiate returns true if limit packets were encrypted or
+// decrypted with the keys of the session and new keys are required.
+func (s *session) renegotiate(limit uint64) bool {
+	if max := nonceCountMax - nonceCountReserve; limit == 0 || limit > max {
+		limit = max
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.encryptCount >= limit || s.decryptCount >= limit
+}
+
+// clear zeros the keys of the session. The session
+// can't be used to encrypt or decrypt data afterwards.
+func (s *session) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zero(s.shared[:])
+	zero(s.encryptKey[:])
+	zero(s.decryptKey[:])
+	s.cleared = true
 }
 
 const (
@@ -0,0 +1,100 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNonceExhausted(t *testing.T) {
+	ss, ctl := testSessions(t)
+	ctl.encryptCount = nonceCountMax - 1
+
+	// The last nonce is used.
+	r, err := ctl.Encrypt(bytes.NewReader([]byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ctl.Encrypt(bytes.NewReader([]byte("hello"))); err != errNonceExhausted {
+		t.Fatalf("%v != %v", err, errNonceExhausted)
+	}
+
+	ss.decryptCount = nonceCountMax
+	if _, err := ss.Decrypt(r, 100); err != errNonceExhausted {
+		t.Fatalf("%v != %v", err, errNonceExhausted)
+	}
+}
+
+func TestRenegotiate(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "Outlet"})
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := net.Pipe()
+	ss, _ := testSessions(t)
+	s.setSession(c, ss)
+
+	h := s.withPairing(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/accessories", nil)
+		req = req.WithContext(connContext(req.Context(), c))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	if is, want := serve().Header().Get("Connection"), ""; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	ss.encryptCount = defaultSessionPacketLimit
+	if is, want := serve().Header().Get("Connection"), "close"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// The limit is configurable.
+	ss.encryptCount = 10
+	if is, want := serve().Header().Get("Connection"), ""; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.SessionPacketLimit = 10
+	if is, want := serve().Header().Get("Connection"), "close"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestRenegotiateEvents(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go io.Copy(ioutil.Discard, c2)
+
+	ss, _ := testSessions(t)
+	c := newConn(c1)
+	c.ss = ss
+	c.packetLimit = 2
+
+	c.sendEvent([]byte("event"))
+	c.sendEvent([]byte("event"))
+
+	// The connection is closed after the second event.
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed")
+	}
+
+	if is, want := ss.encryptCount, uint64(2); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,107 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"net/http"
+	"time"
+)
+
+// restartTimeout is the maximum duration to wait
+// for active requests when restarting the server.
+const restartTimeout = 5 * time.Second
+
+// newHTTPServer returns a new http server, which uses h as handler.
+func (s *Server) newHTTPServer(h http.Handler) *http.Server {
+	hs := &http.Server{
+		Handler:        h,
+		ConnState:      s.connStateEvent,
+		ConnContext:    connContext,
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+	if d := s.receiveTimeout(); d > 0 {
+		hs.ReadHeaderTimeout = d
+	}
+
+	return hs
+}
+
+// Shutdown gracefully stops the server. The accessory is removed from
+// the network (the dnssd service is unannounced) and no new connections
+// are accepted. Active requests are finished and idle connections closed.
+// If ctx is done before, the remaining connections are closed and
+// ctx.Err() is returned. Notifications, which are delayed to coalesce
+// changes (see NotificationInterval), are sent and the queued
+// notifications are written before the connections are closed.
+//
+// If PersistValues is true, the current values are saved in the store.
+// ListenAndServe returns once the server is stopped.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mux.Lock()
+	stop, done := s.stop, s.done
+	s.shutdownCtx = ctx
+	s.mux.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+
+	if s.PersistValues && !s.st.readOnly() {
+		if err := s.saveValues(); err != nil {
+			log.Info.Println("saving values:", err)
+		}
+	}
+
+	s.thr.flush()
+	for _, c := range s.conns() {
+		c.drain(ctx)
+	}
+
+	stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Restart gracefully stops and starts the server. Use it to apply
+// configuration changes (e.g. a different address or pincode).
+// Controllers reconnect when the accessory is announced again.
+func (s *Server) Restart() error {
+	s.mux.Lock()
+	running := s.stop != nil
+	s.restart = running
+	s.mux.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+
+	return s.Shutdown(ctx)
+}
+
+// stopHTTPServer stops the http server. If the server is shut down,
+// active requests are finished before closing the connections.
+func (s *Server) stopHTTPServer() {
+	s.mux.Lock()
+	ctx := s.shutdownCtx
+	s.shutdownCtx = nil
+	s.mux.Unlock()
+
+	if ctx == nil {
+		s.ss.Close()
+		return
+	}
+
+	if err := s.ss.Shutdown(ctx); err != nil {
+		log.Info.Println("shutdown:", err)
+		s.ss.Close()
+	}
+}
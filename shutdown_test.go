@@ -0,0 +1,208 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitRunning waits until the server is listening.
+func waitRunning(t *testing.T, s *Server) {
+	for i := 0; i < 100; i++ {
+		s.mux.Lock()
+		ln := s.ln
+		s.mux.Unlock()
+
+		if ln != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("server not running")
+}
+
+func TestShutdownAndRestart(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), WithAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ListenAndServe(context.Background())
+	}()
+	waitRunning(t, s)
+
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitRunning(t, s)
+
+	select {
+	case err := <-errs:
+		t.Fatalf("server stopped: %v", err)
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("server still running")
+	}
+}
+
+func TestShutdownSendsDelayedEvents(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+	s, err := New(a.A, WithStore(NewMemStore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.NotificationInterval = time.Minute
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(context.Background(), ln)
+	}()
+	waitRunning(t, s)
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The connection becomes idle after the first request.
+	rd := bufio.NewReader(c)
+	req, _ := http.NewRequest(http.MethodGet, "/accessories", nil)
+	if err := req.Write(c); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.ReadResponse(rd, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	a.Outlet.On.SetEvent(c.LocalAddr().String(), true)
+
+	// The first change is sent immediately and the second is delayed.
+	a.Outlet.On.SetValue(true)
+	a.Outlet.On.SetValue(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	b, _ := ioutil.ReadAll(rd)
+	events := strings.Split(string(b), "EVENT/1.0")
+	if is, want := len(events)-1, 2; is != want {
+		t.Fatalf("%v != %v: %s", is, want, b)
+	}
+
+	if !strings.Contains(events[2], `"value":false`) {
+		t.Fatalf("unexpected event %s", events[2])
+	}
+
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("server still running")
+	}
+}
+
+func TestServe(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(ctx, ln)
+	}()
+	waitRunning(t, s)
+
+	if is, want := s.Config().Port, ln.Addr().(*net.TCPAddr).Port; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	res, err := http.Get("http://" + ln.Addr().String() + "/accessories")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if is, want := res.StatusCode, http.StatusBadRequest; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	cancel()
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("server still running")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), WithAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := s.Health()
+	if h.Ready() {
+		t.Fatal("server not running but ready")
+	}
+
+	if is, want := h.Store, true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ListenAndServe(ctx)
+	waitRunning(t, s)
+
+	for i := 0; i < 100 && !s.Health().Ready(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	s.HealthHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if is, want := w.Code, http.StatusOK; is != want {
+		t.Fatalf("%v != %v: %s", is, want, w.Body.String())
+	}
+}
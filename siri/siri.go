@@ -0,0 +1,269 @@
+// Package siri implements Siri audio input of remotes.
+//
+// When the user presses the Siri button of a remote, the accessory opens
+// a dataSend stream over a HomeKit Data Stream (see package hds) to the
+// controller and sends the recorded audio as Opus frames.
+package siri
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/hds"
+	"github.com/brutella/hap/log"
+	"github.com/brutella/hap/rtp"
+	"github.com/brutella/hap/service"
+	"github.com/brutella/hap/tlv8"
+
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	TypeSiri                             = "133"
+	TypeSiriInputType                    = "132"
+	TypeAudioStreamManagement            = "127"
+	TypeSelectedAudioStreamConfiguration = "128"
+)
+
+// SiriInputTypePushButton is the input type of remotes,
+// which start Siri with a push button.
+const SiriInputTypePushButton = 0
+
+// Protocol and topics of the target control messages
+const (
+	ProtocolTargetControl = "targetControl"
+	TopicWhoami           = "whoami"
+)
+
+// dataSendTypeSiri is the type of dataSend streams of Siri audio.
+const dataSendTypeSiri = "audio.siri"
+
+// AudioConfiguration is the supported audio configuration.
+type AudioConfiguration struct {
+	Codecs       []AudioCodecConfiguration `tlv8:"1"`
+	ComfortNoise bool                      `tlv8:"2"`
+}
+
+type AudioCodecConfiguration struct {
+	Type       byte                 `tlv8:"1"` // e.g. rtp.AudioCodecType_Opus
+	Parameters AudioCodecParameters `tlv8:"2"`
+}
+
+type AudioCodecParameters struct {
+	Channels   byte `tlv8:"1"`
+	Bitrate    byte `tlv8:"2"` // e.g. rtp.AudioCodecBitrateVariable
+	Samplerate byte `tlv8:"3"` // e.g. rtp.AudioCodecSampleRate16Khz
+	RTPTime    byte `tlv8:"4"` // packet time in milliseconds
+}
+
+// SelectedAudioConfiguration is the audio configuration
+// selected by the controller.
+type SelectedAudioConfiguration struct {
+	Codec AudioCodecConfiguration `tlv8:"1"`
+}
+
+// DefaultAudioConfiguration returns the audio configuration of the
+// Apple TV Remote: mono Opus with 16 kHz and 20 ms frames.
+func DefaultAudioConfiguration() AudioCodecConfiguration {
+	return AudioCodecConfiguration{
+		Type: rtp.AudioCodecType_Opus,
+		Parameters: AudioCodecParameters{
+			Channels:   1,
+			Bitrate:    rtp.AudioCodecBitrateVariable,
+			Samplerate: rtp.AudioCodecSampleRate16Khz,
+			RTPTime:    20,
+		},
+	}
+}
+
+// Service is the Siri service.
+type Service struct {
+	*service.S
+
+	InputType *characteristic.Int
+}
+
+// NewService returns a Siri service of a remote with a push button.
+func NewService() *Service {
+	s := Service{}
+	s.S = service.New(TypeSiri)
+
+	s.InputType = characteristic.NewInt(TypeSiriInputType)
+	s.InputType.Format = characteristic.FormatUInt8
+	s.InputType.Permissions = []string{characteristic.PermissionRead}
+	s.InputType.SetValue(SiriInputTypePushButton)
+	s.AddC(s.InputType.C)
+
+	return &s
+}
+
+// AudioStreamManagement is the audio stream management service,
+// with which the controller selects the audio configuration.
+type AudioStreamManagement struct {
+	*service.S
+
+	SupportedAudioStreamConfiguration *characteristic.SupportedAudioStreamConfiguration
+	SelectedAudioStreamConfiguration  *characteristic.Bytes
+}
+
+// NewAudioStreamManagement returns an audio
+// stream management service with the codec.
+func NewAudioStreamManagement(codec AudioCodecConfiguration) *AudioStreamManagement {
+	m := AudioStreamManagement{}
+	m.S = service.New(TypeAudioStreamManagement)
+
+	m.SupportedAudioStreamConfiguration = characteristic.NewSupportedAudioStreamConfiguration()
+	setTLV8(m.SupportedAudioStreamConfiguration.Bytes, AudioConfiguration{Codecs: []AudioCodecConfiguration{codec}})
+	m.AddC(m.SupportedAudioStreamConfiguration.C)
+
+	m.SelectedAudioStreamConfiguration = characteristic.NewBytes(TypeSelectedAudioStreamConfiguration)
+	m.SelectedAudioStreamConfiguration.Format = characteristic.FormatTLV8
+	m.SelectedAudioStreamConfiguration.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionWrite}
+	setTLV8(m.SelectedAudioStreamConfiguration, SelectedAudioConfiguration{codec})
+	m.AddC(m.SelectedAudioStreamConfiguration.C)
+
+	return &m
+}
+
+// SelectedConfiguration returns the audio configuration selected by the controller.
+func (m *AudioStreamManagement) SelectedConfiguration() (AudioCodecConfiguration, error) {
+	var cfg SelectedAudioConfiguration
+	err := tlv8.Unmarshal(m.SelectedAudioStreamConfiguration.Value(), &cfg)
+	return cfg.Codec, err
+}
+
+// Siri provides Siri audio input of a remote.
+type Siri struct {
+	Service               *Service
+	AudioStreamManagement *AudioStreamManagement
+	DataStream            *hds.TransportManagement
+
+	srv *hds.Server
+
+	mu     sync.Mutex
+	target *hds.Conn // connection of the controller of the active target
+}
+
+// AddSiri adds the Siri and audio stream management services to the
+// remote accessory a. The audio is sent over the data streams of srv.
+// If a has no data stream transport management service yet, it is added.
+func AddSiri(a *accessory.A, srv *hds.Server) *Siri {
+	s := Siri{
+		Service:               NewService(),
+		AudioStreamManagement: NewAudioStreamManagement(DefaultAudioConfiguration()),
+		srv:                   srv,
+	}
+
+	srv.HandleEvent(ProtocolTargetControl, TopicWhoami, func(c *hds.Conn, ev *hds.Message) {
+		s.mu.Lock()
+		s.target = c
+		s.mu.Unlock()
+	})
+
+	a.AddS(s.Service.S)
+	a.AddS(s.AudioStreamManagement.S)
+	if !hasService(a, hds.TypeDataStreamTransportManagement) {
+		s.DataStream = hds.NewTransportManagement(srv)
+		a.AddS(s.DataStream.S)
+	}
+
+	return &s
+}
+
+// conn returns the connection over which audio is sent. This is the
+// connection of the controller, which identified itself with the target
+// control protocol, or any open connection.
+func (s *Siri) conn() *hds.Conn {
+	s.mu.Lock()
+	target := s.target
+	s.mu.Unlock()
+
+	conns := s.srv.Conns()
+	for _, c := range conns {
+		if c == target {
+			return c
+		}
+	}
+
+	if len(conns) > 0 {
+		return conns[0]
+	}
+
+	return nil
+}
+
+// Start starts a Siri audio session with the controller. The
+// application sends the audio frames of the selected configuration
+// (see AudioStreamManagement.SelectedConfiguration) while the Siri
+// button is pressed and closes the session when it is released.
+func (s *Siri) Start(ctx context.Context) (*Session, error) {
+	c := s.conn()
+	if c == nil {
+		return nil, fmt.Errorf("siri: no data stream connection")
+	}
+
+	stream, err := c.OpenDataSend(ctx, dataSendTypeSiri)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{s: stream}, nil
+}
+
+// A Session is a Siri audio session.
+type Session struct {
+	s   *hds.DataSendStream
+	seq int64
+}
+
+// Context returns the context of the session,
+// which is canceled when the controller stops the session.
+func (s *Session) Context() context.Context {
+	return s.s.Context()
+}
+
+// WriteFrame sends the audio frame. rms is the root mean square
+// of the samples of the frame (0–1), which is used for the
+// Siri animation.
+func (s *Session) WriteFrame(frame []byte, rms float64) error {
+	s.seq++
+	return s.s.Send([]hds.Packet{{
+		Data: frame,
+		Metadata: map[string]interface{}{
+			"rms":            rms,
+			"sequenceNumber": s.seq,
+		},
+	}}, false)
+}
+
+// Close ends the session.
+func (s *Session) Close() error {
+	if s.s.Context().Err() == nil {
+		if err := s.s.Send([]hds.Packet{}, true); err != nil {
+			log.Debug.Println("siri:", err)
+		}
+	}
+
+	return s.s.Close(hds.CloseReasonNormal)
+}
+
+func hasService(a *accessory.A, typ string) bool {
+	for _, s := range a.Ss {
+		if s.Type == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+func setTLV8(c *characteristic.Bytes, v interface{}) {
+	b, err := tlv8.Marshal(v)
+	if err != nil {
+		log.Info.Println(err)
+		return
+	}
+
+	c.SetValue(b)
+}
@@ -0,0 +1,54 @@
+package siri
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/hds"
+	"github.com/brutella/hap/rtp"
+	"github.com/brutella/hap/tlv8"
+
+	"context"
+	"testing"
+)
+
+func TestSelectedConfiguration(t *testing.T) {
+	m := NewAudioStreamManagement(DefaultAudioConfiguration())
+
+	cfg, err := m.SelectedConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := cfg.Type, byte(rtp.AudioCodecType_Opus); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := cfg.Parameters.RTPTime, byte(20); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	var supported AudioConfiguration
+	if err := tlv8.Unmarshal(m.SupportedAudioStreamConfiguration.Value(), &supported); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := len(supported.Codecs), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := supported.Codecs[0].Parameters.Samplerate, rtp.AudioCodecSampleRate16Khz; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestStartWithoutConnection(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "Remote"}, accessory.TypeRemoteControl)
+	s := AddSiri(a, hds.NewServer())
+
+	if s.DataStream == nil {
+		t.Fatal("data stream transport management not added")
+	}
+
+	if _, err := s.Start(context.Background()); err == nil {
+		t.Fatal("expected error without connection")
+	}
+}
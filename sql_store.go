@@ -0,0 +1,174 @@
+package hap
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLDialect describes the differences between sql databases.
+type SQLDialect struct {
+	// Name is the name of the dialect.
+	Name string
+
+	// Blob is the column type for binary data.
+	Blob string
+
+	// Placeholder returns the placeholder for the n-th argument (starting at 1).
+	Placeholder func(n int) string
+}
+
+var (
+	// SQLite is the dialect for SQLite databases.
+	SQLite = SQLDialect{
+		Name:        "sqlite",
+		Blob:        "BLOB",
+		Placeholder: func(n int) string { return "?" },
+	}
+
+	// Postgres is the dialect for PostgreSQL databases.
+	Postgres = SQLDialect{
+		Name:        "postgres",
+		Blob:        "BYTEA",
+		Placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	}
+)
+
+// sqlMigrations are the statements to migrate the database schema.
+// The n-th element migrates the schema from version n to n+1.
+// Never change existing migrations – add new ones instead.
+//
+// Schema version 1
+//
+//	CREATE TABLE hap_kv (
+//		name  TEXT PRIMARY KEY, -- key of the value (e.g. "keypair", "<hex>.pairing", "schema")
+//		value BLOB NOT NULL     -- value as stored by the server (keypair and pairings are json)
+//	);
+//
+// The table hap_schema contains a single row with the current schema version.
+var sqlMigrations = []func(d SQLDialect) string{
+	func(d SQLDialect) string {
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS hap_kv (name TEXT PRIMARY KEY, value %s NOT NULL)", d.Blob)
+	},
+}
+
+type sqlStore struct {
+	db *sql.DB
+	d  SQLDialect
+}
+
+// NewSQLStore returns a store which keeps all key-value pairs in the
+// hap_kv table of db. The tables are created and migrated if needed.
+// The sql driver must be imported by the caller.
+//
+// The server stores the following rows in hap_kv.
+//
+//	name             value
+//	keypair          long-term key pair as json {"Public":"<base64>","Private":"<base64>"}
+//	uuid             device id of the accessory (e.g. "1A:2B:3C:4D:5E:6F")
+//	<hex>.pairing    pairing of a controller as json, where <hex> is the
+//	                 hex encoded pairing name {"Name":…,"PublicKey":…,"Permission":…}
+//	<hex>.entity     ids of an accessory and its characteristics
+//	…                other state, e.g. the configuration number
+//
+// The version of the schema is the only row of the hap_schema table
+// (version INTEGER NOT NULL). Databases with a newer version are rejected.
+func NewSQLStore(db *sql.DB, d SQLDialect) (Store, error) {
+	st := &sqlStore{db, d}
+	if err := st.migrate(); err != nil {
+		return nil, fmt.Errorf("sql: migration failed: %v", err)
+	}
+
+	return st, nil
+}
+
+// migrate applies all pending migrations in a single transaction.
+func (st *sqlStore) migrate() error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS hap_schema (version INTEGER NOT NULL)"); err != nil {
+		return err
+	}
+
+	var version int
+	err = tx.QueryRow("SELECT version FROM hap_schema").Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := tx.Exec("INSERT INTO hap_schema (version) VALUES (0)"); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	if version > len(sqlMigrations) {
+		return fmt.Errorf("unknown schema version %d", version)
+	}
+
+	for _, m := range sqlMigrations[version:] {
+		if _, err := tx.Exec(m(st.d)); err != nil {
+			return err
+		}
+	}
+
+	q := fmt.Sprintf("UPDATE hap_schema SET version = %s", st.d.Placeholder(1))
+	if _, err := tx.Exec(q, len(sqlMigrations)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *sqlStore) Set(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+
+	q := fmt.Sprintf("INSERT INTO hap_kv (name, value) VALUES (%s, %s) ON CONFLICT (name) DO UPDATE SET value = excluded.value", st.d.Placeholder(1), st.d.Placeholder(2))
+	_, err := st.db.Exec(q, key, value)
+	return err
+}
+
+func (st *sqlStore) Get(key string) ([]byte, error) {
+	var value []byte
+	q := fmt.Sprintf("SELECT value FROM hap_kv WHERE name = %s", st.d.Placeholder(1))
+	err := st.db.QueryRow(q, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no entry for key %s", key)
+	}
+
+	return value, err
+}
+
+func (st *sqlStore) Delete(key string) error {
+	q := fmt.Sprintf("DELETE FROM hap_kv WHERE name = %s", st.d.Placeholder(1))
+	_, err := st.db.Exec(q, key)
+	return err
+}
+
+func (st *sqlStore) KeysWithSuffix(suffix string) ([]string, error) {
+	// The suffix is matched in Go to avoid escaping LIKE patterns.
+	rows, err := st.db.Query("SELECT name FROM hap_kv")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+
+		if strings.HasSuffix(k, suffix) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,300 @@
+package hap_test
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/hapstoretest"
+
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is an in-memory database, which understands the
+// statements of the sql store. Like SQLite and Postgres, it
+// rejects inserts of existing keys without ON CONFLICT and
+// statements on tables, which don't exist.
+type fakeDB struct {
+	mu sync.Mutex
+	fakeState
+	stmts []string // executed statements
+}
+
+type fakeState struct {
+	version *int64            // nil if hap_schema doesn't exist
+	kv      map[string][]byte // nil if hap_kv doesn't exist
+}
+
+func (db *fakeDB) snapshot() fakeState {
+	var s fakeState
+	if db.version != nil {
+		v := *db.version
+		s.version = &v
+	}
+	if db.kv != nil {
+		s.kv = map[string][]byte{}
+		for k, v := range db.kv {
+			s.kv[k] = v
+		}
+	}
+	return s
+}
+
+var placeholders = regexp.MustCompile(`\$[0-9]+`)
+
+func (db *fakeDB) exec(query string, args []driver.Value) ([][]driver.Value, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	q := placeholders.ReplaceAllString(query, "?")
+	db.stmts = append(db.stmts, q)
+
+	needKV := func() error {
+		if db.kv == nil {
+			return fmt.Errorf("no such table: hap_kv")
+		}
+		return nil
+	}
+
+	switch {
+	case q == "CREATE TABLE IF NOT EXISTS hap_schema (version INTEGER NOT NULL)":
+		if db.version == nil {
+			db.version = new(int64)
+			*db.version = -1 // no row
+		}
+	case q == "SELECT version FROM hap_schema":
+		if db.version == nil {
+			return nil, fmt.Errorf("no such table: hap_schema")
+		}
+		if *db.version < 0 {
+			return [][]driver.Value{}, nil
+		}
+		return [][]driver.Value{{*db.version}}, nil
+	case q == "INSERT INTO hap_schema (version) VALUES (0)":
+		*db.version = 0
+	case q == "UPDATE hap_schema SET version = ?":
+		*db.version = args[0].(int64)
+	case strings.HasPrefix(q, "CREATE TABLE IF NOT EXISTS hap_kv (name TEXT PRIMARY KEY, value "):
+		if db.kv == nil {
+			db.kv = map[string][]byte{}
+		}
+	case strings.HasPrefix(q, "INSERT INTO hap_kv (name, value) VALUES (?, ?)"):
+		if err := needKV(); err != nil {
+			return nil, err
+		}
+		k := args[0].(string)
+		if _, ok := db.kv[k]; ok && !strings.Contains(q, "ON CONFLICT (name) DO UPDATE SET value = excluded.value") {
+			return nil, fmt.Errorf("UNIQUE constraint failed: hap_kv.name")
+		}
+		db.kv[k] = append([]byte{}, args[1].([]byte)...)
+	case q == "SELECT value FROM hap_kv WHERE name = ?":
+		if err := needKV(); err != nil {
+			return nil, err
+		}
+		if v, ok := db.kv[args[0].(string)]; ok {
+			return [][]driver.Value{{v}}, nil
+		}
+		return [][]driver.Value{}, nil
+	case q == "DELETE FROM hap_kv WHERE name = ?":
+		if err := needKV(); err != nil {
+			return nil, err
+		}
+		delete(db.kv, args[0].(string))
+	case q == "SELECT name FROM hap_kv":
+		if err := needKV(); err != nil {
+			return nil, err
+		}
+		var rows [][]driver.Value
+		for k := range db.kv {
+			rows = append(rows, []driver.Value{k})
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0].(string) < rows[j][0].(string) })
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("unsupported statement %q", query)
+	}
+
+	return nil, nil
+}
+
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+func (d *fakeDriver) db(name string) *fakeDB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if db, ok := d.dbs[name]; ok {
+		return db
+	}
+	db := &fakeDB{}
+	d.dbs[name] = db
+	return db
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: d.db(name)}, nil
+}
+
+var fake = &fakeDriver{dbs: map[string]*fakeDB{}}
+
+func init() {
+	sql.Register("hapfake", fake)
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.db, query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	s := c.db.snapshot()
+	c.db.mu.Unlock()
+	return &fakeTx{c.db, s}, nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+	s  fakeState
+}
+
+func (tx *fakeTx) Commit() error { return nil }
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.mu.Lock()
+	tx.db.fakeState = tx.s
+	tx.db.mu.Unlock()
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if _, err := s.db.exec(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.db.exec(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"column"}
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var fakeDBs int
+
+// openFakeDB returns a new empty database.
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	fakeDBs++
+	name := fmt.Sprintf("%s-%d", t.Name(), fakeDBs)
+	db, err := sql.Open("hapfake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, fake.db(name)
+}
+
+func TestSQLStore(t *testing.T) {
+	for _, d := range []hap.SQLDialect{hap.SQLite, hap.Postgres} {
+		t.Run(d.Name, func(t *testing.T) {
+			hapstoretest.Run(t, func() hap.Store {
+				db, _ := openFakeDB(t)
+				st, err := hap.NewSQLStore(db, d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return st
+			})
+		})
+	}
+}
+
+func TestSQLStoreMigration(t *testing.T) {
+	db, fdb := openFakeDB(t)
+
+	st, err := hap.NewSQLStore(db, hap.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := *fdb.version, int64(1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// Values are overwritten (upsert).
+	st.Set("keypair", []byte("a"))
+	if err := st.Set("keypair", []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the store again keeps the data and doesn't migrate again.
+	n := len(fdb.stmts)
+	st, err = hap.NewSQLStore(db, hap.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range fdb.stmts[n:] {
+		if strings.HasPrefix(s, "CREATE TABLE IF NOT EXISTS hap_kv") {
+			t.Fatal("migrated again")
+		}
+	}
+
+	b, err := st.Get("keypair")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(b), "b"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// Databases of newer versions are rejected.
+	*fdb.version = 2
+	if _, err := hap.NewSQLStore(db, hap.SQLite); err == nil {
+		t.Fatal("expected error")
+	}
+}
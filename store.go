@@ -1,5 +1,12 @@
 package hap
 
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"time"
+)
+
 // A Store lets you store key-value pairs.
 type Store interface {
 
@@ -15,3 +22,86 @@ type Store interface {
 	// KeysWithSuffix returns a list keys with the give suffix.
 	KeysWithSuffix(suffix string) ([]string, error)
 }
+
+// A Verifier is a Store which can check the integrity of its values.
+// The server verifies the store on startup.
+type Verifier interface {
+	// Verify removes corrupt values from the store
+	// and returns their keys.
+	Verify() ([]string, error)
+}
+
+// A StoreContext is a Store whose operations can be canceled.
+// If a store implements this interface, the server prefers the
+// context-aware methods when handling http requests. The context
+// is canceled when the client disconnects or when the store
+// timeout (see Server.StoreTimeout) is exceeded.
+type StoreContext interface {
+	Store
+
+	// SetContext sets the value for the given key.
+	SetContext(ctx context.Context, key string, value []byte) error
+
+	// GetContext returns the value for the given key.
+	GetContext(ctx context.Context, key string) ([]byte, error)
+
+	// DeleteContext deletes the value for the given key.
+	DeleteContext(ctx context.Context, key string) error
+
+	// KeysWithSuffixContext returns a list keys with the give suffix.
+	KeysWithSuffixContext(ctx context.Context, suffix string) ([]string, error)
+}
+
+// ctxStore calls the context-aware methods of a StoreContext.
+type ctxStore struct {
+	sc      StoreContext
+	ctx     context.Context
+	timeout time.Duration
+}
+
+func (s *ctxStore) context() (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(s.ctx, s.timeout)
+	}
+
+	return context.WithCancel(s.ctx)
+}
+
+func (s *ctxStore) Set(key string, value []byte) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.sc.SetContext(ctx, key, value)
+}
+
+func (s *ctxStore) Get(key string) ([]byte, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.sc.GetContext(ctx, key)
+}
+
+func (s *ctxStore) Delete(key string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.sc.DeleteContext(ctx, key)
+}
+
+func (s *ctxStore) KeysWithSuffix(suffix string) ([]string, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.sc.KeysWithSuffixContext(ctx, suffix)
+}
+
+// verify verifies the store, if it implements the Verifier interface.
+func (st *storer) verify() error {
+	v, ok := st.Store.(Verifier)
+	if !ok || st.readOnly() {
+		return nil
+	}
+
+	keys, err := v.Verify()
+	for _, key := range keys {
+		log.Info.Printf("quarantined corrupt value for key %s\n", key)
+	}
+
+	return err
+}
@@ -0,0 +1,41 @@
+package hap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingStore is a StoreContext which blocks until the context is done.
+type blockingStore struct {
+	*MemStore
+}
+
+func (s blockingStore) SetContext(ctx context.Context, key string, value []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s blockingStore) GetContext(ctx context.Context, key string) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s blockingStore) DeleteContext(ctx context.Context, key string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s blockingStore) KeysWithSuffixContext(ctx context.Context, suffix string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestStoreContextTimeout(t *testing.T) {
+	st := &storer{blockingStore{NewMemStore()}}
+
+	_, err := st.withContext(context.Background(), 10*time.Millisecond).Pairing("abc")
+	if is, want := err, context.DeadlineExceeded; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,141 @@
+package hap
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// keySubscriptions is the store key of the persisted subscriptions.
+const keySubscriptions = "subscriptions"
+
+// A subscription is an enabled event of a characteristic.
+type subscription struct {
+	Aid uint64 `json:"aid"`
+	Iid uint64 `json:"iid"`
+}
+
+// subscriptions are the subscriptions of the controllers by pairing name.
+// Events are enabled per connection. The subscriptions of a controller
+// are kept when it disconnects and restored when it connects again.
+type subscriptions map[string]map[subscription]struct{}
+
+// setSubscription records that the controller of the request
+// enabled or disabled the events of the characteristic aid.iid.
+// It returns true if the subscriptions changed.
+func (s *Server) setSubscription(req *http.Request, aid, iid uint64, on bool) bool {
+	p, ok := ContextPairing(req.Context())
+	if !ok || p.Name == "" {
+		return false
+	}
+
+	sub := subscription{Aid: aid, Iid: iid}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	subs := s.subs[p.Name]
+	_, had := subs[sub]
+	if on == had {
+		return false
+	}
+
+	if on {
+		if subs == nil {
+			subs = map[subscription]struct{}{}
+			s.subs[p.Name] = subs
+		}
+		subs[sub] = struct{}{}
+	} else {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(s.subs, p.Name)
+		}
+	}
+
+	return true
+}
+
+// resubscribe enables the events, to which the controller
+// with the pairing p subscribed before, for the connection addr.
+func (s *Server) resubscribe(addr string, p Pairing) {
+	s.mux.Lock()
+	var subs []subscription
+	for sub := range s.subs[p.Name] {
+		subs = append(subs, sub)
+	}
+	s.mux.Unlock()
+
+	for _, sub := range subs {
+		if c := s.findC(sub.Aid, sub.Iid); c != nil && c.IsObservable() {
+			c.SetEvent(addr, true)
+		}
+	}
+
+	if len(subs) > 0 {
+		s.logDebug(nil).Printf("%s resubscribed to %d events\n", addr, len(subs))
+	}
+}
+
+// removeSubscriptions removes the subscriptions
+// of the controller with the pairing name.
+func (s *Server) removeSubscriptions(name string) {
+	s.mux.Lock()
+	_, ok := s.subs[name]
+	delete(s.subs, name)
+	s.mux.Unlock()
+
+	if ok {
+		s.saveSubscriptions()
+	}
+}
+
+// saveSubscriptions stores the subscriptions,
+// if PersistSubscriptions is enabled.
+func (s *Server) saveSubscriptions() {
+	if !s.PersistSubscriptions || s.st.readOnly() {
+		return
+	}
+
+	s.mux.Lock()
+	m := map[string][]subscription{}
+	for name, subs := range s.subs {
+		for sub := range subs {
+			m[name] = append(m[name], sub)
+		}
+	}
+	s.mux.Unlock()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		s.logInfo(nil).Println(err)
+		return
+	}
+
+	if err := s.st.Set(keySubscriptions, b); err != nil {
+		s.logInfo(nil).Println(err)
+	}
+}
+
+// loadSubscriptions restores the stored subscriptions.
+func (s *Server) loadSubscriptions() {
+	b, err := s.st.Get(keySubscriptions)
+	if err != nil {
+		return
+	}
+
+	var m map[string][]subscription
+	if err := json.Unmarshal(b, &m); err != nil {
+		s.logInfo(nil).Println("restoring subscriptions failed:", err)
+		return
+	}
+
+	s.mux.Lock()
+	for name, arr := range m {
+		subs := map[subscription]struct{}{}
+		for _, sub := range arr {
+			subs[sub] = struct{}{}
+		}
+		s.subs[name] = subs
+	}
+	s.mux.Unlock()
+}
@@ -0,0 +1,72 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResubscribe(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+
+	st := NewMemStore()
+	s, err := NewServer(st, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PersistSubscriptions = true
+
+	body := fmt.Sprintf("{\"characteristics\":[{\"aid\":%d,\"iid\":%d,\"ev\":true}]}", a.Id, a.Outlet.On.Id)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", bytes.NewBuffer([]byte(body)))
+	w := httptest.NewRecorder()
+
+	p := Pairing{Name: "Controller", Permission: PermissionAdmin}
+	s.setSession(reqConn(req), &session{Pairing: p})
+	s.ss.Handler.ServeHTTP(w, req)
+
+	if is, want := a.Outlet.On.HasEventsEnabled(req.RemoteAddr), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// the controller disconnects
+	s.unsubscribeAll(req.RemoteAddr)
+
+	// and connects again from a different address
+	s.resubscribe("192.0.2.2:1234", p)
+	if is, want := a.Outlet.On.HasEventsEnabled("192.0.2.2:1234"), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// the subscriptions are restored after a restart
+	s, err = NewServer(st, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.loadSubscriptions()
+	s.resubscribe("192.0.2.3:1234", p)
+	if is, want := a.Outlet.On.HasEventsEnabled("192.0.2.3:1234"), true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// but not for other controllers
+	s.resubscribe("192.0.2.4:1234", Pairing{Name: "Other"})
+	if is, want := a.Outlet.On.HasEventsEnabled("192.0.2.4:1234"), false; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// the subscriptions are removed with the pairing
+	s.PersistSubscriptions = true
+	s.pairingRemoved(p)
+	if _, err := st.Get(keySubscriptions); err != nil {
+		t.Fatal(err)
+	}
+
+	s.loadSubscriptions()
+	if is, want := len(s.subs), 0; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,161 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The file descriptor of the first socket passed by systemd.
+// See https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+const sdListenFdsStart = 3
+
+// sdNotify sends a state notification to systemd.
+// If the process is not supervised by systemd (NOTIFY_SOCKET
+// is not set), no notification is sent and no error is returned.
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+
+	// Abstract namespace sockets start with "@".
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the interval in which the watchdog
+// must be notified. If the watchdog is disabled, 0 is returned.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	// The watchdog is only meant for the process with WATCHDOG_PID.
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdListener returns the tcp listener passed by systemd via socket activation.
+// If no socket was passed, nil is returned.
+func sdListener() (*net.TCPListener, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+
+	// Make sure that the environment is not inherited by child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if n > 1 {
+		log.Info.Printf("systemd passed %d sockets, using the first one\n", n)
+	}
+
+	f := os.NewFile(uintptr(sdListenFdsStart), "LISTEN_FD_3")
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("systemd: %v", err)
+	}
+
+	tcpLn, ok := ln.(*net.TCPListener)
+	if !ok {
+		ln.Close()
+		return nil, errors.New("systemd: passed socket is not a tcp socket")
+	}
+
+	return tcpLn, nil
+}
+
+// watchdog notifies the systemd watchdog in the required interval
+// as long as the server is healthy. It returns when ctx is done.
+func (s *Server) watchdog(ctx context.Context) {
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	// Notify the watchdog twice as often as required.
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.healthy(); err != nil {
+				log.Info.Println("systemd watchdog:", err)
+				continue
+			}
+
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				log.Debug.Println("systemd:", err)
+			}
+		}
+	}
+}
+
+// keyHealthCheck is the key used to check if the store is writable.
+const keyHealthCheck = "healthcheck"
+
+// healthy returns an error if the listener is not accepting
+// connections or if the store is not writable.
+func (s *Server) healthy() error {
+	s.mux.Lock()
+	ln := s.ln
+	s.mux.Unlock()
+
+	if ln == nil {
+		return errors.New("listener not running")
+	}
+
+	return s.storeHealthy()
+}
+
+// storeHealthy returns an error if the store is not writable.
+// A read-only store must be readable.
+func (s *Server) storeHealthy() error {
+	if s.st.readOnly() {
+		if _, err := s.st.Get("uuid"); err != nil {
+			return fmt.Errorf("store not readable: %v", err)
+		}
+		return nil
+	}
+
+	if err := s.st.Set(keyHealthCheck, []byte(time.Now().Format(time.RFC3339))); err != nil {
+		return fmt.Errorf("store not writable: %v", err)
+	}
+
+	if err := s.st.Delete(keyHealthCheck); err != nil {
+		return fmt.Errorf("store not writable: %v", err)
+	}
+
+	return nil
+}
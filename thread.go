@@ -0,0 +1,363 @@
+//go:build thread
+// +build thread
+
+package hap
+
+import (
+	"github.com/brutella/hap/coap"
+	"github.com/brutella/hap/log"
+
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// threadPeerTimeout is the duration after which
+	// the session of an idle controller is removed.
+	threadPeerTimeout = 5 * time.Minute
+
+	// threadMaxMessageSize is the maximum size of a CoAP message.
+	threadMaxMessageSize = 1280
+)
+
+// ServeThread serves the HomeKit Accessory Protocol over CoAP on pc,
+// which is the transport of accessories connected via a Thread border
+// router. The routes of the IP transport are mapped to CoAP requests
+// with the same paths (e.g. GET /accessories). Payloads are encrypted
+// with the session of pair-verify like on the IP transport.
+//
+// ServeThread only handles requests. Event notifications and block-wise
+// transfers (payloads larger than a CoAP message) are not supported yet.
+// Call it in addition to ListenAndServe; it returns when ctx is done.
+//
+// ServeThread is only available with the build tag "thread".
+func (s *Server) ServeThread(ctx context.Context, pc net.PacketConn) error {
+	t := &threadTransport{
+		s:     s,
+		pc:    pc,
+		peers: map[string]*threadPeer{},
+	}
+
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+	}()
+
+	go t.reap(ctx)
+	defer t.closeAll()
+
+	b := make([]byte, threadMaxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		var m coap.Message
+		if err := m.UnmarshalBinary(b[:n]); err != nil {
+			log.Debug.Printf("coap: invalid message from %s: %v\n", addr, err)
+			continue
+		}
+
+		t.handle(ctx, addr, &m)
+	}
+}
+
+type threadTransport struct {
+	s  *Server
+	pc net.PacketConn
+
+	mu    sync.Mutex
+	peers map[string]*threadPeer
+	mid   uint16 // message id of non-confirmable responses
+}
+
+// threadPeer is a controller, which sends requests via CoAP.
+type threadPeer struct {
+	c    *conn
+	last time.Time
+
+	// mid and resp are the message id and the response of the last
+	// confirmable request, which is resent for retransmissions.
+	mid  uint16
+	resp []byte
+}
+
+func (t *threadTransport) peer(addr net.Addr) *threadPeer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.peers[addr.String()]
+	if !ok {
+		c := newConn(&threadConn{local: t.pc.LocalAddr(), remote: addr})
+		c.metrics = t.s.metrics
+		t.s.connStateEvent(c, http.StateNew)
+		p = &threadPeer{c: c}
+		t.peers[addr.String()] = p
+	}
+	p.last = time.Now()
+
+	return p
+}
+
+func (t *threadTransport) handle(ctx context.Context, addr net.Addr, m *coap.Message) {
+	if !m.Code.IsRequest() {
+		if m.Type == coap.Confirmable {
+			// reject pings and unexpected messages
+			t.send(addr, coap.Message{Type: coap.Reset, MessageID: m.MessageID})
+		}
+		return
+	}
+
+	p := t.peer(addr)
+	if m.Type == coap.Confirmable && p.resp != nil && p.mid == m.MessageID {
+		// retransmission
+		t.pc.WriteTo(p.resp, addr)
+		return
+	}
+
+	resp := t.serve(ctx, p, m)
+	if m.Type == coap.Confirmable {
+		resp.Type = coap.Acknowledgement
+		resp.MessageID = m.MessageID
+	} else {
+		resp.Type = coap.NonConfirmable
+		t.mu.Lock()
+		t.mid++
+		resp.MessageID = t.mid
+		t.mu.Unlock()
+	}
+	resp.Token = m.Token
+
+	b := t.send(addr, resp)
+	if m.Type == coap.Confirmable {
+		p.mid, p.resp = m.MessageID, b
+	}
+}
+
+// serve handles the request with the http handler of the server.
+func (t *threadTransport) serve(ctx context.Context, p *threadPeer, m *coap.Message) coap.Message {
+	c := p.c
+
+	// Switch to the session of pair-verify (see conn.Read).
+	c.smu.Lock()
+	if c.s != nil {
+		c.ss = c.s
+		c.s = nil
+	}
+	ss := c.ss
+	c.smu.Unlock()
+
+	body := m.Payload
+	if ss != nil && len(body) > 0 {
+		b, err := ss.Decrypt(bytes.NewReader(body), threadMaxMessageSize)
+		if err != nil {
+			log.Debug.Println("coap: decryption failed:", err)
+			if c.metrics != nil {
+				c.metrics.inc(&c.metrics.decryptFailures)
+			}
+			return coap.Message{Code: coap.Unauthorized}
+		}
+		body = b
+	}
+
+	method, ok := threadMethods[m.Code]
+	if !ok {
+		return coap.Message{Code: coap.MethodNotAllowed}
+	}
+
+	target := m.Path()
+	if q := m.Query(); q != "" {
+		target += "?" + q
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return coap.Message{Code: coap.BadRequest}
+	}
+	req.RemoteAddr = c.RemoteAddr().String()
+	for _, rt := range t.s.routes() {
+		if rt.pattern == req.URL.Path {
+			req.Header.Set("Content-Type", rt.contentType)
+		}
+	}
+	req = req.WithContext(connContext(ctx, c))
+
+	res := &threadResponse{header: http.Header{}}
+	t.s.ss.Handler.ServeHTTP(res, req)
+
+	payload := res.body.Bytes()
+	if ss != nil && len(payload) > 0 {
+		r, err := ss.Encrypt(bytes.NewReader(payload))
+		if err != nil {
+			log.Debug.Println("coap: encryption failed:", err)
+			return coap.Message{Code: coap.InternalServerError}
+		}
+		payload, _ = ioutil.ReadAll(r)
+	}
+
+	return coap.Message{
+		Code:    threadCode(res.status()),
+		Payload: payload,
+	}
+}
+
+func (t *threadTransport) send(addr net.Addr, m coap.Message) []byte {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		log.Debug.Println("coap:", err)
+		return nil
+	}
+
+	if len(b) > threadMaxMessageSize {
+		log.Info.Printf("coap: response to %s too large (%d bytes)\n", addr, len(b))
+		m.Code, m.Payload = coap.InternalServerError, nil
+		b, _ = m.MarshalBinary()
+	}
+
+	if _, err := t.pc.WriteTo(b, addr); err != nil {
+		log.Debug.Println("coap:", err)
+	}
+
+	return b
+}
+
+// reap removes the sessions of idle controllers until ctx is done.
+func (t *threadTransport) reap(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			for addr, p := range t.peers {
+				if time.Since(p.last) > threadPeerTimeout {
+					t.close(addr, p)
+				}
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+func (t *threadTransport) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for addr, p := range t.peers {
+		t.close(addr, p)
+	}
+}
+
+// close removes the peer. t.mu must be locked.
+func (t *threadTransport) close(addr string, p *threadPeer) {
+	delete(t.peers, addr)
+	p.c.Close()
+	t.s.connStateEvent(p.c, http.StateClosed)
+}
+
+var threadMethods = map[coap.Code]string{
+	coap.GET:    http.MethodGet,
+	coap.POST:   http.MethodPost,
+	coap.PUT:    http.MethodPut,
+	coap.DELETE: http.MethodDelete,
+}
+
+// threadCode returns the CoAP response code of the http status.
+func threadCode(status int) coap.Code {
+	switch status {
+	case http.StatusOK, http.StatusMultiStatus:
+		return coap.Content
+	case http.StatusNoContent:
+		return coap.Changed
+	case http.StatusBadRequest:
+		return coap.BadRequest
+	case http.StatusUnauthorized, 470: // connection authorization required
+		return coap.Unauthorized
+	case http.StatusForbidden:
+		return coap.Forbidden
+	case http.StatusNotFound:
+		return coap.NotFound
+	case http.StatusMethodNotAllowed:
+		return coap.MethodNotAllowed
+	case http.StatusRequestEntityTooLarge:
+		return coap.RequestEntityTooLarge
+	case http.StatusUnprocessableEntity:
+		return coap.UnprocessableEntity
+	case http.StatusServiceUnavailable:
+		return coap.ServiceUnavailable
+	}
+
+	switch {
+	case status < 300:
+		return coap.Content
+	case status < 500:
+		return coap.BadRequest
+	default:
+		return coap.InternalServerError
+	}
+}
+
+// threadResponse records the response of the http handler.
+type threadResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *threadResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *threadResponse) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *threadResponse) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+func (r *threadResponse) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+
+	return r.code
+}
+
+// threadConn identifies the session of a controller.
+// Event notifications written to it are dropped.
+type threadConn struct {
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *threadConn) Read(b []byte) (int, error) {
+	return 0, net.ErrClosed
+}
+
+func (c *threadConn) Write(b []byte) (int, error) {
+	log.Debug.Printf("coap: event to %s dropped\n", c.remote)
+	return len(b), nil
+}
+
+func (c *threadConn) Close() error                       { return nil }
+func (c *threadConn) LocalAddr() net.Addr                { return c.local }
+func (c *threadConn) RemoteAddr() net.Addr               { return c.remote }
+func (c *threadConn) SetDeadline(t time.Time) error      { return nil }
+func (c *threadConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *threadConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,98 @@
+//go:build thread
+// +build thread
+
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/coap"
+
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func threadRequest(t *testing.T, c net.Conn, m coap.Message) coap.Message {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, threadMaxMessageSize)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp coap.Message
+	if err := resp.UnmarshalBinary(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func TestServeThread(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "Outlet"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ServeThread(ctx, pc)
+
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	req := coap.Message{Type: coap.Confirmable, Code: coap.GET, MessageID: 1, Token: []byte{0x01}}
+	req.SetPath("/accessories")
+
+	// the controller is not verified
+	resp := threadRequest(t, c, req)
+	if is, want := resp.Type, coap.Acknowledgement; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if is, want := resp.Code, coap.BadRequest; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if is, want := resp.Token, req.Token; !bytes.Equal(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+	if !bytes.Contains(resp.Payload, []byte("-70401")) {
+		t.Fatalf("unexpected payload %s", resp.Payload)
+	}
+
+	// retransmissions are answered with the same response
+	if is, want := threadRequest(t, c, req).MessageID, resp.MessageID; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	req.MessageID = 2
+	req.SetPath("/unknown")
+	if is, want := threadRequest(t, c, req).Code, coap.NotFound; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// pings are reset
+	ping := coap.Message{Type: coap.Confirmable, MessageID: 3}
+	if is, want := threadRequest(t, c, ping).Type, coap.Reset; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,151 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultNotificationInterval is the minimum interval between
+// notifications of a characteristic, as recommended by HAP.
+const defaultNotificationInterval = time.Second
+
+// throttle coalesces the notifications of characteristics.
+// A notification is sent immediately if the last notification of the
+// characteristic was sent more than the interval ago. Otherwise it is
+// delayed until the interval elapsed; further changes in the meantime
+// are merged into the delayed notification, which contains the latest value.
+type throttle struct {
+	mu        sync.Mutex
+	cs        map[*characteristic.C]*throttled
+	intervals map[*characteristic.C]time.Duration // set with SetNotificationInterval
+}
+
+type throttled struct {
+	last  time.Time     // when the last notification was sent
+	timer *time.Timer   // non-nil while a notification is delayed
+	req   *http.Request // request of the latest change
+	send  func(req *http.Request)
+}
+
+func newThrottle() *throttle {
+	return &throttle{
+		cs:        map[*characteristic.C]*throttled{},
+		intervals: map[*characteristic.C]time.Duration{},
+	}
+}
+
+// notify calls send now or after the interval d.
+func (t *throttle) notify(c *characteristic.C, req *http.Request, d time.Duration, send func(req *http.Request)) {
+	if d <= 0 {
+		send(req)
+		return
+	}
+
+	t.mu.Lock()
+	th, ok := t.cs[c]
+	if !ok {
+		th = &throttled{}
+		t.cs[c] = th
+	}
+
+	th.req = req
+	th.send = send
+	if th.timer != nil {
+		// the delayed notification sends the latest value
+		t.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if wait := d - now.Sub(th.last); wait > 0 {
+		th.timer = time.AfterFunc(wait, func() {
+			t.mu.Lock()
+			if th.timer == nil {
+				// already sent by flush
+				t.mu.Unlock()
+				return
+			}
+			req, send := th.req, th.send
+			th.timer = nil
+			th.last = time.Now()
+			t.mu.Unlock()
+
+			send(req)
+		})
+		t.mu.Unlock()
+		return
+	}
+
+	th.last = now
+	t.mu.Unlock()
+
+	send(req)
+}
+
+// flush sends the delayed notifications immediately.
+func (t *throttle) flush() {
+	var pending []*throttled
+	t.mu.Lock()
+	now := time.Now()
+	for _, th := range t.cs {
+		if th.timer == nil {
+			continue
+		}
+		th.timer.Stop()
+		th.timer = nil
+		th.last = now
+		pending = append(pending, &throttled{req: th.req, send: th.send})
+	}
+	t.mu.Unlock()
+
+	for _, th := range pending {
+		th.send(th.req)
+	}
+}
+
+// SetNotificationInterval sets the minimum interval between notifications
+// of the characteristic c, which overrides Server.NotificationInterval.
+// A negative interval disables coalescing of the notifications.
+func (s *Server) SetNotificationInterval(c *characteristic.C, d time.Duration) {
+	s.thr.mu.Lock()
+	s.thr.intervals[c] = d
+	s.thr.mu.Unlock()
+}
+
+// notificationInterval returns the minimum interval
+// between notifications of c.
+func (s *Server) notificationInterval(c *characteristic.C) time.Duration {
+	s.thr.mu.Lock()
+	d, ok := s.thr.intervals[c]
+	s.thr.mu.Unlock()
+
+	switch {
+	case ok:
+		return d
+	case c.IsEventOnly():
+		// every button press must be reported
+		return 0
+	default:
+		return s.minNotificationInterval()
+	}
+}
+
+func (s *Server) minNotificationInterval() time.Duration {
+	if s.NotificationInterval != 0 {
+		return s.NotificationInterval
+	}
+
+	return defaultNotificationInterval
+}
+
+// notify sends a notification about the new value of c
+// to the subscribed clients; coalesced if needed.
+func (s *Server) notify(a *accessory.A, c *characteristic.C, req *http.Request) {
+	s.thr.notify(c, req, s.notificationInterval(c), func(req *http.Request) {
+		s.sendNotification(a, c, req)
+	})
+}
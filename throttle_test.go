@@ -0,0 +1,103 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	thr := newThrottle()
+	c := characteristic.NewBrightness()
+
+	var (
+		mu   sync.Mutex
+		reqs []*http.Request
+	)
+	send := func(req *http.Request) {
+		mu.Lock()
+		reqs = append(reqs, req)
+		mu.Unlock()
+	}
+
+	r1, r2, r3 := &http.Request{}, &http.Request{}, &http.Request{}
+	thr.notify(c.C, r1, 50*time.Millisecond, send)
+	thr.notify(c.C, r2, 50*time.Millisecond, send)
+	thr.notify(c.C, r3, 50*time.Millisecond, send)
+
+	mu.Lock()
+	if is, want := len(reqs), 1; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+	mu.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if is, want := len(reqs), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	// the latest change wins
+	if reqs[1] != r3 {
+		t.Fatal("unexpected request")
+	}
+}
+
+func TestThrottleFlush(t *testing.T) {
+	thr := newThrottle()
+	c := characteristic.NewBrightness()
+
+	var (
+		mu   sync.Mutex
+		reqs []*http.Request
+	)
+	send := func(req *http.Request) {
+		mu.Lock()
+		reqs = append(reqs, req)
+		mu.Unlock()
+	}
+
+	r1, r2 := &http.Request{}, &http.Request{}
+	thr.notify(c.C, r1, time.Minute, send)
+	thr.notify(c.C, r2, time.Minute, send)
+	thr.flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if is, want := len(reqs), 2; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if reqs[1] != r2 {
+		t.Fatal("unexpected request")
+	}
+}
+
+func TestNotificationInterval(t *testing.T) {
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+	sw := accessory.NewProgrammableSwitch(accessory.Info{Name: "Switch"}, 1)
+
+	s, err := NewServer(NewMemStore(), a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.notificationInterval(a.Outlet.On.C), time.Second; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if is, want := s.notificationInterval(sw.Buttons[0].ProgrammableSwitchEvent.C), time.Duration(0); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.SetNotificationInterval(a.Outlet.On.C, -1)
+	if is, want := s.notificationInterval(a.Outlet.On.C), time.Duration(-1); is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -1,12 +1,9 @@
 package tlv8
 
 import (
-	"github.com/xiam/to"
-
 	"bytes"
 	"io"
 	"reflect"
-	"strings"
 )
 
 type decoder struct {
@@ -59,9 +56,8 @@ func (d *decoder) decode(v interface{}) error {
 	for i := 0; i < eValue.NumField(); i++ {
 		typeField := eType.Field(i)
 		if tlv8, ok := typeField.Tag.Lookup("tlv8"); ok {
-			values := strings.Split(tlv8, ",")
-			tag := uint8(to.Uint64(values[0]))
-			optional := len(values) > 1 && values[1] == "optional"
+			name, optional := fieldTag(tlv8)
+			tag := tagType(name)
 
 			field := eValue.Field(i)
 			switch value := field.Interface().(type) {
@@ -3,8 +3,6 @@ package tlv8
 import (
 	"bytes"
 	"reflect"
-
-	"github.com/xiam/to"
 )
 
 type encoder struct {
@@ -58,7 +56,9 @@ func structPayload(v interface{}) ([]byte, error) {
 
 	for i := 0; i < vType.NumField(); i++ {
 		if tlv8, ok := vType.Field(i).Tag.Lookup("tlv8"); ok {
-			tag := uint8(to.Uint64(tlv8))
+			// Options like "optional" only affect decoding.
+			name, _ := fieldTag(tlv8)
+			tag := tagType(name)
 			field := vValue.Field(i)
 			switch v := field.Interface().(type) {
 			case uint8:
@@ -98,7 +98,7 @@ func structPayload(v interface{}) ([]byte, error) {
 							wr.write([]byte{0x0, 0x0})
 						}
 
-						if tlv8 == "-" {
+						if name == "-" {
 							wr.write(b)
 						} else {
 							// every element in a named slice is encoded by the slice field tlv8 tag
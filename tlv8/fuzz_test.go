@@ -0,0 +1,69 @@
+//go:build go1.18
+// +build go1.18
+
+package tlv8
+
+import (
+	"testing"
+)
+
+type fuzzPayload struct {
+	Byte    byte    `tlv8:"1,optional"`
+	String  string  `tlv8:"2,optional"`
+	Bytes   []byte  `tlv8:"3,optional"`
+	Uint16  uint16  `tlv8:"4,optional"`
+	Uint32  uint32  `tlv8:"5,optional"`
+	Uint64  uint64  `tlv8:"6,optional"`
+	Int16   int16   `tlv8:"7,optional"`
+	Int32   int32   `tlv8:"8,optional"`
+	Int64   int64   `tlv8:"9,optional"`
+	Float32 float32 `tlv8:"10,optional"`
+	Bool    bool    `tlv8:"11,optional"`
+	Items   []alias `tlv8:"12,optional"`
+	Person  person  `tlv8:"13,optional"`
+	Inline  []alias `tlv8:"-"`
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	b, err := Marshal(fuzzPayload{
+		Byte:    1,
+		String:  "abc",
+		Bytes:   []byte{1, 2, 3},
+		Uint16:  0x1234,
+		Uint32:  0x12345678,
+		Uint64:  0x1234567890,
+		Int16:   -2,
+		Int32:   -3,
+		Int64:   -4,
+		Float32: 1.5,
+		Bool:    true,
+		Items:   []alias{{"a"}, {"b"}},
+		Person:  p,
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+
+	b, err = Marshal(p)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	f.Add([]byte{0x0a, 0x01, 0xff})
+	f.Add([]byte{0x01, 0xff, 0x00})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var v fuzzPayload
+		if err := Unmarshal(b, &v); err != nil {
+			return
+		}
+
+		if _, err := Marshal(v); err != nil {
+			t.Fatal(err)
+		}
+
+		var vs []alias
+		Unmarshal(b, &vs)
+	})
+}
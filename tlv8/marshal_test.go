@@ -281,3 +281,97 @@ func TestList(t *testing.T) {
 		t.Fatalf("is=%v want=%v", is, want)
 	}
 }
+
+func TestMarshalOptional(t *testing.T) {
+	v := struct {
+		A byte   `tlv8:"1,optional"`
+		B string `tlv8:"2,optional"`
+	}{0x3, "b"}
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := b, []byte{0x1, 0x1, 0x3, 0x2, 0x1, 'b'}; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestMarshalOptionalObjects(t *testing.T) {
+	type Element struct {
+		Id byte `tlv8:"1,optional"`
+	}
+
+	type Object struct {
+		Nested  Element   `tlv8:"2,optional"`
+		Named   []Element `tlv8:"3,optional"`
+		Unnamed []Element `tlv8:"-,optional"`
+	}
+
+	v := Object{Element{0x1}, []Element{{0x2}}, []Element{{0x3}, {0x4}}}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []byte{
+		0x2, 0x3, 0x1, 0x1, 0x1,
+		0x3, 0x3, 0x1, 0x1, 0x2,
+		0x1, 0x1, 0x3,
+		0x0, 0x0,
+		0x1, 0x1, 0x4,
+	}
+	if is, want := b, expect; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestMarshalOptionalRoundtrip(t *testing.T) {
+	type Payload struct {
+		Method     byte   `tlv8:"0"`
+		Identifier string `tlv8:"1,optional"`
+		PublicKey  []byte `tlv8:"3,optional"`
+		Permission byte   `tlv8:"11,optional"`
+		State      byte   `tlv8:"6"`
+	}
+
+	v := Payload{5, "admin", []byte{0xaa}, 1, 1}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var other Payload
+	if err := Unmarshal(b, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := other, v; !reflect.DeepEqual(is, want) {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
+
+func TestFieldTag(t *testing.T) {
+	tests := []struct {
+		tag      string
+		name     string
+		optional bool
+	}{
+		{"1", "1", false},
+		{"11,optional", "11", true},
+		{"-", "-", false},
+		{"-,optional", "-", true},
+		{"2,other", "2", false},
+	}
+
+	for _, test := range tests {
+		name, optional := fieldTag(test.tag)
+		if is, want := name, test.name; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+		if is, want := optional, test.optional; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+}
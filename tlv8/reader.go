@@ -2,6 +2,7 @@ package tlv8
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
 )
@@ -188,6 +189,8 @@ func (r *reader) readint64(tag byte) (int64, error) {
 func (r *reader) readFloat32(tag byte) (float32, error) {
 	if b, err := r.readBytes(tag); err != nil {
 		return 0, err
+	} else if len(b) < 4 {
+		return 0, &InvalidLengthError{tag, len(b)}
 	} else {
 		bits := binary.LittleEndian.Uint32(b)
 		return math.Float32frombits(bits), nil
@@ -232,3 +235,14 @@ func read(r io.Reader) (map[byte][]bucket, error) {
 
 	return h, nil
 }
+
+// An InvalidLengthError is returned if the value
+// of a tag is too short for the type of the field.
+type InvalidLengthError struct {
+	Tag byte
+	Len int
+}
+
+func (e *InvalidLengthError) Error() string {
+	return fmt.Sprintf("tlv8: invalid length %d of tag %d", e.Len, e.Tag)
+}
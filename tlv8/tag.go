@@ -0,0 +1,26 @@
+package tlv8
+
+import (
+	"strings"
+
+	"github.com/xiam/to"
+)
+
+// fieldTag returns the name and the options of a tlv8 struct field tag,
+// e.g. "1,optional". The name is either a type number or "-" for
+// slices, whose elements are encoded without a type.
+func fieldTag(s string) (name string, optional bool) {
+	values := strings.Split(s, ",")
+	for _, v := range values[1:] {
+		if v == "optional" {
+			optional = true
+		}
+	}
+
+	return values[0], optional
+}
+
+// tagType returns the type number of a field tag name.
+func tagType(name string) uint8 {
+	return uint8(to.Uint64(name))
+}
@@ -0,0 +1,112 @@
+package hap
+
+import (
+	"github.com/brutella/hap/log"
+
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// A Watcher is a Store which notifies about changes made out-of-band,
+// e.g. by another process which shares the same database.
+// If the store of a server implements Watcher, the server closes the
+// connections of removed controllers and updates the dnssd txt records
+// when pairings change.
+type Watcher interface {
+	// Watch calls fn with the key of every value which was
+	// changed or deleted by someone else. Watch blocks until
+	// ctx is done or an error occurs.
+	Watch(ctx context.Context, fn func(key string)) error
+}
+
+// errNotWatchable is returned when the wrapped store doesn't implement Watcher.
+var errNotWatchable = errors.New("store doesn't support watching")
+
+// watch calls st.Watch if st implements Watcher.
+func watch(ctx context.Context, st Store, fn func(key string)) error {
+	if w, ok := st.(Watcher); ok {
+		return w.Watch(ctx, fn)
+	}
+
+	return errNotWatchable
+}
+
+func (ps *prefixStore) Watch(ctx context.Context, fn func(key string)) error {
+	return watch(ctx, ps.Store, func(key string) {
+		if strings.HasPrefix(key, ps.prefix) {
+			fn(strings.TrimPrefix(key, ps.prefix))
+		}
+	})
+}
+
+func (es *encryptedStore) Watch(ctx context.Context, fn func(key string)) error {
+	return watch(ctx, es.Store, fn)
+}
+
+// watchStore reacts to out-of-band changes of the store.
+func (s *Server) watchStore(ctx context.Context) {
+	err := watch(ctx, s.st.Store, s.storeChanged)
+	if err == errNotWatchable || err == context.Canceled {
+		return
+	}
+
+	if err != nil {
+		log.Info.Println("watching store failed:", err)
+	}
+}
+
+// storeChanged is called when the value for key was changed out-of-band.
+func (s *Server) storeChanged(key string) {
+	if !strings.HasSuffix(key, ".pairing") {
+		return
+	}
+
+	b, err := hex.DecodeString(strings.TrimSuffix(key, ".pairing"))
+	if err != nil {
+		return
+	}
+	name := string(b)
+
+	log.Debug.Println("pairing changed out-of-band", name)
+	s.pcache.delete(name)
+
+	if p, err := s.st.Pairing(name); err != nil {
+		// The pairing was removed.
+		s.pairingRemoved(Pairing{Name: name})
+		s.closeConnections(name)
+	} else {
+		s.pairingAdded(p)
+	}
+
+	if s.IsPaired() && !s.pairedWithAdmin(context.Background()) {
+		s.closeAllConnections()
+		s.deleteAllPairings("no admin pairing left in the store")
+	}
+
+	s.updateTxtRecords()
+}
+
+// closeConnections closes the connections of the controller with name.
+func (s *Server) closeConnections(name string) {
+	for c, conn := range s.conns() {
+		ss, err := s.getSession(c)
+		if err != nil {
+			continue
+		}
+
+		if ss.Pairing.Name == name {
+			log.Debug.Println("closing connection of removed controller", name)
+			conn.Close()
+		}
+	}
+}
+
+// closeAllConnections closes all connections.
+func (s *Server) closeAllConnections() {
+	for _, conn := range s.conns() {
+		log.Debug.Println("Closing connection to", conn.RemoteAddr())
+		conn.Close()
+	}
+}
@@ -0,0 +1,48 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"context"
+	"testing"
+)
+
+type watchStore struct {
+	*MemStore
+	fn chan func(key string)
+}
+
+func (ws watchStore) Watch(ctx context.Context, fn func(key string)) error {
+	ws.fn <- fn
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWatchStore(t *testing.T) {
+	st := watchStore{NewMemStore(), make(chan func(string))}
+	a := accessory.NewOutlet(accessory.Info{Name: "ABC"})
+	s, err := NewServer(st, a.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.st.SavePairing(Pairing{Name: "admin", Permission: PermissionAdmin})
+
+	var removed string
+	s.PairingRemovedFunc = func(p Pairing) {
+		removed = p.Name
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchStore(ctx)
+	fn := <-st.fn
+
+	// Another process removes the pairing.
+	st.Delete(keyForPairingName("admin"))
+	fn(keyForPairingName("admin"))
+
+	if is, want := removed, "admin"; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+}
@@ -0,0 +1,9 @@
+package hap
+
+// zero overwrites b with zeros. It is used to remove
+// key material from memory when it's not needed anymore.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,60 @@
+package hap
+
+import (
+	"github.com/brutella/hap/accessory"
+
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestClearSessions(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := NewServer(NewMemStore(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := net.Pipe()
+	conn := newConn(c)
+	s.connStateEvent(conn, http.StateNew)
+
+	pv := &pairVerifySession{}
+	pv.SharedKey[0] = 0x01
+	s.setSession(conn, pv)
+
+	ss, _ := testSessions(t)
+	s.setSession(conn, ss)
+
+	// the replaced pair-verify session is cleared
+	if is, want := pv.SharedKey, [32]byte{}; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	s.connStateEvent(conn, http.StateClosed)
+
+	if is, want := ss.encryptKey, [32]byte{}; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if _, err := ss.Encrypt(bytes.NewReader([]byte("data"))); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParanoid(t *testing.T) {
+	a := accessory.New(accessory.Info{Name: "ABC"}, accessory.TypeOutlet)
+	s, err := New(a, WithStore(NewMemStore()), Paranoid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := s.Paranoid, true; is != want {
+		t.Fatalf("%v != %v", is, want)
+	}
+
+	if err := s.prepare(); err != nil {
+		t.Fatal(err)
+	}
+}